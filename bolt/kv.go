@@ -21,6 +21,12 @@ var _ kv.Store = (*KVStore)(nil)
 // ensure *KVStore implements kv.AutoMigrationStore.
 var _ kv.AutoMigrationStore = (*KVStore)(nil)
 
+// ensure *Bucket implements kv.FillPercentBucket.
+var _ kv.FillPercentBucket = (*Bucket)(nil)
+
+// ensure *Tx implements kv.BucketDeleter.
+var _ kv.BucketDeleter = (*Tx)(nil)
+
 // KVStore is a kv.Store backed by boltdb.
 type KVStore struct {
 	path string
@@ -163,6 +169,9 @@ func (tx *Tx) WithContext(ctx context.Context) {
 // createBucketIfNotExists creates a bucket with the provided byte slice.
 func (tx *Tx) createBucketIfNotExists(b []byte) (*Bucket, error) {
 	bkt, err := tx.tx.CreateBucketIfNotExists(b)
+	if err == bolt.ErrTxNotWritable {
+		return nil, kv.ErrTxNotWritable
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -182,6 +191,14 @@ func (tx *Tx) Bucket(b []byte) (kv.Bucket, error) {
 	}, nil
 }
 
+// DeleteBucket removes the bucket named b and all of its keys.
+func (tx *Tx) DeleteBucket(b []byte) error {
+	if err := tx.tx.DeleteBucket(b); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	return nil
+}
+
 // Bucket implements kv.Bucket.
 type Bucket struct {
 	bucket *bolt.Bucket
@@ -221,6 +238,12 @@ func (b *Bucket) Put(key []byte, value []byte) error {
 	return err
 }
 
+// SetFillPercent sets the threshold to which bolt fills the bucket's pages before
+// splitting them for the remainder of the transaction.
+func (b *Bucket) SetFillPercent(p float64) {
+	b.bucket.FillPercent = p
+}
+
 // Delete removes the provided key.
 func (b *Bucket) Delete(key []byte) error {
 	err := b.bucket.Delete(key)
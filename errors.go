@@ -25,6 +25,9 @@ const (
 	EUnauthorized        = "unauthorized"
 	EMethodNotAllowed    = "method not allowed"
 	ETooLarge            = "request too large"
+	EDataCorruption      = "data corruption"     // stored data failed an integrity check
+	EReferenceNotFound   = "reference not found" // a referenced entity does not exist
+	EMultipleResults     = "multiple results"    // more than one entity matched a lookup expecting one
 )
 
 // Error is the error struct of platform.
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 
 	"github.com/google/btree"
@@ -14,6 +15,9 @@ import (
 // ensure *KVStore implement kv.Store interface
 var _ kv.Store = (*KVStore)(nil)
 
+// ensure *Tx implements kv.BucketDeleter
+var _ kv.BucketDeleter = (*Tx)(nil)
+
 // ensure *KVStore implements kv.AutoMigrationStore
 var _ kv.AutoMigrationStore = (*KVStore)(nil)
 
@@ -48,16 +52,22 @@ func (s *KVStore) View(ctx context.Context, fn func(kv.Tx) error) error {
 	})
 }
 
-// Update opens up a transaction with a write lock.
+// Update opens up a transaction with a write lock. When fn returns an error,
+// the writes made within the transaction are rolled back.
 func (s *KVStore) Update(ctx context.Context, fn func(kv.Tx) error) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return fn(&Tx{
+	tx := &Tx{
 		kv:       s,
 		writable: true,
 		ctx:      ctx,
-	})
+	}
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	return nil
 }
 
 func (s *KVStore) Backup(ctx context.Context, w io.Writer) error {
@@ -90,12 +100,16 @@ func (s *KVStore) Buckets(ctx context.Context) [][]byte {
 	return buckets
 }
 
-// Tx is an in memory transaction.
-// TODO: make transactions actually transactional
+// Tx is an in memory transaction. Transactions are isolated by the store's lock
+// rather than by snapshots, so an open read transaction blocks writers.
 type Tx struct {
 	kv       *KVStore
 	writable bool
 	ctx      context.Context
+
+	// undo holds the inverse of each write made within a writable
+	// transaction, applied in reverse should the transaction fail.
+	undo []func()
 }
 
 // Context returns the context for the transaction.
@@ -108,6 +122,13 @@ func (t *Tx) WithContext(ctx context.Context) {
 	t.ctx = ctx
 }
 
+func (t *Tx) rollback() {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.undo = nil
+}
+
 // createBucketIfNotExists creates a btree bucket at the provided key.
 func (t *Tx) createBucketIfNotExists(b []byte) (kv.Bucket, error) {
 	if t.writable {
@@ -116,10 +137,13 @@ func (t *Tx) createBucketIfNotExists(b []byte) (kv.Bucket, error) {
 			bkt = &Bucket{btree: btree.New(2)}
 			t.kv.buckets[string(b)] = bkt
 			t.kv.ro[string(b)] = &bucket{Bucket: bkt}
-			return bkt, nil
+			t.undo = append(t.undo, func() {
+				delete(t.kv.buckets, string(b))
+				delete(t.kv.ro, string(b))
+			})
 		}
 
-		return bkt, nil
+		return &txBucket{Bucket: bkt, tx: t}, nil
 	}
 
 	return nil, kv.ErrTxNotWritable
@@ -133,12 +157,32 @@ func (t *Tx) Bucket(b []byte) (kv.Bucket, error) {
 	}
 
 	if t.writable {
-		return bkt, nil
+		return &txBucket{Bucket: bkt, tx: t}, nil
 	}
 
 	return t.kv.ro[string(b)], nil
 }
 
+// DeleteBucket removes the bucket named b and all of its keys.
+func (t *Tx) DeleteBucket(b []byte) error {
+	if !t.writable {
+		return kv.ErrTxNotWritable
+	}
+
+	bkt, ok := t.kv.buckets[string(b)]
+	if !ok {
+		return nil
+	}
+	ro := t.kv.ro[string(b)]
+	delete(t.kv.buckets, string(b))
+	delete(t.kv.ro, string(b))
+	t.undo = append(t.undo, func() {
+		t.kv.buckets[string(b)] = bkt
+		t.kv.ro[string(b)] = ro
+	})
+	return nil
+}
+
 // Bucket is a btree that implements kv.Bucket.
 type Bucket struct {
 	mu    sync.RWMutex
@@ -161,6 +205,34 @@ func (b *bucket) Delete(_ []byte) error {
 	return kv.ErrTxNotWritable
 }
 
+// txBucket records the writes made to a bucket within a writable transaction
+// so they can be rolled back.
+type txBucket struct {
+	*Bucket
+	tx *Tx
+}
+
+// Put sets the key value pair provided.
+func (b *txBucket) Put(key []byte, value []byte) error {
+	b.tx.undo = append(b.tx.undo, b.restoreFn(key))
+	return b.Bucket.Put(key, value)
+}
+
+// Delete removes the key provided.
+func (b *txBucket) Delete(key []byte) error {
+	b.tx.undo = append(b.tx.undo, b.restoreFn(key))
+	return b.Bucket.Delete(key)
+}
+
+// restoreFn returns a func restoring the key to its current state.
+func (b *txBucket) restoreFn(key []byte) func() {
+	v, err := b.Bucket.Get(key)
+	if err != nil {
+		return func() { _ = b.Bucket.Delete(key) }
+	}
+	return func() { _ = b.Bucket.Put(key, v) }
+}
+
 type item struct {
 	key   []byte
 	value []byte
@@ -239,7 +311,7 @@ func (b *Bucket) Delete(key []byte) error {
 	return nil
 }
 
-// Cursor creates a static cursor from all entries in the database.
+// Cursor creates a cursor over a snapshot of all entries in the bucket.
 func (b *Bucket) Cursor(opts ...kv.CursorHint) (kv.Cursor, error) {
 	var o kv.CursorHints
 	for _, opt := range opts {
@@ -253,7 +325,60 @@ func (b *Bucket) Cursor(opts ...kv.CursorHint) (kv.Cursor, error) {
 		return nil, err
 	}
 
-	return kv.NewStaticCursor(pairs), nil
+	return &cursor{pairs: pairs, idx: -1}, nil
+}
+
+// cursor iterates a snapshot of key ordered pairs with the same positioning
+// semantics as a bolt cursor. Unlike the static cursor of the kv package,
+// Seek positions on the first key greater than or equal to the one provided,
+// whether or not it shares it as a prefix.
+type cursor struct {
+	pairs []kv.Pair
+	idx   int
+}
+
+// Seek moves the cursor to the first key greater than or equal to the one provided.
+func (c *cursor) Seek(key []byte) ([]byte, []byte) {
+	c.idx = sort.Search(len(c.pairs), func(i int) bool {
+		return bytes.Compare(c.pairs[i].Key, key) >= 0
+	})
+	return c.at()
+}
+
+// First moves the cursor to the first key.
+func (c *cursor) First() ([]byte, []byte) {
+	c.idx = 0
+	return c.at()
+}
+
+// Last moves the cursor to the last key.
+func (c *cursor) Last() ([]byte, []byte) {
+	c.idx = len(c.pairs) - 1
+	return c.at()
+}
+
+// Next moves the cursor to the next key.
+func (c *cursor) Next() ([]byte, []byte) {
+	if c.idx < len(c.pairs) {
+		c.idx++
+	}
+	return c.at()
+}
+
+// Prev moves the cursor to the previous key.
+func (c *cursor) Prev() ([]byte, []byte) {
+	if c.idx >= 0 {
+		c.idx--
+	}
+	return c.at()
+}
+
+func (c *cursor) at() ([]byte, []byte) {
+	if c.idx < 0 || c.idx >= len(c.pairs) {
+		return nil, nil
+	}
+	pair := c.pairs[c.idx]
+	return pair.Key, pair.Value
 }
 
 func (b *Bucket) getAll(o *kv.CursorHints) ([]kv.Pair, error) {
@@ -76,6 +76,8 @@ var influxDBErrorToStatusCode = map[string]int{
 	influxdb.EUnprocessableEntity: http.StatusUnprocessableEntity,
 	influxdb.EEmptyValue:          http.StatusBadRequest,
 	influxdb.EConflict:            http.StatusUnprocessableEntity,
+	influxdb.EReferenceNotFound:   http.StatusUnprocessableEntity,
+	influxdb.EMultipleResults:     http.StatusConflict,
 	influxdb.ENotFound:            http.StatusNotFound,
 	influxdb.EUnavailable:         http.StatusServiceUnavailable,
 	influxdb.EForbidden:           http.StatusForbidden,
@@ -3,6 +3,7 @@ package http_test
 import (
 	"context"
 	"fmt"
+	nethttp "net/http"
 	"net/http/httptest"
 	"testing"
 
@@ -55,3 +56,25 @@ func TestEncodeErrorWithError(t *testing.T) {
 		t.Errorf("unexpected message -want/+got:\n\t- %q\n\t+ %q", want, got)
 	}
 }
+
+func TestErrorCodeToStatusCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want int
+	}{
+		{code: influxdb.EInternal, want: nethttp.StatusInternalServerError},
+		{code: influxdb.EInvalid, want: nethttp.StatusBadRequest},
+		{code: influxdb.ENotFound, want: nethttp.StatusNotFound},
+		{code: influxdb.EConflict, want: nethttp.StatusUnprocessableEntity},
+		{code: influxdb.EReferenceNotFound, want: nethttp.StatusUnprocessableEntity},
+		{code: influxdb.EMultipleResults, want: nethttp.StatusConflict},
+		{code: "unknown code", want: nethttp.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := kithttp.ErrorCodeToStatusCode(context.TODO(), tt.code); got != tt.want {
+				t.Errorf("unexpected status code -want/+got:\n\t- %d\n\t+ %d", tt.want, got)
+			}
+		})
+	}
+}
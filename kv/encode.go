@@ -54,3 +54,48 @@ func EncBytes(b []byte) EncodeFn {
 		return b, nil
 	}
 }
+
+// orgNameKeyTerminator separates the name from the ID in an org then name key.
+const orgNameKeyTerminator = 0x00
+
+// EncOrgThenNameKey encodes a composite key of the organization id, the entity name
+// and the entity id, in that order. Bolt keeps keys in byte order, so within a
+// given organization prefix the entities are ordered by name rather than by id,
+// with the id breaking ties between identical names.
+//
+// The name is normalized before being encoded so that the byte order matches the
+// expected listing order:
+//   - the name is case folded to lower case, so "Bar" sorts between "apple" and "cat"
+//   - the name is terminated by a single 0x00 byte rather than length prefixed. A
+//     length prefix would order all shorter names before longer ones, whereas the
+//     terminator keeps "ab" before "abc" before "b". Names holding a 0x00 byte are
+//     rejected as they would break that ordering.
+func EncOrgThenNameKey(orgID influxdb.ID, name string, id influxdb.ID) EncodeFn {
+	return func() ([]byte, error) {
+		if strings.IndexByte(name, orgNameKeyTerminator) >= 0 {
+			return nil, errors.New("name must not contain a null byte")
+		}
+		return Encode(
+			EncID(orgID),
+			EncStringCaseInsensitive(name),
+			EncBytes([]byte{orgNameKeyTerminator}),
+			EncID(id),
+		)()
+	}
+}
+
+// DecodeOrgThenNameKey decodes a key encoded with EncOrgThenNameKey into the organization
+// id, the case folded name and the entity id.
+func DecodeOrgThenNameKey(k []byte) (orgID influxdb.ID, name string, id influxdb.ID, err error) {
+	if len(k) < 2*influxdb.IDLength+1 || k[len(k)-influxdb.IDLength-1] != orgNameKeyTerminator {
+		return 0, "", 0, errors.New("invalid org then name key")
+	}
+
+	if err := orgID.Decode(k[:influxdb.IDLength]); err != nil {
+		return 0, "", 0, err
+	}
+	if err := id.Decode(k[len(k)-influxdb.IDLength:]); err != nil {
+		return 0, "", 0, err
+	}
+	return orgID, string(k[influxdb.IDLength : len(k)-influxdb.IDLength-1]), id, nil
+}
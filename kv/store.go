@@ -109,6 +109,20 @@ type Bucket interface {
 	ForwardCursor(seek []byte, opts ...CursorOption) (ForwardCursor, error)
 }
 
+// FillPercentBucket is implemented by buckets whose page fill threshold can be
+// tuned, as with bolt's Bucket.FillPercent. The setting applies to the bucket for
+// the life of the transaction it was retrieved in.
+type FillPercentBucket interface {
+	SetFillPercent(p float64)
+}
+
+// BucketDeleter is implemented by transactions able to remove a bucket entirely,
+// as with bolt's Tx.DeleteBucket. Deleting a bucket that does not exist is not an
+// error.
+type BucketDeleter interface {
+	DeleteBucket(b []byte) error
+}
+
 // Cursor is an abstraction for iterating/ranging through data. A concrete implementation
 // of a cursor can be found in cursor.go.
 type Cursor interface {
@@ -0,0 +1,380 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// backupMagic begins every backup written by BackupStores, followed by the version
+// of its format.
+var backupMagic = []byte("KVBK")
+
+const backupVersion byte = 1
+
+// The entries of a backup are each tagged with their kind. A backup is a sequence
+// of sections, one per store, each a header naming the bucket, the bucket's pairs,
+// and a trailer holding the number of pairs, followed by the end of the backup.
+const (
+	backupSection byte = 'S'
+	backupPair    byte = 'P'
+	backupTrailer byte = 'T'
+	backupEnd     byte = 'E'
+)
+
+// BackupStores writes the raw pairs of the bucket of each store to w, within a
+// single read transaction, so the stores are captured at one consistent point no
+// matter the writes committed while the backup runs. Each bucket is written as a
+// section labeled with its name, for RestoreStores to dispatch the pairs back to.
+//
+// Values are copied as stored, frames and checksums included, and are never
+// decoded. Only the bucket of each store is captured. Secondary indexes are rebuilt
+// on restore, while the sequence indexes, sidecars, blobs, and outboxes of a store
+// are not part of the backup.
+func BackupStores(ctx context.Context, store Store, w io.Writer, stores ...*StoreBase) error {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	if err := checkBackupStores(stores); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	err := store.View(ctx, func(tx Tx) error {
+		if _, err := bw.Write(backupMagic); err != nil {
+			return err
+		}
+		if err := bw.WriteByte(backupVersion); err != nil {
+			return err
+		}
+		for _, s := range stores {
+			if err := s.backup(ctx, tx, bw); err != nil {
+				return err
+			}
+		}
+		return bw.WriteByte(backupEnd)
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		if _, ok := err.(*influxdb.Error); ok {
+			return err
+		}
+		return &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  "failed to write backup",
+			Err:  err,
+		}
+	}
+	return nil
+}
+
+// backup writes the section of the store's bucket.
+func (s *StoreBase) backup(ctx context.Context, tx Tx, w *bufio.Writer) error {
+	if err := w.WriteByte(backupSection); err != nil {
+		return err
+	}
+	if err := writeBackupBytes(w, s.BktName); err != nil {
+		return err
+	}
+
+	var n uint64
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil && !s.isMissingBucket(err) {
+		return err
+	}
+	if err == nil {
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := w.WriteByte(backupPair); err != nil {
+				return err
+			}
+			if err := writeBackupBytes(w, k); err != nil {
+				return err
+			}
+			if err := writeBackupBytes(w, v); err != nil {
+				return err
+			}
+			n++
+		}
+	}
+
+	if err := w.WriteByte(backupTrailer); err != nil {
+		return err
+	}
+	return writeBackupUvarint(w, n)
+}
+
+// RestoreMode decides how RestoreStoresWith treats the data already held by the
+// buckets it restores.
+type RestoreMode int
+
+const (
+	// RestoreReplace replaces the contents of each restored bucket with those of
+	// the backup. It is the default.
+	RestoreReplace RestoreMode = iota
+	// RestoreOverwrite merges the backup into each restored bucket, the backup's
+	// value winning wherever a key is held by both.
+	RestoreOverwrite
+	// RestoreSkip merges the backup into each restored bucket, the bucket's value
+	// winning wherever a key is held by both.
+	RestoreSkip
+)
+
+// ResolveFn resolves a conflict between the value a bucket holds for a key and the
+// value restored or imported for it, returning the value to keep, as stored. Either
+// of the values may be returned, or a merge of the two, while an error aborts.
+type ResolveFn func(key []byte, existing, incoming []byte) ([]byte, error)
+
+// RestoreOpts configures RestoreStoresWith.
+type RestoreOpts struct {
+	Mode RestoreMode
+	// ResolveFn, when provided, resolves the conflicts of a merging mode in place
+	// of the mode's fixed policy. A conflict is a key held by both the bucket and
+	// the backup with differing values. It may not be combined with
+	// RestoreReplace, which leaves nothing to conflict with.
+	ResolveFn ResolveFn
+}
+
+// RestoreStores reads a backup written by BackupStores and writes the pairs of each
+// of its sections to the bucket of the store it was taken from, all within a single
+// update transaction. The contents of each restored bucket are replaced by those of
+// the backup, only those within its namespace for a namespaced store, and the
+// secondary indexes of each restored store are then rebuilt with ReindexAll. Stores absent from the backup are left untouched, while a
+// section for a bucket none of the stores use fails the restore as invalid, as does
+// a backup that is truncated or otherwise malformed.
+func RestoreStores(ctx context.Context, store Store, r io.Reader, stores ...*StoreBase) error {
+	return RestoreStoresWith(ctx, store, r, RestoreOpts{}, stores...)
+}
+
+// RestoreStoresWith restores a backup as RestoreStores does, merging it into the
+// existing data of the restored buckets rather than replacing it when the mode of
+// opts is RestoreOverwrite or RestoreSkip.
+func RestoreStoresWith(ctx context.Context, store Store, r io.Reader, opts RestoreOpts, stores ...*StoreBase) error {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	if err := checkBackupStores(stores); err != nil {
+		return err
+	}
+	if opts.ResolveFn != nil && opts.Mode == RestoreReplace {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  "a restore resolve fn requires a merging restore mode",
+		}
+	}
+
+	byBucket := make(map[string]*StoreBase, len(stores))
+	for _, s := range stores {
+		byBucket[string(s.BktName)] = s
+	}
+
+	br := &backupReader{r: bufio.NewReader(r), opts: opts}
+	return store.Update(ctx, func(tx Tx) error {
+		header := make([]byte, len(backupMagic)+1)
+		if _, err := io.ReadFull(br.r, header); err != nil || !bytes.Equal(header[:len(backupMagic)], backupMagic) {
+			return errMalformedBackup("missing backup header", err)
+		}
+		if v := header[len(backupMagic)]; v != backupVersion {
+			return errMalformedBackup(fmt.Sprintf("unsupported backup version %d", v), nil)
+		}
+
+		for {
+			tag, err := br.r.ReadByte()
+			if err != nil {
+				return errMalformedBackup("backup ends without its end marker", err)
+			}
+			switch tag {
+			case backupEnd:
+				return nil
+			case backupSection:
+				if err := br.restoreSection(ctx, tx, byBucket); err != nil {
+					return err
+				}
+			default:
+				return errMalformedBackup(fmt.Sprintf("unexpected entry %q where a section was expected", tag), nil)
+			}
+		}
+	})
+}
+
+type backupReader struct {
+	r    *bufio.Reader
+	opts RestoreOpts
+}
+
+// restoreSection restores the section whose tag has just been read.
+func (br *backupReader) restoreSection(ctx context.Context, tx Tx, byBucket map[string]*StoreBase) error {
+	name, err := br.readBytes()
+	if err != nil {
+		return errMalformedBackup("truncated section header", err)
+	}
+	s, ok := byBucket[string(name)]
+	if !ok {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("backup section for bucket %q matches none of the stores restored", string(name)),
+		}
+	}
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if br.opts.Mode == RestoreReplace {
+		if err := clearBucket(b, s.namespace, s.decodeCache); err != nil {
+			return err
+		}
+	}
+
+	var n uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		tag, err := br.r.ReadByte()
+		if err != nil {
+			return errMalformedBackup(fmt.Sprintf("truncated section for bucket %q", string(name)), err)
+		}
+		switch tag {
+		case backupPair:
+			k, err := br.readBytes()
+			if err != nil {
+				return errMalformedBackup(fmt.Sprintf("truncated pair in section for bucket %q", string(name)), err)
+			}
+			v, err := br.readBytes()
+			if err != nil {
+				return errMalformedBackup(fmt.Sprintf("truncated pair in section for bucket %q", string(name)), err)
+			}
+			if !bytes.HasPrefix(k, s.namespace) {
+				return errMalformedBackup(fmt.Sprintf("pair for key %q lies outside the namespace %q of bucket %q", string(k), string(s.namespace), string(name)), nil)
+			}
+			if v, err = br.resolve(s, b, k, v); err != nil {
+				return err
+			}
+			if v != nil {
+				if err := s.putInBucket(b, k, v); err != nil {
+					return err
+				}
+			}
+			n++
+		case backupTrailer:
+			count, err := binary.ReadUvarint(br.r)
+			if err != nil {
+				return errMalformedBackup(fmt.Sprintf("truncated trailer of section for bucket %q", string(name)), err)
+			}
+			if count != n {
+				return errMalformedBackup(fmt.Sprintf("section for bucket %q holds %d pairs but its trailer records %d", string(name), n, count), nil)
+			}
+			_, err = s.ReindexAll(ctx, tx)
+			return err
+		default:
+			return errMalformedBackup(fmt.Sprintf("unexpected entry %q in section for bucket %q", tag, string(name)), nil)
+		}
+	}
+}
+
+// resolve returns the value to write for a restored pair, or nil when the value the
+// bucket holds is to be kept.
+func (br *backupReader) resolve(s *StoreBase, b Bucket, k, incoming []byte) ([]byte, error) {
+	if br.opts.Mode == RestoreReplace {
+		return incoming, nil
+	}
+
+	existing, err := b.Get(k)
+	if IsNotFound(err) {
+		return incoming, nil
+	}
+	if err != nil {
+		return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	if bytes.Equal(existing, incoming) {
+		return nil, nil
+	}
+
+	switch {
+	case br.opts.ResolveFn != nil:
+		resolved, err := br.opts.ResolveFn(k, existing, incoming)
+		if err != nil {
+			return nil, &influxdb.Error{
+				Code: influxdb.EConflict,
+				Msg:  fmt.Sprintf("failed to resolve restored %s for key %q", s.Resource, string(k)),
+				Err:  err,
+			}
+		}
+		if bytes.Equal(resolved, existing) {
+			return nil, nil
+		}
+		return resolved, nil
+	case br.opts.Mode == RestoreSkip:
+		return nil, nil
+	default:
+		return incoming, nil
+	}
+}
+
+func (br *backupReader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(br.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("length %d exceeds the maximum of %d", n, math.MaxInt32)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br.r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func checkBackupStores(stores []*StoreBase) error {
+	seen := make(map[string]bool, len(stores))
+	for _, s := range stores {
+		if seen[string(s.BktName)] {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  fmt.Sprintf("bucket %q is listed more than once", string(s.BktName)),
+			}
+		}
+		seen[string(s.BktName)] = true
+	}
+	return nil
+}
+
+func writeBackupBytes(w *bufio.Writer, b []byte) error {
+	if err := writeBackupUvarint(w, uint64(len(b))); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func writeBackupUvarint(w *bufio.Writer, n uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	_, err := w.Write(buf[:binary.PutUvarint(buf[:], n)])
+	return err
+}
+
+func errMalformedBackup(msg string, err error) error {
+	return &influxdb.Error{
+		Code: influxdb.EInvalid,
+		Msg:  "malformed backup: " + msg,
+		Err:  err,
+	}
+}
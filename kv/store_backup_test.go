@@ -0,0 +1,203 @@
+package kv_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupStores(t *testing.T) {
+	newStores := func(t *testing.T) (kv.Store, *kv.StoreBase, *kv.StoreBase, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		foos := kv.NewStoreBase("foo", []byte("foo_backup"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithNameFoldIndex([]byte("foo_backup_name_fold"), fooNameFn, true),
+		)
+		bars := kv.NewStoreBase("bar", []byte("bar_backup"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := foos.Init(context.TODO(), tx); err != nil {
+				return err
+			}
+			return bars.Init(context.TODO(), tx)
+		})
+		return kvStore, foos, bars, done
+	}
+
+	findAll := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase) []interface{} {
+		t.Helper()
+
+		var vals []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					vals = append(vals, decodedVal)
+					return nil
+				},
+			})
+		})
+		return vals
+	}
+
+	src, srcFoos, srcBars, srcDone := newStores(t)
+	defer srcDone()
+	seedEnts(t, src, srcFoos, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2"))
+	seedEnts(t, src, srcBars, newFooEnt(3, 9001, "bar_3"))
+
+	var backup bytes.Buffer
+	require.NoError(t, kv.BackupStores(context.TODO(), src, &backup, srcFoos, srcBars))
+
+	t.Run("restores every store", func(t *testing.T) {
+		dst, dstFoos, dstBars, dstDone := newStores(t)
+		defer dstDone()
+
+		// replaced by the contents of the backup
+		seedEnts(t, dst, dstFoos, newFooEnt(4, 9000, "stale"))
+
+		require.NoError(t, kv.RestoreStores(context.TODO(), dst, bytes.NewReader(backup.Bytes()), dstFoos, dstBars))
+
+		assert.Equal(t, findAll(t, src, srcFoos), findAll(t, dst, dstFoos))
+		assert.Equal(t, findAll(t, src, srcBars), findAll(t, dst, dstBars))
+
+		view(t, dst, func(tx kv.Tx) error {
+			v, err := dstFoos.FindEntByNameFold(context.TODO(), tx, "FOO_2")
+			require.NoError(t, err)
+			assert.Equal(t, foo{ID: 2, OrgID: 9000, Name: "foo_2"}, v)
+
+			_, err = dstFoos.FindEntByNameFold(context.TODO(), tx, "stale")
+			isNotFoundErr(t, err)
+			return nil
+		})
+	})
+
+	t.Run("merges into existing data", func(t *testing.T) {
+		seedLocal := func(t *testing.T) (kv.Store, *kv.StoreBase, *kv.StoreBase, func()) {
+			dst, dstFoos, dstBars, dstDone := newStores(t)
+			seedEnts(t, dst, dstFoos, newFooEnt(2, 9000, "local_2"), newFooEnt(4, 9000, "local_4"))
+			return dst, dstFoos, dstBars, dstDone
+		}
+
+		for _, tt := range []struct {
+			name     string
+			opts     kv.RestoreOpts
+			expected []interface{}
+		}{
+			{
+				name: "overwrite",
+				opts: kv.RestoreOpts{Mode: kv.RestoreOverwrite},
+				expected: []interface{}{
+					foo{ID: 1, OrgID: 9000, Name: "foo_1"},
+					foo{ID: 2, OrgID: 9000, Name: "foo_2"},
+					foo{ID: 4, OrgID: 9000, Name: "local_4"},
+				},
+			},
+			{
+				name: "skip",
+				opts: kv.RestoreOpts{Mode: kv.RestoreSkip},
+				expected: []interface{}{
+					foo{ID: 1, OrgID: 9000, Name: "foo_1"},
+					foo{ID: 2, OrgID: 9000, Name: "local_2"},
+					foo{ID: 4, OrgID: 9000, Name: "local_4"},
+				},
+			},
+			{
+				name: "resolve fn",
+				opts: kv.RestoreOpts{
+					Mode: kv.RestoreSkip,
+					ResolveFn: func(key []byte, existing, incoming []byte) ([]byte, error) {
+						return []byte(`{"ID":"0000000000000002","OrgID":"0000000000002328","Name":"merged"}`), nil
+					},
+				},
+				expected: []interface{}{
+					foo{ID: 1, OrgID: 9000, Name: "foo_1"},
+					foo{ID: 2, OrgID: 9000, Name: "merged"},
+					foo{ID: 4, OrgID: 9000, Name: "local_4"},
+				},
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				dst, dstFoos, dstBars, dstDone := seedLocal(t)
+				defer dstDone()
+
+				require.NoError(t, kv.RestoreStoresWith(context.TODO(), dst, bytes.NewReader(backup.Bytes()), tt.opts, dstFoos, dstBars))
+				assert.Equal(t, tt.expected, findAll(t, dst, dstFoos))
+
+				view(t, dst, func(tx kv.Tx) error {
+					_, err := dstFoos.FindEntByNameFold(context.TODO(), tx, "local_4")
+					require.NoError(t, err)
+					return nil
+				})
+			})
+		}
+
+		t.Run("resolve fn replacing", func(t *testing.T) {
+			dst, dstFoos, dstBars, dstDone := seedLocal(t)
+			defer dstDone()
+
+			err := kv.RestoreStoresWith(context.TODO(), dst, bytes.NewReader(backup.Bytes()), kv.RestoreOpts{
+				ResolveFn: func(key []byte, existing, incoming []byte) ([]byte, error) { return incoming, nil },
+			}, dstFoos, dstBars)
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		})
+	})
+
+	t.Run("section for an unknown bucket", func(t *testing.T) {
+		dst, dstFoos, _, dstDone := newStores(t)
+		defer dstDone()
+
+		err := kv.RestoreStores(context.TODO(), dst, bytes.NewReader(backup.Bytes()), dstFoos)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Empty(t, findAll(t, dst, dstFoos))
+	})
+
+	t.Run("truncated backup", func(t *testing.T) {
+		dst, dstFoos, dstBars, dstDone := newStores(t)
+		defer dstDone()
+
+		truncated := backup.Bytes()[:backup.Len()-1]
+		err := kv.RestoreStores(context.TODO(), dst, bytes.NewReader(truncated), dstFoos, dstBars)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Empty(t, findAll(t, dst, dstFoos))
+	})
+
+	t.Run("namespaced store leaves sibling namespaces", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		bktName := []byte("foo_backup_shared")
+		first := kv.NewNamespacedStoreBase("foo", bktName, []byte("a/"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		second := kv.NewNamespacedStoreBase("foo", bktName, []byte("b/"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return first.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, first, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2"))
+		seedEnts(t, kvStore, second, newFooEnt(3, 9000, "foo_3"))
+
+		var firstBackup, secondBackup bytes.Buffer
+		require.NoError(t, kv.BackupStores(context.TODO(), kvStore, &firstBackup, first.StoreBase))
+		require.NoError(t, kv.BackupStores(context.TODO(), kvStore, &secondBackup, second.StoreBase))
+
+		seedEnts(t, kvStore, first, newFooEnt(4, 9000, "foo_4"))
+		seedEnts(t, kvStore, second, newFooEnt(5, 9000, "foo_5"))
+
+		require.NoError(t, kv.RestoreStores(context.TODO(), kvStore, bytes.NewReader(firstBackup.Bytes()), first.StoreBase))
+		assert.Equal(t, toIfaces(newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2")), findAll(t, kvStore, first.StoreBase))
+		assert.Equal(t, toIfaces(newFooEnt(3, 9000, "foo_3"), newFooEnt(5, 9000, "foo_5")), findAll(t, kvStore, second.StoreBase))
+
+		err = kv.RestoreStores(context.TODO(), kvStore, bytes.NewReader(secondBackup.Bytes()), first.StoreBase)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Equal(t, toIfaces(newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2")), findAll(t, kvStore, first.StoreBase))
+	})
+}
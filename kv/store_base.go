@@ -1,16 +1,24 @@
 package kv
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/influxdata/influxdb/v2"
 	"github.com/influxdata/influxdb/v2/kit/tracing"
 	"github.com/opentracing/opentracing-go"
 )
 
+// ErrMaxScanExceeded is the underlying error of a Find aborted for examining more keys
+// than its configured maximum.
+var ErrMaxScanExceeded = errors.New("maximum number of scanned keys exceeded")
+
 type Entity struct {
 	PK        EncodeFn
 	UniqueKey EncodeFn
@@ -39,6 +47,24 @@ func EncUniqKey(ent Entity) ([]byte, string, error) {
 	return key, "Unique Key", err
 }
 
+// EncKeyFunc returns a key encoder deriving the key from the entity body with
+// extract, for resources whose natural key is neither their ID nor their name, i.e.
+// a composite of type and slug. An error from extract, or an empty key, fails the
+// Put as invalid. As the key derives from the body, FindEnt and DeleteEnt must be
+// provided an entity with its body set.
+func EncKeyFunc(extract func(body interface{}) ([]byte, error)) EncodeEntFn {
+	return func(ent Entity) ([]byte, string, error) {
+		key, err := extract(ent.Body)
+		if err != nil {
+			return nil, "key", err
+		}
+		if len(key) == 0 {
+			return nil, "key", errors.New("extracted key is empty")
+		}
+		return key, "key", nil
+	}
+}
+
 // EncBodyJSON JSON encodes the entity body and returns the raw bytes and indicates
 // that it uses the entity body.
 func EncBodyJSON(ent Entity) ([]byte, string, error) {
@@ -46,6 +72,56 @@ func EncBodyJSON(ent Entity) ([]byte, string, error) {
 	return v, "entity body", err
 }
 
+// JSONOpts configures the JSON encoding of entity bodies. The zero value encodes
+// identically to EncBodyJSON.
+type JSONOpts struct {
+	// DisableHTMLEscape stores <, >, and & verbatim rather than as \u003c
+	// style escapes.
+	DisableHTMLEscape bool
+	// SortKeys orders the fields of every object by key, including those
+	// encoded from structs, which are otherwise written in declaration order.
+	// Map keys are always sorted. Numbers are preserved exactly. This gives a
+	// stable byte representation suitable for hashing even as body types gain
+	// or reorder fields.
+	SortKeys bool
+}
+
+// EncBodyJSONWith returns an EncodeEntFn that JSON encodes the entity body with
+// the provided options.
+func EncBodyJSONWith(opts JSONOpts) EncodeEntFn {
+	return func(ent Entity) ([]byte, string, error) {
+		v, err := marshalJSON(ent.Body, opts)
+		return v, "entity body", err
+	}
+}
+
+func marshalJSON(v interface{}, opts JSONOpts) ([]byte, error) {
+	if opts.SortKeys {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		// decoding into generic values turns every object into a map,
+		// which encoding/json writes with sorted keys
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var generic interface{}
+		if err := dec.Decode(&generic); err != nil {
+			return nil, err
+		}
+		v = generic
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(!opts.DisableHTMLEscape)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// the encoder terminates each value with a newline which json.Marshal does not
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
 // DecodeBucketValFn decodes the raw []byte.
 type DecodeBucketValFn func(key, val []byte) (keyRepeat []byte, decodedVal interface{}, err error)
 
@@ -61,6 +137,10 @@ type ConvertValToEntFn func(k []byte, v interface{}) (Entity, error)
 // DecodeOrgNameKey decodes a raw bucket key into the organization id and name
 // used to create it.
 func DecodeOrgNameKey(k []byte) (influxdb.ID, string, error) {
+	if len(k) < influxdb.IDLength {
+		return 0, "", fmt.Errorf("key of length %d is too short to contain an organization id", len(k))
+	}
+
 	var orgID influxdb.ID
 	if err := orgID.Decode(k[:influxdb.IDLength]); err != nil {
 		return 0, "", err
@@ -107,17 +187,166 @@ type StoreBase struct {
 	EncodeEntBodyFn   EncodeEntFn
 	DecodeEntFn       DecodeBucketValFn
 	ConvertValToEntFn ConvertValToEntFn
+
+	indexes  []StoreIndex
+	onPut    OnPutFn
+	onDelete OnDeleteFn
+
+	autoInit          bool
+	naturalDescending bool
+	defaultMaxScan    int
+	decodeCache       *decodeCache
+
+	limiter     RateLimiter
+	limitPolicy RateLimitPolicy
+
+	outboxBktName []byte
+	versionFn     VersionFn
+	blobChunkSize int
+	readTransform ReadTransformFn
+	jsonBodies    bool
+	fillPercent   float64
+	timeGen       influxdb.TimeGenerator
+	metadataTTL   time.Duration
+	readOnly      int32
+	sidecars      []sidecar
+	redactFn      RedactFn
+	orgKeyPrefix  bool
+	orgIDFn       OrgIDFn
+	namespace     []byte
+	checksumFn    ChecksumFn
+	projection    *projection
+	kindFn        KindFn
+	kindDispatch  KindDispatch
+	seqBktName    []byte
+	metrics       *storeMetrics
+	references    []Reference
+	maxKeyBytes   int
+	timingHook    *TimingHook
+	decodePool    *sync.Pool
+	schema        *bodySchema
+	schemaErr     error
+
+	quarantineBktName []byte
+	quarantineRemove  bool
 }
 
+// StoreBaseOptFn is a functional option for configuring optional behavior
+// of a StoreBase at construction time.
+type StoreBaseOptFn func(s *StoreBase)
+
 // NewStoreBase creates a new store base.
-func NewStoreBase(resource string, bktName []byte, encKeyFn, encBodyFn EncodeEntFn, decFn DecodeBucketValFn, decToEntFn ConvertValToEntFn) *StoreBase {
-	return &StoreBase{
+func NewStoreBase(resource string, bktName []byte, encKeyFn, encBodyFn EncodeEntFn, decFn DecodeBucketValFn, decToEntFn ConvertValToEntFn, opts ...StoreBaseOptFn) *StoreBase {
+	s := &StoreBase{
 		Resource:          resource,
 		BktName:           bktName,
 		EncodeEntKeyFn:    encKeyFn,
 		EncodeEntBodyFn:   encBodyFn,
 		DecodeEntFn:       decFn,
 		ConvertValToEntFn: decToEntFn,
+		metrics:           &storeMetrics{},
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// WithAutoInit allows the store to be used before Init has been run. Reads against
+// the missing bucket are treated as reads against an empty store, and the bucket is
+// created lazily by the first writable transaction that touches it.
+func WithAutoInit() StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.autoInit = true
+	}
+}
+
+// WithNaturalOrderDescending makes Find iterate the store in descending key order by
+// default. This suits stores whose natural listing order is newest first, i.e.
+// resources keyed by time. A Find call can still iterate in ascending order by
+// setting FindOpts.Ascending.
+func WithNaturalOrderDescending() StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.naturalDescending = true
+	}
+}
+
+// WithMaxScan sets the default maximum number of keys a Find will examine before
+// aborting with ErrMaxScanExceeded. It acts as a safety valve against runaway
+// unbounded scans, and may be overridden per call via FindOpts.MaxScan.
+func WithMaxScan(n int) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.defaultMaxScan = n
+	}
+}
+
+// DefaultMaxKeyBytes is the largest key a store accepts by default, bolt's maximum
+// key size.
+const DefaultMaxKeyBytes = 32768
+
+// WithMaxKeyBytes sets the largest encoded key, in bytes, a store accepts on Put.
+// Larger keys fail as invalid before anything is written, rather than deep in the
+// underlying store. A limit of zero or less restores DefaultMaxKeyBytes; limits
+// past what the underlying store supports only defer the failure to it.
+func WithMaxKeyBytes(n int) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.maxKeyBytes = n
+	}
+}
+
+// WithFillPercent sets the fill percent of the store's bucket for transactions that
+// put to it, on stores whose buckets implement FillPercentBucket. Bolt splits pages
+// once they are filled to this fraction, half full by default, which leaves the
+// pages of stores written with monotonically increasing keys, i.e. time ordered
+// keys, half empty since inserts never land in them again. Such append only stores
+// should use 1.0 to fill pages completely. Stores with random inserts should keep
+// the default.
+func WithFillPercent(p float64) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.fillPercent = p
+	}
+}
+
+// ReadTransformFn normalizes a decoded value on the read path.
+type ReadTransformFn func(decodedVal interface{}) interface{}
+
+// WithReadTransform applies fn to every value the store decodes, presenting readers
+// such as Find and FindEnt a normalized view of records stored in a legacy shape.
+// Filters and hooks see the transformed value too. The stored bytes are untouched
+// until the record is next put. When combined with WithDecodeCache, fn must return
+// a new value rather than modify the one it is given, as that value is cached.
+func WithReadTransform(fn ReadTransformFn) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.readTransform = fn
+	}
+}
+
+// OnPutFn is called with the key, the newly written decoded value, and the decoded
+// value it replaced for each entity written to the store. The prevVal is nil when
+// the entity was created.
+type OnPutFn func(key []byte, newVal, prevVal interface{}) error
+
+// WithOnPut registers a callback that is invoked after every successful write of an
+// entity. The callback runs inside the writing transaction, so the notifications it
+// emits align with the commit, and an error returned from it aborts the write. The
+// previous value is only read and decoded when a callback is registered.
+func WithOnPut(fn OnPutFn) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.onPut = fn
+	}
+}
+
+// OnDeleteFn is called with the key and decoded value of each entity removed
+// from the store.
+type OnDeleteFn func(key []byte, deletedVal interface{}) error
+
+// WithOnDelete registers a callback that is invoked for every entity removed by
+// Delete or DeleteEnt. The callback runs inside the deleting transaction, so the
+// events it emits align with the commit, and an error returned from it aborts the
+// delete. The prior value is only read and decoded when a callback is registered.
+func WithOnDelete(fn OnDeleteFn) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.onDelete = fn
 	}
 }
 
@@ -134,6 +363,12 @@ func (s *StoreBase) Init(ctx context.Context, tx Tx) error {
 	span, ctx := s.startSpan(ctx)
 	defer span.Finish()
 
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
+	if s.schemaErr != nil {
+		return s.errInvalidSchema()
+	}
 	if _, err := s.bucket(ctx, tx); err != nil {
 		return &influxdb.Error{
 			Code: influxdb.EInternal,
@@ -141,7 +376,22 @@ func (s *StoreBase) Init(ctx context.Context, tx Tx) error {
 			Err:  err,
 		}
 	}
-	return nil
+	if err := s.initIndexes(ctx, tx); err != nil {
+		return err
+	}
+	if err := s.initSidecars(ctx, tx); err != nil {
+		return err
+	}
+	if err := s.initProjection(ctx, tx); err != nil {
+		return err
+	}
+	if err := s.initSeq(ctx, tx); err != nil {
+		return err
+	}
+	if err := s.initOutbox(ctx, tx); err != nil {
+		return err
+	}
+	return s.initQuarantine(ctx, tx)
 }
 
 type (
@@ -160,14 +410,26 @@ type (
 )
 
 // Delete deletes entities by the provided options.
-func (s *StoreBase) Delete(ctx context.Context, tx Tx, opts DeleteOpts) error {
+func (s *StoreBase) Delete(ctx context.Context, tx Tx, opts DeleteOpts) (err error) {
 	span, ctx := s.startSpan(ctx)
 	defer span.Finish()
+	defer func(start time.Time) { s.observe(metricsOpDelete, "Delete", start, 0, err) }(time.Now())
+
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
 
 	if opts.FilterFn == nil {
 		return nil
 	}
 
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	if err := s.throttle(ctx); err != nil {
+		return err
+	}
+
 	findOpts := FindOpts{
 		CaptureFn: func(k []byte, v interface{}) error {
 			for _, deleteFn := range opts.DeleteRelationFns {
@@ -175,45 +437,221 @@ func (s *StoreBase) Delete(ctx context.Context, tx Tx, opts DeleteOpts) error {
 					return err
 				}
 			}
-			return s.bucketDelete(ctx, tx, k)
+			// the captured key is stripped of any namespace, the bucket's is not
+			key := s.withNamespace(k)
+			if err := s.deleteIndexes(ctx, tx, key, v); err != nil {
+				return err
+			}
+			if err := s.deleteKey(ctx, tx, key); err != nil {
+				return err
+			}
+			return s.notifyDelete(key, v)
 		},
 		FilterEntFn: opts.FilterFn,
 	}
-	return s.Find(ctx, tx, findOpts)
+	return s.find(ctx, tx, findOpts)
 }
 
 // DeleteEnt deletes an entity.
-func (s *StoreBase) DeleteEnt(ctx context.Context, tx Tx, ent Entity) error {
+func (s *StoreBase) DeleteEnt(ctx context.Context, tx Tx, ent Entity) (err error) {
 	span, ctx := s.startSpan(ctx)
 	defer span.Finish()
+	defer func(start time.Time) { s.observe(metricsOpDelete, "DeleteEnt", start, 0, err) }(time.Now())
+
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	if err := s.throttle(ctx); err != nil {
+		return err
+	}
 
 	encodedID, err := s.EntKey(ctx, ent)
 	if err != nil {
 		return err
 	}
-	return s.bucketDelete(ctx, tx, encodedID)
+
+	if len(s.indexes) == 0 && s.onDelete == nil {
+		return s.deleteKey(ctx, tx, encodedID)
+	}
+
+	existing, err := s.findByKey(ctx, tx, encodedID)
+	if err != nil {
+		return err
+	}
+	return s.deleteExisting(ctx, tx, encodedID, existing)
+}
+
+// deleteExisting deletes the entity stored at the key, whose decoded value has
+// already been read, along with its index entries and sidecar data.
+func (s *StoreBase) deleteExisting(ctx context.Context, tx Tx, key []byte, existing interface{}) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	if err := s.deleteIndexes(ctx, tx, key, existing); err != nil {
+		return err
+	}
+	if err := s.deleteKey(ctx, tx, key); err != nil {
+		return err
+	}
+	return s.notifyDelete(key, existing)
+}
+
+// deleteUndecodable deletes the value stored under key that fails to decode,
+// following deleteExisting except that its index entries are found by sweeping the
+// indexes for the key, and no delete hook is run as there is no value to give it.
+func (s *StoreBase) deleteUndecodable(ctx context.Context, tx Tx, key []byte) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	if err := s.deleteIndexesFor(ctx, tx, key); err != nil {
+		return err
+	}
+	return s.deleteKey(ctx, tx, key)
+}
+
+// deleteKey deletes the value stored under key along with its sidecar data,
+// projection and sequence entries. Its index entries are left to the caller, as
+// finding them requires the decoded value.
+func (s *StoreBase) deleteKey(ctx context.Context, tx Tx, key []byte) error {
+	if err := s.bucketDelete(ctx, tx, key); err != nil {
+		return err
+	}
+	if err := s.deleteSidecars(ctx, tx, key); err != nil {
+		return err
+	}
+	if err := s.deleteProjection(ctx, tx, key); err != nil {
+		return err
+	}
+	return s.deleteSeq(ctx, tx, key)
+}
+
+func (s *StoreBase) notifyDelete(key []byte, deletedVal interface{}) error {
+	if s.onDelete == nil {
+		return nil
+	}
+	return s.onDelete(key, deletedVal)
 }
 
 type (
 	// FindOpts provided a means to search through the bucket. When a filter func
 	// is provided, that will run against the entity and if the filter responds true,
 	// will count it towards the number of entries seen and the capture func will be
-	// run with it provided to it.
+	// run with it provided to it. The Ascending option only has an effect on stores
+	// whose natural order is descending, where it overrides that default. A Limit
+	// of zero means no limit and an Offset of zero skips nothing; negative values
+	// of either are invalid.
 	FindOpts struct {
 		Descending  bool
+		Ascending   bool
 		Offset      int
 		Limit       int
 		Prefix      []byte
 		CaptureFn   FindCaptureFn
 		FilterEntFn FilterFn
+		// IndexedCaptureFn is an alternative to CaptureFn that is also provided the
+		// zero based index of the result within the results emitted by this Find.
+		// When paginating with an Offset, the rank within the full result set is
+		// the Offset plus the index.
+		IndexedCaptureFn FindIndexedCaptureFn
+		// MaxScan aborts the Find with ErrMaxScanExceeded once this many keys
+		// have been examined, regardless of how many matched the filter. When
+		// zero the store's default from WithMaxScan is used, and when both are
+		// zero the scan is unbounded.
+		MaxScan int
+		// Stats, when provided, is reset and populated with the scan statistics
+		// of the Find call.
+		Stats *FindStats
+		// After resumes a Find from the key of the last result of a previous
+		// page. The After key itself is never returned, nor is it required to
+		// still exist. When ascending, results start at the first key greater
+		// than After; when descending, at the greatest key less than After.
+		// Keys are compared in the byte order of the bucket. After takes
+		// precedence over Prefix for positioning the cursor.
+		//
+		// Paginating with After is stable under concurrent writes: deleting
+		// rows before the cursor, the cursor's own row included, neither skips
+		// nor repeats a result of the following pages. Paginating with an
+		// Offset is not, as each deletion shifts the rows of later pages back
+		// by one and the next page skips as many results.
+		After []byte
+		// StopFn halts the Find the first time it returns true for a key, i.e.
+		// once a time ordered key crosses a boundary. It is called before the
+		// value is decoded, so stopping costs no decode.
+		StopFn func(key []byte) bool
+		// ErrorOnEmpty fails the Find with a not found error when no results
+		// are captured, whether the store is empty or nothing matched the
+		// filter.
+		ErrorOnEmpty bool
+		// Deadline, when set, ends the Find early without error once it passes,
+		// leaving the caller with the results captured so far. The results are
+		// a prefix of those a Find without a deadline would capture, in the same
+		// order. Truncated, when provided, is set to whether the deadline cut
+		// the results short, which callers must check to tell a partial page
+		// from a complete one.
+		Deadline  time.Time
+		Truncated *bool
+		// DedupeKeyFn, when provided, derives a key from each decoded value
+		// and only the first value with a given key is captured; later values
+		// with the same key are skipped as though filtered out. Every distinct
+		// key is held in memory for the duration of the Find, so memory grows
+		// with the number of distinct results.
+		DedupeKeyFn func(decodedVal interface{}) []byte
+		// OrgPolicyFn, when provided, skips the entities of organizations for
+		// which it returns false, as though they did not exist. It is applied
+		// before the Offset and Limit, and an entity must pass both it and the
+		// FilterEntFn to be captured. The organization of each entity is found
+		// with the store's WithOrgKeyPrefix or WithOrgIDFn configuration, one of
+		// which is required.
+		OrgPolicyFn func(orgID influxdb.ID) bool
+		// OnDecodeError decides what becomes of values that fail to decode.
+		// With DecodeErrorSkip they are skipped rather than failing the Find,
+		// and a Find quarantines them when the store has a quarantine.
+		OnDecodeError DecodeErrorPolicy
+		// BatchCaptureFn is an alternative to CaptureFn and IndexedCaptureFn,
+		// which may not be combined with it, that is provided the results in
+		// batches of up to BatchSize at a time, amortizing the work done per
+		// result. The final batch, holding whatever remains, is provided once
+		// the scan ends; should the Find fail, the results not yet provided
+		// are dropped. A BatchSize of zero uses DefaultBatchSize.
+		BatchCaptureFn func(batch []KV) error
+		BatchSize      int
+
+		// onSkip is provided the raw pairs skipped for failing to decode.
+		onSkip func(k, v []byte)
+		// retain is set by the finds that hold on to decoded values beyond
+		// their capture, so they are never returned to a decode pool.
+		retain bool
+	}
+
+	// FindStats reports how much work a Find call did to produce its results. A
+	// large gap between keys scanned and keys emitted indicates a query that would
+	// benefit from a prefix or an index.
+	FindStats struct {
+		KeysScanned  int
+		KeysFiltered int
+		KeysEmitted  int
+		BytesDecoded int64
 	}
 
 	// FindCaptureFn is the mechanism for closing over the key and decoded value pair
 	// for adding results to the call sites collection. This generic implementation allows
 	// it to be reused. The returned decodedVal should always satisfy whatever decoding
 	// of the bucket value was set on the storeo that calls Find.
+	// The decodedVal is passed through exactly as returned by the store's
+	// DecodeBucketValFn; Find never runs the ConvertValToEntFn, so list paths
+	// do not pay for the conversion to an Entity.
 	FindCaptureFn func(key []byte, decodedVal interface{}) error
 
+	// FindIndexedCaptureFn is a FindCaptureFn that is provided the index of the
+	// result being captured.
+	FindIndexedCaptureFn func(idx int, key []byte, decodedVal interface{}) error
+
 	// FilterFn will provide an indicator to the Find or Delete calls that the entity that
 	// was seen is one that is valid and should be either captured or deleted (depending on
 	// the caller of the filter func).
@@ -223,45 +661,304 @@ type (
 // Find provides a mechanism for looking through the bucket via
 // the set options. When a prefix is provided, the prefix is used to
 // seek the bucket.
-func (s *StoreBase) Find(ctx context.Context, tx Tx, opts FindOpts) error {
+func (s *StoreBase) Find(ctx context.Context, tx Tx, opts FindOpts) (err error) {
 	span, ctx := s.startSpan(ctx)
 	defer span.Finish()
 
+	var rows int
+	defer func(start time.Time) { s.observe(metricsOpFind, "Find", start, rows, err) }(time.Now())
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
+
+	if captureFn := opts.CaptureFn; captureFn != nil {
+		opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+			rows++
+			return captureFn(key, decodedVal)
+		}
+	} else if captureFn := opts.IndexedCaptureFn; captureFn != nil {
+		opts.IndexedCaptureFn = func(idx int, key []byte, decodedVal interface{}) error {
+			rows++
+			return captureFn(idx, key, decodedVal)
+		}
+	} else if captureFn := opts.BatchCaptureFn; captureFn != nil {
+		opts.BatchCaptureFn = func(batch []KV) error {
+			rows += len(batch)
+			return captureFn(batch)
+		}
+	}
+
+	if err := s.throttle(ctx); err != nil {
+		return err
+	}
+	return s.find(ctx, tx, opts)
+}
+
+func (s *StoreBase) find(ctx context.Context, tx Tx, opts FindOpts) error {
+	if err := s.validateFindOpts(opts); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	cur, err := s.bucketCursor(ctx, tx)
 	if err != nil {
+		if s.isMissingBucket(err) {
+			return s.findEmpty(opts)
+		}
+		return err
+	}
+
+	if opts.OnDecodeError != DecodeErrorSkip || s.quarantineBktName == nil {
+		return s.findCursor(ctx, cur, opts)
+	}
+
+	var skipped []Pair
+	opts.onSkip = func(k, v []byte) {
+		skipped = append(skipped, Pair{Key: copyBytes(k), Value: copyBytes(v)})
+	}
+	if err := s.findCursor(ctx, cur, opts); err != nil {
 		return err
 	}
+	return s.quarantine(ctx, tx, skipped)
+}
+
+// findEmpty returns the result of a Find that captured nothing.
+func (s *StoreBase) findEmpty(opts FindOpts) error {
+	if !opts.ErrorOnEmpty {
+		return nil
+	}
+	return &influxdb.Error{
+		Code: influxdb.ENotFound,
+		Msg:  fmt.Sprintf("no %s found", s.Resource),
+	}
+}
+
+// findCursor runs the Find over the provided cursor, which ranges over values
+// encoded by this store.
+func (s *StoreBase) findCursor(ctx context.Context, cur Cursor, opts FindOpts) error {
+	return s.findCursorDec(ctx, cur, opts, s.decodeFn(), s.releaseFn(opts))
+}
+
+// findCursorDec runs the Find over the provided cursor, decoding its values with
+// decFn. Each decoded value is passed to releaseFn, when provided, once the Find
+// is done with it.
+func (s *StoreBase) findCursorDec(ctx context.Context, cur Cursor, opts FindOpts, decFn DecodeBucketValFn, releaseFn func(decodedVal interface{})) error {
+	if opts.BatchCaptureFn != nil {
+		return s.findCursorBatches(ctx, cur, opts, decFn)
+	}
+	opts = s.namespaceFindOpts(opts)
 
 	iter := &iterator{
 		cursor:     cur,
-		descending: opts.Descending,
+		descending: s.descending(opts),
 		limit:      opts.Limit,
 		offset:     opts.Offset,
 		prefix:     opts.Prefix,
-		decodeFn:   s.DecodeEntFn,
+		after:      opts.After,
+		stopFn:     opts.StopFn,
+		deadline:   opts.Deadline,
+		maxScan:    s.maxScan(opts),
+		decodeFn:   decFn,
 		filterFn:   opts.FilterEntFn,
+		dedupeFn:   opts.DedupeKeyFn,
+		releaseFn:  releaseFn,
+	}
+	if opts.OnDecodeError == DecodeErrorSkip {
+		iter.skipFn = func(k, v []byte) {}
+		if opts.onSkip != nil {
+			iter.skipFn = opts.onSkip
+		}
+	}
+	if opts.OrgPolicyFn != nil {
+		iter.orgPolicyFn = s.orgPolicyFn(opts.OrgPolicyFn)
+	}
+	if opts.Stats != nil {
+		*opts.Stats = FindStats{}
+		iter.decodeFn, iter.filterFn = opts.Stats.instrument(iter.decodeFn, iter.filterFn)
 	}
 
-	for k, v, err := iter.Next(ctx); k != nil; k, v, err = iter.Next(ctx) {
+	if opts.Truncated != nil {
+		*opts.Truncated = false
+	}
+
+	var idx int
+	for {
+		k, v, err := iter.Next(ctx)
 		if err != nil {
 			return err
 		}
-		if err := opts.CaptureFn(k, v); err != nil {
+		if k == nil {
+			if iter.truncated {
+				if opts.Truncated != nil {
+					*opts.Truncated = true
+				}
+				return nil
+			}
+			if idx == 0 {
+				return s.findEmpty(opts)
+			}
+			return nil
+		}
+		if opts.Stats != nil {
+			opts.Stats.KeysEmitted++
+		}
+		if err := opts.capture(idx, k, v); err != nil {
+			return err
+		}
+		iter.release(v)
+		idx++
+	}
+}
+
+// findCursorBatches runs the Find over the provided cursor, providing its results
+// to the BatchCaptureFn in batches. The values of a batch are held beyond their
+// capture, so none is released.
+func (s *StoreBase) findCursorBatches(ctx context.Context, cur Cursor, opts FindOpts, decFn DecodeBucketValFn) error {
+	size := opts.BatchSize
+	if size == 0 {
+		size = DefaultBatchSize
+	}
+
+	batchFn := opts.BatchCaptureFn
+	batch := make([]KV, 0, size)
+	opts.BatchCaptureFn = nil
+	opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+		batch = append(batch, KV{Key: copyBytes(key), Val: decodedVal})
+		if len(batch) < size {
+			return nil
+		}
+		err := batchFn(batch)
+		batch = make([]KV, 0, size)
+		return err
+	}
+
+	if err := s.findCursorDec(ctx, cur, opts, decFn, nil); err != nil {
+		return err
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return batchFn(batch)
+}
+
+func (s *StoreBase) validateFindOpts(opts FindOpts) error {
+	if opts.Limit < 0 {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("find %s limit must not be negative; got %d", s.Resource, opts.Limit),
+		}
+	}
+	if opts.Offset < 0 {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("find %s offset must not be negative; got %d", s.Resource, opts.Offset),
+		}
+	}
+	if opts.BatchSize < 0 {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("find %s batch size must not be negative; got %d", s.Resource, opts.BatchSize),
+		}
+	}
+	if opts.BatchCaptureFn != nil && (opts.CaptureFn != nil || opts.IndexedCaptureFn != nil) {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("find %s may capture results in batches or one at a time, not both", s.Resource),
+		}
+	}
+	if opts.OrgPolicyFn != nil && !s.orgKeyPrefix && s.orgIDFn == nil {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("find %s with an org policy requires a store that can find the organization of an entity", s.Resource),
+		}
+	}
+	return nil
+}
+
+func (o FindOpts) capture(idx int, k []byte, v interface{}) error {
+	if o.CaptureFn != nil {
+		if err := o.CaptureFn(k, v); err != nil {
 			return err
 		}
 	}
+	if o.IndexedCaptureFn != nil {
+		return o.IndexedCaptureFn(idx, k, v)
+	}
 	return nil
 }
 
+func (f *FindStats) instrument(decFn DecodeBucketValFn, filterFn FilterFn) (DecodeBucketValFn, FilterFn) {
+	instDecFn := func(key, val []byte) ([]byte, interface{}, error) {
+		if len(key) > 0 {
+			f.KeysScanned++
+			f.BytesDecoded += int64(len(val))
+		}
+		return decFn(key, val)
+	}
+	if filterFn == nil {
+		return instDecFn, nil
+	}
+
+	instFilterFn := func(key []byte, decodedVal interface{}) bool {
+		if !filterFn(key, decodedVal) {
+			f.KeysFiltered++
+			return false
+		}
+		return true
+	}
+	return instDecFn, instFilterFn
+}
+
+// CountByPrefix returns the number of keys in the bucket that begin with the provided
+// prefix. Values are never decoded and iteration stops at the first key past the
+// prefix, making this cheap even in large multi-tenant buckets.
+func (s *StoreBase) CountByPrefix(ctx context.Context, tx Tx, prefix []byte) (int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	prefix = s.withNamespace(prefix)
+	var n int
+	for k, _ := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cur.Next() {
+		n++
+	}
+	return n, nil
+}
+
+func (s *StoreBase) maxScan(opts FindOpts) int {
+	if opts.MaxScan > 0 {
+		return opts.MaxScan
+	}
+	return s.defaultMaxScan
+}
+
+func (s *StoreBase) descending(opts FindOpts) bool {
+	if opts.Descending {
+		return true
+	}
+	return s.naturalDescending && !opts.Ascending
+}
+
 // FindEnt returns the decoded entity body via the provided entity.
 // An example entity should not include a Body, but rather the ID,
 // Name, or OrgID.
-func (s *StoreBase) FindEnt(ctx context.Context, tx Tx, ent Entity) (interface{}, error) {
+func (s *StoreBase) FindEnt(ctx context.Context, tx Tx, ent Entity) (_ interface{}, err error) {
 	span, ctx := s.startSpan(ctx)
 	defer span.Finish()
+	defer func(start time.Time) { s.observe(metricsOpFind, "FindEnt", start, 0, err) }(time.Now())
+
+	if err := s.checkTx(tx); err != nil {
+		return nil, err
+	}
 
 	encodedID, err := s.EntKey(ctx, ent)
 	if err != nil {
@@ -269,7 +966,11 @@ func (s *StoreBase) FindEnt(ctx context.Context, tx Tx, ent Entity) (interface{}
 		return nil, err
 	}
 
-	body, err := s.bucketGet(ctx, tx, encodedID)
+	return s.findByKey(ctx, tx, encodedID)
+}
+
+func (s *StoreBase) findByKey(ctx context.Context, tx Tx, key []byte) (interface{}, error) {
+	body, err := s.bucketGet(ctx, tx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -277,6 +978,192 @@ func (s *StoreBase) FindEnt(ctx context.Context, tx Tx, ent Entity) (interface{}
 	return s.decodeEnt(ctx, body)
 }
 
+// PeekRaw returns the value stored for the ID exactly as it is held in the bucket,
+// without running it through the store's decoders, or a not found error when the
+// ID is absent. Any metadata framing is left in place. The returned slice is a copy
+// that is safe to retain after the transaction closes.
+func (s *StoreBase) PeekRaw(ctx context.Context, tx Tx, id influxdb.ID) ([]byte, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	key, err := s.EntKey(ctx, Entity{PK: EncID(id)})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := s.bucketGet(ctx, tx, key)
+	if err != nil {
+		return nil, err
+	}
+	return copyBytes(body), nil
+}
+
+// FindEntMap returns the decoded bodies of the entities found for the provided IDs,
+// keyed by ID. IDs with no stored entity are absent from the map rather than
+// reported as errors. Being a map, no ordering of the results is implied.
+func (s *StoreBase) FindEntMap(ctx context.Context, tx Tx, ids ...influxdb.ID) (map[influxdb.ID]interface{}, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	ents := make(map[influxdb.ID]interface{}, len(ids))
+	if len(ids) == 0 {
+		return ents, nil
+	}
+
+	keys := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		key, err := s.EntKey(ctx, Entity{PK: EncID(id)})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return ents, nil
+		}
+		return nil, err
+	}
+
+	vals, err := b.GetBatch(keys...)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Err:  err,
+		}
+	}
+
+	for i, val := range vals {
+		if val == nil {
+			continue
+		}
+		v, err := s.decodeEnt(ctx, val)
+		if err != nil {
+			return nil, err
+		}
+		ents[ids[i]] = v
+	}
+	return ents, nil
+}
+
+// KV is a key and its decoded value as found in a store.
+type KV struct {
+	Key []byte
+	Val interface{}
+}
+
+// FindPairs runs a Find returning the key and decoded value of each result, in the
+// order found. The keys are copied, so they remain valid after the transaction.
+// Any CaptureFn on the options still runs after the pair is appended.
+func (s *StoreBase) FindPairs(ctx context.Context, tx Tx, opts FindOpts) ([]KV, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	var pairs []KV
+	opts.retain = true
+	captureFn := opts.CaptureFn
+	opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+		pairs = append(pairs, KV{
+			Key: append([]byte(nil), key...),
+			Val: decodedVal,
+		})
+		if captureFn != nil {
+			return captureFn(key, decodedVal)
+		}
+		return nil
+	}
+
+	if err := s.Find(ctx, tx, opts); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// FindOne returns the decoded value of the single entity matching the options,
+// i.e. the one foo passing a filter. It fails with a not found error when none
+// match and with EMultipleResults when more than one does. The scan stops at the
+// second match, and the options' Limit and capture functions are ignored.
+func (s *StoreBase) FindOne(ctx context.Context, tx Tx, opts FindOpts) (interface{}, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	var (
+		found interface{}
+		n     int
+	)
+	opts.Limit = 2
+	opts.ErrorOnEmpty = false
+	opts.retain = true
+	opts.IndexedCaptureFn = nil
+	opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+		found = decodedVal
+		n++
+		return nil
+	}
+	if err := s.Find(ctx, tx, opts); err != nil {
+		return nil, err
+	}
+
+	switch n {
+	case 0:
+		return nil, &influxdb.Error{
+			Code: influxdb.ENotFound,
+			Msg:  fmt.Sprintf("%s not found", s.Resource),
+		}
+	case 1:
+		return found, nil
+	default:
+		return nil, &influxdb.Error{
+			Code: influxdb.EMultipleResults,
+			Msg:  fmt.Sprintf("more than one %s matched where one was expected", s.Resource),
+		}
+	}
+}
+
+// FindSortedBy returns the decoded values of the entities matching the options
+// ordered by less rather than by key, i.e. by name. Every match is buffered and
+// sorted before the options' Offset and Limit select the page returned, so results
+// are not streamed and memory grows with the number of matches. It is meant for
+// result sets bounded by a prefix or filter; a MaxScan on the options bounds the
+// work done. The sort is stable, so values less considers equal keep their key
+// order. The options' capture functions are ignored.
+func (s *StoreBase) FindSortedBy(ctx context.Context, tx Tx, less func(a, b interface{}) bool, opts FindOpts) ([]interface{}, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.validateFindOpts(opts); err != nil {
+		return nil, err
+	}
+	offset, limit := opts.Offset, opts.Limit
+
+	var vals []interface{}
+	opts.Offset, opts.Limit = 0, 0
+	opts.retain = true
+	opts.IndexedCaptureFn = nil
+	opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+		vals = append(vals, decodedVal)
+		return nil
+	}
+	if err := s.Find(ctx, tx, opts); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(vals, func(i, j int) bool {
+		return less(vals[i], vals[j])
+	})
+
+	if offset >= len(vals) {
+		return []interface{}{}, nil
+	}
+	vals = vals[offset:]
+	if limit > 0 && limit < len(vals) {
+		vals = vals[:limit]
+	}
+	return vals, nil
+}
+
 type (
 	putOption struct {
 		isNew    bool
@@ -307,9 +1194,18 @@ func PutUpdate() PutOptionFn {
 }
 
 // Put will persist the entity.
-func (s *StoreBase) Put(ctx context.Context, tx Tx, ent Entity, opts ...PutOptionFn) error {
+func (s *StoreBase) Put(ctx context.Context, tx Tx, ent Entity, opts ...PutOptionFn) (err error) {
 	span, ctx := s.startSpan(ctx)
 	defer span.Finish()
+	defer func(start time.Time) { s.observe(metricsOpPut, "Put", start, 0, err) }(time.Now())
+
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
+
+	if err := s.throttle(ctx); err != nil {
+		return err
+	}
 
 	var opt putOption
 	for _, o := range opts {
@@ -330,12 +1226,324 @@ func (s *StoreBase) Put(ctx context.Context, tx Tx, ent Entity, opts ...PutOptio
 		return err
 	}
 
+	return s.put(ctx, tx, encodedID, ent)
+}
+
+// PutRaw persists the entity under the provided key, bypassing the store's key
+// encoder. The body encoder and index maintenance still apply. This is an escape
+// hatch for keys computed outside of the store, i.e. reversed time keys or keys
+// supplied externally. The caller is responsible for the uniqueness of the key and
+// for it ordering correctly amongst the keys produced by the key encoder.
+func (s *StoreBase) PutRaw(ctx context.Context, tx Tx, key []byte, ent Entity) (err error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+	defer func(start time.Time) { s.observe(metricsOpPut, "PutRaw", start, 0, err) }(time.Now())
+
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
+
+	if err := s.throttle(ctx); err != nil {
+		return err
+	}
+
+	if len(key) == 0 {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("no key was provided for %s", s.Resource),
+		}
+	}
+	return s.put(ctx, tx, key, ent)
+}
+
+// PutIfChanged puts the entity only when its encoded body differs from the body
+// currently stored for it, reporting whether a write happened. Both bodies are
+// produced by the store's body encoder, so an entity whose encoding is unchanged is
+// never rewritten, sparing idempotent sync loops needless writes and hooks.
+func (s *StoreBase) PutIfChanged(ctx context.Context, tx Tx, ent Entity) (bool, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.checkTx(tx); err != nil {
+		return false, err
+	}
+	if err := s.throttle(ctx); err != nil {
+		return false, err
+	}
+
+	key, err := s.EntKey(ctx, ent)
+	if err != nil {
+		return false, err
+	}
+
+	body, err := s.encodeEnt(ctx, ent, s.EncodeEntBodyFn)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := s.bucketGet(ctx, tx, key)
+	if err != nil && influxdb.ErrorCode(err) != influxdb.ENotFound {
+		return false, err
+	}
+	if current != nil {
+		f, err := s.unframe(current)
+		if err != nil {
+			return false, err
+		}
+		if bytes.Equal(f.body, body) {
+			return false, nil
+		}
+	}
+
+	if err := s.putBody(ctx, tx, key, ent, body); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UpsertMany puts each of the entities, creating those whose key is absent and
+// updating those already stored, and reports how many of each it wrote. Existence is
+// checked against the raw bucket without decoding, and the bucket is resolved once
+// for the batch. Stores with indexes, hooks or metadata still maintain them for every
+// entity. The first entity failing to encode or write stops the upsert with an
+// error naming its index in ents, and the counts returned are of the entities
+// written before it, which the caller should discard along with the transaction.
+func (s *StoreBase) UpsertMany(ctx context.Context, tx Tx, ents ...Entity) (created int, updated int, err error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.checkTx(tx); err != nil {
+		return 0, 0, err
+	}
+	if err := s.checkWritable(); err != nil {
+		return 0, 0, err
+	}
+	if err := s.throttle(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	plain := len(s.indexes) == 0 && s.onPut == nil && !s.framed() && s.seqBktName == nil && len(s.references) == 0 && s.projection == nil
+
+	for i, ent := range ents {
+		exists, err := s.upsert(ctx, tx, b, ent, plain)
+		if err != nil {
+			return created, updated, &influxdb.Error{
+				Code: influxdb.ErrorCode(err),
+				Msg:  fmt.Sprintf("failed to upsert %s at index %d", s.Resource, i),
+				Err:  err,
+			}
+		}
+		if exists {
+			updated++
+		} else {
+			created++
+		}
+	}
+	return created, updated, nil
+}
+
+// upsert puts the entity in the store's resolved bucket, reporting whether its key
+// was already present. Plain stores, with nothing to maintain beside the value
+// itself, write straight to the bucket.
+func (s *StoreBase) upsert(ctx context.Context, tx Tx, b Bucket, ent Entity, plain bool) (bool, error) {
+	key, err := s.EntKey(ctx, ent)
+	if err != nil {
+		return false, err
+	}
+	body, err := s.encodeEnt(ctx, ent, s.EncodeEntBodyFn)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = b.Get(key)
+	if err != nil && !IsNotFound(err) {
+		return false, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Err:  err,
+		}
+	}
+	exists := err == nil
+
+	if plain {
+		if err := s.checkKeySize(key); err != nil {
+			return false, err
+		}
+		if err := s.checkSchema(body); err != nil {
+			return false, err
+		}
+		return exists, s.putInBucket(b, key, body)
+	}
+	return exists, s.putBody(ctx, tx, key, ent, body)
+}
+
+func (s *StoreBase) put(ctx context.Context, tx Tx, key []byte, ent Entity) error {
 	body, err := s.encodeEnt(ctx, ent, s.EncodeEntBodyFn)
 	if err != nil {
 		return err
 	}
+	return s.putBody(ctx, tx, key, ent, body)
+}
+
+// checkKeySize fails when the key exceeds the store's maximum key size.
+func (s *StoreBase) checkKeySize(key []byte) error {
+	max := s.maxKeyBytes
+	if max <= 0 {
+		max = DefaultMaxKeyBytes
+	}
+	if len(key) > max {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s key of %d bytes exceeds the maximum of %d bytes", s.Resource, len(key), max),
+		}
+	}
+	return nil
+}
+
+// putBody persists the entity under key with its already encoded body.
+func (s *StoreBase) putBody(ctx context.Context, tx Tx, key []byte, ent Entity, body []byte) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	if err := s.checkKeySize(key); err != nil {
+		return err
+	}
+	if err := s.checkSchema(body); err != nil {
+		return err
+	}
+	if err := s.checkReferences(ctx, tx, ent); err != nil {
+		return err
+	}
+	kind, err := s.entKind(ent)
+	if err != nil {
+		return err
+	}
+
+	var prevVal interface{}
+	if len(s.indexes) > 0 || s.onPut != nil {
+		prevVal, err = s.findByKey(ctx, tx, key)
+		if err != nil && influxdb.ErrorCode(err) != influxdb.ENotFound {
+			return err
+		}
+	}
+
+	if err := s.putIndexes(ctx, tx, key, ent, prevVal); err != nil {
+		return err
+	}
+
+	body, err = s.frameBody(ctx, tx, key, kind, body)
+	if err != nil {
+		return err
+	}
+	if err := s.bucketPut(ctx, tx, key, body); err != nil {
+		return err
+	}
+	if err := s.putProjection(ctx, tx, key, ent); err != nil {
+		return err
+	}
+	if err := s.putSeq(ctx, tx, key); err != nil {
+		return err
+	}
+	return s.notifyPut(ctx, key, body, prevVal)
+}
+
+func (s *StoreBase) notifyPut(ctx context.Context, key, body []byte, prevVal interface{}) error {
+	if s.onPut == nil {
+		return nil
+	}
+
+	newVal, err := s.decodeEnt(ctx, body)
+	if err != nil {
+		return err
+	}
+	return s.onPut(key, newVal, prevVal)
+}
+
+// GetOrCreate returns the decoded body of the existing entity when found. Otherwise
+// the entity returned by createFn is persisted and its decoded body is returned,
+// along with true to indicate it was created. The lookup and the create happen
+// within the provided transaction.
+func (s *StoreBase) GetOrCreate(ctx context.Context, tx Tx, ent Entity, createFn func() Entity) (interface{}, bool, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	existing, err := s.FindEnt(ctx, tx, ent)
+	if err == nil {
+		return existing, false, nil
+	}
+	if influxdb.ErrorCode(err) != influxdb.ENotFound {
+		return nil, false, err
+	}
+
+	newEnt := createFn()
+	if err := s.Put(ctx, tx, newEnt, PutNew()); err != nil {
+		return nil, false, err
+	}
+
+	created, err := s.FindEnt(ctx, tx, newEnt)
+	if err != nil {
+		return nil, false, err
+	}
+	return created, true, nil
+}
+
+// PatchFn receives the current decoded body of an entity and returns the updated
+// body to be persisted in its place.
+type PatchFn func(current interface{}) (interface{}, error)
+
+// Patch reads the entity for the provided id, applies the patch func to its decoded
+// body, and persists the result, all within the provided transaction. The updated
+// body is returned. When the entity does not exist a not found error is returned.
+// The patched body may not change the key of the entity.
+func (s *StoreBase) Patch(ctx context.Context, tx Tx, id influxdb.ID, patchFn PatchFn) (interface{}, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	key, err := s.EntKey(ctx, Entity{PK: EncID(id)})
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.FindEnt(ctx, tx, Entity{PK: EncID(id)})
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := patchFn(current)
+	if err != nil {
+		return nil, err
+	}
+
+	ent, err := s.ConvertValToEntFn(key, updated)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("failed to convert patched %s", s.Resource),
+			Err:  err,
+		}
+	}
+	if ent.Body == nil {
+		ent.Body = updated
+	}
+
+	newKey, err := s.EntKey(ctx, ent)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(key, newKey) {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("patching %s may not change its key", s.Resource),
+		}
+	}
 
-	return s.bucketPut(ctx, tx, encodedID, body)
+	if err := s.Put(ctx, tx, ent); err != nil {
+		return nil, err
+	}
+	return updated, nil
 }
 
 func (s *StoreBase) putValidate(ctx context.Context, tx Tx, ent Entity, opt putOption) error {
@@ -346,7 +1554,10 @@ func (s *StoreBase) putValidate(ctx context.Context, tx Tx, ent Entity, opt putO
 		return nil
 	}
 
-	_, err := s.FindEnt(ctx, tx, ent)
+	key, err := s.EntKey(ctx, ent)
+	if err == nil {
+		_, err = s.findByKey(ctx, tx, key)
+	}
 	if opt.isNew {
 		if err == nil || influxdb.ErrorCode(err) != influxdb.ENotFound {
 			return &influxdb.Error{
@@ -360,21 +1571,72 @@ func (s *StoreBase) putValidate(ctx context.Context, tx Tx, ent Entity, opt putO
 	return err
 }
 
+// checkTx fails when no transaction is provided, as when a caller passes a nil Tx,
+// which would otherwise panic or fail with a confusing low level error.
+func (s *StoreBase) checkTx(tx Tx) error {
+	if tx == nil {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s operation requires an open transaction", s.Resource),
+		}
+	}
+	return nil
+}
+
 func (s *StoreBase) bucket(ctx context.Context, tx Tx) (Bucket, error) {
 	span, _ := tracing.StartSpanFromContext(ctx)
 	defer span.Finish()
 
+	if err := s.checkTx(tx); err != nil {
+		return nil, err
+	}
 	bkt, err := tx.Bucket(s.BktName)
+	if iErr, ok := err.(*influxdb.Error); ok {
+		// the tx has already explained why the bucket is unavailable
+		return nil, iErr
+	}
+	if err == ErrTxNotWritable {
+		// a read only tx cannot create the bucket, so it has yet to be created
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s bucket %q is missing; the store must be initialized with Init before use", s.Resource, string(s.BktName)),
+			Err:  &bucketMissingError{err: err},
+		}
+	}
 	if err != nil {
 		return nil, &influxdb.Error{
 			Code: influxdb.EInternal,
-			Msg:  fmt.Sprintf("unexpected error retrieving bucket %q; Err %v", string(s.BktName), err),
+			Msg:  fmt.Sprintf("failed to retrieve %s bucket %q", s.Resource, string(s.BktName)),
 			Err:  err,
 		}
 	}
 	return bkt, nil
 }
 
+// bucketMissingError marks the absence of the store's bucket so that stores
+// configured with auto init can treat it as an empty bucket. Any other failure to
+// retrieve the bucket is never marked, so it is reported rather than mistaken for
+// an empty bucket.
+type bucketMissingError struct {
+	err error
+}
+
+func (e *bucketMissingError) Error() string {
+	return e.err.Error()
+}
+
+func (s *StoreBase) isMissingBucket(err error) bool {
+	if !s.autoInit {
+		return false
+	}
+	iErr, ok := err.(*influxdb.Error)
+	if !ok {
+		return false
+	}
+	_, ok = iErr.Err.(*bucketMissingError)
+	return ok
+}
+
 func (s *StoreBase) bucketCursor(ctx context.Context, tx Tx) (Cursor, error) {
 	span, _ := tracing.StartSpanFromContext(ctx)
 	defer span.Finish()
@@ -392,6 +1654,9 @@ func (s *StoreBase) bucketCursor(ctx context.Context, tx Tx) (Cursor, error) {
 			Err:  err,
 		}
 	}
+	if s.namespace != nil {
+		return &namespaceCursor{Cursor: cur, ns: s.namespace}, nil
+	}
 	return cur, nil
 }
 
@@ -401,11 +1666,15 @@ func (s *StoreBase) bucketDelete(ctx context.Context, tx Tx, key []byte) error {
 
 	b, err := s.bucket(ctx, tx)
 	if err != nil {
+		if s.isMissingBucket(err) {
+			return s.errNotFound(key)
+		}
 		return err
 	}
 
 	err = b.Delete(key)
 	if err == nil {
+		s.decodeCache.invalidate(key)
 		return nil
 	}
 
@@ -426,15 +1695,15 @@ func (s *StoreBase) bucketGet(ctx context.Context, tx Tx, key []byte) ([]byte, e
 
 	b, err := s.bucket(ctx, tx)
 	if err != nil {
+		if s.isMissingBucket(err) {
+			return nil, s.errNotFound(key)
+		}
 		return nil, err
 	}
 
 	body, err := b.Get(key)
 	if IsNotFound(err) {
-		return nil, &influxdb.Error{
-			Code: influxdb.ENotFound,
-			Msg:  fmt.Sprintf("%s not found for key %q", s.Resource, string(key)),
-		}
+		return nil, s.errNotFound(key)
 	}
 	if err != nil {
 		return nil, &influxdb.Error{
@@ -446,6 +1715,26 @@ func (s *StoreBase) bucketGet(ctx context.Context, tx Tx, key []byte) ([]byte, e
 	return body, nil
 }
 
+// ErrEntNotFound returns the not found error for the resource and ID provided. Services
+// wrapping stores should use this to produce consistently formatted not found errors.
+func ErrEntNotFound(resource string, id influxdb.ID) *influxdb.Error {
+	return &influxdb.Error{
+		Code: influxdb.ENotFound,
+		Msg:  fmt.Sprintf("%s not found for key %q", resource, id.String()),
+	}
+}
+
+func (s *StoreBase) errNotFound(key []byte) error {
+	var id influxdb.ID
+	if err := id.Decode(key); err == nil && id.String() == string(key) {
+		return ErrEntNotFound(s.Resource, id)
+	}
+	return &influxdb.Error{
+		Code: influxdb.ENotFound,
+		Msg:  fmt.Sprintf("%s not found for key %q", s.Resource, string(key)),
+	}
+}
+
 func (s *StoreBase) bucketPut(ctx context.Context, tx Tx, key, body []byte) error {
 	span, _ := tracing.StartSpanFromContext(ctx)
 	defer span.Finish()
@@ -454,6 +1743,14 @@ func (s *StoreBase) bucketPut(ctx context.Context, tx Tx, key, body []byte) erro
 	if err != nil {
 		return err
 	}
+	return s.putInBucket(b, key, body)
+}
+
+// putInBucket writes the stored value to the already resolved bucket of the store.
+func (s *StoreBase) putInBucket(b Bucket, key, body []byte) error {
+	if fb, ok := b.(FillPercentBucket); ok && s.fillPercent > 0 {
+		fb.SetFillPercent(s.fillPercent)
+	}
 
 	if err := b.Put(key, body); err != nil {
 		return &influxdb.Error{
@@ -461,6 +1758,7 @@ func (s *StoreBase) bucketPut(ctx context.Context, tx Tx, key, body []byte) erro
 			Err:  err,
 		}
 	}
+	s.decodeCache.invalidate(key)
 	return nil
 }
 
@@ -468,7 +1766,10 @@ func (s *StoreBase) decodeEnt(ctx context.Context, body []byte) (interface{}, er
 	span, _ := tracing.StartSpanFromContext(ctx)
 	defer span.Finish()
 
-	_, v, err := s.DecodeEntFn([]byte{}, body) // ignore key here
+	_, v, err := s.decodeFn()([]byte{}, body) // ignore key here
+	if influxdb.ErrorCode(err) == influxdb.EDataCorruption {
+		return nil, err
+	}
 	if err != nil {
 		return nil, &influxdb.Error{
 			Code: influxdb.EInternal,
@@ -479,6 +1780,26 @@ func (s *StoreBase) decodeEnt(ctx context.Context, body []byte) (interface{}, er
 	return v, nil
 }
 
+func (s *StoreBase) decodeFn() DecodeBucketValFn {
+	decFn := s.DecodeEntFn
+	if s.decodeCache != nil {
+		decFn = s.decodeCache.wrap(decFn)
+	}
+	if s.framed() {
+		decFn = s.unframeFn(decFn)
+	}
+	if s.readTransform == nil {
+		return decFn
+	}
+	return func(key, val []byte) ([]byte, interface{}, error) {
+		k, v, err := decFn(key, val)
+		if err != nil {
+			return k, v, err
+		}
+		return k, s.readTransform(v), nil
+	}
+}
+
 func (s *StoreBase) encodeEnt(ctx context.Context, ent Entity, fn EncodeEntFn) ([]byte, error) {
 	span, _ := tracing.StartSpanFromContext(ctx)
 	defer span.Finish()
@@ -516,18 +1837,38 @@ type iterator struct {
 	limit      int
 	offset     int
 	prefix     []byte
+	after      []byte
+	stopFn     func(key []byte) bool
+	stopped    bool
+	deadline   time.Time
+	truncated  bool
+	maxScan    int
+	scanned    int
 
 	nextFn func() (key, val []byte)
 
 	decodeFn func(key, val []byte) (k []byte, decodedVal interface{}, err error)
 	filterFn FilterFn
+
+	dedupeFn func(decodedVal interface{}) []byte
+	seen     map[string]struct{}
+
+	orgPolicyFn func(key []byte, decodedVal interface{}) (bool, error)
+	releaseFn   func(decodedVal interface{})
+	skipFn      func(k, v []byte)
+}
+
+func (i *iterator) release(decodedVal interface{}) {
+	if i.releaseFn != nil {
+		i.releaseFn(decodedVal)
+	}
 }
 
 func (i *iterator) Next(ctx context.Context) (key []byte, val interface{}, err error) {
 	span, _ := tracing.StartSpanFromContext(ctx)
 	defer span.Finish()
 
-	if i.limit > 0 && i.counter >= i.limit+i.offset {
+	if i.stopped || i.truncated || (i.limit > 0 && i.counter >= i.limit+i.offset) {
 		return nil, nil, nil
 	}
 
@@ -535,6 +1876,8 @@ func (i *iterator) Next(ctx context.Context) (key []byte, val interface{}, err e
 	switch {
 	case i.nextFn != nil:
 		k, vRaw = i.nextFn()
+	case len(i.after) > 0:
+		k, vRaw = i.seekAfter()
 	case len(i.prefix) > 0:
 		k, vRaw = i.cursor.Seek(i.prefix)
 		i.nextFn = i.cursor.Next
@@ -546,16 +1889,72 @@ func (i *iterator) Next(ctx context.Context) (key []byte, val interface{}, err e
 		i.nextFn = i.cursor.Next
 	}
 
-	k, decodedVal, err := i.decodeFn(k, vRaw)
-	for ; ; k, decodedVal, err = i.decodeFn(i.nextFn()) {
+	for ; len(k) > 0; k, vRaw = i.nextFn() {
+		if i.stopFn != nil && i.stopFn(k) {
+			i.stopped = true
+			return nil, nil, nil
+		}
+
+		if !i.deadline.IsZero() && !time.Now().Before(i.deadline) {
+			i.truncated = true
+			return nil, nil, nil
+		}
+
+		if i.maxScan > 0 {
+			if i.scanned >= i.maxScan {
+				return nil, nil, &influxdb.Error{
+					Code: influxdb.ETooLarge,
+					Msg:  fmt.Sprintf("find aborted after scanning %d keys", i.scanned),
+					Err:  ErrMaxScanExceeded,
+				}
+			}
+			i.scanned++
+		}
+
+		key, decodedVal, err := i.decodeFn(k, vRaw)
 		if err != nil {
+			if i.skipFn != nil {
+				i.skipFn(k, vRaw)
+				continue
+			}
 			return nil, nil, err
 		}
-		if i.isNext(k, decodedVal) {
-			break
+		if i.orgPolicyFn != nil {
+			ok, err := i.orgPolicyFn(key, decodedVal)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !ok {
+				i.release(decodedVal)
+				continue
+			}
+		}
+		if i.isNext(key, decodedVal) {
+			return key, decodedVal, nil
+		}
+		i.release(decodedVal)
+	}
+	return nil, nil, nil
+}
+
+// seekAfter positions the cursor on the first key strictly beyond the after
+// key in the direction of iteration. A seek lands on the first key greater than
+// or equal to the after key, so descending iteration steps back from there.
+func (i *iterator) seekAfter() ([]byte, []byte) {
+	k, v := i.cursor.Seek(i.after)
+	if i.descending {
+		i.nextFn = i.cursor.Prev
+		if k == nil {
+			return i.cursor.Last()
 		}
+		return i.cursor.Prev()
+	}
+
+	i.nextFn = i.cursor.Next
+	if bytes.Equal(k, i.after) {
+		return i.cursor.Next()
 	}
-	return k, decodedVal, nil
+	return k, v
 }
 
 func (i *iterator) isNext(k []byte, v interface{}) bool {
@@ -567,6 +1966,17 @@ func (i *iterator) isNext(k []byte, v interface{}) bool {
 		return false
 	}
 
+	if i.dedupeFn != nil {
+		if i.seen == nil {
+			i.seen = make(map[string]struct{})
+		}
+		dk := string(i.dedupeFn(v))
+		if _, ok := i.seen[dk]; ok {
+			return false
+		}
+		i.seen[dk] = struct{}{}
+	}
+
 	// increase counter here since the entity is a valid ent
 	// and counts towards the total the user is looking for
 	// 	i.e. limit = 5 => 5 valid ents
@@ -0,0 +1,188 @@
+package kv
+
+import (
+	"bytes"
+	"container/list"
+	"hash/fnv"
+	"sync"
+)
+
+// WithDecodeCache enables a memoized decode cache on the store. Decoded values
+// are cached by a hash of the raw bucket value, so repeated reads of unchanged
+// bytes skip the decode func entirely. The cache holds at most size entries and
+// evicts the least recently used entry when full.
+//
+// The cache trades memory for CPU and is only worthwhile for read heavy, write
+// light stores. Cached values are shared between callers, so a decode func that
+// returns pointers must not have those values mutated by callers. The decode func
+// must also derive the value from the raw bytes alone, as the bucket key is not
+// part of the cache key.
+func WithDecodeCache(size int) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		if size <= 0 {
+			return
+		}
+		s.decodeCache = newDecodeCache(size)
+	}
+}
+
+type decodeCacheEntry struct {
+	hash    uint64
+	raw     []byte
+	decoded interface{}
+	// keys are the bucket keys last seen holding the raw value.
+	keys map[string]struct{}
+}
+
+// decodeCache is a size bounded LRU cache of decoded bucket values keyed
+// by the hash of the raw value bytes.
+type decodeCache struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[uint64]*list.Element
+	// keys tracks the hash of the value last seen for a given bucket key so
+	// that writes to that key can drop the stale entry. Only the keys of cached
+	// entries are tracked, each being dropped along with its entry on eviction.
+	keys map[string]uint64
+}
+
+func newDecodeCache(size int) *decodeCache {
+	return &decodeCache{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[uint64]*list.Element),
+		keys:    make(map[string]uint64),
+	}
+}
+
+// wrap returns a decode func that consults the cache before calling decFn.
+func (c *decodeCache) wrap(decFn DecodeBucketValFn) DecodeBucketValFn {
+	return func(key, val []byte) ([]byte, interface{}, error) {
+		if len(val) == 0 {
+			return decFn(key, val)
+		}
+
+		h := hashBytes(val)
+		if v, ok := c.get(h, val); ok {
+			c.track(key, h)
+			return key, v, nil
+		}
+
+		k, v, err := decFn(key, val)
+		if err != nil {
+			return k, v, err
+		}
+		c.add(key, h, val, v)
+		return k, v, nil
+	}
+}
+
+func (c *decodeCache) get(h uint64, raw []byte) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[h]
+	if !ok {
+		return nil, false
+	}
+	ent := el.Value.(*decodeCacheEntry)
+	// guard against hash collisions
+	if !bytes.Equal(ent.raw, raw) {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return ent.decoded, true
+}
+
+func (c *decodeCache) track(key []byte, h uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.trackLocked(key, h)
+}
+
+// trackLocked records the key as holding the value of the cached entry with the
+// hash, moving it from the entry of the value it held before.
+func (c *decodeCache) trackLocked(key []byte, h uint64) {
+	el, ok := c.entries[h]
+	if len(key) == 0 || !ok {
+		return
+	}
+	if prev, ok := c.keys[string(key)]; ok && prev != h {
+		if prevEl, ok := c.entries[prev]; ok {
+			delete(prevEl.Value.(*decodeCacheEntry).keys, string(key))
+		}
+	}
+	c.keys[string(key)] = h
+	el.Value.(*decodeCacheEntry).keys[string(key)] = struct{}{}
+}
+
+func (c *decodeCache) add(key []byte, h uint64, raw []byte, decoded interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[h]; ok {
+		c.ll.MoveToFront(el)
+		ent := el.Value.(*decodeCacheEntry)
+		ent.raw, ent.decoded = copyBytes(raw), decoded
+		c.trackLocked(key, h)
+		return
+	}
+
+	c.entries[h] = c.ll.PushFront(&decodeCacheEntry{
+		hash:    h,
+		raw:     copyBytes(raw),
+		decoded: decoded,
+		keys:    make(map[string]struct{}),
+	})
+	c.trackLocked(key, h)
+	for c.ll.Len() > c.size {
+		c.removeLocked(c.ll.Back())
+	}
+}
+
+// removeLocked drops the entry from the cache along with the keys tracked for it.
+func (c *decodeCache) removeLocked(el *list.Element) {
+	ent := el.Value.(*decodeCacheEntry)
+	c.ll.Remove(el)
+	delete(c.entries, ent.hash)
+	for key := range ent.keys {
+		delete(c.keys, key)
+	}
+}
+
+// invalidate drops the cached entry for the value last seen under key. It is
+// safe to call on a nil cache.
+func (c *decodeCache) invalidate(key []byte) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok := c.keys[string(key)]
+	if !ok {
+		return
+	}
+	delete(c.keys, string(key))
+	if el, ok := c.entries[h]; ok {
+		c.removeLocked(el)
+	}
+}
+
+func hashBytes(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	out := make([]byte, len(b))
+	copy(out, b)
+	return out
+}
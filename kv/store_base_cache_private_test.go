@@ -0,0 +1,42 @@
+package kv
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDecodeCache_EvictionDropsTrackedKeys(t *testing.T) {
+	c := newDecodeCache(2)
+	decFn := c.wrap(func(key, val []byte) ([]byte, interface{}, error) {
+		return key, string(val), nil
+	})
+	decode := func(key, val string) {
+		t.Helper()
+		if _, _, err := decFn([]byte(key), []byte(val)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		decode(fmt.Sprintf("key_%d", i), fmt.Sprintf("val_%d", i))
+	}
+	if len(c.entries) != 2 || len(c.keys) != 2 {
+		t.Fatalf("expected 2 entries and 2 tracked keys; got %d and %d", len(c.entries), len(c.keys))
+	}
+
+	// a key read with another key's value moves to that value's entry, so
+	// evicting the entry of its old value leaves it tracked
+	decode("key_98", "val_99")
+	decode("key_100", "val_100")
+	if h, ok := c.keys["key_98"]; !ok || h != hashBytes([]byte("val_99")) {
+		t.Fatalf("expected key_98 to be tracked against val_99")
+	}
+	if len(c.entries) != 2 || len(c.keys) != 3 {
+		t.Fatalf("expected 2 entries and 3 tracked keys; got %d and %d", len(c.entries), len(c.keys))
+	}
+
+	c.invalidate([]byte("key_98"))
+	if len(c.entries) != 1 || len(c.keys) != 1 {
+		t.Fatalf("expected 1 entry and 1 tracked key after invalidation; got %d and %d", len(c.entries), len(c.keys))
+	}
+}
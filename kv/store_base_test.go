@@ -3,7 +3,9 @@ package kv_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,132 +16,1571 @@ import (
 )
 
 func TestStoreBase(t *testing.T) {
+	t.Run("bolt", func(t *testing.T) {
+		testStoreBase(t, NewTestBoltStore)
+	})
+	t.Run("inmem", func(t *testing.T) {
+		testStoreBase(t, NewTestInmemStore)
+	})
+}
+
+func testStoreBase(t *testing.T, newKVStore func(t *testing.T) (kv.Store, func(), error)) {
 	newStoreBase := func(t *testing.T, bktSuffix string, encKeyFn, encBodyFn kv.EncodeEntFn, decFn kv.DecodeBucketValFn, decToEntFn kv.ConvertValToEntFn) (*kv.StoreBase, func(), kv.Store) {
 		t.Helper()
 
-		inmemSVC, done, err := NewTestBoltStore(t)
-		require.NoError(t, err)
+		inmemSVC, done, err := newKVStore(t)
+		require.NoError(t, err)
+
+		store := kv.NewStoreBase("foo", []byte("foo_"+bktSuffix), encKeyFn, encBodyFn, decFn, decToEntFn)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		require.NoError(t, inmemSVC.Update(ctx, func(tx kv.Tx) error {
+			return store.Init(ctx, tx)
+		}))
+		return store, done, inmemSVC
+	}
+
+	newFooStoreBase := func(t *testing.T, bktSuffix string) (*kv.StoreBase, func(), kv.Store) {
+		return newStoreBase(t, bktSuffix, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	}
+
+	t.Run("Put", func(t *testing.T) {
+		t.Run("basic", func(t *testing.T) {
+			base, done, kvStore := newFooStoreBase(t, "put")
+			defer done()
+
+			testPutBase(t, kvStore, base, base.BktName)
+		})
+
+		t.Run("new", func(t *testing.T) {
+			base, done, kvStore := newFooStoreBase(t, "put")
+			defer done()
+
+			expected := newFooEnt(3, 33, "name3")
+			update(t, kvStore, func(tx kv.Tx) error {
+				return base.Put(context.TODO(), tx, expected, kv.PutNew())
+			})
+
+			var actual interface{}
+			view(t, kvStore, func(tx kv.Tx) error {
+				f, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: expected.PK})
+				actual = f
+				return err
+			})
+
+			assert.Equal(t, expected.Body, actual)
+		})
+
+		t.Run("update", func(t *testing.T) {
+			base, done, kvStore := newFooStoreBase(t, "put")
+			defer done()
+
+			expected := testPutBase(t, kvStore, base, base.BktName)
+
+			updateEnt := newFooEnt(expected.ID, expected.OrgID, "new name")
+			update(t, kvStore, func(tx kv.Tx) error {
+				return base.Put(context.TODO(), tx, updateEnt, kv.PutUpdate())
+			})
+
+			var actual interface{}
+			view(t, kvStore, func(tx kv.Tx) error {
+				f, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(expected.ID)})
+				actual = f
+				return err
+			})
+
+			expected.Name = "new name"
+			assert.Equal(t, expected, actual)
+		})
+
+		t.Run("error cases", func(t *testing.T) {
+			t.Run("new entity conflicts with existing", func(t *testing.T) {
+				base, done, kvStore := newFooStoreBase(t, "put")
+				defer done()
+
+				expected := testPutBase(t, kvStore, base, base.BktName)
+
+				err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+					entCopy := newFooEnt(expected.ID, expected.OrgID, expected.Name)
+					return base.Put(context.TODO(), tx, entCopy, kv.PutNew())
+				})
+				require.Error(t, err)
+				assert.Equal(t, influxdb.EConflict, influxdb.ErrorCode(err))
+			})
+		})
+
+		t.Run("updating entity that does not exist", func(t *testing.T) {
+			base, done, kvStore := newFooStoreBase(t, "put")
+			defer done()
+
+			expected := testPutBase(t, kvStore, base, base.BktName)
+
+			err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+				// ent by id does not exist
+				entCopy := newFooEnt(333, expected.OrgID, "name1")
+				return base.Put(context.TODO(), tx, entCopy, kv.PutUpdate())
+			})
+			require.Error(t, err)
+			assert.Equal(t, influxdb.ENotFound, influxdb.ErrorCode(err))
+		})
+	})
+
+	t.Run("EncBodyJSONWith", func(t *testing.T) {
+		type body struct {
+			Zeta  string                 `json:"zeta"`
+			Alpha string                 `json:"alpha"`
+			Attrs map[string]interface{} `json:"attrs"`
+		}
+		ent := kv.Entity{Body: body{
+			Zeta:  "<a&b>",
+			Alpha: "a",
+			Attrs: map[string]interface{}{"y": 1, "x": json.Number("12345678901234567890")},
+		}}
+
+		tests := []struct {
+			name     string
+			opts     kv.JSONOpts
+			expected string
+		}{
+			{
+				name:     "defaults match EncBodyJSON",
+				expected: `{"zeta":"\u003ca\u0026b\u003e","alpha":"a","attrs":{"x":12345678901234567890,"y":1}}`,
+			},
+			{
+				name:     "html escape disabled",
+				opts:     kv.JSONOpts{DisableHTMLEscape: true},
+				expected: `{"zeta":"<a&b>","alpha":"a","attrs":{"x":12345678901234567890,"y":1}}`,
+			},
+			{
+				name:     "sorted keys",
+				opts:     kv.JSONOpts{SortKeys: true, DisableHTMLEscape: true},
+				expected: `{"alpha":"a","attrs":{"x":12345678901234567890,"y":1},"zeta":"<a&b>"}`,
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				b, _, err := kv.EncBodyJSONWith(tt.opts)(ent)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, string(b))
+			})
+		}
+
+		def, _, err := kv.EncBodyJSON(ent)
+		require.NoError(t, err)
+		assert.Equal(t, tests[0].expected, string(def))
+	})
+
+	t.Run("PutIfChanged", func(t *testing.T) {
+		kvStore, done, err := newKVStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		var puts int
+		base := kv.NewStoreBase("foo", []byte("foo_put_if_changed"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithOnPut(func(key []byte, newVal, prevVal interface{}) error {
+				puts++
+				return nil
+			}),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+
+		putIfChanged := func(ent kv.Entity) bool {
+			var changed bool
+			update(t, kvStore, func(tx kv.Tx) error {
+				var err error
+				changed, err = base.PutIfChanged(context.TODO(), tx, ent)
+				return err
+			})
+			return changed
+		}
+
+		assert.True(t, putIfChanged(newFooEnt(1, 9000, "foo_1")))
+		assert.False(t, putIfChanged(newFooEnt(1, 9000, "foo_1")))
+		assert.True(t, putIfChanged(newFooEnt(1, 9000, "foo_1_renamed")))
+		assert.Equal(t, 2, puts)
+
+		actual := getEntRaw(t, kvStore, []byte("foo_put_if_changed"), encodeID(t, 1))
+		assert.JSONEq(t, `{"ID":"0000000000000001","OrgID":"0000000000002328","Name":"foo_1_renamed"}`, string(actual))
+	})
+
+	t.Run("PutRaw", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "put_raw")
+		defer done()
+
+		expected := foo{ID: 1, OrgID: 9000, Name: "raw"}
+		rawKey := []byte("custom-key")
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.PutRaw(context.TODO(), tx, rawKey, kv.Entity{Body: expected})
+		})
+
+		var actual foo
+		decodeJSON(t, getEntRaw(t, kvStore, base.BktName, rawKey), &actual)
+		assert.Equal(t, expected, actual)
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.PutRaw(context.TODO(), tx, nil, kv.Entity{Body: expected})
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+
+	t.Run("FindEntMap", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_ent_map")
+		defer done()
+
+		expectedEnts := []kv.Entity{
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+			newFooEnt(3, 9000, "foo_3"),
+		}
+		seedEnts(t, kvStore, base, expectedEnts...)
+
+		var actual map[influxdb.ID]interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			m, err := base.FindEntMap(context.TODO(), tx, 3, 1, 44)
+			actual = m
+			return err
+		})
+
+		expected := map[influxdb.ID]interface{}{
+			1: expectedEnts[0].Body,
+			3: expectedEnts[2].Body,
+		}
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("GetOrCreate", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "get_or_create")
+		defer done()
+
+		expected := newFooEnt(1, 9000, "foo_1")
+		getOrCreate := func(name string) (interface{}, bool) {
+			var (
+				actual  interface{}
+				created bool
+			)
+			update(t, kvStore, func(tx kv.Tx) error {
+				v, ok, err := base.GetOrCreate(context.TODO(), tx, kv.Entity{PK: expected.PK}, func() kv.Entity {
+					return newFooEnt(1, 9000, name)
+				})
+				actual, created = v, ok
+				return err
+			})
+			return actual, created
+		}
+
+		actual, created := getOrCreate("foo_1")
+		assert.True(t, created)
+		assert.Equal(t, expected.Body, actual)
+
+		actual, created = getOrCreate("not used")
+		assert.False(t, created)
+		assert.Equal(t, expected.Body, actual)
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "patch")
+		defer done()
+
+		expected := testPutBase(t, kvStore, base, base.BktName)
+
+		var patched interface{}
+		update(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.Patch(context.TODO(), tx, expected.ID, func(current interface{}) (interface{}, error) {
+				f := current.(foo)
+				f.Name = "patched"
+				return f, nil
+			})
+			patched = v
+			return err
+		})
+
+		expected.Name = "patched"
+		assert.Equal(t, expected, patched)
+
+		var actual foo
+		decodeJSON(t, getEntRaw(t, kvStore, base.BktName, encodeID(t, expected.ID)), &actual)
+		assert.Equal(t, expected, actual)
+
+		t.Run("missing entity", func(t *testing.T) {
+			err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+				_, err := base.Patch(context.TODO(), tx, 333, func(current interface{}) (interface{}, error) {
+					return current, nil
+				})
+				return err
+			})
+			isNotFoundErr(t, err)
+		})
+
+		t.Run("changing the key", func(t *testing.T) {
+			err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+				_, err := base.Patch(context.TODO(), tx, expected.ID, func(current interface{}) (interface{}, error) {
+					f := current.(foo)
+					f.ID = 333
+					return f, nil
+				})
+				return err
+			})
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		})
+	})
+
+	t.Run("DeleteEnt", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "delete_ent")
+		defer done()
+
+		testDeleteEntBase(t, kvStore, base)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		testDeleteBase(t, func(t *testing.T, suffix string) (storeBase, func(), kv.Store) {
+			return newFooStoreBase(t, suffix)
+		})
+	})
+
+	t.Run("OnPut", func(t *testing.T) {
+		kvStore, done, err := newKVStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		type putEvent struct {
+			newVal, prevVal interface{}
+		}
+		var events []putEvent
+		base := kv.NewStoreBase("foo", []byte("foo_on_put"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithOnPut(func(key []byte, newVal, prevVal interface{}) error {
+				events = append(events, putEvent{newVal: newVal, prevVal: prevVal})
+				return nil
+			}),
+		)
+
+		created := newFooEnt(1, 9000, "foo_0")
+		updated := newFooEnt(1, 9000, "foo_0_updated")
+		seedEnts(t, kvStore, base, created, updated)
+
+		err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, newFooEnt(1, 9000, "conflict"), kv.PutNew())
+		})
+		require.Error(t, err)
+
+		assert.Equal(t, []putEvent{
+			{newVal: created.Body},
+			{newVal: updated.Body, prevVal: created.Body},
+		}, events)
+	})
+
+	t.Run("OnDelete", func(t *testing.T) {
+		kvStore, done, err := newKVStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		var deleted []interface{}
+		base := kv.NewStoreBase("foo", []byte("foo_on_delete"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithOnDelete(func(key []byte, deletedVal interface{}) error {
+				deleted = append(deleted, deletedVal)
+				return nil
+			}),
+		)
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9003, "foo_2"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.DeleteEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+		})
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Delete(context.TODO(), tx, kv.DeleteOpts{
+				FilterFn: func(k []byte, v interface{}) bool {
+					return v.(foo).OrgID == 9003
+				},
+			})
+		})
+
+		assert.Equal(t, toIfaces(ents[0], ents[2]), deleted)
+	})
+
+	t.Run("FindEnt", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_ent")
+		defer done()
+
+		testFindEnt(t, kvStore, base)
+
+		t.Run("not found", func(t *testing.T) {
+			err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				_, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(333)})
+				return err
+			})
+			isNotFoundErr(t, err)
+			assert.Equal(t, kv.ErrEntNotFound("foo", 333), err)
+		})
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		testFind(t, func(t *testing.T, suffix string) (storeBase, func(), kv.Store) {
+			return newFooStoreBase(t, suffix)
+		})
+
+		t.Run("does not convert decoded values to entities", func(t *testing.T) {
+			var converted int
+			countingConvFn := func(k []byte, v interface{}) (kv.Entity, error) {
+				converted++
+				return decFooEntFn(k, v)
+			}
+			base, done, kvStore := newStoreBase(t, "find_no_convert", kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, countingConvFn)
+			defer done()
+
+			expectedEnts := []kv.Entity{
+				newFooEnt(1, 9000, "foo_0"),
+				newFooEnt(2, 9000, "foo_1"),
+			}
+			seedEnts(t, kvStore, base, expectedEnts...)
+
+			var actuals []interface{}
+			view(t, kvStore, func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, kv.FindOpts{
+					CaptureFn: func(key []byte, decodedVal interface{}) error {
+						actuals = append(actuals, decodedVal)
+						return nil
+					},
+				})
+			})
+
+			assert.Equal(t, toIfaces(expectedEnts...), actuals)
+			assert.Zero(t, converted)
+		})
+	})
+
+	t.Run("CountByPrefix", func(t *testing.T) {
+		encOrgNameKey := func(ent kv.Entity) ([]byte, string, error) {
+			f := ent.Body.(foo)
+			key, err := kv.EncOrgThenNameKey(f.OrgID, f.Name, f.ID)()
+			return key, "org then name key", err
+		}
+		base, done, kvStore := newStoreBase(t, "count_prefix", encOrgNameKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		defer done()
+
+		seedEnts(t, kvStore, base,
+			newFooEnt(1, 8000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9000, "foo_2"),
+			newFooEnt(4, 9001, "foo_3"),
+		)
+
+		tests := []struct {
+			prefix   []byte
+			expected int
+		}{
+			{prefix: nil, expected: 4},
+			{prefix: encodeID(t, 8000), expected: 1},
+			{prefix: encodeID(t, 9000), expected: 2},
+			{prefix: encodeID(t, 9002), expected: 0},
+		}
+		for _, tt := range tests {
+			view(t, kvStore, func(tx kv.Tx) error {
+				n, err := base.CountByPrefix(context.TODO(), tx, tt.prefix)
+				assert.Equal(t, tt.expected, n, "prefix %q", tt.prefix)
+				return err
+			})
+		}
+	})
+
+	t.Run("Find after cursor", func(t *testing.T) {
+		encOrgNameKey := func(ent kv.Entity) ([]byte, string, error) {
+			f := ent.Body.(foo)
+			key, err := kv.EncOrgThenNameKey(f.OrgID, f.Name, f.ID)()
+			return key, "org then name key", err
+		}
+		base, done, kvStore := newStoreBase(t, "find_after", encOrgNameKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		defer done()
+
+		// listed in key order: org first, then name, then ID
+		ents := []kv.Entity{
+			newFooEnt(5, 8000, "b"),
+			newFooEnt(1, 9000, "a"),
+			newFooEnt(2, 9000, "a_b"),
+			newFooEnt(3, 9000, "ab"),
+			newFooEnt(4, 9001, "a"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		paginate := func(t *testing.T, descending bool) []interface{} {
+			t.Helper()
+
+			var (
+				after   []byte
+				actuals []interface{}
+			)
+			for page := 0; ; page++ {
+				require.True(t, page <= len(ents), "pagination did not terminate")
+
+				var n int
+				view(t, kvStore, func(tx kv.Tx) error {
+					return base.Find(context.TODO(), tx, kv.FindOpts{
+						Descending: descending,
+						Limit:      2,
+						After:      after,
+						CaptureFn: func(key []byte, decodedVal interface{}) error {
+							after = append([]byte(nil), key...)
+							actuals = append(actuals, decodedVal)
+							n++
+							return nil
+						},
+					})
+				})
+				if n == 0 {
+					return actuals
+				}
+			}
+		}
+
+		t.Run("ascending", func(t *testing.T) {
+			assert.Equal(t, toIfaces(ents...), paginate(t, false))
+		})
+
+		t.Run("descending", func(t *testing.T) {
+			assert.Equal(t, reverseSlc(toIfaces(ents...)), paginate(t, true))
+		})
+
+		t.Run("cursor key no longer exists", func(t *testing.T) {
+			// sorts between "a_b" and "ab" within org 9000
+			after, err := kv.EncOrgThenNameKey(9000, "aa", 99)()
+			require.NoError(t, err)
+
+			findAfter := func(descending bool) []interface{} {
+				var actuals []interface{}
+				view(t, kvStore, func(tx kv.Tx) error {
+					return base.Find(context.TODO(), tx, kv.FindOpts{
+						Descending: descending,
+						After:      after,
+						CaptureFn: func(key []byte, decodedVal interface{}) error {
+							actuals = append(actuals, decodedVal)
+							return nil
+						},
+					})
+				})
+				return actuals
+			}
+
+			assert.Equal(t, toIfaces(ents[3:]...), findAfter(false))
+			assert.Equal(t, reverseSlc(toIfaces(ents[:3]...)), findAfter(true))
+		})
+
+		t.Run("descending from past the last key", func(t *testing.T) {
+			var actuals []interface{}
+			view(t, kvStore, func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, kv.FindOpts{
+					Descending: true,
+					After:      []byte{0xff},
+					CaptureFn: func(key []byte, decodedVal interface{}) error {
+						actuals = append(actuals, decodedVal)
+						return nil
+					},
+				})
+			})
+			assert.Equal(t, reverseSlc(toIfaces(ents...)), actuals)
+		})
+
+		t.Run("rows before the cursor deleted between pages", func(t *testing.T) {
+			for _, descending := range []bool{false, true} {
+				base, done, kvStore := newStoreBase(t, "find_after_deletes", encOrgNameKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+				defer done()
+				seedEnts(t, kvStore, base, ents...)
+
+				var (
+					after   []byte
+					emitted []kv.Entity
+					actuals []interface{}
+				)
+				for page := 0; ; page++ {
+					require.True(t, page <= len(ents), "pagination did not terminate")
+
+					var n int
+					view(t, kvStore, func(tx kv.Tx) error {
+						return base.Find(context.TODO(), tx, kv.FindOpts{
+							Descending: descending,
+							Limit:      2,
+							After:      after,
+							CaptureFn: func(key []byte, decodedVal interface{}) error {
+								f := decodedVal.(foo)
+								after = append([]byte(nil), key...)
+								emitted = append(emitted, newFooEnt(f.ID, f.OrgID, f.Name))
+								actuals = append(actuals, decodedVal)
+								n++
+								return nil
+							},
+						})
+					})
+					if n == 0 {
+						break
+					}
+
+					// another writer deletes every row emitted so far, the cursor's
+					// own row included, before the next page is read
+					update(t, kvStore, func(tx kv.Tx) error {
+						for _, ent := range emitted {
+							if err := base.DeleteEnt(context.TODO(), tx, ent); err != nil && influxdb.ErrorCode(err) != influxdb.ENotFound {
+								return err
+							}
+						}
+						return nil
+					})
+				}
+
+				expected := toIfaces(ents...)
+				if descending {
+					expected = reverseSlc(expected)
+				}
+				assert.Equal(t, expected, actuals, "descending=%t", descending)
+			}
+		})
+	})
+
+	t.Run("Find with stop func", func(t *testing.T) {
+		var decoded int
+		countingDecFn := func(key, val []byte) ([]byte, interface{}, error) {
+			if len(val) > 0 {
+				decoded++
+			}
+			return decJSONFooFn(key, val)
+		}
+		base, done, kvStore := newStoreBase(t, "find_stop", kv.EncIDKey, kv.EncBodyJSON, countingDecFn, decFooEntFn)
+		defer done()
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9003, "foo_2"),
+			newFooEnt(4, 9004, "foo_3"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		stopKey := encodeID(t, 3)
+		findUntil := func(opts kv.FindOpts) []interface{} {
+			var actuals []interface{}
+			opts.StopFn = func(key []byte) bool {
+				if opts.Descending {
+					return string(key) < string(stopKey)
+				}
+				return string(key) >= string(stopKey)
+			}
+			opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+				actuals = append(actuals, decodedVal)
+				return nil
+			}
+			view(t, kvStore, func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, opts)
+			})
+			return actuals
+		}
+
+		decoded = 0
+		assert.Equal(t, toIfaces(ents[:2]...), findUntil(kv.FindOpts{}))
+		assert.Equal(t, 2, decoded)
+
+		assert.Equal(t, reverseSlc(toIfaces(ents[2:]...)), findUntil(kv.FindOpts{Descending: true}))
+	})
+
+	t.Run("Find with indexed capture", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_indexed")
+		defer done()
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9003, "foo_2"),
+			newFooEnt(4, 9004, "foo_3"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		var (
+			idxs    []int
+			actuals []interface{}
+		)
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				Offset: 1,
+				Limit:  2,
+				IndexedCaptureFn: func(idx int, key []byte, decodedVal interface{}) error {
+					idxs = append(idxs, idx)
+					actuals = append(actuals, decodedVal)
+					return nil
+				},
+			})
+		})
+
+		assert.Equal(t, []int{0, 1}, idxs)
+		assert.Equal(t, toIfaces(ents[1:3]...), actuals)
+	})
+
+	t.Run("Find with error on empty", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_error_on_empty")
+		defer done()
+
+		find := func(opts kv.FindOpts) error {
+			return kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, opts)
+			})
+		}
+
+		err := find(kv.FindOpts{ErrorOnEmpty: true})
+		isNotFoundErr(t, err)
+
+		require.NoError(t, find(kv.FindOpts{}))
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_0"))
+
+		require.NoError(t, find(kv.FindOpts{ErrorOnEmpty: true}))
+
+		err = find(kv.FindOpts{
+			ErrorOnEmpty: true,
+			FilterEntFn: func(key []byte, decodedVal interface{}) bool {
+				return decodedVal.(foo).OrgID == 9001
+			},
+		})
+		isNotFoundErr(t, err)
+	})
+
+	t.Run("WithFillPercent", func(t *testing.T) {
+		kvStore, done, err := newKVStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := kv.NewStoreBase("foo", []byte("foo_fill_percent"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithFillPercent(1.0),
+		)
+
+		var fillPercents []float64
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := base.Init(context.TODO(), tx); err != nil {
+				return err
+			}
+			fillTx := &fillPercentTx{Tx: tx, fillPercents: &fillPercents}
+			return base.Put(context.TODO(), fillTx, newFooEnt(1, 9000, "foo_0"))
+		})
+		assert.Equal(t, []float64{1.0}, fillPercents)
+	})
+
+	t.Run("Find with deadline", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_deadline")
+		defer done()
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9000, "foo_2"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		find := func(deadline time.Time, captureFn kv.FindCaptureFn) ([]interface{}, bool) {
+			var (
+				actuals   []interface{}
+				truncated = true
+			)
+			view(t, kvStore, func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, kv.FindOpts{
+					Deadline:  deadline,
+					Truncated: &truncated,
+					CaptureFn: func(key []byte, decodedVal interface{}) error {
+						actuals = append(actuals, decodedVal)
+						return captureFn(key, decodedVal)
+					},
+				})
+			})
+			return actuals, truncated
+		}
+		noop := func(key []byte, decodedVal interface{}) error { return nil }
+
+		actuals, truncated := find(time.Now().Add(time.Hour), noop)
+		assert.False(t, truncated)
+		assert.Equal(t, toIfaces(ents...), actuals)
+
+		actuals, truncated = find(time.Now().Add(-time.Second), noop)
+		assert.True(t, truncated)
+		assert.Empty(t, actuals)
+
+		deadline := time.Now().Add(50 * time.Millisecond)
+		actuals, truncated = find(deadline, func(key []byte, decodedVal interface{}) error {
+			time.Sleep(time.Until(deadline))
+			return nil
+		})
+		assert.True(t, truncated)
+		assert.Equal(t, toIfaces(ents[0]), actuals)
+	})
+
+	t.Run("Find with dedupe key", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_dedupe")
+		defer done()
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_0"),
+			newFooEnt(3, 9000, "foo_1"),
+			newFooEnt(4, 9000, "foo_2"),
+			newFooEnt(5, 9000, "foo_1"),
+			newFooEnt(6, 9000, "foo_3"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		var actuals []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				Offset: 1,
+				Limit:  2,
+				DedupeKeyFn: func(decodedVal interface{}) []byte {
+					return []byte(decodedVal.(foo).Name)
+				},
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					actuals = append(actuals, decodedVal)
+					return nil
+				},
+			})
+		})
+		assert.Equal(t, toIfaces(ents[2], ents[3]), actuals)
+	})
+
+	t.Run("Find limit and offset validation", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_validation")
+		defer done()
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		find := func(opts kv.FindOpts) ([]interface{}, error) {
+			var actuals []interface{}
+			opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+				actuals = append(actuals, decodedVal)
+				return nil
+			}
+			err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, opts)
+			})
+			return actuals, err
+		}
+
+		for _, opts := range []kv.FindOpts{{Limit: -1}, {Offset: -1}, {Limit: 1, Offset: -2}} {
+			_, err := find(opts)
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		}
+
+		actuals, err := find(kv.FindOpts{Limit: 0, Offset: 0})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents...), actuals)
+
+		actuals, err = find(kv.FindOpts{Limit: 0, Offset: 1})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents[1]), actuals)
+	})
+
+	t.Run("PeekRaw", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "peek_raw")
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_0"))
+		expected := getEntRaw(t, kvStore, base.BktName, encodeID(t, 1))
+
+		var raw []byte
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			raw, err = base.PeekRaw(context.TODO(), tx, 1)
+			return err
+		})
+		assert.Equal(t, expected, raw)
+
+		// the bytes are returned even when the decoder would reject them
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.PutRaw(context.TODO(), tx, encodeID(t, 2), kv.Entity{Body: "not a foo"})
+		})
+		view(t, kvStore, func(tx kv.Tx) error {
+			raw, err := base.PeekRaw(context.TODO(), tx, 2)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(`"not a foo"`), raw)
+
+			_, err = base.PeekRaw(context.TODO(), tx, 3)
+			isNotFoundErr(t, err)
+			return nil
+		})
+	})
+
+	t.Run("UpsertMany", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "upsert_many")
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_0"))
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0_renamed"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9000, "foo_2"),
+		}
+		update(t, kvStore, func(tx kv.Tx) error {
+			created, updated, err := base.UpsertMany(context.TODO(), tx, ents...)
+			assert.Equal(t, 2, created)
+			assert.Equal(t, 1, updated)
+			return err
+		})
+
+		var actuals []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					actuals = append(actuals, decodedVal)
+					return nil
+				},
+			})
+		})
+		assert.Equal(t, toIfaces(ents...), actuals)
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			created, updated, err := base.UpsertMany(context.TODO(), tx, newFooEnt(4, 9000, "foo_3"), kv.Entity{PK: kv.EncID(0)})
+			assert.Equal(t, 1, created)
+			assert.Equal(t, 0, updated)
+			return err
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Contains(t, err.Error(), "index 1")
+	})
+
+	t.Run("UpsertMany maintains indexes", func(t *testing.T) {
+		base, done, kvStore := newFooNameFoldStore(t, "upsert_many_index", true)
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "before"))
+		update(t, kvStore, func(tx kv.Tx) error {
+			_, _, err := base.UpsertMany(context.TODO(), tx, newFooEnt(1, 9000, "after"), newFooEnt(2, 9000, "other"))
+			return err
+		})
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEntByNameFold(context.TODO(), tx, "AFTER")
+			require.NoError(t, err)
+			assert.Equal(t, influxdb.ID(1), v.(foo).ID)
+
+			_, err = base.FindEntByNameFold(context.TODO(), tx, "before")
+			isNotFoundErr(t, err)
+			return nil
+		})
+	})
+
+	t.Run("EncKeyFunc", func(t *testing.T) {
+		// keyed by a composite of org and name, neither of which is the ID
+		encSlugKey := kv.EncKeyFunc(func(body interface{}) ([]byte, error) {
+			f, ok := body.(foo)
+			if !ok {
+				return nil, fmt.Errorf("unexpected body of type %T", body)
+			}
+			if f.Name == "" {
+				return nil, errors.New("foo has no name")
+			}
+			return []byte(f.OrgID.String() + "/" + f.Name), nil
+		})
+		base, done, kvStore := newStoreBase(t, "enc_key_func", encSlugKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "b"), newFooEnt(2, 9000, "a"))
+
+		var keys []string
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					keys = append(keys, string(key))
+					return nil
+				},
+			})
+		})
+		org := influxdb.ID(9000).String()
+		assert.Equal(t, []string{org + "/a", org + "/b"}, keys)
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEnt(context.TODO(), tx, kv.Entity{Body: foo{OrgID: 9000, Name: "b"}})
+			require.NoError(t, err)
+			assert.Equal(t, foo{ID: 1, OrgID: 9000, Name: "b"}, v)
+			return nil
+		})
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, newFooEnt(3, 9000, ""))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+
+	t.Run("SelfTest", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "self_test")
+		defer done()
+
+		selfTest := func() error {
+			return kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				return base.SelfTest(context.TODO(), tx)
+			})
+		}
+
+		require.NoError(t, selfTest())
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2"))
+		require.NoError(t, selfTest())
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			b, err := tx.Bucket(base.BktName)
+			if err != nil {
+				return err
+			}
+			return b.Put(encodeID(t, 2), []byte("not json"))
+		})
+
+		err := selfTest()
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+		assert.Contains(t, err.Error(), "counted 2 keys but decoded 1 values")
+		assert.Contains(t, err.Error(), string(encodeID(t, 2)))
+	})
 
-		store := kv.NewStoreBase("foo", []byte("foo_"+bktSuffix), encKeyFn, encBodyFn, decFn, decToEntFn)
+	t.Run("FindOne", func(t *testing.T) {
+		var decoded int
+		countingDecFn := func(key, val []byte) ([]byte, interface{}, error) {
+			decoded++
+			return decJSONFooFn(key, val)
+		}
+		base, done, kvStore := newStoreBase(t, "find_one", kv.EncIDKey, kv.EncBodyJSON, countingDecFn, decFooEntFn)
+		defer done()
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
+		seedEnts(t, kvStore, base,
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+			newFooEnt(3, 9001, "foo_3"),
+			newFooEnt(4, 9002, "foo_4"),
+		)
 
-		require.NoError(t, inmemSVC.Update(ctx, func(tx kv.Tx) error {
-			return store.Init(ctx, tx)
-		}))
-		return store, done, inmemSVC
-	}
+		inOrg := func(orgID influxdb.ID) kv.FilterFn {
+			return func(key []byte, decodedVal interface{}) bool {
+				return decodedVal.(foo).OrgID == orgID
+			}
+		}
 
-	newFooStoreBase := func(t *testing.T, bktSuffix string) (*kv.StoreBase, func(), kv.Store) {
-		return newStoreBase(t, bktSuffix, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
-	}
+		findOne := func(opts kv.FindOpts) (interface{}, error) {
+			var (
+				v   interface{}
+				err error
+			)
+			view(t, kvStore, func(tx kv.Tx) error {
+				v, err = base.FindOne(context.TODO(), tx, opts)
+				return nil
+			})
+			return v, err
+		}
 
-	t.Run("Put", func(t *testing.T) {
-		t.Run("basic", func(t *testing.T) {
-			base, done, kvStore := newFooStoreBase(t, "put")
-			defer done()
+		v, err := findOne(kv.FindOpts{FilterEntFn: inOrg(9001), Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, foo{ID: 3, OrgID: 9001, Name: "foo_3"}, v)
 
-			testPutBase(t, kvStore, base, base.BktName)
-		})
+		_, err = findOne(kv.FindOpts{FilterEntFn: inOrg(8000)})
+		isNotFoundErr(t, err)
 
-		t.Run("new", func(t *testing.T) {
-			base, done, kvStore := newFooStoreBase(t, "put")
-			defer done()
+		decoded = 0
+		_, err = findOne(kv.FindOpts{FilterEntFn: inOrg(9000)})
+		require.Error(t, err)
+		assert.True(t, kv.IsMultipleResults(err))
+		assert.Equal(t, 2, decoded, "scan should stop at the second match")
+	})
 
-			expected := newFooEnt(3, 33, "name3")
+	t.Run("max key bytes", func(t *testing.T) {
+		encNameKey := kv.EncKeyFunc(func(body interface{}) ([]byte, error) {
+			return []byte(body.(foo).Name), nil
+		})
+		newStore := func(t *testing.T, opts ...kv.StoreBaseOptFn) (*kv.StoreBase, kv.Store) {
+			kvStore, _, err := newKVStore(t)
+			require.NoError(t, err)
+
+			base := kv.NewStoreBase("foo", []byte("foo_max_key"), encNameKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn, opts...)
 			update(t, kvStore, func(tx kv.Tx) error {
-				return base.Put(context.TODO(), tx, expected, kv.PutNew())
+				return base.Init(context.TODO(), tx)
 			})
+			return base, kvStore
+		}
 
-			var actual interface{}
-			view(t, kvStore, func(tx kv.Tx) error {
-				f, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: expected.PK})
-				actual = f
-				return err
+		put := func(kvStore kv.Store, base *kv.StoreBase, name string) error {
+			return kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+				return base.Put(context.TODO(), tx, newFooEnt(1, 9000, name))
 			})
+		}
 
-			assert.Equal(t, expected.Body, actual)
+		t.Run("defaults to bolt's limit", func(t *testing.T) {
+			base, kvStore := newStore(t)
+
+			require.NoError(t, put(kvStore, base, strings.Repeat("a", kv.DefaultMaxKeyBytes)))
+
+			err := put(kvStore, base, strings.Repeat("b", kv.DefaultMaxKeyBytes+1))
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+			assert.Contains(t, err.Error(), "exceeds the maximum of 32768 bytes")
 		})
 
-		t.Run("update", func(t *testing.T) {
-			base, done, kvStore := newFooStoreBase(t, "put")
-			defer done()
+		t.Run("configured limit", func(t *testing.T) {
+			base, kvStore := newStore(t, kv.WithMaxKeyBytes(8))
 
-			expected := testPutBase(t, kvStore, base, base.BktName)
+			require.NoError(t, put(kvStore, base, "12345678"))
 
-			updateEnt := newFooEnt(expected.ID, expected.OrgID, "new name")
-			update(t, kvStore, func(tx kv.Tx) error {
-				return base.Put(context.TODO(), tx, updateEnt, kv.PutUpdate())
+			err := put(kvStore, base, "123456789")
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+
+			err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+				_, _, err := base.UpsertMany(context.TODO(), tx, newFooEnt(2, 9000, "123456789"))
+				return err
 			})
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		})
+	})
 
-			var actual interface{}
+	t.Run("FindSortedBy", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_sorted")
+		defer done()
+
+		seedEnts(t, kvStore, base,
+			newFooEnt(1, 9000, "delta"),
+			newFooEnt(2, 9000, "alpha"),
+			newFooEnt(3, 9001, "charlie"),
+			newFooEnt(4, 9000, "bravo"),
+			newFooEnt(5, 9000, "alpha"),
+		)
+
+		byName := func(a, b interface{}) bool {
+			return a.(foo).Name < b.(foo).Name
+		}
+		findSorted := func(opts kv.FindOpts) []interface{} {
+			var vals []interface{}
 			view(t, kvStore, func(tx kv.Tx) error {
-				f, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(expected.ID)})
-				actual = f
+				var err error
+				vals, err = base.FindSortedBy(context.TODO(), tx, byName, opts)
 				return err
 			})
+			return vals
+		}
 
-			expected.Name = "new name"
-			assert.Equal(t, expected, actual)
+		// names that compare equal keep their key order
+		expected := toIfaces(
+			newFooEnt(2, 9000, "alpha"),
+			newFooEnt(5, 9000, "alpha"),
+			newFooEnt(4, 9000, "bravo"),
+			newFooEnt(3, 9001, "charlie"),
+			newFooEnt(1, 9000, "delta"),
+		)
+		assert.Equal(t, expected, findSorted(kv.FindOpts{}))
+
+		// offset and limit page the sorted results
+		assert.Equal(t, expected[1:3], findSorted(kv.FindOpts{Offset: 1, Limit: 2}))
+		assert.Empty(t, findSorted(kv.FindOpts{Offset: 5}))
+
+		inOrg9000 := func(key []byte, decodedVal interface{}) bool {
+			return decodedVal.(foo).OrgID == 9000
+		}
+		assert.Equal(t, toIfaces(
+			newFooEnt(2, 9000, "alpha"),
+			newFooEnt(5, 9000, "alpha"),
+			newFooEnt(4, 9000, "bravo"),
+		), findSorted(kv.FindOpts{FilterEntFn: inOrg9000, Limit: 3}))
+	})
+
+	t.Run("BatchCaptureFn", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "batch_capture")
+		defer done()
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9003, "foo_2"),
+			newFooEnt(4, 9003, "foo_3"),
+			newFooEnt(5, 9003, "foo_4"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		var batches [][]kv.KV
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				BatchSize: 2,
+				BatchCaptureFn: func(batch []kv.KV) error {
+					batches = append(batches, batch)
+					return nil
+				},
+			})
 		})
 
-		t.Run("error cases", func(t *testing.T) {
-			t.Run("new entity conflicts with existing", func(t *testing.T) {
-				base, done, kvStore := newFooStoreBase(t, "put")
-				defer done()
+		require.Len(t, batches, 3)
+		var i int
+		for _, batch := range batches {
+			for _, pair := range batch {
+				assert.Equal(t, encodeID(t, influxdb.ID(i+1)), pair.Key)
+				assert.Equal(t, ents[i].Body, pair.Val)
+				i++
+			}
+		}
+		assert.Equal(t, 5, i)
+		assert.Len(t, batches[2], 1)
 
-				expected := testPutBase(t, kvStore, base, base.BktName)
+		t.Run("with a per row capture", func(t *testing.T) {
+			err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, kv.FindOpts{
+					CaptureFn:      func(key []byte, decodedVal interface{}) error { return nil },
+					BatchCaptureFn: func(batch []kv.KV) error { return nil },
+				})
+			})
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		})
+	})
 
-				err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
-					entCopy := newFooEnt(expected.ID, expected.OrgID, expected.Name)
-					return base.Put(context.TODO(), tx, entCopy, kv.PutNew())
+	t.Run("nil tx", func(t *testing.T) {
+		base, done, _ := newFooStoreBase(t, "nil_tx")
+		defer done()
+
+		ctx := context.TODO()
+		ent := newFooEnt(1, 9000, "foo_1")
+		ops := map[string]func() error{
+			"Init": func() error { return base.Init(ctx, nil) },
+			"Put":  func() error { return base.Put(ctx, nil, ent) },
+			"PutRaw": func() error {
+				return base.PutRaw(ctx, nil, encodeID(t, 1), ent)
+			},
+			"PutIfChanged": func() error {
+				_, err := base.PutIfChanged(ctx, nil, ent)
+				return err
+			},
+			"UpsertMany": func() error {
+				_, _, err := base.UpsertMany(ctx, nil, ent)
+				return err
+			},
+			"Find": func() error {
+				return base.Find(ctx, nil, kv.FindOpts{
+					CaptureFn: func(key []byte, decodedVal interface{}) error { return nil },
+				})
+			},
+			"FindEnt": func() error {
+				_, err := base.FindEnt(ctx, nil, ent)
+				return err
+			},
+			"DeleteEnt": func() error { return base.DeleteEnt(ctx, nil, ent) },
+			"Delete": func() error {
+				return base.Delete(ctx, nil, kv.DeleteOpts{
+					FilterFn: func(k []byte, v interface{}) bool { return true },
 				})
+			},
+			"FindPairs": func() error {
+				_, err := base.FindPairs(ctx, nil, kv.FindOpts{})
+				return err
+			},
+		}
+		for name, op := range ops {
+			t.Run(name, func(t *testing.T) {
+				err := op()
 				require.Error(t, err)
-				assert.Equal(t, influxdb.EConflict, influxdb.ErrorCode(err))
+				assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+				assert.Contains(t, err.Error(), "requires an open transaction")
+			})
+		}
+	})
+
+	t.Run("FindPairs", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_pairs")
+		defer done()
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9003, "foo_2"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		var pairs []kv.KV
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			pairs, err = base.FindPairs(context.TODO(), tx, kv.FindOpts{
+				Descending: true,
+				Limit:      2,
 			})
+			return err
 		})
 
-		t.Run("updating entity that does not exist", func(t *testing.T) {
-			base, done, kvStore := newFooStoreBase(t, "put")
-			defer done()
+		expected := []kv.KV{
+			{Key: encodeID(t, 3), Val: ents[2].Body},
+			{Key: encodeID(t, 2), Val: ents[1].Body},
+		}
+		assert.Equal(t, expected, pairs)
+	})
 
-			expected := testPutBase(t, kvStore, base, base.BktName)
+	t.Run("Find with max scan", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_max_scan")
+		defer done()
 
-			err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
-				// ent by id does not exist
-				entCopy := newFooEnt(333, expected.OrgID, "name1")
-				return base.Put(context.TODO(), tx, entCopy, kv.PutUpdate())
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9003, "foo_2"),
+			newFooEnt(4, 9004, "foo_3"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		find := func(opts kv.FindOpts) ([]interface{}, error) {
+			var actuals []interface{}
+			opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+				actuals = append(actuals, decodedVal)
+				return nil
+			}
+			err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, opts)
 			})
-			require.Error(t, err)
-			assert.Equal(t, influxdb.ENotFound, influxdb.ErrorCode(err))
+			return actuals, err
+		}
+
+		actuals, err := find(kv.FindOpts{MaxScan: 4})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents...), actuals)
+
+		actuals, err = find(kv.FindOpts{MaxScan: 3, Limit: 3})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents[:3]...), actuals)
+
+		_, err = find(kv.FindOpts{
+			MaxScan: 3,
+			FilterEntFn: func(key []byte, decodedVal interface{}) bool {
+				return decodedVal.(foo).OrgID == 9004
+			},
 		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.ETooLarge, influxdb.ErrorCode(err))
+		assert.Equal(t, kv.ErrMaxScanExceeded, err.(*influxdb.Error).Err)
 	})
 
-	t.Run("DeleteEnt", func(t *testing.T) {
-		base, done, kvStore := newFooStoreBase(t, "delete_ent")
+	t.Run("Find stats", func(t *testing.T) {
+		base, done, kvStore := newFooStoreBase(t, "find_stats")
 		defer done()
 
-		testDeleteEntBase(t, kvStore, base)
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9003, "foo_2"),
+			newFooEnt(4, 9004, "foo_3"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		var stats kv.FindStats
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				Stats: &stats,
+				FilterEntFn: func(key []byte, decodedVal interface{}) bool {
+					return decodedVal.(foo).OrgID == 9000
+				},
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					return nil
+				},
+			})
+		})
+
+		assert.Equal(t, 4, stats.KeysScanned)
+		assert.Equal(t, 2, stats.KeysFiltered)
+		assert.Equal(t, 2, stats.KeysEmitted)
+
+		var bytesDecoded int64
+		for _, ent := range ents {
+			bytesDecoded += int64(len(getEntRaw(t, kvStore, base.BktName, encodeID(t, ent.Body.(foo).ID))))
+		}
+		assert.Equal(t, bytesDecoded, stats.BytesDecoded)
 	})
 
-	t.Run("Delete", func(t *testing.T) {
-		testDeleteBase(t, func(t *testing.T, suffix string) (storeBase, func(), kv.Store) {
-			return newFooStoreBase(t, suffix)
+	t.Run("uninitialized bucket", func(t *testing.T) {
+		kvStore, done, err := newKVStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		t.Run("errors clearly without auto init", func(t *testing.T) {
+			base := kv.NewStoreBase("foo", []byte("foo_no_init"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+
+			err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, kv.FindOpts{
+					CaptureFn: func(key []byte, decodedVal interface{}) error {
+						return nil
+					},
+				})
+			})
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+			assert.Contains(t, err.Error(), "Init")
+		})
+
+		t.Run("treated as empty with auto init", func(t *testing.T) {
+			base := kv.NewStoreBase("foo", []byte("foo_auto_init"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn, kv.WithAutoInit())
+
+			var actuals []interface{}
+			view(t, kvStore, func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, kv.FindOpts{
+					CaptureFn: func(key []byte, decodedVal interface{}) error {
+						actuals = append(actuals, decodedVal)
+						return nil
+					},
+				})
+			})
+			assert.Empty(t, actuals)
+
+			err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				_, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+				return err
+			})
+			isNotFoundErr(t, err)
+
+			expected := newFooEnt(1, 9000, "foo_1")
+			seedEnts(t, kvStore, base, expected)
+			testFindEnt(t, kvStore, base)
+		})
+
+		t.Run("failures are reported with auto init", func(t *testing.T) {
+			base := kv.NewStoreBase("foo", []byte("foo_auto_init_failure"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn, kv.WithAutoInit())
+
+			err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				return base.Find(context.TODO(), &failingBucketTx{Tx: tx}, kv.FindOpts{
+					CaptureFn: func(key []byte, decodedVal interface{}) error {
+						return nil
+					},
+				})
+			})
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+			assert.Contains(t, err.Error(), "i/o failure")
+
+			err = kvStore.View(context.TODO(), func(tx kv.Tx) error {
+				_, err := base.FindEnt(context.TODO(), &failingBucketTx{Tx: tx}, kv.Entity{PK: kv.EncID(1)})
+				return err
+			})
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
 		})
 	})
 
-	t.Run("FindEnt", func(t *testing.T) {
-		base, done, kvStore := newFooStoreBase(t, "find_ent")
+	t.Run("org then name keys", func(t *testing.T) {
+		encOrgNameKey := func(ent kv.Entity) ([]byte, string, error) {
+			f, ok := ent.Body.(foo)
+			if !ok {
+				return nil, "org then name key", fmt.Errorf("invalid entry: %#v", ent.Body)
+			}
+			key, err := kv.EncOrgThenNameKey(f.OrgID, f.Name, f.ID)()
+			return key, "org then name key", err
+		}
+		base, done, kvStore := newStoreBase(t, "org_name", encOrgNameKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
 		defer done()
 
-		testFindEnt(t, kvStore, base)
+		seedEnts(t, kvStore, base,
+			newFooEnt(1, 9000, "zed"),
+			newFooEnt(2, 9000, "Bar"),
+			newFooEnt(3, 9000, "apple"),
+			newFooEnt(4, 9000, "ab"),
+			newFooEnt(5, 9000, "bar"),
+			newFooEnt(6, 8000, "aaa"),
+		)
+
+		var names []string
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				Prefix: encodeID(t, 9000),
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					orgID, name, id, err := kv.DecodeOrgThenNameKey(key)
+					require.NoError(t, err)
+					assert.Equal(t, decodedVal.(foo).OrgID, orgID)
+					assert.Equal(t, decodedVal.(foo).ID, id)
+					names = append(names, name)
+					return nil
+				},
+			})
+		})
+
+		assert.Equal(t, []string{"ab", "apple", "bar", "bar", "zed"}, names)
 	})
 
-	t.Run("Find", func(t *testing.T) {
-		testFind(t, func(t *testing.T, suffix string) (storeBase, func(), kv.Store) {
-			return newFooStoreBase(t, suffix)
+	t.Run("natural order descending", func(t *testing.T) {
+		kvStore, done, err := newKVStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := kv.NewStoreBase("foo", []byte("foo_natural_desc"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn, kv.WithNaturalOrderDescending())
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_0"),
+			newFooEnt(2, 9000, "foo_1"),
+			newFooEnt(3, 9000, "foo_2"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		find := func(opts kv.FindOpts) []interface{} {
+			var actuals []interface{}
+			opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+				actuals = append(actuals, decodedVal)
+				return nil
+			}
+			view(t, kvStore, func(tx kv.Tx) error {
+				return base.Find(context.TODO(), tx, opts)
+			})
+			return actuals
+		}
+
+		assert.Equal(t, reverseSlc(toIfaces(ents...)), find(kv.FindOpts{}))
+		assert.Equal(t, reverseSlc(toIfaces(ents...)), find(kv.FindOpts{Descending: true}))
+		assert.Equal(t, toIfaces(ents...), find(kv.FindOpts{Ascending: true}))
+		assert.Equal(t, toIfaces(ents[1]), find(kv.FindOpts{Limit: 1, Offset: 1}))
+	})
+
+	t.Run("decode cache", func(t *testing.T) {
+		var decodes int
+		countingDecFn := func(key, val []byte) ([]byte, interface{}, error) {
+			if len(val) > 0 {
+				decodes++
+			}
+			return decJSONFooFn(key, val)
+		}
+
+		inmemSVC, done, err := newKVStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := kv.NewStoreBase("foo", []byte("foo_decode_cache"), kv.EncIDKey, kv.EncBodyJSON, countingDecFn, decFooEntFn, kv.WithDecodeCache(10))
+
+		expected := newFooEnt(1, 9000, "foo_1")
+		seedEnts(t, inmemSVC, base, expected)
+
+		findEnt := func() interface{} {
+			var actual interface{}
+			view(t, inmemSVC, func(tx kv.Tx) error {
+				f, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: expected.PK})
+				actual = f
+				return err
+			})
+			return actual
+		}
+
+		assert.Equal(t, expected.Body, findEnt())
+		assert.Equal(t, expected.Body, findEnt())
+		view(t, inmemSVC, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					assert.Equal(t, expected.Body, decodedVal)
+					return nil
+				},
+			})
 		})
+		assert.Equal(t, 1, decodes)
+
+		updated := newFooEnt(1, 9000, "foo_1_updated")
+		seedEnts(t, inmemSVC, base, updated)
+
+		assert.Equal(t, updated.Body, findEnt())
+		assert.Equal(t, 2, decodes)
 	})
 }
 
@@ -393,6 +1834,38 @@ func seedEnts(t *testing.T, kvStore kv.Store, store storeBase, ents ...kv.Entity
 	}
 }
 
+// fillPercentTx records the fill percents set on the buckets it returns.
+type fillPercentTx struct {
+	kv.Tx
+	fillPercents *[]float64
+}
+
+func (tx *fillPercentTx) Bucket(b []byte) (kv.Bucket, error) {
+	bkt, err := tx.Tx.Bucket(b)
+	if err != nil {
+		return nil, err
+	}
+	return &fillPercentBucket{Bucket: bkt, fillPercents: tx.fillPercents}, nil
+}
+
+// failingBucketTx fails to retrieve any bucket, as a tx whose backend has failed.
+type failingBucketTx struct {
+	kv.Tx
+}
+
+func (tx *failingBucketTx) Bucket(b []byte) (kv.Bucket, error) {
+	return nil, errors.New("i/o failure")
+}
+
+type fillPercentBucket struct {
+	kv.Bucket
+	fillPercents *[]float64
+}
+
+func (b *fillPercentBucket) SetFillPercent(p float64) {
+	*b.fillPercents = append(*b.fillPercents, p)
+}
+
 func update(t *testing.T, kvStore kv.Store, fn func(tx kv.Tx) error) {
 	t.Helper()
 
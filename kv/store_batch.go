@@ -0,0 +1,219 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// DefaultBatchSize is the number of keys a batched maintenance operation processes
+// per transaction when no batch size is configured.
+const DefaultBatchSize = 1000
+
+// Checkpoint is the continuation cursor of a batched maintenance operation. It is
+// opaque: only the operation that produced it understands it, and resuming another
+// operation from it fails as invalid.
+type Checkpoint []byte
+
+// The first byte of a checkpoint tags the operation it belongs to, and the rest is
+// the last key the operation processed.
+const (
+	checkpointDelete  byte = 'd'
+	checkpointReindex byte = 'r'
+)
+
+// BatchOpts configures a batched maintenance operation, which processes the keys of
+// a store in key order in batches, each committed in an update transaction of its
+// own, so no single transaction grows with the size of the store.
+type BatchOpts struct {
+	// BatchSize is the number of keys processed per transaction, defaulting to
+	// DefaultBatchSize.
+	BatchSize int
+	// Resume continues the operation after the batch a checkpoint was provided
+	// for, rather than from the start.
+	Resume Checkpoint
+	// CheckpointFn, when provided, is called after each committed batch with the
+	// checkpoint to resume from after it. Persisting the checkpoint lets an
+	// operation interrupted by a crash or restart resume from its last committed
+	// batch. An error from it stops the operation, leaving the batch committed.
+	CheckpointFn func(ctx context.Context, cp Checkpoint) error
+}
+
+// DeleteInBatches deletes the entities the FilterFn of opts matches, as Delete does,
+// in batches of their own transaction each, returning the number deleted by this
+// call. A failed batch is rolled back, leaving the batches before it deleted.
+func (s *StoreBase) DeleteInBatches(ctx context.Context, store Store, opts DeleteOpts, batch BatchOpts) (int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if opts.FilterFn == nil {
+		return 0, nil
+	}
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	after, err := s.resumeKey(checkpointDelete, batch.Resume)
+	if err != nil {
+		return 0, err
+	}
+
+	decFn := s.decodeFn()
+	var n int
+	err = s.inBatches(ctx, store, checkpointDelete, after, batch, func(ctx context.Context, tx Tx, k, v []byte) error {
+		_, decodedVal, err := decFn(k, v)
+		if err != nil {
+			return s.errDecode(k, err)
+		}
+		if !opts.FilterFn(k, decodedVal) {
+			return nil
+		}
+
+		for _, deleteFn := range opts.DeleteRelationFns {
+			if err := deleteFn(k, decodedVal); err != nil {
+				return err
+			}
+		}
+		if err := s.deleteExisting(ctx, tx, k, decodedVal); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// ReindexAllInBatches rebuilds every secondary index of the store as ReindexAll
+// does, in batches of their own transaction each, returning the number of entities
+// indexed by this call. The index buckets are cleared in a transaction of their
+// own before the first batch. Until the rebuild completes the indexes are partial,
+// so lookups through them miss the entities of batches yet to run.
+func (s *StoreBase) ReindexAllInBatches(ctx context.Context, store Store, batch BatchOpts) (int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	after, err := s.resumeKey(checkpointReindex, batch.Resume)
+	if err != nil {
+		return 0, err
+	}
+
+	if batch.Resume == nil {
+		err := store.Update(ctx, func(tx Tx) error {
+			for _, idx := range s.indexes {
+				if err := s.clearIndex(ctx, tx, idx); err != nil {
+					return err
+				}
+			}
+			return s.clearProjection(ctx, tx)
+		})
+		if err != nil {
+			return 0, err
+		}
+		if batch.CheckpointFn != nil {
+			if err := batch.CheckpointFn(ctx, Checkpoint{checkpointReindex}); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	decFn := s.decodeFn()
+	var n int
+	err = s.inBatches(ctx, store, checkpointReindex, after, batch, func(ctx context.Context, tx Tx, k, v []byte) error {
+		_, decodedVal, err := decFn(k, v)
+		if err != nil {
+			return s.errDecode(k, err)
+		}
+		if err := s.reindexEnt(ctx, tx, k, decodedVal); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// inBatches calls fn with each pair of the store's bucket past the after key, in
+// batches of their own update transaction. The pairs of a batch are read before fn
+// is called with any of them, so fn may modify the bucket.
+func (s *StoreBase) inBatches(ctx context.Context, store Store, tag byte, after []byte, opts BatchOpts, fn func(ctx context.Context, tx Tx, k, v []byte) error) error {
+	size := opts.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	for {
+		var pairs []Pair
+		err := store.Update(ctx, func(tx Tx) error {
+			cur, err := s.bucketCursor(ctx, tx)
+			if err != nil {
+				if s.isMissingBucket(err) {
+					return nil
+				}
+				return err
+			}
+
+			k, v := cur.First()
+			if len(after) > 0 {
+				k, v = cur.Seek(after)
+				if bytes.Equal(k, after) {
+					k, v = cur.Next()
+				}
+			}
+			for ; k != nil && len(pairs) < size; k, v = cur.Next() {
+				pairs = append(pairs, Pair{Key: copyBytes(k), Value: copyBytes(v)})
+			}
+
+			for _, p := range pairs {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := fn(ctx, tx, p.Key, p.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(pairs) == 0 {
+			return nil
+		}
+
+		after = pairs[len(pairs)-1].Key
+		if opts.CheckpointFn != nil {
+			cp := append(Checkpoint{tag}, after...)
+			if err := opts.CheckpointFn(ctx, cp); err != nil {
+				return err
+			}
+		}
+		if len(pairs) < size {
+			return nil
+		}
+	}
+}
+
+// resumeKey returns the key to resume the operation tagged tag after, or nil to
+// start from the beginning when there is no checkpoint.
+func (s *StoreBase) resumeKey(tag byte, cp Checkpoint) ([]byte, error) {
+	if cp == nil {
+		return nil, nil
+	}
+	if len(cp) == 0 || cp[0] != tag {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s checkpoint was not produced by this operation", s.Resource),
+		}
+	}
+	return cp[1:], nil
+}
+
+func (s *StoreBase) errDecode(key []byte, err error) error {
+	return &influxdb.Error{
+		Code: influxdb.EInternal,
+		Msg:  fmt.Sprintf("failed to decode %s for key %q", s.Resource, string(key)),
+		Err:  err,
+	}
+}
@@ -0,0 +1,143 @@
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_Batches(t *testing.T) {
+	errInterrupted := errors.New("interrupted")
+
+	newStore := func(t *testing.T, suffix string) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_batch_"+suffix), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithNameFoldIndex([]byte("foo_batch_name_fold_"+suffix), fooNameFn, false),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		var ents []kv.Entity
+		for i := 1; i <= 10; i++ {
+			ents = append(ents, newFooEnt(influxdb.ID(i), 9000+influxdb.ID(i%2), "foo"))
+		}
+		seedEnts(t, kvStore, base, ents...)
+		return base, kvStore, done
+	}
+
+	// interruptAfter returns a checkpoint fn that records checkpoints and fails
+	// once n have been recorded, as a crash would.
+	interruptAfter := func(n int, cps *[]kv.Checkpoint) func(context.Context, kv.Checkpoint) error {
+		return func(ctx context.Context, cp kv.Checkpoint) error {
+			*cps = append(*cps, cp)
+			if len(*cps) == n {
+				return errInterrupted
+			}
+			return nil
+		}
+	}
+
+	remaining := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase) []influxdb.ID {
+		t.Helper()
+
+		var ids []influxdb.ID
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					ids = append(ids, decodedVal.(foo).ID)
+					return nil
+				},
+			})
+		})
+		return ids
+	}
+
+	t.Run("DeleteInBatches resumes from its checkpoint", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "delete")
+		defer done()
+
+		opts := kv.DeleteOpts{
+			FilterFn: func(k []byte, v interface{}) bool {
+				return v.(foo).OrgID == 9000
+			},
+		}
+
+		var cps []kv.Checkpoint
+		n, err := base.DeleteInBatches(context.TODO(), kvStore, opts, kv.BatchOpts{
+			BatchSize:    3,
+			CheckpointFn: interruptAfter(2, &cps),
+		})
+		require.Equal(t, errInterrupted, err)
+		assert.Equal(t, 3, n)
+		require.Len(t, cps, 2)
+		assert.Equal(t, []influxdb.ID{1, 3, 5, 7, 8, 9, 10}, remaining(t, kvStore, base))
+
+		n, err = base.DeleteInBatches(context.TODO(), kvStore, opts, kv.BatchOpts{
+			BatchSize: 3,
+			Resume:    cps[1],
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []influxdb.ID{1, 3, 5, 7, 9}, remaining(t, kvStore, base))
+	})
+
+	t.Run("ReindexAllInBatches resumes without clearing the indexes", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "reindex")
+		defer done()
+
+		var cps []kv.Checkpoint
+		n, err := base.ReindexAllInBatches(context.TODO(), kvStore, kv.BatchOpts{
+			BatchSize:    4,
+			CheckpointFn: interruptAfter(2, &cps),
+		})
+		require.Equal(t, errInterrupted, err)
+		assert.Equal(t, 4, n)
+		require.Len(t, cps, 2)
+		assert.NotEqual(t, cps[0], cps[1])
+
+		n, err = base.ReindexAllInBatches(context.TODO(), kvStore, kv.BatchOpts{
+			BatchSize: 4,
+			Resume:    cps[1],
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 6, n)
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			report, err := base.VerifyIndexIntegrity(context.TODO(), tx, kv.NameFoldIndexName)
+			require.NoError(t, err)
+			assert.True(t, report.OK())
+			assert.Equal(t, 10, report.Checked)
+			return nil
+		})
+	})
+
+	t.Run("rejects a checkpoint of another operation", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "mismatch")
+		defer done()
+
+		var cp kv.Checkpoint
+		_, err := base.ReindexAllInBatches(context.TODO(), kvStore, kv.BatchOpts{
+			CheckpointFn: func(ctx context.Context, c kv.Checkpoint) error {
+				cp = c
+				return nil
+			},
+		})
+		require.NoError(t, err)
+
+		_, err = base.DeleteInBatches(context.TODO(), kvStore, kv.DeleteOpts{
+			FilterFn: func(k []byte, v interface{}) bool { return true },
+		}, kv.BatchOpts{Resume: cp})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Len(t, remaining(t, kvStore, base), 10)
+	})
+}
@@ -0,0 +1,261 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// DefaultBlobChunkSize is the size of the chunks blobs are split into when no chunk
+// size is configured with WithBlobChunkSize.
+const DefaultBlobChunkSize = 512 << 10
+
+const (
+	blobInline  byte = 0
+	blobChunked byte = 1
+)
+
+// WithBlobChunkSize sets the maximum number of bytes PutBlob stores under a single
+// key. Larger blobs are split across chunk keys.
+func WithBlobChunkSize(n int) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.blobChunkSize = n
+	}
+}
+
+// PutBlob stores the bytes read from r as the blob for the id, replacing any
+// existing blob. The bytes are stored raw, bypassing the store's codec, hooks, and
+// indexes, so blobs should be kept in a store dedicated to them.
+//
+// A blob no larger than the chunk size is stored inline under the encoded id.
+// Larger blobs are split into chunks of the chunk size, the last possibly shorter,
+// stored under the encoded id followed by "/" and the chunk's big endian uint32
+// ordinal. The encoded id then holds the number of chunks, and GetBlob reassembles
+// the chunks in ordinal order.
+func (s *StoreBase) PutBlob(ctx context.Context, tx Tx, id influxdb.ID, r io.Reader) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	key, err := s.blobKey(id)
+	if err != nil {
+		return err
+	}
+
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	prevChunks, err := s.blobChunks(b, key)
+	if err != nil && influxdb.ErrorCode(err) != influxdb.ENotFound {
+		return err
+	}
+
+	size := s.blobChunkSize
+	if size <= 0 {
+		size = DefaultBlobChunkSize
+	}
+
+	var n uint32
+	for {
+		chunk, err := readBlobChunk(r, size)
+		if err != nil {
+			return &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to read %s blob", s.Resource),
+				Err:  err,
+			}
+		}
+
+		if n == 0 && len(chunk) < size {
+			// the blob fits in a single value and is stored inline
+			if err := s.bucketPut(ctx, tx, key, append([]byte{blobInline}, chunk...)); err != nil {
+				return err
+			}
+			break
+		}
+		if len(chunk) > 0 {
+			if err := s.bucketPut(ctx, tx, blobChunkKey(key, n), chunk); err != nil {
+				return err
+			}
+			n++
+		}
+		if len(chunk) < size {
+			header := make([]byte, 5)
+			header[0] = blobChunked
+			binary.BigEndian.PutUint32(header[1:], n)
+			if err := s.bucketPut(ctx, tx, key, header); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	for i := n; i < prevChunks; i++ {
+		if err := b.Delete(blobChunkKey(key, i)); err != nil && !IsNotFound(err) {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
+
+// GetBlob returns a reader over the blob stored for the id. Chunks are read from the
+// transaction lazily, so the reader must be consumed before the transaction ends.
+func (s *StoreBase) GetBlob(ctx context.Context, tx Tx, id influxdb.ID) (io.ReadCloser, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	key, err := s.blobKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := s.bucketGet(ctx, tx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(header) == 0 {
+		return nil, s.errCorruptBlob(key)
+	}
+	if header[0] == blobInline {
+		return &blobReader{cur: header[1:]}, nil
+	}
+
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.blobChunks(b, key)
+	if err != nil {
+		return nil, err
+	}
+	return &blobReader{s: s, b: b, key: key, n: n}, nil
+}
+
+// DeleteBlob removes the blob stored for the id along with all of its chunks.
+func (s *StoreBase) DeleteBlob(ctx context.Context, tx Tx, id influxdb.ID) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	key, err := s.blobKey(id)
+	if err != nil {
+		return err
+	}
+
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+	n, err := s.blobChunks(b, key)
+	if err != nil {
+		return err
+	}
+
+	for i := uint32(0); i < n; i++ {
+		if err := b.Delete(blobChunkKey(key, i)); err != nil && !IsNotFound(err) {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return s.bucketDelete(ctx, tx, key)
+}
+
+func (s *StoreBase) blobKey(id influxdb.ID) ([]byte, error) {
+	key, err := id.Encode()
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("provided %s blob id is invalid", s.Resource),
+			Err:  err,
+		}
+	}
+	return key, nil
+}
+
+// blobChunks returns the number of chunks the blob at key is split into, which is
+// zero for a blob stored inline.
+func (s *StoreBase) blobChunks(b Bucket, key []byte) (uint32, error) {
+	header, err := b.Get(key)
+	if IsNotFound(err) {
+		return 0, s.errNotFound(key)
+	}
+	if err != nil {
+		return 0, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	switch {
+	case len(header) > 0 && header[0] == blobInline:
+		return 0, nil
+	case len(header) == 5 && header[0] == blobChunked:
+		return binary.BigEndian.Uint32(header[1:]), nil
+	default:
+		return 0, s.errCorruptBlob(key)
+	}
+}
+
+func (s *StoreBase) errCorruptBlob(key []byte) error {
+	return &influxdb.Error{
+		Code: influxdb.EInternal,
+		Msg:  fmt.Sprintf("%s blob for key %q is corrupt", s.Resource, string(key)),
+	}
+}
+
+func blobChunkKey(key []byte, i uint32) []byte {
+	k := make([]byte, len(key)+5)
+	copy(k, key)
+	k[len(key)] = '/'
+	binary.BigEndian.PutUint32(k[len(key)+1:], i)
+	return k
+}
+
+// readBlobChunk reads up to size bytes from r. A chunk shorter than size means r
+// has been exhausted.
+func readBlobChunk(r io.Reader, size int) ([]byte, error) {
+	chunk := make([]byte, size)
+	n, err := io.ReadFull(r, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return chunk[:n], err
+}
+
+type blobReader struct {
+	s   *StoreBase
+	b   Bucket
+	key []byte
+	n   uint32
+	idx uint32
+	cur []byte
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	for len(r.cur) == 0 {
+		if r.idx >= r.n {
+			return 0, io.EOF
+		}
+		chunk, err := r.b.Get(blobChunkKey(r.key, r.idx))
+		if err != nil {
+			return 0, r.s.errCorruptBlob(r.key)
+		}
+		r.cur = chunk
+		r.idx++
+	}
+
+	n := copy(p, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+func (r *blobReader) Close() error {
+	return nil
+}
@@ -0,0 +1,150 @@
+package kv_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_Blob(t *testing.T) {
+	const chunkSize = 4
+
+	newStore := func(t *testing.T) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("attachment", []byte("attachments"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithBlobChunkSize(chunkSize),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	getBlob := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase, id influxdb.ID) ([]byte, error) {
+		t.Helper()
+
+		var out []byte
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			rc, err := base.GetBlob(context.TODO(), tx, id)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+
+			out, err = ioutil.ReadAll(rc)
+			return err
+		})
+		return out, err
+	}
+
+	countKeys := func(t *testing.T, kvStore kv.Store) int {
+		t.Helper()
+
+		var n int
+		view(t, kvStore, func(tx kv.Tx) error {
+			b, err := tx.Bucket([]byte("attachments"))
+			if err != nil {
+				return err
+			}
+			cur, err := b.Cursor()
+			if err != nil {
+				return err
+			}
+			for k, _ := cur.First(); k != nil; k, _ = cur.Next() {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+
+	tests := []struct {
+		name     string
+		blob     []byte
+		expected int
+	}{
+		{name: "empty", blob: []byte{}, expected: 1},
+		{name: "inline", blob: []byte("abc"), expected: 1},
+		{name: "exactly one chunk", blob: []byte("abcd"), expected: 2},
+		{name: "several chunks", blob: []byte("abcdefghij"), expected: 4},
+		{name: "exact multiple of chunks", blob: []byte("abcdefgh"), expected: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, kvStore, done := newStore(t)
+			defer done()
+
+			update(t, kvStore, func(tx kv.Tx) error {
+				return base.PutBlob(context.TODO(), tx, 1, bytes.NewReader(tt.blob))
+			})
+
+			got, err := getBlob(t, kvStore, base, 1)
+			require.NoError(t, err)
+			assert.Equal(t, tt.blob, got)
+			assert.Equal(t, tt.expected, countKeys(t, kvStore))
+		})
+	}
+
+	t.Run("overwrite removes stale chunks", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.PutBlob(context.TODO(), tx, 1, bytes.NewReader([]byte("abcdefghijklmnop")))
+		})
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.PutBlob(context.TODO(), tx, 1, bytes.NewReader([]byte("xyz")))
+		})
+
+		got, err := getBlob(t, kvStore, base, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("xyz"), got)
+		assert.Equal(t, 1, countKeys(t, kvStore))
+	})
+
+	t.Run("delete removes every chunk", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := base.PutBlob(context.TODO(), tx, 1, bytes.NewReader([]byte("abcdefghij"))); err != nil {
+				return err
+			}
+			return base.PutBlob(context.TODO(), tx, 2, bytes.NewReader([]byte("keep")))
+		})
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.DeleteBlob(context.TODO(), tx, 1)
+		})
+
+		_, err := getBlob(t, kvStore, base, 1)
+		require.Error(t, err)
+		isNotFoundErr(t, err)
+		assert.Equal(t, 2, countKeys(t, kvStore))
+
+		got, err := getBlob(t, kvStore, base, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("keep"), got)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.PutBlob(context.TODO(), tx, 0, bytes.NewReader(nil))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
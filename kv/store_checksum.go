@@ -0,0 +1,53 @@
+package kv
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// frameChecksum flags a frame carrying a checksum of the body.
+const frameChecksum byte = 1 << 1
+
+const frameChecksumLen = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ChecksumFn computes the checksum stored alongside an encoded body.
+type ChecksumFn func(body []byte) uint32
+
+// CRC32Checksum is a ChecksumFn computing the CRC-32 of the body with the
+// Castagnoli polynomial, which is hardware accelerated on most platforms.
+func CRC32Checksum(body []byte) uint32 {
+	return crc32.Checksum(body, castagnoli)
+}
+
+// WithChecksum frames each value the store writes with the checksum of its encoded
+// body, as computed by fn, and verifies it whenever the value is read. A value whose
+// body no longer matches its checksum fails to read with a data corruption error
+// rather than a confusing decode failure. Values written before the option was
+// enabled carry no checksum and remain readable, gaining one when next written,
+// unless a binary body among them begins with 0xff and is misread as a frame.
+// The checksum fn is part of the storage format and may not change once values
+// have been written with it.
+func WithChecksum(fn ChecksumFn) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.checksumFn = fn
+	}
+}
+
+// verifyChecksum checks the body against the checksum it was stored with. Stores
+// without a checksum fn have no means to verify and accept the body as is.
+func (s *StoreBase) verifyChecksum(sum uint32, body []byte) error {
+	if s.checksumFn == nil {
+		return nil
+	}
+	if actual := s.checksumFn(body); actual != sum {
+		return &influxdb.Error{
+			Code: influxdb.EDataCorruption,
+			Msg:  fmt.Sprintf("%s value failed its checksum: stored %08x computed %08x", s.Resource, sum, actual),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_WithChecksum(t *testing.T) {
+	bktName := []byte("foo_checksum")
+
+	newStores := func(t *testing.T, opts ...kv.StoreBaseOptFn) (*kv.StoreBase, *kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		plain := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		opts = append(opts, kv.WithChecksum(kv.CRC32Checksum))
+		base := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn, opts...)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, plain, kvStore, done
+	}
+
+	findEnt := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase, id influxdb.ID) (interface{}, error) {
+		t.Helper()
+
+		var (
+			v   interface{}
+			err error
+		)
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err = base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(id)})
+			return nil
+		})
+		return v, err
+	}
+
+	// corrupt flips a bit of the last byte of the stored value, which lies within
+	// the body whatever the frame.
+	corrupt := func(t *testing.T, kvStore kv.Store, id influxdb.ID) {
+		t.Helper()
+
+		raw := getEntRaw(t, kvStore, bktName, encodeID(t, id))
+		corrupted := append([]byte(nil), raw...)
+		corrupted[len(corrupted)-1] ^= 0x01
+		update(t, kvStore, func(tx kv.Tx) error {
+			b, err := tx.Bucket(bktName)
+			if err != nil {
+				return err
+			}
+			return b.Put(encodeID(t, id), corrupted)
+		})
+	}
+
+	t.Run("detects a corrupted body", func(t *testing.T) {
+		base, _, kvStore, done := newStores(t)
+		defer done()
+
+		ent := newFooEnt(1, 9000, "foo_1")
+		seedEnts(t, kvStore, base, ent, newFooEnt(2, 9000, "foo_2"))
+
+		v, err := findEnt(t, kvStore, base, 1)
+		require.NoError(t, err)
+		assert.Equal(t, ent.Body, v)
+
+		corrupt(t, kvStore, 1)
+
+		_, err = findEnt(t, kvStore, base, 1)
+		require.Error(t, err)
+		assert.True(t, kv.IsDataCorruption(err))
+		assert.Equal(t, influxdb.EDataCorruption, influxdb.ErrorCode(err))
+
+		err = kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{})
+		})
+		assert.True(t, kv.IsDataCorruption(err))
+
+		_, err = findEnt(t, kvStore, base, 2)
+		require.NoError(t, err)
+	})
+
+	t.Run("values without a checksum remain readable", func(t *testing.T) {
+		base, plain, kvStore, done := newStores(t)
+		defer done()
+
+		ent := newFooEnt(1, 9000, "foo_1")
+		seedEnts(t, kvStore, plain, ent)
+
+		v, err := findEnt(t, kvStore, base, 1)
+		require.NoError(t, err)
+		assert.Equal(t, ent.Body, v)
+
+		// rewriting the value adds its checksum
+		seedEnts(t, kvStore, base, ent)
+		corrupt(t, kvStore, 1)
+		_, err = findEnt(t, kvStore, base, 1)
+		assert.True(t, kv.IsDataCorruption(err))
+	})
+
+	t.Run("combines with metadata", func(t *testing.T) {
+		start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+		timeGen := &stepTimeGenerator{now: start}
+		base, _, kvStore, done := newStores(t, kv.WithMetadata(timeGen, 0))
+		defer done()
+
+		ent := newFooEnt(1, 9000, "foo_1")
+		seedEnts(t, kvStore, base, ent)
+
+		timeGen.now = start.Add(time.Hour)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Touch(context.TODO(), tx, 1)
+		})
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			meta, err := base.FindMetadata(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			require.NoError(t, err)
+			assert.Equal(t, kv.Metadata{CreatedAt: start, UpdatedAt: start.Add(time.Hour)}, meta)
+			return nil
+		})
+
+		v, err := findEnt(t, kvStore, base, 1)
+		require.NoError(t, err)
+		assert.Equal(t, ent.Body, v)
+
+		corrupt(t, kvStore, 1)
+		_, err = findEnt(t, kvStore, base, 1)
+		assert.True(t, kv.IsDataCorruption(err))
+	})
+}
@@ -0,0 +1,52 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+)
+
+// ParentWithChildren is a parent found by FindWithChildren along with its children.
+type ParentWithChildren struct {
+	Parent   KV
+	Children []KV
+}
+
+// FindWithChildren lists the parents matching the options along with the children
+// of each, i.e. orgs and their buckets. The children of a parent are those of the
+// child store whose keys have the prefix returned by parentToChildKey for the
+// parent's decoded value, listed in key order. A parent for which it returns an
+// empty prefix has no children.
+//
+// The parents are found first and the children of each are then found by a prefix
+// scan of their own, so listing n parents costs n + 1 scans. A Limit on the options
+// bounds the number of parents, and with it the number of child scans; paginate
+// with it when the parents are many.
+func FindWithChildren(ctx context.Context, tx Tx, parent, child *StoreBase, parentToChildKey func(parent interface{}) []byte, opts FindOpts) ([]ParentWithChildren, error) {
+	span, ctx := parent.startSpan(ctx)
+	defer span.Finish()
+
+	parents, err := parent.FindPairs(ctx, tx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ParentWithChildren, 0, len(parents))
+	for _, p := range parents {
+		result := ParentWithChildren{Parent: p}
+		if prefix := parentToChildKey(p.Val); len(prefix) > 0 {
+			children, err := child.FindPairs(ctx, tx, FindOpts{
+				Ascending: true,
+				Prefix:    prefix,
+				StopFn: func(key []byte) bool {
+					return !bytes.HasPrefix(key, prefix)
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			result.Children = children
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,100 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindWithChildren(t *testing.T) {
+	encOrgKey := func(ent kv.Entity) ([]byte, string, error) {
+		f := ent.Body.(foo)
+		key, err := kv.EncOrgThenNameKey(f.OrgID, f.Name, f.ID)()
+		return key, "org then name key", err
+	}
+
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	orgs := kv.NewStoreBase("org", []byte("orgs_children"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	foos := kv.NewStoreBase("foo", []byte("foos_children"), encOrgKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		if err := orgs.Init(context.TODO(), tx); err != nil {
+			return err
+		}
+		return foos.Init(context.TODO(), tx)
+	})
+
+	seedEnts(t, kvStore, orgs,
+		newFooEnt(9000, 1, "org_a"),
+		newFooEnt(9001, 1, "org_b"),
+		newFooEnt(9002, 1, "org_c"),
+	)
+	seedEnts(t, kvStore, foos,
+		newFooEnt(1, 9000, "foo_1"),
+		newFooEnt(2, 9000, "foo_2"),
+		newFooEnt(3, 9002, "foo_3"),
+	)
+
+	orgToFoos := func(parent interface{}) []byte {
+		prefix, err := kv.EncID(parent.(foo).ID)()
+		require.NoError(t, err)
+		return prefix
+	}
+
+	findWithChildren := func(opts kv.FindOpts) []kv.ParentWithChildren {
+		var results []kv.ParentWithChildren
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			results, err = kv.FindWithChildren(context.TODO(), tx, orgs, foos, orgToFoos, opts)
+			return err
+		})
+		return results
+	}
+
+	summarize := func(results []kv.ParentWithChildren) map[influxdb.ID][]string {
+		out := make(map[influxdb.ID][]string)
+		for _, r := range results {
+			names := []string{}
+			for _, c := range r.Children {
+				names = append(names, c.Val.(foo).Name)
+			}
+			out[r.Parent.Val.(foo).ID] = names
+		}
+		return out
+	}
+
+	t.Run("pairs each parent with its children", func(t *testing.T) {
+		results := findWithChildren(kv.FindOpts{})
+		require.Len(t, results, 3)
+		assert.Equal(t, encodeID(t, 9000), results[0].Parent.Key)
+		assert.Equal(t, map[influxdb.ID][]string{
+			9000: {"foo_1", "foo_2"},
+			9001: {},
+			9002: {"foo_3"},
+		}, summarize(results))
+	})
+
+	t.Run("options bound the parents", func(t *testing.T) {
+		results := findWithChildren(kv.FindOpts{Descending: true, Limit: 1})
+		assert.Equal(t, map[influxdb.ID][]string{9002: {"foo_3"}}, summarize(results))
+	})
+
+	t.Run("empty child key matches no children", func(t *testing.T) {
+		var results []kv.ParentWithChildren
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			results, err = kv.FindWithChildren(context.TODO(), tx, orgs, foos, func(interface{}) []byte { return nil }, kv.FindOpts{})
+			return err
+		})
+		require.Len(t, results, 3)
+		for _, r := range results {
+			assert.Empty(t, r.Children)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package kv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// Compact rewrites the store's bucket into a fresh one so the underlying pages are
+// rebuilt densely, reclaiming the space left fragmented by many overwrites. The
+// pairs are copied in key order to a uniquely named scratch bucket, the original
+// bucket is dropped, and the scratch bucket is renamed in its place with
+// RenameBucket. Dropping a bucket requires a transaction implementing
+// BucketDeleter; against a store whose transactions do not, Compact fails without
+// touching the bucket. The bucket of a namespaced store is compacted in full, every
+// namespace sharing it included.
+//
+// Compact runs within one update transaction, which holds the store's exclusive
+// write lock for the duration. Concurrent readers see either the bucket before or
+// after compaction, and writers block until it completes. The full contents of the
+// bucket are held in memory while it is rewritten.
+func (s *StoreBase) Compact(ctx context.Context, store Store) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	return store.Update(ctx, func(tx Tx) error {
+		deleter, ok := tx.(BucketDeleter)
+		if !ok {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  fmt.Sprintf("cannot compact %s bucket %q as the store cannot drop buckets", s.Resource, string(s.BktName)),
+			}
+		}
+
+		// the whole bucket is copied, not only the namespace of a namespaced store,
+		// as the bucket dropped holds every namespace sharing it.
+		b, err := s.bucket(ctx, tx)
+		if err != nil {
+			return err
+		}
+		cur, err := b.Cursor()
+		if err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+
+		var pairs []Pair
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			pairs = append(pairs, Pair{Key: copyBytes(k), Value: copyBytes(v)})
+		}
+
+		scratchName, err := compactScratchName(s.BktName)
+		if err != nil {
+			return err
+		}
+		scratch, err := tx.Bucket(scratchName)
+		if err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+		for _, p := range pairs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := scratch.Put(p.Key, p.Value); err != nil {
+				return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+			}
+		}
+
+		if err := deleter.DeleteBucket(s.BktName); err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+		return RenameBucket(ctx, tx, scratchName, s.BktName)
+	})
+}
+
+// compactScratchName returns a name for the scratch bucket of a compaction that
+// is unique to it, so no bucket in use is written to or dropped.
+func compactScratchName(bktName []byte) ([]byte, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to name the scratch bucket compacting %q", string(bktName)),
+			Err:  err,
+		}
+	}
+	name := append(copyBytes(bktName), "_compact_"...)
+	return append(name, hex.EncodeToString(suffix)...), nil
+}
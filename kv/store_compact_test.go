@@ -0,0 +1,90 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_Compact(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("foo", []byte("foo_compact"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+
+	ents := []kv.Entity{
+		newFooEnt(1, 9000, "foo_0"),
+		newFooEnt(2, 9000, "foo_1"),
+		newFooEnt(3, 9003, "foo_2"),
+	}
+	seedEnts(t, kvStore, base, ents...)
+	for i := 0; i < 10; i++ {
+		seedEnts(t, kvStore, base, ents...)
+	}
+
+	require.NoError(t, base.Compact(context.Background(), kvStore))
+
+	var actuals []interface{}
+	view(t, kvStore, func(tx kv.Tx) error {
+		return base.Find(context.TODO(), tx, kv.FindOpts{
+			CaptureFn: func(key []byte, decodedVal interface{}) error {
+				actuals = append(actuals, decodedVal)
+				return nil
+			},
+		})
+	})
+	assert.Equal(t, toIfaces(ents...), actuals)
+
+	t.Run("keeps every namespace of a shared bucket", func(t *testing.T) {
+		first := kv.NewNamespacedStoreBase("foo", []byte("foo_compact_shared"), []byte("a/"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		second := kv.NewNamespacedStoreBase("foo", []byte("foo_compact_shared"), []byte("b/"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return first.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, first, ents[0])
+		seedEnts(t, kvStore, second, ents[1:]...)
+
+		require.NoError(t, first.Compact(context.Background(), kvStore))
+
+		for _, tt := range []struct {
+			store *kv.NamespacedStoreBase
+			ents  []kv.Entity
+		}{
+			{store: first, ents: ents[:1]},
+			{store: second, ents: ents[1:]},
+		} {
+			var actuals []interface{}
+			view(t, kvStore, func(tx kv.Tx) error {
+				return tt.store.Find(context.TODO(), tx, kv.FindOpts{
+					CaptureFn: func(key []byte, decodedVal interface{}) error {
+						actuals = append(actuals, decodedVal)
+						return nil
+					},
+				})
+			})
+			assert.Equal(t, toIfaces(tt.ents...), actuals)
+		}
+	})
+
+	t.Run("requires a store able to drop buckets", func(t *testing.T) {
+		err := base.Compact(context.Background(), &noBucketDeleterStore{Store: kvStore})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
+
+// noBucketDeleterStore hides the BucketDeleter implementation of its store's txs.
+type noBucketDeleterStore struct {
+	kv.Store
+}
+
+func (s *noBucketDeleterStore) Update(ctx context.Context, fn func(kv.Tx) error) error {
+	return s.Store.Update(ctx, func(tx kv.Tx) error {
+		return fn(struct{ kv.Tx }{tx})
+	})
+}
@@ -0,0 +1,119 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// CounterStore maintains named int64 counters within a bucket. Each counter is
+// read, modified, and written within the caller's transaction, so increments made
+// in concurrent update transactions never lose one another.
+//
+// A counter that has never been incremented reads as zero. Negative deltas
+// decrement the counter, which may go below zero. An increment that would overflow
+// or underflow an int64 fails with an unprocessable entity error and leaves the
+// counter unchanged.
+type CounterStore struct {
+	store *StoreBase
+}
+
+// NewCounterStore creates a counter store for the resource within the bucket.
+func NewCounterStore(resource string, bktName []byte, opts ...StoreBaseOptFn) *CounterStore {
+	return &CounterStore{
+		store: NewStoreBase(resource, bktName, EncIDKey, encCounterBody, decCounterVal, decCounterEnt, opts...),
+	}
+}
+
+// Init creates the bucket of the counter store.
+func (s *CounterStore) Init(ctx context.Context, tx Tx) error {
+	return s.store.Init(ctx, tx)
+}
+
+// Get returns the current value of the named counter.
+func (s *CounterStore) Get(ctx context.Context, tx Tx, name string) (int64, error) {
+	span, ctx := s.store.startSpan(ctx)
+	defer span.Finish()
+
+	ent, err := s.ent(name)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := s.store.FindEnt(ctx, tx, ent)
+	if err != nil {
+		if influxdb.ErrorCode(err) == influxdb.ENotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return v.(int64), nil
+}
+
+// Incr adds the delta to the named counter and returns its new value.
+func (s *CounterStore) Incr(ctx context.Context, tx Tx, name string, delta int64) (int64, error) {
+	span, ctx := s.store.startSpan(ctx)
+	defer span.Finish()
+
+	n, err := s.Get(ctx, tx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, &influxdb.Error{
+			Code: influxdb.EUnprocessableEntity,
+			Msg:  fmt.Sprintf("%s counter %q at %d cannot be incremented by %d without overflowing", s.store.Resource, name, n, delta),
+		}
+	}
+	n += delta
+
+	ent, err := s.ent(name)
+	if err != nil {
+		return 0, err
+	}
+	ent.Body = n
+	if err := s.store.Put(ctx, tx, ent); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *CounterStore) ent(name string) (Entity, error) {
+	if name == "" {
+		return Entity{}, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s counter name must not be empty", s.store.Resource),
+		}
+	}
+	return Entity{PK: EncString(name)}, nil
+}
+
+func encCounterBody(ent Entity) ([]byte, string, error) {
+	n, ok := ent.Body.(int64)
+	if !ok {
+		return nil, "counter value", fmt.Errorf("unexpected counter value of type %T", ent.Body)
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	return b, "counter value", nil
+}
+
+func decCounterVal(key, val []byte) ([]byte, interface{}, error) {
+	if len(val) != 8 {
+		return nil, nil, errors.New("counter value must be 8 bytes")
+	}
+	return key, int64(binary.BigEndian.Uint64(val)), nil
+}
+
+func decCounterEnt(k []byte, v interface{}) (Entity, error) {
+	n, ok := v.(int64)
+	if err := IsErrUnexpectedDecodeVal(ok); err != nil {
+		return Entity{}, err
+	}
+	return Entity{PK: EncString(string(k)), Body: n}, nil
+}
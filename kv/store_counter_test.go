@@ -0,0 +1,96 @@
+package kv_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterStore(t *testing.T) {
+	newStore := func(t *testing.T) (*kv.CounterStore, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		counters := kv.NewCounterStore("usage", []byte("usage_counters"))
+		update(t, kvStore, func(tx kv.Tx) error {
+			return counters.Init(context.TODO(), tx)
+		})
+		return counters, kvStore, done
+	}
+
+	incr := func(kvStore kv.Store, counters *kv.CounterStore, name string, delta int64) (int64, error) {
+		var n int64
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			var err error
+			n, err = counters.Incr(context.TODO(), tx, name, delta)
+			return err
+		})
+		return n, err
+	}
+
+	get := func(t *testing.T, kvStore kv.Store, counters *kv.CounterStore, name string) int64 {
+		t.Helper()
+
+		var n int64
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			n, err = counters.Get(context.TODO(), tx, name)
+			return err
+		})
+		return n
+	}
+
+	t.Run("increments and decrements", func(t *testing.T) {
+		counters, kvStore, done := newStore(t)
+		defer done()
+
+		assert.Zero(t, get(t, kvStore, counters, "writes"))
+
+		n, err := incr(kvStore, counters, "writes", 5)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), n)
+
+		n, err = incr(kvStore, counters, "writes", -7)
+		require.NoError(t, err)
+		assert.Equal(t, int64(-2), n)
+
+		assert.Equal(t, int64(-2), get(t, kvStore, counters, "writes"))
+		assert.Zero(t, get(t, kvStore, counters, "reads"))
+	})
+
+	t.Run("overflow leaves the counter unchanged", func(t *testing.T) {
+		counters, kvStore, done := newStore(t)
+		defer done()
+
+		_, err := incr(kvStore, counters, "big", math.MaxInt64-1)
+		require.NoError(t, err)
+
+		_, err = incr(kvStore, counters, "big", 2)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EUnprocessableEntity, influxdb.ErrorCode(err))
+		assert.Equal(t, int64(math.MaxInt64-1), get(t, kvStore, counters, "big"))
+
+		_, err = incr(kvStore, counters, "small", math.MinInt64)
+		require.NoError(t, err)
+
+		_, err = incr(kvStore, counters, "small", -1)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EUnprocessableEntity, influxdb.ErrorCode(err))
+	})
+
+	t.Run("empty name is invalid", func(t *testing.T) {
+		counters, kvStore, done := newStore(t)
+		defer done()
+
+		_, err := incr(kvStore, counters, "", 1)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
@@ -0,0 +1,66 @@
+package kv
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// DecodePanicError is the underlying error of a DecodePipeline call whose decode or
+// convert func panicked on the bytes provided to it.
+type DecodePanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *DecodePanicError) Error() string {
+	return fmt.Sprintf("panic while decoding: %v", e.Value)
+}
+
+// IsDecodePanic reports whether the error is the result of a panic recovered by
+// DecodePipeline.
+func IsDecodePanic(err error) bool {
+	iErr, ok := err.(*influxdb.Error)
+	if !ok {
+		return false
+	}
+	_, ok = iErr.Err.(*DecodePanicError)
+	return ok
+}
+
+// DecodePipeline runs the full decode path of a store on a raw key and value: the
+// bucket value is decoded by decFn and converted to an entity by convFn. A panic in
+// either func is recovered and returned as an error satisfying IsDecodePanic, so the
+// pipeline can be fed arbitrary bytes, as a fuzzer does, to harden a store's codec
+// against corrupt stored values.
+func DecodePipeline(decFn DecodeBucketValFn, convFn ConvertValToEntFn, key, val []byte) (ent Entity, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ent, err = Entity{}, &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to decode value at key %q", string(key)),
+				Err:  &DecodePanicError{Value: r, Stack: debug.Stack()},
+			}
+		}
+	}()
+
+	k, v, err := decFn(key, val)
+	if err != nil {
+		return Entity{}, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to decode value at key %q", string(key)),
+			Err:  err,
+		}
+	}
+
+	ent, err = convFn(k, v)
+	if err != nil {
+		return Entity{}, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to convert value at key %q", string(key)),
+			Err:  err,
+		}
+	}
+	return ent, nil
+}
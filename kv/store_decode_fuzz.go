@@ -0,0 +1,39 @@
+// +build gofuzz
+
+package kv
+
+// FuzzCodec is the body of a go-fuzz entrypoint for a store's codec. The input is
+// split into a key and a value, the first byte giving the length of the key, and
+// run through DecodePipeline. A recovered panic is raised again so go-fuzz records
+// the input as a crasher.
+func FuzzCodec(decFn DecodeBucketValFn, convFn ConvertValToEntFn, data []byte) int {
+	if len(data) == 0 {
+		return -1
+	}
+
+	keyLen := int(data[0])
+	data = data[1:]
+	if keyLen > len(data) {
+		keyLen = len(data)
+	}
+	key, val := data[:keyLen], data[keyLen:]
+
+	_, err := DecodePipeline(decFn, convFn, key, val)
+	if IsDecodePanic(err) {
+		panic(err.Error())
+	}
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// FuzzOrgNameKeyCodec fuzzes the codec of the org and name unique key stores. Seed
+// inputs live in testdata/fuzz/orgnamekey/corpus. Run with:
+//
+//	go-fuzz-build -func FuzzOrgNameKeyCodec github.com/influxdata/influxdb/v2/kv
+//	go-fuzz -bin kv-fuzz.zip -workdir testdata/fuzz/orgnamekey
+func FuzzOrgNameKeyCodec(data []byte) int {
+	s := NewOrgNameKeyStore("fuzz", []byte("fuzz"), false)
+	return FuzzCodec(s.DecodeEntFn, s.ConvertValToEntFn, data)
+}
@@ -0,0 +1,39 @@
+package kv
+
+import (
+	"sync"
+)
+
+// WithDecodePool returns the values decoded by Find to pool once they are done
+// with, so a DecodeBucketValFn drawing its targets from the same pool reuses them
+// rather than allocating a value per row. It suits list heavy stores on hot paths.
+//
+// Pooling is unsafe unless every reader of the store honors its contract: a value
+// provided to a CaptureFn, IndexedCaptureFn, or FilterEntFn is only valid until the
+// function returns. Its fields are overwritten by the decode of a later row, so a
+// capture that keeps the value, or a pointer into it, past its return must copy
+// it. The same holds for OnDeleteFn hooks run by Delete. Values skipped by a filter
+// are returned to the pool too.
+//
+// The store's own finds that return values to their caller, FindPairs, FindOne,
+// FindTyped, and Sample, never return them to the pool, nor do FindEnt and the
+// finds over indexes. The option has no effect on stores with a decode cache or a
+// read transform, whose values are shared with or produced outside of the decode.
+func WithDecodePool(pool *sync.Pool) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.decodePool = pool
+	}
+}
+
+// releaseFn returns the function a Find passes its decoded values to once done
+// with them, or nil when they are not pooled.
+func (s *StoreBase) releaseFn(opts FindOpts) func(decodedVal interface{}) {
+	if s.decodePool == nil || s.decodeCache != nil || s.readTransform != nil || opts.retain {
+		return nil
+	}
+	return func(decodedVal interface{}) {
+		if decodedVal != nil {
+			s.decodePool.Put(decodedVal)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package kv_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_DecodePool(t *testing.T) {
+	const rows = 20
+
+	newStore := func(t *testing.T) (*kv.StoreBase, kv.Store, *int) {
+		t.Helper()
+
+		kvStore, _, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		var allocs int
+		pool := &sync.Pool{New: func() interface{} {
+			allocs++
+			return new(foo)
+		}}
+		decPooledFn := func(key, val []byte) ([]byte, interface{}, error) {
+			f := pool.Get().(*foo)
+			*f = foo{}
+			if err := json.Unmarshal(val, f); err != nil {
+				return nil, nil, err
+			}
+			return key, f, nil
+		}
+		decPooledEntFn := func(k []byte, v interface{}) (kv.Entity, error) {
+			return decFooEntFn(k, *v.(*foo))
+		}
+
+		base := kv.NewStoreBase("foo", []byte("foo_decode_pool"), kv.EncIDKey, kv.EncBodyJSON, decPooledFn, decPooledEntFn, kv.WithDecodePool(pool))
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+
+		var ents []kv.Entity
+		for i := 1; i <= rows; i++ {
+			ents = append(ents, newFooEnt(influxdb.ID(i), 9000, "foo"))
+		}
+		seedEnts(t, kvStore, base, ents...)
+		allocs = 0
+		return base, kvStore, &allocs
+	}
+
+	t.Run("reuses values released after capture", func(t *testing.T) {
+		base, kvStore, allocs := newStore(t)
+
+		var ids []influxdb.ID
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					// the value is only valid until the capture returns
+					ids = append(ids, decodedVal.(*foo).ID)
+					return nil
+				},
+			})
+		})
+		require.Len(t, ids, rows)
+		for i, id := range ids {
+			assert.Equal(t, influxdb.ID(i+1), id)
+		}
+		assert.True(t, *allocs < rows, "expected pooled values to be reused; allocated %d for %d rows", *allocs, rows)
+	})
+
+	t.Run("finds returning values never release them", func(t *testing.T) {
+		base, kvStore, allocs := newStore(t)
+
+		var pairs []kv.KV
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			pairs, err = base.FindPairs(context.TODO(), tx, kv.FindOpts{})
+			return err
+		})
+		require.Len(t, pairs, rows)
+		for i, p := range pairs {
+			assert.Equal(t, influxdb.ID(i+1), p.Val.(*foo).ID)
+		}
+		assert.Equal(t, rows, *allocs)
+	})
+}
@@ -0,0 +1,48 @@
+package kv_test
+
+import (
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodePipeline(t *testing.T) {
+	t.Run("decodes and converts", func(t *testing.T) {
+		expected := newFooEnt(1, 9000, "foo_1")
+		val := []byte(`{"id":"0000000000000001","orgID":"0000000000002328","name":"foo_1"}`)
+
+		ent, err := kv.DecodePipeline(decJSONFooFn, decFooEntFn, encodeID(t, 1), val)
+		require.NoError(t, err)
+		assert.Equal(t, expected.Body, ent.Body)
+	})
+
+	t.Run("decode error", func(t *testing.T) {
+		_, err := kv.DecodePipeline(decJSONFooFn, decFooEntFn, encodeID(t, 1), []byte("{"))
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+		assert.False(t, kv.IsDecodePanic(err))
+	})
+
+	t.Run("panic is recovered", func(t *testing.T) {
+		panicFn := func(k []byte, v interface{}) (kv.Entity, error) {
+			var m map[string]int
+			m["boom"]++
+			return kv.Entity{}, nil
+		}
+
+		_, err := kv.DecodePipeline(kv.DecIndexID, panicFn, nil, encodeID(t, 1))
+		require.Error(t, err)
+		assert.True(t, kv.IsDecodePanic(err))
+	})
+
+	t.Run("org name key codec rejects short keys", func(t *testing.T) {
+		s := kv.NewOrgNameKeyStore("foo", []byte("foo_index"), false)
+
+		_, err := kv.DecodePipeline(s.DecodeEntFn, s.ConvertValToEntFn, []byte("00002328"), encodeID(t, 1))
+		require.Error(t, err)
+		assert.False(t, kv.IsDecodePanic(err))
+	})
+}
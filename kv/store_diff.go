@@ -0,0 +1,65 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// DiffReport describes the differences between the raw contents of two stores.
+// All keys are reported in ascending byte order.
+type DiffReport struct {
+	OnlyInA   [][]byte
+	OnlyInB   [][]byte
+	Differing [][]byte
+}
+
+// Empty returns true when the two stores compared held identical contents.
+func (d DiffReport) Empty() bool {
+	return len(d.OnlyInA) == 0 && len(d.OnlyInB) == 0 && len(d.Differing) == 0
+}
+
+// DiffStores compares the buckets of the two stores provided and reports the keys
+// only found in a, the keys only found in b, and the keys found in both whose
+// values differ. The comparison is done on raw bytes so it is agnostic to the
+// codecs of either store. Both buckets are walked in key order side by side, so
+// only the differing keys are held in memory.
+func DiffStores(ctx context.Context, tx Tx, a, b *StoreBase) (DiffReport, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	curA, err := a.bucketCursor(ctx, tx)
+	if err != nil {
+		return DiffReport{}, err
+	}
+	curB, err := b.bucketCursor(ctx, tx)
+	if err != nil {
+		return DiffReport{}, err
+	}
+
+	var report DiffReport
+	kA, vA := curA.First()
+	kB, vB := curB.First()
+	for kA != nil || kB != nil {
+		if err := ctx.Err(); err != nil {
+			return DiffReport{}, err
+		}
+
+		switch {
+		case kB == nil || (kA != nil && bytes.Compare(kA, kB) < 0):
+			report.OnlyInA = append(report.OnlyInA, copyBytes(kA))
+			kA, vA = curA.Next()
+		case kA == nil || bytes.Compare(kA, kB) > 0:
+			report.OnlyInB = append(report.OnlyInB, copyBytes(kB))
+			kB, vB = curB.Next()
+		default:
+			if !bytes.Equal(vA, vB) {
+				report.Differing = append(report.Differing, copyBytes(kA))
+			}
+			kA, vA = curA.Next()
+			kB, vB = curB.Next()
+		}
+	}
+	return report, nil
+}
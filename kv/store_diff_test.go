@@ -0,0 +1,55 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffStores(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	a := kv.NewStoreBase("foo", []byte("foo_diff_a"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	b := kv.NewStoreBase("foo", []byte("foo_diff_b"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+
+	update(t, kvStore, func(tx kv.Tx) error {
+		if err := a.Init(context.TODO(), tx); err != nil {
+			return err
+		}
+		return b.Init(context.TODO(), tx)
+	})
+
+	seedEnts(t, kvStore, a,
+		newFooEnt(1, 9000, "foo_1"),
+		newFooEnt(2, 9000, "foo_2"),
+		newFooEnt(3, 9000, "foo_3"),
+	)
+	seedEnts(t, kvStore, b,
+		newFooEnt(2, 9000, "foo_2"),
+		newFooEnt(3, 9000, "foo_3_changed"),
+		newFooEnt(4, 9000, "foo_4"),
+	)
+
+	var report kv.DiffReport
+	view(t, kvStore, func(tx kv.Tx) error {
+		r, err := kv.DiffStores(context.TODO(), tx, a, b)
+		report = r
+		return err
+	})
+
+	assert.False(t, report.Empty())
+	assert.Equal(t, [][]byte{encodeID(t, 1)}, report.OnlyInA)
+	assert.Equal(t, [][]byte{encodeID(t, 4)}, report.OnlyInB)
+	assert.Equal(t, [][]byte{encodeID(t, 3)}, report.Differing)
+
+	view(t, kvStore, func(tx kv.Tx) error {
+		r, err := kv.DiffStores(context.TODO(), tx, a, a)
+		assert.True(t, r.Empty())
+		return err
+	})
+}
@@ -0,0 +1,62 @@
+package kv
+
+import (
+	"errors"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// IsConflict reports whether the error is a store operation failing on the state
+// it found, i.e. a create of an existing entity, a failed compare and swap, or a
+// version mismatch.
+func IsConflict(err error) bool {
+	return storeErrorCode(err) == influxdb.EConflict
+}
+
+// IsInvalid reports whether the error is a store operation rejecting its input,
+// i.e. a malformed key or entity.
+func IsInvalid(err error) bool {
+	return storeErrorCode(err) == influxdb.EInvalid
+}
+
+// IsTooLarge reports whether the error is a store operation exceeding a size or
+// scan limit, i.e. ErrMaxScanExceeded.
+func IsTooLarge(err error) bool {
+	return storeErrorCode(err) == influxdb.ETooLarge
+}
+
+// IsEntNotFound reports whether the error is a store failing to find an entity. It
+// differs from IsNotFound, which matches only the ErrKeyNotFound of a bucket.
+func IsEntNotFound(err error) bool {
+	return storeErrorCode(err) == influxdb.ENotFound
+}
+
+// IsDataCorruption reports whether the error is a stored value failing its integrity
+// check, i.e. a checksum mismatch of a store with WithChecksum.
+func IsDataCorruption(err error) bool {
+	return storeErrorCode(err) == influxdb.EDataCorruption
+}
+
+// IsReferenceNotFound reports whether the error is a Put referencing an entity
+// that does not exist, as declared with WithReference.
+func IsReferenceNotFound(err error) bool {
+	return storeErrorCode(err) == influxdb.EReferenceNotFound
+}
+
+// IsMultipleResults reports whether the error is a lookup expecting a single entity
+// matching more than one, as from FindOne.
+func IsMultipleResults(err error) bool {
+	return storeErrorCode(err) == influxdb.EMultipleResults
+}
+
+// storeErrorCode returns the code of the first *influxdb.Error in the error's
+// chain, so errors wrapped by callers with fmt.Errorf are matched too. The codes
+// remain the source of truth, keeping the helpers consistent with checks of
+// influxdb.ErrorCode.
+func storeErrorCode(err error) string {
+	var iErr *influxdb.Error
+	if !errors.As(err, &iErr) {
+		return ""
+	}
+	return influxdb.ErrorCode(iErr)
+}
@@ -0,0 +1,71 @@
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreErrors(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("foo", []byte("foo_errors"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+	seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2"))
+
+	t.Run("conflict", func(t *testing.T) {
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, newFooEnt(1, 9000, "foo_1"), kv.PutNew())
+		})
+		assert.True(t, kv.IsConflict(err))
+		assert.Equal(t, influxdb.EConflict, influxdb.ErrorCode(err))
+		assert.False(t, kv.IsInvalid(err))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, kv.Entity{})
+		})
+		assert.True(t, kv.IsInvalid(err))
+		assert.False(t, kv.IsConflict(err))
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{MaxScan: 1})
+		})
+		assert.True(t, kv.IsTooLarge(err))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			_, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(3)})
+			return err
+		})
+		assert.True(t, kv.IsEntNotFound(err))
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		err := fmt.Errorf("creating foo: %w", &influxdb.Error{Code: influxdb.EConflict})
+		assert.True(t, kv.IsConflict(err))
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		for _, err := range []error{nil, errors.New("boom"), kv.ErrKeyNotFound} {
+			assert.False(t, kv.IsConflict(err))
+			assert.False(t, kv.IsInvalid(err))
+			assert.False(t, kv.IsTooLarge(err))
+			assert.False(t, kv.IsEntNotFound(err))
+		}
+	})
+}
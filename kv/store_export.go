@@ -0,0 +1,71 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// ExportRecord is a single entity as written by ExportJSON, one per line. The
+// key is the raw key of the entity in the store's bucket and the value is the JSON
+// encoding of its decoded value.
+type ExportRecord struct {
+	Key   []byte          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// RedactFn strips sensitive fields from a decoded value before it leaves the store
+// in an export or sample. It must return a copy rather than modify the value it is
+// given, which may be shared with the store's other readers.
+type RedactFn func(decodedVal interface{}) interface{}
+
+// WithRedactFn registers fn to redact the values emitted by ExportJSON and Sample.
+// Find, FindEnt, and the store's other reads are unaffected.
+func WithRedactFn(fn RedactFn) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.redactFn = fn
+	}
+}
+
+// ExportJSON writes every entity of the store to w as newline delimited
+// ExportRecords in key order, returning the number of entities written. Values are
+// redacted by the store's RedactFn when one is registered.
+func (s *StoreBase) ExportJSON(ctx context.Context, tx Tx, w io.Writer) (int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	enc := json.NewEncoder(w)
+	var n int
+	err := s.Find(ctx, tx, FindOpts{
+		Ascending: true,
+		CaptureFn: func(key []byte, decodedVal interface{}) error {
+			val, err := json.Marshal(s.redact(decodedVal))
+			if err != nil {
+				return &influxdb.Error{
+					Code: influxdb.EInternal,
+					Msg:  fmt.Sprintf("failed to encode %s for key %q", s.Resource, string(key)),
+					Err:  err,
+				}
+			}
+			if err := enc.Encode(ExportRecord{Key: key, Value: val}); err != nil {
+				return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+			}
+			n++
+			return nil
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *StoreBase) redact(decodedVal interface{}) interface{} {
+	if s.redactFn == nil {
+		return decodedVal
+	}
+	return s.redactFn(decodedVal)
+}
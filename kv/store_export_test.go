@@ -0,0 +1,96 @@
+package kv_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_ExportJSON(t *testing.T) {
+	redactName := func(v interface{}) interface{} {
+		f := v.(foo)
+		f.Name = "REDACTED"
+		return f
+	}
+
+	newStore := func(t *testing.T, opts ...kv.StoreBaseOptFn) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_export"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn, opts...)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9001, "foo_2"))
+		return base, kvStore, done
+	}
+
+	export := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase) []kv.ExportRecord {
+		t.Helper()
+
+		var buf bytes.Buffer
+		view(t, kvStore, func(tx kv.Tx) error {
+			n, err := base.ExportJSON(context.TODO(), tx, &buf)
+			assert.Equal(t, 2, n)
+			return err
+		})
+
+		var records []kv.ExportRecord
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			var r kv.ExportRecord
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+			records = append(records, r)
+		}
+		require.NoError(t, scanner.Err())
+		return records
+	}
+
+	decode := func(t *testing.T, raw json.RawMessage) foo {
+		t.Helper()
+
+		var f foo
+		require.NoError(t, json.Unmarshal(raw, &f))
+		return f
+	}
+
+	t.Run("exports every entity", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		records := export(t, kvStore, base)
+		require.Len(t, records, 2)
+		assert.Equal(t, encodeID(t, 1), records[0].Key)
+		assert.Equal(t, foo{ID: 1, OrgID: 9000, Name: "foo_1"}, decode(t, records[0].Value))
+		assert.Equal(t, encodeID(t, 2), records[1].Key)
+		assert.Equal(t, foo{ID: 2, OrgID: 9001, Name: "foo_2"}, decode(t, records[1].Value))
+	})
+
+	t.Run("redacts exports and samples only", func(t *testing.T) {
+		base, kvStore, done := newStore(t, kv.WithRedactFn(redactName))
+		defer done()
+
+		for _, r := range export(t, kvStore, base) {
+			assert.Equal(t, "REDACTED", decode(t, r.Value).Name)
+		}
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			samples, err := base.Sample(context.TODO(), tx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, []interface{}{foo{ID: 1, OrgID: 9000, Name: "REDACTED"}}, samples)
+
+			v, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			require.NoError(t, err)
+			assert.Equal(t, foo{ID: 1, OrgID: 9000, Name: "foo_1"}, v)
+			return nil
+		})
+	})
+}
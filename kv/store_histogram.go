@@ -0,0 +1,55 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// KeyHistogramMaxBuckets bounds the number of distinct prefixes counted by
+// KeyHistogram. Keys with prefixes seen after the bound is reached are counted
+// under KeyHistogramOverflow.
+const KeyHistogramMaxBuckets = 10000
+
+// KeyHistogramOverflow is the histogram bucket counting the keys whose prefixes were
+// first seen after KeyHistogramMaxBuckets distinct prefixes had been counted. Every
+// key has a non empty prefix, so it never collides with a real prefix.
+const KeyHistogramOverflow = ""
+
+// KeyHistogram counts the keys of the store by their first prefixLen bytes, keys
+// shorter than that being counted whole. It reveals skew in the key space, such as
+// one organization owning most of a resource, to inform the choice of shard count
+// and key prefixes. Only keys are read; values are never decoded.
+func (s *StoreBase) KeyHistogram(ctx context.Context, tx Tx, prefixLen int) (map[string]int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if prefixLen <= 0 {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("key histogram prefix length must be positive; got %d", prefixLen),
+		}
+	}
+
+	hist := make(map[string]int)
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return hist, nil
+		}
+		return nil, err
+	}
+
+	for k, _ := cur.First(); k != nil; k, _ = cur.Next() {
+		if len(k) > prefixLen {
+			k = k[:prefixLen]
+		}
+		if _, ok := hist[string(k)]; !ok && len(hist) >= KeyHistogramMaxBuckets {
+			hist[KeyHistogramOverflow]++
+			continue
+		}
+		hist[string(k)]++
+	}
+	return hist, nil
+}
@@ -0,0 +1,59 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_KeyHistogram(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	encOrgNameKey := func(ent kv.Entity) ([]byte, string, error) {
+		f := ent.Body.(foo)
+		key, err := kv.EncOrgThenNameKey(f.OrgID, f.Name, f.ID)()
+		return key, "org then name key", err
+	}
+	base := kv.NewStoreBase("foo", []byte("foo_histogram"), encOrgNameKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	seedEnts(t, kvStore, base,
+		newFooEnt(1, 8000, "foo_0"),
+		newFooEnt(2, 9000, "foo_1"),
+		newFooEnt(3, 9000, "foo_2"),
+		newFooEnt(4, 9000, "foo_3"),
+		newFooEnt(5, 9001, "foo_4"),
+	)
+
+	histogram := func(prefixLen int) (map[string]int, error) {
+		var hist map[string]int
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			var err error
+			hist, err = base.KeyHistogram(context.TODO(), tx, prefixLen)
+			return err
+		})
+		return hist, err
+	}
+
+	hist, err := histogram(influxdb.IDLength)
+	require.NoError(t, err)
+
+	expected := map[string]int{
+		string(encodeID(t, 8000)): 1,
+		string(encodeID(t, 9000)): 3,
+		string(encodeID(t, 9001)): 1,
+	}
+	assert.Equal(t, expected, hist)
+
+	_, err = histogram(0)
+	require.Error(t, err)
+	assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+}
@@ -0,0 +1,307 @@
+package kv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// RemapIDFn returns the ID to import an entity or reference under in place of the
+// ID it had in the exported data.
+type RemapIDFn func(old influxdb.ID) (influxdb.ID, error)
+
+// ImportWithRemap reads the newline delimited ExportRecords written by ExportJSON
+// and puts them in the store under new IDs, returning the number of entities
+// imported and the mapping of every old ID seen to its new ID. Callers use the
+// mapping to fix up references held in other stores.
+//
+// The remap is called once per distinct ID, so an ID is mapped consistently
+// wherever it appears. It is applied to the fields of the value named by the ID
+// paths, being only the top level "ID" field unless others are provided with
+// WithImportIDPaths. The exported key is not rewritten; each entity is put under
+// the key its store's EncodeEntKeyFn derives from the remapped value, so composite
+// keys embedding an ID follow the remap as well. A remap that returns the old ID
+// leaves references, such as the owning org, untouched. Entities are created rather
+// than overwritten, so an ID the remap fails to move clear of an existing entity
+// fails the import with a conflict instead of clobbering local data, unless the
+// conflict is resolved by WithImportResolveFn.
+func (s *StoreBase) ImportWithRemap(ctx context.Context, tx Tx, r io.Reader, remap RemapIDFn, opts ...ImportOptFn) (int, map[influxdb.ID]influxdb.ID, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	o := importOpts{idPaths: [][]string{{"ID"}}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	im := &importRemapper{remap: remap, paths: o.idPaths, ids: make(map[influxdb.ID]influxdb.ID)}
+
+	var (
+		n    int
+		line int
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var rec ExportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return 0, nil, &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  fmt.Sprintf("invalid %s import record on line %d", s.Resource, line),
+				Err:  err,
+			}
+		}
+
+		ent, err := s.remapRecord(im, rec)
+		if err != nil {
+			return 0, nil, err
+		}
+		written, err := s.importEnt(ctx, tx, ent, o)
+		if err != nil {
+			return 0, nil, err
+		}
+		if written {
+			n++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to read %s import", s.Resource),
+			Err:  err,
+		}
+	}
+	return n, im.ids, nil
+}
+
+// ImportOptFn is a functional option for configuring ImportWithRemap.
+type ImportOptFn func(o *importOpts)
+
+type importOpts struct {
+	resolveFn ResolveFn
+	idPaths   [][]string
+}
+
+// WithImportIDPaths sets the paths of the ID fields the remap is applied to, in
+// place of the default top level "ID" field. A path names the fields leading to an
+// ID from the top of the value, separated by dots, such as "OrgID" or "Owner.ID".
+// Lists met along a path are traversed, so a path may name a field holding a list
+// of IDs or a list of objects each holding one. Field names match exactly, and a
+// field absent from a value or holding an empty string is skipped.
+func WithImportIDPaths(paths ...string) ImportOptFn {
+	return func(o *importOpts) {
+		o.idPaths = o.idPaths[:0]
+		for _, p := range paths {
+			o.idPaths = append(o.idPaths, strings.Split(p, "."))
+		}
+	}
+}
+
+// WithImportResolveFn resolves an imported entity whose key the store already holds
+// with fn rather than failing the import with a conflict. The fn is provided the
+// stored and imported bodies, as encoded by the store, and the body it returns is
+// decoded and put in place of the stored one. Returning the stored body keeps the
+// entity as it is, and such entities do not count as imported.
+func WithImportResolveFn(fn ResolveFn) ImportOptFn {
+	return func(o *importOpts) {
+		o.resolveFn = fn
+	}
+}
+
+// importEnt creates the imported entity, resolving a conflict with an existing one
+// when configured to, and reports whether it was written.
+func (s *StoreBase) importEnt(ctx context.Context, tx Tx, ent Entity, o importOpts) (bool, error) {
+	if o.resolveFn == nil {
+		return true, s.Put(ctx, tx, ent, PutNew())
+	}
+
+	key, err := s.EntKey(ctx, ent)
+	if err != nil {
+		return false, err
+	}
+	raw, err := s.bucketGet(ctx, tx, key)
+	if influxdb.ErrorCode(err) == influxdb.ENotFound {
+		return true, s.Put(ctx, tx, ent, PutNew())
+	}
+	if err != nil {
+		return false, err
+	}
+	existing, err := s.unframe(raw)
+	if err != nil {
+		return false, err
+	}
+
+	incoming, err := s.encodeEnt(ctx, ent, s.EncodeEntBodyFn)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(existing.body, incoming) {
+		return false, nil
+	}
+
+	resolved, err := o.resolveFn(key, existing.body, incoming)
+	if err != nil {
+		return false, &influxdb.Error{
+			Code: influxdb.EConflict,
+			Msg:  fmt.Sprintf("failed to resolve imported %s for key %q", s.Resource, string(key)),
+			Err:  err,
+		}
+	}
+	if bytes.Equal(resolved, existing.body) {
+		return false, nil
+	}
+
+	_, decodedVal, err := s.DecodeEntFn(key, resolved)
+	if err != nil {
+		return false, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("failed to decode resolved %s for key %q", s.Resource, string(key)),
+			Err:  err,
+		}
+	}
+	resolvedEnt, err := s.ConvertValToEntFn(key, decodedVal)
+	if err != nil {
+		return false, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("failed to convert resolved %s for key %q", s.Resource, string(key)),
+			Err:  err,
+		}
+	}
+	if resolvedEnt.Body == nil {
+		resolvedEnt.Body = decodedVal
+	}
+	return true, s.PutRaw(ctx, tx, key, resolvedEnt)
+}
+
+func (s *StoreBase) remapRecord(im *importRemapper, rec ExportRecord) (Entity, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(rec.Value))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return Entity{}, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("invalid %s import value for key %q", s.Resource, string(rec.Key)),
+			Err:  err,
+		}
+	}
+	for _, path := range im.paths {
+		var err error
+		if v, err = im.remapPath(v, path); err != nil {
+			return Entity{}, &influxdb.Error{
+				Code: influxdb.ErrorCode(err),
+				Msg:  fmt.Sprintf("failed to remap %s %s for key %q", s.Resource, strings.Join(path, "."), string(rec.Key)),
+				Err:  err,
+			}
+		}
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return Entity{}, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	_, decodedVal, err := s.DecodeEntFn(rec.Key, body)
+	if err != nil {
+		return Entity{}, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("failed to decode imported %s for key %q", s.Resource, string(rec.Key)),
+			Err:  err,
+		}
+	}
+	ent, err := s.ConvertValToEntFn(rec.Key, decodedVal)
+	if err != nil {
+		return Entity{}, err
+	}
+	if ent.Body == nil {
+		ent.Body = decodedVal
+	}
+	return ent, nil
+}
+
+// importRemapper memoizes the remap of an import, so each old ID is remapped once.
+type importRemapper struct {
+	remap RemapIDFn
+	paths [][]string
+	ids   map[influxdb.ID]influxdb.ID
+}
+
+func (im *importRemapper) id(old influxdb.ID) (influxdb.ID, error) {
+	if id, ok := im.ids[old]; ok {
+		return id, nil
+	}
+	id, err := im.remap(old)
+	if err != nil {
+		return 0, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to remap id %s", old),
+			Err:  err,
+		}
+	}
+	if !id.Valid() {
+		return 0, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("id %s remapped to an invalid id", old),
+		}
+	}
+	im.ids[old] = id
+	return id, nil
+}
+
+// remapPath remaps the IDs found at the path within the JSON value v, returning
+// the remapped value.
+func (im *importRemapper) remapPath(v interface{}, path []string) (interface{}, error) {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, ev := range v {
+			nv, err := im.remapPath(ev, path)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = nv
+		}
+		return v, nil
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return v, nil
+		}
+		fv, ok := v[path[0]]
+		if !ok {
+			return v, nil
+		}
+		nv, err := im.remapPath(fv, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		v[path[0]] = nv
+		return v, nil
+	case string:
+		if len(path) != 0 || v == "" {
+			return v, nil
+		}
+		var old influxdb.ID
+		if err := old.DecodeFromString(v); err != nil {
+			return nil, &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  fmt.Sprintf("%q is not a valid id", v),
+				Err:  err,
+			}
+		}
+		id, err := im.id(old)
+		if err != nil {
+			return nil, err
+		}
+		return id.String(), nil
+	default:
+		return v, nil
+	}
+}
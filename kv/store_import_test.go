@@ -0,0 +1,253 @@
+package kv_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_ImportWithRemap(t *testing.T) {
+	newStore := func(t *testing.T, bktSuffix string) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_import_"+bktSuffix), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithNameFoldIndex([]byte("foo_import_name_fold_"+bktSuffix), fooNameFn, true),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	exported := func(t *testing.T) *bytes.Buffer {
+		t.Helper()
+
+		src, kvStore, done := newStore(t, "src")
+		defer done()
+
+		seedEnts(t, kvStore, src, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2"))
+
+		var buf bytes.Buffer
+		view(t, kvStore, func(tx kv.Tx) error {
+			_, err := src.ExportJSON(context.TODO(), tx, &buf)
+			return err
+		})
+		return &buf
+	}
+
+	t.Run("imports under new ids", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "remap")
+		defer done()
+
+		local := newFooEnt(1, 9000, "local")
+		seedEnts(t, kvStore, base, local)
+
+		var calls int
+		remap := func(old influxdb.ID) (influxdb.ID, error) {
+			calls++
+			if old == 9000 {
+				return old, nil
+			}
+			return old + 100, nil
+		}
+
+		var (
+			n   int
+			ids map[influxdb.ID]influxdb.ID
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			n, ids, err = base.ImportWithRemap(context.TODO(), tx, exported(t), remap, kv.WithImportIDPaths("ID", "OrgID"))
+			return err
+		})
+
+		assert.Equal(t, 2, n)
+		assert.Equal(t, map[influxdb.ID]influxdb.ID{1: 101, 2: 102, 9000: 9000}, ids)
+		assert.Equal(t, 3, calls)
+
+		var actuals []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					actuals = append(actuals, decodedVal)
+					return nil
+				},
+			})
+		})
+		assert.Equal(t, toIfaces(local, newFooEnt(101, 9000, "foo_1"), newFooEnt(102, 9000, "foo_2")), actuals)
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEntByNameFold(context.TODO(), tx, "FOO_2")
+			require.NoError(t, err)
+			assert.Equal(t, influxdb.ID(102), v.(foo).ID)
+			return nil
+		})
+	})
+
+	t.Run("only the id paths are remapped", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "paths")
+		defer done()
+
+		var ids map[influxdb.ID]influxdb.ID
+		update(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			_, ids, err = base.ImportWithRemap(context.TODO(), tx, exported(t), func(old influxdb.ID) (influxdb.ID, error) {
+				return old + 100, nil
+			})
+			return err
+		})
+		assert.Equal(t, map[influxdb.ID]influxdb.ID{1: 101, 2: 102}, ids)
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEntByNameFold(context.TODO(), tx, "foo_1")
+			require.NoError(t, err)
+			assert.Equal(t, foo{ID: 101, OrgID: 9000, Name: "foo_1"}, v)
+			return nil
+		})
+	})
+
+	t.Run("composite keys follow the remap", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		encOrgNameKey := func(ent kv.Entity) ([]byte, string, error) {
+			f, ok := ent.Body.(foo)
+			if !ok {
+				return nil, "org then name key", fmt.Errorf("invalid entry: %#v", ent.Body)
+			}
+			key, err := kv.EncOrgThenNameKey(f.OrgID, f.Name, f.ID)()
+			return key, "org then name key", err
+		}
+		base := kv.NewStoreBase("foo", []byte("foo_import_org_name"), encOrgNameKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			_, _, err := base.ImportWithRemap(context.TODO(), tx, exported(t), func(old influxdb.ID) (influxdb.ID, error) {
+				return old + 100, nil
+			}, kv.WithImportIDPaths("ID", "OrgID"))
+			return err
+		})
+
+		var keys [][]byte
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					keys = append(keys, key)
+					return nil
+				},
+			})
+		})
+		want := func(id influxdb.ID, name string) []byte {
+			key, err := kv.EncOrgThenNameKey(9100, name, id)()
+			require.NoError(t, err)
+			return key
+		}
+		assert.Equal(t, [][]byte{want(101, "foo_1"), want(102, "foo_2")}, keys)
+	})
+
+	t.Run("invalid ids at an id path are invalid", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "invalid_id")
+		defer done()
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			_, _, err := base.ImportWithRemap(context.TODO(), tx, exported(t), func(old influxdb.ID) (influxdb.ID, error) {
+				return old, nil
+			}, kv.WithImportIDPaths("Name"))
+			return err
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+
+	t.Run("colliding ids conflict rather than overwrite", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "collide")
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(2, 9000, "local"))
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			_, _, err := base.ImportWithRemap(context.TODO(), tx, exported(t), func(old influxdb.ID) (influxdb.ID, error) {
+				return old, nil
+			})
+			return err
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EConflict, influxdb.ErrorCode(err))
+	})
+
+	t.Run("colliding ids resolved", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "resolve")
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "local"))
+
+		var resolved [][]byte
+		var n int
+		update(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			n, _, err = base.ImportWithRemap(context.TODO(), tx, exported(t), func(old influxdb.ID) (influxdb.ID, error) {
+				return old, nil
+			}, kv.WithImportResolveFn(func(key []byte, existing, incoming []byte) ([]byte, error) {
+				resolved = append(resolved, key)
+				return incoming, nil
+			}))
+			return err
+		})
+
+		// the identical foo_1 is no conflict
+		assert.Equal(t, 1, n)
+		assert.Equal(t, [][]byte{encodeID(t, 2)}, resolved)
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEntByNameFold(context.TODO(), tx, "foo_2")
+			require.NoError(t, err)
+			assert.Equal(t, influxdb.ID(2), v.(foo).ID)
+
+			_, err = base.FindEntByNameFold(context.TODO(), tx, "local")
+			isNotFoundErr(t, err)
+			return nil
+		})
+	})
+
+	t.Run("remap errors fail the import", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "remap_err")
+		defer done()
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			_, _, err := base.ImportWithRemap(context.TODO(), tx, exported(t), func(old influxdb.ID) (influxdb.ID, error) {
+				return 0, errors.New("out of ids")
+			})
+			return err
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+	})
+
+	t.Run("malformed records are invalid", func(t *testing.T) {
+		base, kvStore, done := newStore(t, "malformed")
+		defer done()
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			_, _, err := base.ImportWithRemap(context.TODO(), tx, strings.NewReader("not json\n"), func(old influxdb.ID) (influxdb.ID, error) {
+				return old, nil
+			})
+			return err
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
@@ -0,0 +1,125 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// IncrField adds delta to the integer field at the dotted fieldPath of the JSON body
+// of the entity stored for the id, i.e. "stats.hits", returning the new value. The
+// body is read, incremented, and written back through Patch, all within the
+// provided transaction, so indexes and hooks see the update as they would any other.
+// IncrField requires a store built with WithJSONBodies. A missing entity is not
+// found, while a missing or non integer field, or an increment overflowing an int64,
+// is invalid.
+func (s *StoreBase) IncrField(ctx context.Context, tx Tx, id influxdb.ID, fieldPath string, delta int64) (int64, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if !s.encodesJSON() {
+		return 0, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s store does not store its bodies as JSON", s.Resource),
+		}
+	}
+	if fieldPath == "" {
+		return 0, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s field path must not be empty", s.Resource),
+		}
+	}
+
+	var n int64
+	_, err := s.Patch(ctx, tx, id, func(current interface{}) (interface{}, error) {
+		body, err := json.Marshal(current)
+		if err != nil {
+			return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+
+		body, n, err = s.incrJSONField(body, fieldPath, delta)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := s.EntKey(ctx, Entity{PK: EncID(id)})
+		if err != nil {
+			return nil, err
+		}
+		_, updated, err := s.DecodeEntFn(key, body)
+		if err != nil {
+			return nil, &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to decode incremented %s", s.Resource),
+				Err:  err,
+			}
+		}
+		return updated, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// incrJSONField adds delta to the integer field at the dotted path of the JSON body,
+// returning the updated body and the new value of the field.
+func (s *StoreBase) incrJSONField(body []byte, fieldPath string, delta int64) ([]byte, int64, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return nil, 0, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	errField := func(msg string) error {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s field %q %s", s.Resource, fieldPath, msg),
+		}
+	}
+
+	parts := strings.Split(fieldPath, ".")
+	obj, ok := root.(map[string]interface{})
+	for _, part := range parts[:len(parts)-1] {
+		if !ok {
+			return nil, 0, errField("does not exist")
+		}
+		obj, ok = obj[part].(map[string]interface{})
+	}
+	if !ok {
+		return nil, 0, errField("does not exist")
+	}
+
+	leaf := parts[len(parts)-1]
+	num, ok := obj[leaf].(json.Number)
+	if !ok {
+		if _, exists := obj[leaf]; !exists {
+			return nil, 0, errField("does not exist")
+		}
+		return nil, 0, errField("is not numeric")
+	}
+	n, err := num.Int64()
+	if err != nil {
+		return nil, 0, errField("is not an integer")
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return nil, 0, errField("would overflow")
+	}
+
+	n += delta
+	obj[leaf] = json.Number(strconv.FormatInt(n, 10))
+
+	body, err = json.Marshal(root)
+	if err != nil {
+		return nil, 0, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	return body, n, nil
+}
@@ -0,0 +1,96 @@
+package kv_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type counted struct {
+	ID    influxdb.ID
+	Name  string
+	Stats struct {
+		Hits  int64
+		Ratio float64
+	}
+}
+
+func TestStoreBase_IncrField(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("counted", []byte("counted"), kv.EncIDKey, kv.EncBodyJSON,
+		func(key, val []byte) ([]byte, interface{}, error) {
+			var c counted
+			if err := json.Unmarshal(val, &c); err != nil {
+				return nil, nil, err
+			}
+			return key, c, nil
+		},
+		func(k []byte, v interface{}) (kv.Entity, error) {
+			c, ok := v.(counted)
+			if !ok {
+				return kv.Entity{}, fmt.Errorf("invalid entry: %#v", v)
+			}
+			return kv.Entity{PK: kv.EncID(c.ID), Body: c}, nil
+		},
+		kv.WithJSONBodies(),
+	)
+
+	c := counted{ID: 1, Name: "counted_1"}
+	c.Stats.Hits = 41
+	c.Stats.Ratio = 0.5
+	update(t, kvStore, func(tx kv.Tx) error {
+		if err := base.Init(context.TODO(), tx); err != nil {
+			return err
+		}
+		return base.Put(context.TODO(), tx, kv.Entity{PK: kv.EncID(c.ID), Body: c})
+	})
+
+	incr := func(id influxdb.ID, path string, delta int64) (int64, error) {
+		var n int64
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			var err error
+			n, err = base.IncrField(context.TODO(), tx, id, path, delta)
+			return err
+		})
+		return n, err
+	}
+
+	n, err := incr(1, "Stats.Hits", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+
+	n, err = incr(1, "Stats.Hits", -2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), n)
+
+	view(t, kvStore, func(tx kv.Tx) error {
+		v, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+		require.NoError(t, err)
+		c.Stats.Hits = 40
+		assert.Equal(t, c, v)
+		return nil
+	})
+
+	_, err = incr(2, "Stats.Hits", 1)
+	isNotFoundErr(t, err)
+
+	for _, path := range []string{"Name", "Stats.Ratio", "Stats.Misses", "Name.Hits", ""} {
+		_, err = incr(1, path, 1)
+		require.Error(t, err, path)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err), path)
+	}
+
+	_, err = incr(1, "Stats.Hits", math.MaxInt64)
+	require.Error(t, err)
+	assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+}
@@ -0,0 +1,59 @@
+package kv
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// indexDeterminismRounds is the number of times AssertIndexDeterministic calls the
+// extractor for each sample beyond the first.
+const indexDeterminismRounds = 3
+
+// AssertIndexDeterministic verifies that the index key extractor is a pure function
+// of the entity, as an index whose keys drift for an unchanged entity leaves entries
+// behind that no longer resolve. It is meant for tests, run against a
+// representative set of sample entities before an index is enabled.
+//
+// Each sample's key is first recorded, and the samples are then passed to the
+// extractor for a number of further rounds, alternating between reverse and
+// forward order. Every key must equal the one first recorded for its sample. The
+// changing order flags extractors that depend on mutable state shared between
+// calls, i.e. a global counter or the last entity seen, as well as those reading
+// the clock or randomness. Such state left unchanged across the calls cannot be
+// detected.
+func AssertIndexDeterministic(extractor func(Entity) []byte, samples ...Entity) error {
+	if len(samples) == 0 {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  "at least one sample entity is required to assert an index is deterministic",
+		}
+	}
+
+	first := make([][]byte, len(samples))
+	for i, ent := range samples {
+		first[i] = copyBytes(extractor(ent))
+	}
+
+	for round := 0; round < indexDeterminismRounds; round++ {
+		for j := range samples {
+			i := j
+			if round%2 == 0 {
+				i = len(samples) - 1 - j
+			}
+
+			key := extractor(samples[i])
+			if !bytes.Equal(key, first[i]) {
+				return &influxdb.Error{
+					Code: influxdb.EInvalid,
+					Msg: fmt.Sprintf(
+						"index key of sample %d is not deterministic; got %q after first extracting %q",
+						i, key, first[i],
+					),
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package kv_test
+
+import (
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertIndexDeterministic(t *testing.T) {
+	samples := []kv.Entity{
+		newFooEnt(1, 9000, "foo_1"),
+		newFooEnt(2, 9000, "foo_2"),
+		newFooEnt(3, 9001, "foo_3"),
+	}
+
+	t.Run("pure extractor passes", func(t *testing.T) {
+		byName := func(ent kv.Entity) []byte {
+			return []byte(ent.Body.(foo).Name)
+		}
+		assert.NoError(t, kv.AssertIndexDeterministic(byName, samples...))
+	})
+
+	t.Run("extractor with a call counter fails", func(t *testing.T) {
+		var calls int
+		counted := func(ent kv.Entity) []byte {
+			calls++
+			return []byte{byte(calls)}
+		}
+
+		err := kv.AssertIndexDeterministic(counted, samples...)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+
+	t.Run("extractor depending on the previous entity fails", func(t *testing.T) {
+		var prev string
+		chained := func(ent kv.Entity) []byte {
+			name := ent.Body.(foo).Name
+			key := []byte(prev + "/" + name)
+			prev = name
+			return key
+		}
+
+		err := kv.AssertIndexDeterministic(chained, samples...)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+
+	t.Run("requires samples", func(t *testing.T) {
+		err := kv.AssertIndexDeterministic(func(kv.Entity) []byte { return nil })
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
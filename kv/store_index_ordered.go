@@ -0,0 +1,171 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// indexOrderedBatchSize is the number of primaries FindViaIndexOrdered resolves in
+// a single batch when no Limit bounds the results.
+const indexOrderedBatchSize = 100
+
+// FindViaIndexOrdered lists the entities referenced by the entries of the named
+// index whose index key has the provided prefix, in the order of the index rather
+// than of the primary keys, i.e. foos of an org ordered by name via an index keyed
+// by org and name. The Descending, Offset, Limit, FilterEntFn, and capture options
+// apply; the remaining options are ignored.
+//
+// The index is scanned in key order and its primary keys are resolved in batches of
+// a single GetBatch call each, so every emitted entity costs one primary lookup
+// beyond the index scan. Without a FilterEntFn the Offset is applied to the index
+// entries before any primary is read. Entries whose primary no longer exists are
+// skipped.
+func (s *StoreBase) FindViaIndexOrdered(ctx context.Context, tx Tx, indexName string, prefix []byte, opts FindOpts) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	idx, err := s.index(indexName)
+	if err != nil {
+		return err
+	}
+
+	ib, err := s.indexBucket(ctx, tx, idx)
+	if err != nil {
+		return err
+	}
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	cur, err := ib.Cursor()
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	if !idx.Unique {
+		prefix = escapeIndexKey(prefix)
+	}
+	return s.findViaIndexCursor(ctx, b, cur, prefix, opts)
+}
+
+// findViaIndexCursor lists the entities of the store's bucket b referenced by the
+// values of the index entries with the prefix, in the order of the index cursor.
+func (s *StoreBase) findViaIndexCursor(ctx context.Context, b Bucket, cur Cursor, prefix []byte, opts FindOpts) error {
+	opts = s.namespaceFindOpts(opts)
+	descending := s.descending(opts)
+	next := cur.Next
+	if descending {
+		next = cur.Prev
+	}
+
+	batchSize := opts.Limit
+	if batchSize <= 0 || batchSize > indexOrderedBatchSize {
+		batchSize = indexOrderedBatchSize
+	}
+
+	var (
+		offset  = opts.Offset
+		emitted int
+		pks     [][]byte
+	)
+
+	// flush resolves the batch of primary keys and captures the entities, returning
+	// true once the limit is reached.
+	flush := func() (bool, error) {
+		defer func() { pks = pks[:0] }()
+		if len(pks) == 0 {
+			return false, nil
+		}
+
+		vals, err := b.GetBatch(pks...)
+		if err != nil {
+			return false, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+
+		decFn := s.decodeFn()
+		for i, val := range vals {
+			if val == nil {
+				continue
+			}
+			k, v, err := decFn(pks[i], val)
+			if err != nil {
+				return false, &influxdb.Error{
+					Code: influxdb.EInternal,
+					Msg:  fmt.Sprintf("failed to decode %s for key %q", s.Resource, string(pks[i])),
+					Err:  err,
+				}
+			}
+			if opts.FilterEntFn != nil && !opts.FilterEntFn(k, v) {
+				continue
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+			if err := opts.capture(emitted, k, v); err != nil {
+				return false, err
+			}
+			emitted++
+			if opts.Limit > 0 && emitted >= opts.Limit {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	for k, v := seekIndexPrefix(cur, prefix, descending); k != nil && bytes.HasPrefix(k, prefix); k, v = next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if opts.FilterEntFn == nil && offset > 0 {
+			offset--
+			continue
+		}
+
+		pks = append(pks, copyBytes(v))
+		if len(pks) < batchSize {
+			continue
+		}
+		done, err := flush()
+		if err != nil || done {
+			return err
+		}
+	}
+
+	_, err := flush()
+	return err
+}
+
+// seekIndexPrefix positions the cursor on the first entry with the prefix in the
+// direction of iteration.
+func seekIndexPrefix(cur Cursor, prefix []byte, descending bool) ([]byte, []byte) {
+	if !descending {
+		return cur.Seek(prefix)
+	}
+
+	end := prefixEnd(prefix)
+	if end == nil {
+		return cur.Last()
+	}
+	if k, _ := cur.Seek(end); k == nil {
+		return cur.Last()
+	}
+	return cur.Prev()
+}
+
+// prefixEnd returns the smallest key greater than every key with the prefix, or nil
+// when there is none, as for an empty prefix or one of only 0xff bytes.
+func prefixEnd(prefix []byte) []byte {
+	end := copyBytes(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package kv_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_FindViaIndexOrdered(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	orgNameIndex := kv.StoreIndex{
+		Name:    "org_name",
+		BktName: []byte("foo_org_name_index"),
+		KeyFn: func(ent kv.Entity) ([]byte, error) {
+			f, ok := ent.Body.(foo)
+			if !ok {
+				return nil, fmt.Errorf("invalid entry: %#v", ent.Body)
+			}
+			return []byte(f.OrgID.String() + "/" + f.Name), nil
+		},
+	}
+	base := kv.NewStoreBase("foo", []byte("foo_index_ordered"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+		kv.WithIndex(orgNameIndex),
+	)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	ents := []kv.Entity{
+		newFooEnt(1, 9000, "delta"),
+		newFooEnt(2, 9000, "alpha"),
+		newFooEnt(3, 9001, "bravo"),
+		newFooEnt(4, 9000, "charlie"),
+		newFooEnt(5, 9000, "bravo"),
+	}
+	seedEnts(t, kvStore, base, ents...)
+
+	// org 9000 in name order
+	byName := []kv.Entity{ents[1], ents[4], ents[3], ents[0]}
+	prefix := []byte(ents[0].Body.(foo).OrgID.String() + "/")
+
+	tests := []struct {
+		name     string
+		opts     kv.FindOpts
+		expected []interface{}
+	}{
+		{
+			name:     "index order",
+			expected: toIfaces(byName...),
+		},
+		{
+			name:     "descending",
+			opts:     kv.FindOpts{Descending: true},
+			expected: reverseSlc(toIfaces(byName...)),
+		},
+		{
+			name:     "offset and limit",
+			opts:     kv.FindOpts{Offset: 1, Limit: 2},
+			expected: toIfaces(byName[1:3]...),
+		},
+		{
+			name: "filter",
+			opts: kv.FindOpts{
+				Offset: 1,
+				FilterEntFn: func(key []byte, decodedVal interface{}) bool {
+					return decodedVal.(foo).ID != 5
+				},
+			},
+			expected: toIfaces(ents[3], ents[0]),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actuals []interface{}
+			opts := tt.opts
+			opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+				actuals = append(actuals, decodedVal)
+				return nil
+			}
+			view(t, kvStore, func(tx kv.Tx) error {
+				return base.FindViaIndexOrdered(context.TODO(), tx, "org_name", prefix, opts)
+			})
+			assert.Equal(t, tt.expected, actuals)
+		})
+	}
+
+	t.Run("unknown index", func(t *testing.T) {
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.FindViaIndexOrdered(context.TODO(), tx, "missing", nil, kv.FindOpts{})
+		})
+		require.Error(t, err)
+	})
+}
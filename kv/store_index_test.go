@@ -11,6 +11,15 @@ import (
 )
 
 func TestIndexStore(t *testing.T) {
+	t.Run("bolt", func(t *testing.T) {
+		testIndexStore(t, NewTestBoltStore)
+	})
+	t.Run("inmem", func(t *testing.T) {
+		testIndexStore(t, NewTestInmemStore)
+	})
+}
+
+func testIndexStore(t *testing.T, newKVStore func(t *testing.T) (kv.Store, func(), error)) {
 	newStoreBase := func(resource string, bktName []byte, encKeyFn, encBodyFn kv.EncodeEntFn, decFn kv.DecodeBucketValFn, decToEntFn kv.ConvertValToEntFn) *kv.StoreBase {
 		return kv.NewStoreBase(resource, bktName, encKeyFn, encBodyFn, decFn, decToEntFn)
 	}
@@ -18,7 +27,7 @@ func TestIndexStore(t *testing.T) {
 	newFooIndexStore := func(t *testing.T, bktSuffix string) (*kv.IndexStore, func(), kv.Store) {
 		t.Helper()
 
-		kvStoreStore, done, err := NewTestBoltStore(t)
+		kvStoreStore, done, err := newKVStore(t)
 		require.NoError(t, err)
 
 		const resource = "foo"
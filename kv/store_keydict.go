@@ -0,0 +1,336 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// DefaultKeyDictMinSegment is the length from which a KeyDict interns a key segment
+// when none is configured. Shorter segments cost less inline than as a reference.
+const DefaultKeyDictMinSegment = 16
+
+// Each segment of a compressed key is tagged as held inline or interned. Interned
+// segments are referenced by their id, four bytes big endian.
+const (
+	keyDictLiteral byte = 0
+	keyDictRef     byte = 1
+
+	keyDictRefLen = 4
+)
+
+var (
+	keyDictSegmentPrefix = []byte("s")
+	keyDictIDPrefix      = []byte("i")
+	keyDictSeqKey        = []byte("n")
+)
+
+// KeyDict compresses long composite keys, i.e. those of an org, a name, and a type,
+// by interning their long segments in a dictionary bucket, so that keys reference
+// each such segment by a short id. High cardinality stores keyed by long strings
+// hold far smaller keys, and so far smaller b-trees and indexes.
+//
+// A KeyDict is a key encoder wrapper: EncodeKey compresses the segments of a key,
+// interning those not seen before, LookupKey compresses them for reads without
+// interning, and DecodeKey reconstructs the segments of a compressed key. Callers
+// put entities under compressed keys with PutRaw, and read them back with Finds
+// whose Prefix is the compressed encoding of the leading segments. Compressed keys
+// do not preserve the byte order of their segments: a segment held inline is
+// prefixed with its length, so shorter segments order before longer ones, inline
+// segments order before interned ones, and interned segments order by the order in
+// which they were first seen. Finds over a compressed store therefore only group
+// keys by their leading segments, and callers needing keys in segment order sort
+// the decoded results.
+//
+// The indirection has a cost per operation: encoding a key reads the dictionary once
+// per long segment, and writes to it twice more for a segment seen for the first
+// time, while decoding a key reads the dictionary once per interned segment. No
+// entry is cached, as one interned by a transaction that is rolled back never
+// existed. Interned segments are never removed, even once no key references them.
+//
+// Stores holding plain keys move to compressed ones, and back, with CompressKeys
+// and ExpandKeys, typically as the up and down of a migration.
+type KeyDict struct {
+	bktName    []byte
+	minSegment int
+}
+
+// NewKeyDict creates a key dictionary held in the bucket, interning segments of at
+// least minSegment bytes. A minSegment of zero or less uses DefaultKeyDictMinSegment.
+func NewKeyDict(bktName []byte, minSegment int) *KeyDict {
+	if minSegment <= 0 {
+		minSegment = DefaultKeyDictMinSegment
+	}
+	return &KeyDict{bktName: bktName, minSegment: minSegment}
+}
+
+// Init creates the dictionary bucket.
+func (d *KeyDict) Init(ctx context.Context, tx Tx) error {
+	_, err := d.bucket(ctx, tx)
+	return err
+}
+
+// EncodeKey compresses the segments of a key, interning each long segment the
+// dictionary has not seen before. It requires an update transaction.
+func (d *KeyDict) EncodeKey(ctx context.Context, tx Tx, segments ...[]byte) ([]byte, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	return d.encode(ctx, tx, true, segments)
+}
+
+// LookupKey compresses the segments of a key as EncodeKey does, without interning
+// any segment, so it may be used within a read transaction. A long segment the
+// dictionary has never seen is part of no stored key, and fails as not found.
+func (d *KeyDict) LookupKey(ctx context.Context, tx Tx, segments ...[]byte) ([]byte, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	return d.encode(ctx, tx, false, segments)
+}
+
+func (d *KeyDict) encode(ctx context.Context, tx Tx, intern bool, segments [][]byte) ([]byte, error) {
+	b, err := d.bucket(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	for _, seg := range segments {
+		if len(seg) < d.minSegment {
+			key = append(key, keyDictLiteral)
+			key = appendUvarint(key, uint64(len(seg)))
+			key = append(key, seg...)
+			continue
+		}
+
+		id, err := d.segmentID(b, seg, intern)
+		if err != nil {
+			return nil, err
+		}
+		key = append(key, keyDictRef)
+		key = append(key, id...)
+	}
+	return key, nil
+}
+
+// segmentID returns the id of the interned segment, interning it when allowed.
+func (d *KeyDict) segmentID(b Bucket, seg []byte, intern bool) ([]byte, error) {
+	id, err := b.Get(d.segmentKey(seg))
+	if err == nil {
+		return id, nil
+	}
+	if !IsNotFound(err) {
+		return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	if !intern {
+		return nil, &influxdb.Error{
+			Code: influxdb.ENotFound,
+			Msg:  fmt.Sprintf("key segment %q is not in the dictionary", string(seg)),
+		}
+	}
+
+	var seq uint32
+	raw, err := b.Get(keyDictSeqKey)
+	if err != nil && !IsNotFound(err) {
+		return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	if err == nil {
+		seq = binary.BigEndian.Uint32(raw)
+	}
+	if seq == ^uint32(0) {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  "key dictionary has run out of ids",
+		}
+	}
+	seq++
+
+	id = make([]byte, keyDictRefLen)
+	binary.BigEndian.PutUint32(id, seq)
+	for _, p := range []Pair{
+		{Key: keyDictSeqKey, Value: id},
+		{Key: d.segmentKey(seg), Value: id},
+		{Key: d.idKey(id), Value: seg},
+	} {
+		if err := b.Put(p.Key, p.Value); err != nil {
+			return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return id, nil
+}
+
+// DecodeKey reconstructs the segments of a key compressed by the dictionary.
+func (d *KeyDict) DecodeKey(ctx context.Context, tx Tx, key []byte) ([][]byte, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	b, err := d.bucket(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	errMalformed := &influxdb.Error{
+		Code: influxdb.EInternal,
+		Msg:  fmt.Sprintf("malformed compressed key %q", string(key)),
+	}
+
+	var segments [][]byte
+	for rest := key; len(rest) > 0; {
+		tag := rest[0]
+		rest = rest[1:]
+		switch tag {
+		case keyDictLiteral:
+			n, l := binary.Uvarint(rest)
+			if l <= 0 || uint64(len(rest)-l) < n {
+				return nil, errMalformed
+			}
+			segments = append(segments, copyBytes(rest[l:l+int(n)]))
+			rest = rest[l+int(n):]
+		case keyDictRef:
+			if len(rest) < keyDictRefLen {
+				return nil, errMalformed
+			}
+			seg, err := b.Get(d.idKey(rest[:keyDictRefLen]))
+			if err != nil {
+				if IsNotFound(err) {
+					return nil, &influxdb.Error{
+						Code: influxdb.EInternal,
+						Msg:  fmt.Sprintf("compressed key %q references a segment missing from the dictionary", string(key)),
+					}
+				}
+				return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+			}
+			segments = append(segments, copyBytes(seg))
+			rest = rest[keyDictRefLen:]
+		default:
+			return nil, errMalformed
+		}
+	}
+	return segments, nil
+}
+
+// SplitKeyFn splits a plain key of a store into its segments.
+type SplitKeyFn func(key []byte) ([][]byte, error)
+
+// CompressKeys moves every value of the store from its plain key to the key the
+// dictionary compresses its segments, as split by splitFn, to, and rebuilds the
+// store's indexes, which reference entities by key. It returns the number of keys
+// moved. Values are moved as stored, without being decoded, and neither hooks nor
+// reference checks run. The move happens within the caller's transaction and must
+// run once only, as compressed keys cannot be told apart from plain ones.
+func (d *KeyDict) CompressKeys(ctx context.Context, tx Tx, s *StoreBase, splitFn SplitKeyFn) (int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	return d.rekey(ctx, tx, s, func(key []byte) ([]byte, error) {
+		segments, err := splitFn(key)
+		if err != nil {
+			return nil, &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to split %s key %q", s.Resource, string(key)),
+				Err:  err,
+			}
+		}
+		return d.encode(ctx, tx, true, segments)
+	})
+}
+
+// ExpandKeys reverses CompressKeys, moving every value of the store from its
+// compressed key back to the plain key joinFn builds from its segments.
+func (d *KeyDict) ExpandKeys(ctx context.Context, tx Tx, s *StoreBase, joinFn func(segments [][]byte) ([]byte, error)) (int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	return d.rekey(ctx, tx, s, func(key []byte) ([]byte, error) {
+		segments, err := d.DecodeKey(ctx, tx, key)
+		if err != nil {
+			return nil, err
+		}
+		return joinFn(segments)
+	})
+}
+
+// rekey moves every value of the store to the key keyFn maps its key to, then
+// rebuilds the store's indexes.
+func (d *KeyDict) rekey(ctx context.Context, tx Tx, s *StoreBase, keyFn func(key []byte) ([]byte, error)) (int, error) {
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	cur, err := b.Cursor()
+	if err != nil {
+		return 0, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	// the pairs are collected before any is moved, as writing beneath an open
+	// cursor is not supported by every store.
+	var pairs []Pair
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		pairs = append(pairs, Pair{Key: copyBytes(k), Value: copyBytes(v)})
+	}
+
+	var n int
+	for _, p := range pairs {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		newKey, err := keyFn(p.Key)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(newKey, p.Key) {
+			continue
+		}
+		if err := b.Delete(p.Key); err != nil && !IsNotFound(err) {
+			return 0, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+		s.decodeCache.invalidate(p.Key)
+		if err := s.putInBucket(b, newKey, p.Value); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	if _, err := s.ReindexAll(ctx, tx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (d *KeyDict) segmentKey(seg []byte) []byte {
+	return append(append([]byte{}, keyDictSegmentPrefix...), seg...)
+}
+
+func (d *KeyDict) idKey(id []byte) []byte {
+	return append(append([]byte{}, keyDictIDPrefix...), id...)
+}
+
+func (d *KeyDict) bucket(ctx context.Context, tx Tx) (Bucket, error) {
+	span, _ := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	b, err := tx.Bucket(d.bktName)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("key dictionary bucket %q is missing; it must be initialized with Init before use", string(d.bktName)),
+			Err:  err,
+		}
+	}
+	return b, nil
+}
+
+func appendUvarint(b []byte, n uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], n)]...)
+}
@@ -0,0 +1,121 @@
+package kv_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyDict(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	dict := kv.NewKeyDict([]byte("foo_key_dict"), 17)
+	base := kv.NewStoreBase("foo", []byte("foo_key_dict_store"), kv.EncUniqKey, kv.EncIDKey, kv.DecIndexID,
+		func(k []byte, v interface{}) (kv.Entity, error) {
+			return kv.Entity{PK: kv.EncID(v.(influxdb.ID))}, nil
+		},
+	)
+	update(t, kvStore, func(tx kv.Tx) error {
+		if err := dict.Init(context.TODO(), tx); err != nil {
+			return err
+		}
+		return base.Init(context.TODO(), tx)
+	})
+
+	org := encodeID(t, 9000)
+	longName := []byte(strings.Repeat("a_rather_long_name_", 4))
+	shortName := []byte("short")
+
+	// each plain key is the 16 byte org id followed by the name
+	seedEnts(t, kvStore, base,
+		kv.Entity{PK: kv.EncID(1), UniqueKey: kv.Encode(kv.EncBytes(org), kv.EncBytes(longName))},
+		kv.Entity{PK: kv.EncID(2), UniqueKey: kv.Encode(kv.EncBytes(org), kv.EncBytes(shortName))},
+	)
+	splitFn := func(key []byte) ([][]byte, error) {
+		return [][]byte{key[:influxdb.IDLength], key[influxdb.IDLength:]}, nil
+	}
+
+	rawKeys := func() [][]byte {
+		var keys [][]byte
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					keys = append(keys, key)
+					return nil
+				},
+			})
+		})
+		return keys
+	}
+
+	update(t, kvStore, func(tx kv.Tx) error {
+		n, err := dict.CompressKeys(context.TODO(), tx, base, splitFn)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		return nil
+	})
+
+	keys := rawKeys()
+	require.Len(t, keys, 2)
+	for _, k := range keys {
+		assert.Less(t, len(k), influxdb.IDLength+len(longName))
+	}
+
+	view(t, kvStore, func(tx kv.Tx) error {
+		key, err := dict.LookupKey(context.TODO(), tx, org, longName)
+		require.NoError(t, err)
+		segments, err := dict.DecodeKey(context.TODO(), tx, key)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{org, longName}, segments)
+
+		// the compressed org alone prefixes the keys of its entities
+		prefix, err := dict.LookupKey(context.TODO(), tx, org)
+		require.NoError(t, err)
+		var ids []interface{}
+		err = base.Find(context.TODO(), tx, kv.FindOpts{
+			Prefix: prefix,
+			StopFn: func(key []byte) bool { return !bytes.HasPrefix(key, prefix) },
+			CaptureFn: func(key []byte, decodedVal interface{}) error {
+				ids = append(ids, decodedVal)
+				return nil
+			},
+		})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []interface{}{influxdb.ID(1), influxdb.ID(2)}, ids)
+
+		_, err = dict.LookupKey(context.TODO(), tx, org, []byte(strings.Repeat("never_interned_", 4)))
+		isNotFoundErr(t, err)
+		return nil
+	})
+
+	update(t, kvStore, func(tx kv.Tx) error {
+		again, err := dict.EncodeKey(context.TODO(), tx, org, longName)
+		require.NoError(t, err)
+		key, err := dict.LookupKey(context.TODO(), tx, org, longName)
+		require.NoError(t, err)
+		assert.Equal(t, key, again)
+
+		return base.PutRaw(context.TODO(), tx, again, kv.Entity{PK: kv.EncID(3)})
+	})
+
+	update(t, kvStore, func(tx kv.Tx) error {
+		n, err := dict.ExpandKeys(context.TODO(), tx, base, func(segments [][]byte) ([]byte, error) {
+			return bytes.Join(segments, nil), nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		return nil
+	})
+	assert.ElementsMatch(t, [][]byte{
+		append(append([]byte{}, org...), longName...),
+		append(append([]byte{}, org...), shortName...),
+	}, rawKeys())
+}
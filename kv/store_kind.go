@@ -0,0 +1,101 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// frameKind flags a frame carrying the kind of the body.
+const frameKind byte = 1 << 2
+
+// KindFn returns the kind of the entity, naming the concrete type of its body.
+type KindFn func(ent Entity) (string, error)
+
+// KindDispatch maps each kind to the decoder of its bodies.
+type KindDispatch map[string]DecodeBucketValFn
+
+// WithKind lets a store hold bodies of several types in the one bucket. Each value
+// the store writes is framed with the kind fn returns for its entity, and on read
+// the decoder registered in dispatch for that kind decodes the body. Values written
+// before the option was enabled carry no kind and are decoded by the store's
+// DecodeEntFn, as are entities for which fn returns an empty kind, provided none
+// begins with the byte 0xff as binary bodies may. A value whose kind has no
+// decoder in dispatch fails to read.
+func WithKind(fn KindFn, dispatch KindDispatch) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.kindFn = fn
+		s.kindDispatch = dispatch
+	}
+}
+
+// FindKind returns the kind recorded for the entity, which is empty for values
+// written without one.
+func (s *StoreBase) FindKind(ctx context.Context, tx Tx, ent Entity) (string, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	key, err := s.EntKey(ctx, ent)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := s.bucketGet(ctx, tx, key)
+	if err != nil {
+		return "", err
+	}
+	f, err := s.unframe(raw)
+	if err != nil {
+		return "", err
+	}
+	return f.kind, nil
+}
+
+// entKind returns the kind of the entity for stores recording one.
+func (s *StoreBase) entKind(ent Entity) (string, error) {
+	if s.kindFn == nil {
+		return "", nil
+	}
+	kind, err := s.kindFn(ent)
+	if err != nil {
+		return "", &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("failed to determine %s kind", s.Resource),
+			Err:  err,
+		}
+	}
+	return kind, nil
+}
+
+// kindDecodeFn returns the decoder for bodies of the kind, falling back to decFn
+// for bodies without one.
+func (s *StoreBase) kindDecodeFn(kind string, decFn DecodeBucketValFn) (DecodeBucketValFn, error) {
+	if kind == "" {
+		return decFn, nil
+	}
+	kindDecFn, ok := s.kindDispatch[kind]
+	if !ok {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s value has kind %q without a decoder", s.Resource, kind),
+		}
+	}
+	return kindDecFn, nil
+}
+
+func appendFrameKind(b []byte, kind string) []byte {
+	var n [binary.MaxVarintLen64]byte
+	b = append(b, n[:binary.PutUvarint(n[:], uint64(len(kind)))]...)
+	return append(b, kind...)
+}
+
+func readFrameKind(b []byte) (string, []byte, bool) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 || uint64(len(b)-size) < n {
+		return "", nil, false
+	}
+	b = b[size:]
+	return string(b[:n]), b[n:], true
+}
@@ -0,0 +1,199 @@
+package kv_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bar is a second body type stored alongside foo in the one bucket.
+type bar struct {
+	ID    influxdb.ID `json:"id"`
+	Label string      `json:"label"`
+}
+
+func newBarEnt(id influxdb.ID, label string) kv.Entity {
+	return kv.Entity{PK: kv.EncID(id), Body: bar{ID: id, Label: label}}
+}
+
+func decJSONBarFn(key, val []byte) ([]byte, interface{}, error) {
+	var b bar
+	if err := json.Unmarshal(val, &b); err != nil {
+		return nil, nil, err
+	}
+	return key, b, nil
+}
+
+func fooBarKindFn(ent kv.Entity) (string, error) {
+	switch ent.Body.(type) {
+	case foo:
+		return "foo", nil
+	case bar:
+		return "bar", nil
+	default:
+		return "", fmt.Errorf("unexpected body %T", ent.Body)
+	}
+}
+
+func decFooBarEntFn(k []byte, v interface{}) (kv.Entity, error) {
+	if b, ok := v.(bar); ok {
+		return newBarEnt(b.ID, b.Label), nil
+	}
+	return decFooEntFn(k, v)
+}
+
+func TestStoreBase_WithKind(t *testing.T) {
+	bktName := []byte("foo_kind")
+	dispatch := kv.KindDispatch{"foo": decJSONFooFn, "bar": decJSONBarFn}
+
+	newStore := func(t *testing.T, kvStore kv.Store, opts ...kv.StoreBaseOptFn) *kv.StoreBase {
+		t.Helper()
+
+		base := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooBarEntFn, opts...)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base
+	}
+
+	findEnt := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase, id influxdb.ID) (interface{}, error) {
+		t.Helper()
+
+		var (
+			v   interface{}
+			err error
+		)
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err = base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(id)})
+			return nil
+		})
+		return v, err
+	}
+
+	findKind := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase, id influxdb.ID) string {
+		t.Helper()
+
+		var kind string
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			kind, err = base.FindKind(context.TODO(), tx, kv.Entity{PK: kv.EncID(id)})
+			return err
+		})
+		return kind
+	}
+
+	t.Run("decodes each body by its kind", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := newStore(t, kvStore, kv.WithKind(fooBarKindFn, dispatch))
+		fooEnt, barEnt := newFooEnt(1, 9000, "foo_1"), newBarEnt(2, "bar_2")
+		seedEnts(t, kvStore, base, fooEnt, barEnt)
+
+		v, err := findEnt(t, kvStore, base, 1)
+		require.NoError(t, err)
+		assert.Equal(t, fooEnt.Body, v)
+		assert.Equal(t, "foo", findKind(t, kvStore, base, 1))
+
+		v, err = findEnt(t, kvStore, base, 2)
+		require.NoError(t, err)
+		assert.Equal(t, barEnt.Body, v)
+		assert.Equal(t, "bar", findKind(t, kvStore, base, 2))
+
+		var found []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(k []byte, v interface{}) error {
+					found = append(found, v)
+					return nil
+				},
+			})
+		})
+		assert.Equal(t, []interface{}{fooEnt.Body, barEnt.Body}, found)
+	})
+
+	t.Run("decodes values without a kind with the store decoder", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		plain := newStore(t, kvStore)
+		legacy := newFooEnt(1, 9000, "foo_1")
+		seedEnts(t, kvStore, plain, legacy)
+
+		base := newStore(t, kvStore, kv.WithKind(fooBarKindFn, dispatch))
+		v, err := findEnt(t, kvStore, base, 1)
+		require.NoError(t, err)
+		assert.Equal(t, legacy.Body, v)
+		assert.Empty(t, findKind(t, kvStore, base, 1))
+
+		seedEnts(t, kvStore, base, legacy)
+		assert.Equal(t, "foo", findKind(t, kvStore, base, 1))
+	})
+
+	t.Run("fails to read a kind without a decoder", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := newStore(t, kvStore, kv.WithKind(fooBarKindFn, dispatch))
+		seedEnts(t, kvStore, base, newBarEnt(2, "bar_2"))
+
+		fooOnly := newStore(t, kvStore, kv.WithKind(fooBarKindFn, kv.KindDispatch{"foo": decJSONFooFn}))
+		_, err = findEnt(t, kvStore, fooOnly, 2)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+	})
+
+	t.Run("rejects an entity without a kind", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := newStore(t, kvStore, kv.WithKind(fooBarKindFn, dispatch))
+		err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, kv.Entity{PK: kv.EncID(3), Body: "baz"})
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+
+		_, err = findEnt(t, kvStore, base, 3)
+		isNotFoundErr(t, err)
+	})
+
+	t.Run("verifies the checksum of a kind framed body", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := newStore(t, kvStore, kv.WithKind(fooBarKindFn, dispatch), kv.WithChecksum(kv.CRC32Checksum))
+		barEnt := newBarEnt(2, "bar_2")
+		seedEnts(t, kvStore, base, barEnt)
+
+		v, err := findEnt(t, kvStore, base, 2)
+		require.NoError(t, err)
+		assert.Equal(t, barEnt.Body, v)
+
+		raw := getEntRaw(t, kvStore, bktName, encodeID(t, 2))
+		corrupted := append([]byte(nil), raw...)
+		corrupted[len(corrupted)-1] ^= 0x01
+		update(t, kvStore, func(tx kv.Tx) error {
+			b, err := tx.Bucket(bktName)
+			if err != nil {
+				return err
+			}
+			return b.Put(encodeID(t, 2), corrupted)
+		})
+
+		_, err = findEnt(t, kvStore, base, 2)
+		require.Error(t, err)
+		assert.True(t, kv.IsDataCorruption(err))
+	})
+}
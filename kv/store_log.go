@@ -0,0 +1,157 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// logSeqCounter is the counter of a log store's sequence bucket holding the last
+// sequence appended.
+const logSeqCounter = "seq"
+
+// LogStore is an append-only log of bodies, i.e. of events, each keyed by the
+// sequence it was appended at. Sequences start at 1 and increase by one with every
+// append, and are never reused, even once truncated away. As entries are only
+// ever appended, they are stored in the order of their sequences and reads from a
+// sequence onward are a single range scan.
+//
+// The log grows without bound unless it is truncated, either up to a sequence with
+// Truncate or down to a number of most recent entries with Retain. Neither is run
+// on its own; callers bound the log by calling one after appending, or
+// periodically.
+type LogStore struct {
+	store *StoreBase
+	seq   *CounterStore
+}
+
+// NewLogStore creates a log store for the resource. Entries are held in bktName
+// and the last sequence appended in seqBktName. The bodies of entries are encoded
+// with encBodyFn and decoded with decBodyFn, which is provided the 8 byte key of
+// each entry; LogSeq returns its sequence.
+func NewLogStore(resource string, bktName, seqBktName []byte, encBodyFn EncodeEntFn, decBodyFn DecodeBucketValFn, opts ...StoreBaseOptFn) *LogStore {
+	decToEntFn := func(k []byte, v interface{}) (Entity, error) {
+		return Entity{PK: EncBytes(k), Body: v}, nil
+	}
+	return &LogStore{
+		store: NewStoreBase(resource, bktName, EncIDKey, encBodyFn, decBodyFn, decToEntFn, opts...),
+		seq:   NewCounterStore(resource, seqBktName),
+	}
+}
+
+// Init creates the buckets of the log store.
+func (s *LogStore) Init(ctx context.Context, tx Tx) error {
+	if err := s.store.Init(ctx, tx); err != nil {
+		return err
+	}
+	return s.seq.Init(ctx, tx)
+}
+
+// Append adds the body to the end of the log and returns its sequence.
+func (s *LogStore) Append(ctx context.Context, tx Tx, body interface{}) (uint64, error) {
+	span, ctx := s.store.startSpan(ctx)
+	defer span.Finish()
+
+	n, err := s.seq.Incr(ctx, tx, logSeqCounter, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	seq := uint64(n)
+	err = s.store.Put(ctx, tx, Entity{PK: EncBytes(logKey(seq)), Body: body}, PutNew())
+	if err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// ReadFrom runs a Find over the entries from seq onward, in the order they were
+// appended. A seq of zero reads from the oldest entry retained. The Descending,
+// Ascending, After, and Prefix options are ignored as the log is only read
+// forward; the remaining options apply.
+func (s *LogStore) ReadFrom(ctx context.Context, tx Tx, seq uint64, opts FindOpts) error {
+	span, ctx := s.store.startSpan(ctx)
+	defer span.Finish()
+
+	opts.Descending, opts.Ascending, opts.Prefix, opts.After = false, false, nil, nil
+	if seq > 1 {
+		opts.After = logKey(seq - 1)
+	}
+	return s.store.Find(ctx, tx, opts)
+}
+
+// LastSeq returns the sequence of the last entry appended, or zero when nothing
+// has been appended. It is unaffected by truncation.
+func (s *LogStore) LastSeq(ctx context.Context, tx Tx) (uint64, error) {
+	n, err := s.seq.Get(ctx, tx, logSeqCounter)
+	return uint64(n), err
+}
+
+// Truncate removes the entries before seq, returning the number removed.
+func (s *LogStore) Truncate(ctx context.Context, tx Tx, seq uint64) (int, error) {
+	span, ctx := s.store.startSpan(ctx)
+	defer span.Finish()
+
+	cur, err := s.store.bucketCursor(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	// the entries are collected before any is deleted, as deleting beneath an open
+	// cursor is not supported by every store.
+	end := logKey(seq)
+	var keys [][]byte
+	for k, _ := cur.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = cur.Next() {
+		keys = append(keys, copyBytes(k))
+	}
+
+	for i, k := range keys {
+		if err := s.store.DeleteEnt(ctx, tx, Entity{PK: EncBytes(k)}); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
+
+// Retain truncates the log down to its n most recent entries, returning the
+// number removed.
+func (s *LogStore) Retain(ctx context.Context, tx Tx, n int) (int, error) {
+	span, ctx := s.store.startSpan(ctx)
+	defer span.Finish()
+
+	if n < 0 {
+		return 0, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s log cannot retain %d entries", s.store.Resource, n),
+		}
+	}
+
+	last, err := s.LastSeq(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if last <= uint64(n) {
+		return 0, nil
+	}
+	return s.Truncate(ctx, tx, last-uint64(n)+1)
+}
+
+// LogSeq returns the sequence of the log entry stored under the key.
+func LogSeq(key []byte) (uint64, error) {
+	if len(key) != 8 {
+		return 0, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("log key must be 8 bytes; got %d", len(key)),
+		}
+	}
+	return binary.BigEndian.Uint64(key), nil
+}
+
+func logKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
@@ -0,0 +1,159 @@
+package kv_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogStore(t *testing.T) {
+	decEvent := func(key, val []byte) ([]byte, interface{}, error) {
+		var event string
+		if err := json.Unmarshal(val, &event); err != nil {
+			return nil, nil, err
+		}
+		return key, event, nil
+	}
+
+	newStore := func(t *testing.T) (*kv.LogStore, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		log := kv.NewLogStore("event", []byte("events"), []byte("events_seq"), kv.EncBodyJSON, decEvent)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return log.Init(context.TODO(), tx)
+		})
+		return log, kvStore, done
+	}
+
+	appendEvents := func(t *testing.T, kvStore kv.Store, log *kv.LogStore, events ...string) []uint64 {
+		t.Helper()
+
+		var seqs []uint64
+		update(t, kvStore, func(tx kv.Tx) error {
+			for _, event := range events {
+				seq, err := log.Append(context.TODO(), tx, event)
+				if err != nil {
+					return err
+				}
+				seqs = append(seqs, seq)
+			}
+			return nil
+		})
+		return seqs
+	}
+
+	type entry struct {
+		seq   uint64
+		event string
+	}
+
+	readFrom := func(t *testing.T, kvStore kv.Store, log *kv.LogStore, seq uint64, opts kv.FindOpts) []entry {
+		t.Helper()
+
+		var entries []entry
+		opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+			seq, err := kv.LogSeq(key)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{seq: seq, event: decodedVal.(string)})
+			return nil
+		}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return log.ReadFrom(context.TODO(), tx, seq, opts)
+		})
+		return entries
+	}
+
+	t.Run("appends in sequence and reads forward", func(t *testing.T) {
+		log, kvStore, done := newStore(t)
+		defer done()
+
+		assert.Equal(t, []uint64{1, 2, 3}, appendEvents(t, kvStore, log, "a", "b", "c"))
+		assert.Equal(t, []uint64{4}, appendEvents(t, kvStore, log, "d"))
+
+		assert.Equal(t, []entry{{1, "a"}, {2, "b"}, {3, "c"}, {4, "d"}}, readFrom(t, kvStore, log, 0, kv.FindOpts{}))
+		assert.Equal(t, []entry{{3, "c"}, {4, "d"}}, readFrom(t, kvStore, log, 3, kv.FindOpts{}))
+		assert.Equal(t, []entry{{2, "b"}, {3, "c"}}, readFrom(t, kvStore, log, 2, kv.FindOpts{Limit: 2}))
+		assert.Empty(t, readFrom(t, kvStore, log, 5, kv.FindOpts{}))
+	})
+
+	t.Run("reads forward regardless of order options", func(t *testing.T) {
+		log, kvStore, done := newStore(t)
+		defer done()
+
+		appendEvents(t, kvStore, log, "a", "b", "c")
+
+		got := readFrom(t, kvStore, log, 2, kv.FindOpts{Descending: true, Prefix: []byte("x")})
+		assert.Equal(t, []entry{{2, "b"}, {3, "c"}}, got)
+	})
+
+	t.Run("truncates before a sequence", func(t *testing.T) {
+		log, kvStore, done := newStore(t)
+		defer done()
+
+		appendEvents(t, kvStore, log, "a", "b", "c", "d")
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			n, err := log.Truncate(context.TODO(), tx, 3)
+			assert.Equal(t, 2, n)
+			return err
+		})
+		assert.Equal(t, []entry{{3, "c"}, {4, "d"}}, readFrom(t, kvStore, log, 0, kv.FindOpts{}))
+		assert.Equal(t, []entry{{3, "c"}, {4, "d"}}, readFrom(t, kvStore, log, 1, kv.FindOpts{}))
+	})
+
+	t.Run("retains the most recent entries", func(t *testing.T) {
+		log, kvStore, done := newStore(t)
+		defer done()
+
+		appendEvents(t, kvStore, log, "a", "b", "c", "d")
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			n, err := log.Retain(context.TODO(), tx, 2)
+			assert.Equal(t, 2, n)
+			return err
+		})
+		assert.Equal(t, []entry{{3, "c"}, {4, "d"}}, readFrom(t, kvStore, log, 0, kv.FindOpts{}))
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			n, err := log.Retain(context.TODO(), tx, 5)
+			assert.Zero(t, n)
+			return err
+		})
+		assert.Len(t, readFrom(t, kvStore, log, 0, kv.FindOpts{}), 2)
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			_, err := log.Retain(context.TODO(), tx, -1)
+			return err
+		})
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+
+	t.Run("never reuses truncated sequences", func(t *testing.T) {
+		log, kvStore, done := newStore(t)
+		defer done()
+
+		appendEvents(t, kvStore, log, "a", "b")
+		update(t, kvStore, func(tx kv.Tx) error {
+			_, err := log.Retain(context.TODO(), tx, 0)
+			return err
+		})
+		assert.Empty(t, readFrom(t, kvStore, log, 0, kv.FindOpts{}))
+
+		assert.Equal(t, []uint64{3}, appendEvents(t, kvStore, log, "c"))
+		view(t, kvStore, func(tx kv.Tx) error {
+			last, err := log.LastSeq(context.TODO(), tx)
+			assert.Equal(t, uint64(3), last)
+			return err
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// ErrMaxTxDurationExceeded is the underlying error of a transaction aborted for
+// running past the maximum duration of a MaxTxDurationStore.
+var ErrMaxTxDurationExceeded = errors.New("transaction exceeded its maximum duration")
+
+// MaxTxDurationStore is a Store that bounds how long any one transaction may be
+// held open, as a safety rail against stuck callbacks blocking writers.
+type MaxTxDurationStore struct {
+	store Store
+	d     time.Duration
+}
+
+var _ Store = (*MaxTxDurationStore)(nil)
+
+// WithMaxTxDuration wraps the store so every View and Update runs with a context
+// whose deadline is at most d away. The deadline is carried by the Tx's context, so
+// operations within the callback may observe it, and opening a bucket past the
+// deadline fails. A transaction whose callback returns after the deadline is
+// aborted, rolling back an Update, with an unavailable error wrapping
+// ErrMaxTxDurationExceeded. A callback that never returns cannot be interrupted.
+func WithMaxTxDuration(store Store, d time.Duration) *MaxTxDurationStore {
+	return &MaxTxDurationStore{store: store, d: d}
+}
+
+// View opens up a read transaction bounded by the maximum duration.
+func (s *MaxTxDurationStore) View(ctx context.Context, fn func(Tx) error) error {
+	return s.bounded(ctx, s.store.View, fn)
+}
+
+// Update opens up a write transaction bounded by the maximum duration.
+func (s *MaxTxDurationStore) Update(ctx context.Context, fn func(Tx) error) error {
+	return s.bounded(ctx, s.store.Update, fn)
+}
+
+// Backup copies all K:Vs of the underlying store to a writer. It is not bounded.
+func (s *MaxTxDurationStore) Backup(ctx context.Context, w io.Writer) error {
+	return s.store.Backup(ctx, w)
+}
+
+func (s *MaxTxDurationStore) bounded(ctx context.Context, txFn func(context.Context, func(Tx) error) error, fn func(Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.d)
+	defer cancel()
+
+	return txFn(ctx, func(tx Tx) error {
+		if _, ok := tx.Context().Deadline(); !ok {
+			tx.WithContext(ctx)
+		}
+
+		err := fn(&deadlineTx{Tx: tx})
+		if ctx.Err() == context.DeadlineExceeded {
+			return &influxdb.Error{
+				Code: influxdb.EUnavailable,
+				Msg:  fmt.Sprintf("transaction exceeded maximum duration of %s", s.d),
+				Err:  ErrMaxTxDurationExceeded,
+			}
+		}
+		return err
+	})
+}
+
+// deadlineTx fails to open buckets once its context is done, so stores working
+// within a transaction that has run out of time stop at their next bucket access.
+type deadlineTx struct {
+	Tx
+}
+
+func (tx *deadlineTx) Bucket(b []byte) (Bucket, error) {
+	if err := tx.Context().Err(); err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EUnavailable,
+			Msg:  "transaction context is done",
+			Err:  err,
+		}
+	}
+	return tx.Tx.Bucket(b)
+}
@@ -0,0 +1,84 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMaxTxDuration(t *testing.T) {
+	newStore := func(t *testing.T, d time.Duration) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		inmem, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		kvStore := kv.WithMaxTxDuration(inmem, d)
+		base := kv.NewStoreBase("foo", []byte("foo_max_tx"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	t.Run("transactions within the duration succeed", func(t *testing.T) {
+		base, kvStore, done := newStore(t, time.Minute)
+		defer done()
+
+		expected := newFooEnt(1, 9000, "foo_1")
+		seedEnts(t, kvStore, base, expected)
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			deadline, ok := tx.Context().Deadline()
+			assert.True(t, ok)
+			assert.True(t, deadline.Before(time.Now().Add(time.Minute+time.Second)))
+
+			v, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			require.NoError(t, err)
+			assert.Equal(t, expected.Body, v)
+			return nil
+		})
+	})
+
+	t.Run("overrunning update is aborted and rolled back", func(t *testing.T) {
+		base, kvStore, done := newStore(t, 20*time.Millisecond)
+		defer done()
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			if err := base.Put(context.TODO(), tx, newFooEnt(1, 9000, "foo_1")); err != nil {
+				return err
+			}
+			<-tx.Context().Done()
+			return nil
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EUnavailable, influxdb.ErrorCode(err))
+		assert.Equal(t, kv.ErrMaxTxDurationExceeded, err.(*influxdb.Error).Err)
+
+		err = kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			_, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			return err
+		})
+		isNotFoundErr(t, err)
+	})
+
+	t.Run("operations past the deadline fail", func(t *testing.T) {
+		base, kvStore, done := newStore(t, 20*time.Millisecond)
+		defer done()
+
+		var putErr error
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			<-tx.Context().Done()
+			putErr = base.Put(context.TODO(), tx, newFooEnt(1, 9000, "foo_1"))
+			return putErr
+		})
+		require.Error(t, putErr)
+		assert.Equal(t, influxdb.EUnavailable, influxdb.ErrorCode(putErr))
+		assert.Equal(t, kv.ErrMaxTxDurationExceeded, err.(*influxdb.Error).Err)
+	})
+}
@@ -0,0 +1,355 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// Values of stores with framing enabled begin with frameMagic, as every value such
+// a store writes is framed. Values written before framing was enabled are bare
+// bodies and are told apart by their first byte, which is never frameMagic in UTF-8
+// text such as JSON. A bare body of another encoding that begins with frameMagic is
+// misread as a frame, so framing may only be enabled over bodies that never do.
+const frameMagic byte = 0xff
+
+// frameMetadata flags a frame carrying the created, updated, and expires times.
+const frameMetadata byte = 1 << 0
+
+const frameMetadataLen = 24
+
+// Metadata is the bookkeeping a store with WithMetadata records alongside each
+// value. Times are zero when unknown, as for values written before metadata was
+// enabled, and ExpiresAt is zero for stores without a TTL.
+type Metadata struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// WithMetadata frames each value the store writes with its created and updated
+// times, as given by the time generator, and when ttl is positive an expiry of ttl
+// past the update. Decoders only ever see the body, and values written before the
+// option was enabled remain readable, reporting zero metadata, provided none begins
+// with the byte 0xff; JSON and other UTF-8 bodies never do, binary bodies may.
+func WithMetadata(timeGen influxdb.TimeGenerator, ttl time.Duration) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.timeGen = timeGen
+		s.metadataTTL = ttl
+	}
+}
+
+// FindMetadata returns the metadata recorded for the entity.
+func (s *StoreBase) FindMetadata(ctx context.Context, tx Tx, ent Entity) (Metadata, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	key, err := s.EntKey(ctx, ent)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	raw, err := s.bucketGet(ctx, tx, key)
+	if err != nil {
+		return Metadata{}, err
+	}
+	f, err := s.unframe(raw)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return f.meta, nil
+}
+
+// Touch bumps the updated time, and the expiry of stores with a TTL, of the entity
+// stored for the id. The body is neither decoded nor re-encoded, and neither hooks
+// nor indexes run as the body is unchanged. Touch requires WithMetadata.
+func (s *StoreBase) Touch(ctx context.Context, tx Tx, id influxdb.ID) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	if s.timeGen == nil {
+		return &influxdb.Error{
+			Code: influxdb.EMethodNotAllowed,
+			Msg:  fmt.Sprintf("%s store does not record metadata", s.Resource),
+		}
+	}
+
+	key, err := s.EntKey(ctx, Entity{PK: EncID(id)})
+	if err != nil {
+		return err
+	}
+
+	raw, err := s.bucketGet(ctx, tx, key)
+	if err != nil {
+		return err
+	}
+	f, err := s.unframe(raw)
+	if err != nil {
+		return err
+	}
+
+	s.stamp(&f.meta)
+	return s.bucketPut(ctx, tx, key, s.encodeFrame(f))
+}
+
+// FindModifiedBetween runs a Find over the entities whose updated time falls within
+// the window from to to, both bounds inclusive. A zero from or to leaves that side
+// of the window open. Entities carrying no metadata, as for those not written since
+// WithMetadata was enabled, have no known updated time and are never returned.
+// There is no index of updated times, so every value is scanned, though values
+// outside the window are skipped without being decoded. The options apply to the
+// entities within the window, so a Limit of 10 returns the first 10 of them.
+// FindModifiedBetween requires WithMetadata.
+func (s *StoreBase) FindModifiedBetween(ctx context.Context, tx Tx, from, to time.Time, opts FindOpts) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if s.timeGen == nil {
+		return &influxdb.Error{
+			Code: influxdb.EMethodNotAllowed,
+			Msg:  fmt.Sprintf("%s store does not record metadata", s.Resource),
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("modified window starts at %s after it ends at %s", from, to),
+		}
+	}
+	if err := s.validateFindOpts(opts); err != nil {
+		return err
+	}
+	if err := s.throttle(ctx); err != nil {
+		return err
+	}
+
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return s.findEmpty(opts)
+		}
+		return err
+	}
+	return s.findCursor(ctx, &modifiedCursor{Cursor: cur, s: s, from: from, to: to}, opts)
+}
+
+// modifiedCursor skips the values of a cursor whose frame does not record an
+// updated time within its window. Malformed frames are kept so the decode reports
+// them.
+type modifiedCursor struct {
+	Cursor
+	s        *StoreBase
+	from, to time.Time
+}
+
+func (c *modifiedCursor) Seek(prefix []byte) ([]byte, []byte) {
+	k, v := c.Cursor.Seek(prefix)
+	return c.skip(c.Cursor.Next, k, v)
+}
+
+func (c *modifiedCursor) First() ([]byte, []byte) {
+	k, v := c.Cursor.First()
+	return c.skip(c.Cursor.Next, k, v)
+}
+
+func (c *modifiedCursor) Last() ([]byte, []byte) {
+	k, v := c.Cursor.Last()
+	return c.skip(c.Cursor.Prev, k, v)
+}
+
+func (c *modifiedCursor) Next() ([]byte, []byte) {
+	k, v := c.Cursor.Next()
+	return c.skip(c.Cursor.Next, k, v)
+}
+
+func (c *modifiedCursor) Prev() ([]byte, []byte) {
+	k, v := c.Cursor.Prev()
+	return c.skip(c.Cursor.Prev, k, v)
+}
+
+func (c *modifiedCursor) skip(move func() ([]byte, []byte), k, v []byte) ([]byte, []byte) {
+	for ; k != nil && !c.inWindow(v); k, v = move() {
+	}
+	return k, v
+}
+
+func (c *modifiedCursor) inWindow(raw []byte) bool {
+	f, err := c.s.unframe(raw)
+	if err != nil {
+		return true
+	}
+
+	updated := f.meta.UpdatedAt
+	if updated.IsZero() {
+		return false
+	}
+	return (c.from.IsZero() || !updated.Before(c.from)) && (c.to.IsZero() || !updated.After(c.to))
+}
+
+// framed reports whether the store frames its values.
+func (s *StoreBase) framed() bool {
+	return s.timeGen != nil || s.checksumFn != nil || s.kindFn != nil
+}
+
+// frame is a stored value split into its metadata, kind and encoded body.
+type frame struct {
+	meta Metadata
+	kind string
+	body []byte
+}
+
+// stamp sets the updated and expiry times of meta to now, along with the created
+// time if it has none.
+func (s *StoreBase) stamp(meta *Metadata) {
+	now := s.timeGen.Now()
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = now
+	}
+	meta.UpdatedAt = now
+	meta.ExpiresAt = time.Time{}
+	if s.metadataTTL > 0 {
+		meta.ExpiresAt = now.Add(s.metadataTTL)
+	}
+}
+
+// frameBody frames the encoded body of the kind for the value stored at key. The
+// created time of the value it replaces is carried over.
+func (s *StoreBase) frameBody(ctx context.Context, tx Tx, key []byte, kind string, body []byte) ([]byte, error) {
+	if !s.framed() {
+		return body, nil
+	}
+
+	f := frame{kind: kind, body: body}
+	if s.timeGen != nil {
+		prev, err := s.bucketGet(ctx, tx, key)
+		if err != nil && influxdb.ErrorCode(err) != influxdb.ENotFound {
+			return nil, err
+		}
+		if prev != nil {
+			prevFrame, err := s.unframe(prev)
+			if err != nil {
+				return nil, err
+			}
+			f.meta = prevFrame.meta
+		}
+		s.stamp(&f.meta)
+	}
+	return s.encodeFrame(f), nil
+}
+
+// encodeFrame encodes the frame with the sections enabled for the store, in the
+// order of their flags.
+func (s *StoreBase) encodeFrame(f frame) []byte {
+	b := make([]byte, 2, 2+frameMetadataLen+frameChecksumLen+len(f.body))
+	b[0] = frameMagic
+	if s.timeGen != nil {
+		b[1] |= frameMetadata
+		var meta [frameMetadataLen]byte
+		putFrameTime(meta[0:], f.meta.CreatedAt)
+		putFrameTime(meta[8:], f.meta.UpdatedAt)
+		putFrameTime(meta[16:], f.meta.ExpiresAt)
+		b = append(b, meta[:]...)
+	}
+	if s.checksumFn != nil {
+		b[1] |= frameChecksum
+		var sum [frameChecksumLen]byte
+		binary.BigEndian.PutUint32(sum[:], s.checksumFn(f.body))
+		b = append(b, sum[:]...)
+	}
+	if s.kindFn != nil {
+		b[1] |= frameKind
+		b = appendFrameKind(b, f.kind)
+	}
+	return append(b, f.body...)
+}
+
+// unframe splits the stored value into its metadata, kind and body, verifying its
+// checksum when it has one. A value without a frame is a bare body.
+func (s *StoreBase) unframe(raw []byte) (frame, error) {
+	if !s.framed() || len(raw) == 0 || raw[0] != frameMagic {
+		return frame{body: raw}, nil
+	}
+	if len(raw) < 2 || raw[1]&^(frameMetadata|frameChecksum|frameKind) != 0 {
+		return frame{}, s.errMalformedFrame()
+	}
+
+	var f frame
+	flags, rest := raw[1], raw[2:]
+	if flags&frameMetadata != 0 {
+		if len(rest) < frameMetadataLen {
+			return frame{}, s.errMalformedFrame()
+		}
+		f.meta = Metadata{
+			CreatedAt: frameTime(rest[0:]),
+			UpdatedAt: frameTime(rest[8:]),
+			ExpiresAt: frameTime(rest[16:]),
+		}
+		rest = rest[frameMetadataLen:]
+	}
+	var sum []byte
+	if flags&frameChecksum != 0 {
+		if len(rest) < frameChecksumLen {
+			return frame{}, s.errMalformedFrame()
+		}
+		sum, rest = rest[:frameChecksumLen], rest[frameChecksumLen:]
+	}
+	if flags&frameKind != 0 {
+		var ok bool
+		if f.kind, rest, ok = readFrameKind(rest); !ok {
+			return frame{}, s.errMalformedFrame()
+		}
+	}
+	if sum != nil {
+		if err := s.verifyChecksum(binary.BigEndian.Uint32(sum), rest); err != nil {
+			return frame{}, err
+		}
+	}
+	f.body = rest
+	return f, nil
+}
+
+func (s *StoreBase) errMalformedFrame() error {
+	return &influxdb.Error{
+		Code: influxdb.EInternal,
+		Msg:  fmt.Sprintf("%s value has a malformed frame", s.Resource),
+	}
+}
+
+// unframeFn strips the frame from values before they reach decFn, or the decoder
+// dispatched to for the kind of the value.
+func (s *StoreBase) unframeFn(decFn DecodeBucketValFn) DecodeBucketValFn {
+	return func(key, val []byte) ([]byte, interface{}, error) {
+		f, err := s.unframe(val)
+		if err != nil {
+			return nil, nil, err
+		}
+		kindDecFn, err := s.kindDecodeFn(f.kind, decFn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return kindDecFn(key, f.body)
+	}
+}
+
+func putFrameTime(b []byte, t time.Time) {
+	var n int64
+	if !t.IsZero() {
+		n = t.UnixNano()
+	}
+	binary.BigEndian.PutUint64(b, uint64(n))
+}
+
+func frameTime(b []byte) time.Time {
+	n := int64(binary.BigEndian.Uint64(b))
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
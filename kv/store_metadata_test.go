@@ -0,0 +1,200 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stepTimeGenerator struct {
+	now time.Time
+}
+
+func (g *stepTimeGenerator) Now() time.Time {
+	return g.now
+}
+
+func TestStoreBase_Metadata(t *testing.T) {
+	bktName := []byte("foo_metadata")
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	newStore := func(t *testing.T, timeGen influxdb.TimeGenerator) (*kv.StoreBase, *kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		plain := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		base := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithMetadata(timeGen, time.Minute),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, plain, kvStore, done
+	}
+
+	findMetadata := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase, id influxdb.ID) kv.Metadata {
+		t.Helper()
+
+		var meta kv.Metadata
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			meta, err = base.FindMetadata(context.TODO(), tx, kv.Entity{PK: kv.EncID(id)})
+			return err
+		})
+		return meta
+	}
+
+	t.Run("put records created and updated times", func(t *testing.T) {
+		timeGen := &stepTimeGenerator{now: start}
+		base, _, kvStore, done := newStore(t, timeGen)
+		defer done()
+
+		ent := newFooEnt(1, 9000, "foo_1")
+		seedEnts(t, kvStore, base, ent)
+
+		timeGen.now = start.Add(time.Hour)
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1_renamed"))
+
+		expected := kv.Metadata{
+			CreatedAt: start,
+			UpdatedAt: start.Add(time.Hour),
+			ExpiresAt: start.Add(time.Hour + time.Minute),
+		}
+		assert.Equal(t, expected, findMetadata(t, kvStore, base, 1))
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			require.NoError(t, err)
+			assert.Equal(t, foo{ID: 1, OrgID: 9000, Name: "foo_1_renamed"}, v)
+			return nil
+		})
+	})
+
+	t.Run("touch bumps updated time only", func(t *testing.T) {
+		timeGen := &stepTimeGenerator{now: start}
+		base, _, kvStore, done := newStore(t, timeGen)
+		defer done()
+
+		ent := newFooEnt(1, 9000, "foo_1")
+		seedEnts(t, kvStore, base, ent)
+		before := findMetadata(t, kvStore, base, 1)
+
+		var bodyBefore []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					bodyBefore = append(bodyBefore, decodedVal)
+					return nil
+				},
+			})
+		})
+
+		timeGen.now = start.Add(30 * time.Second)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Touch(context.TODO(), tx, 1)
+		})
+
+		after := findMetadata(t, kvStore, base, 1)
+		assert.Equal(t, before.CreatedAt, after.CreatedAt)
+		assert.Equal(t, timeGen.now, after.UpdatedAt)
+		assert.Equal(t, timeGen.now.Add(time.Minute), after.ExpiresAt)
+		assert.Equal(t, toIfaces(ent), bodyBefore)
+	})
+
+	t.Run("touch of a missing key is not found", func(t *testing.T) {
+		base, _, kvStore, done := newStore(t, &stepTimeGenerator{now: start})
+		defer done()
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Touch(context.TODO(), tx, 1)
+		})
+		isNotFoundErr(t, err)
+	})
+
+	t.Run("values written before metadata was enabled", func(t *testing.T) {
+		timeGen := &stepTimeGenerator{now: start}
+		base, plain, kvStore, done := newStore(t, timeGen)
+		defer done()
+
+		ent := newFooEnt(1, 9000, "foo_1")
+		seedEnts(t, kvStore, plain, ent)
+
+		assert.Equal(t, kv.Metadata{}, findMetadata(t, kvStore, base, 1))
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			require.NoError(t, err)
+			assert.Equal(t, ent.Body, v)
+			return nil
+		})
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Touch(context.TODO(), tx, 1)
+		})
+		assert.Equal(t, kv.Metadata{
+			CreatedAt: start,
+			UpdatedAt: start,
+			ExpiresAt: start.Add(time.Minute),
+		}, findMetadata(t, kvStore, base, 1))
+	})
+
+	t.Run("touch requires metadata", func(t *testing.T) {
+		_, plain, kvStore, done := newStore(t, &stepTimeGenerator{now: start})
+		defer done()
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return plain.Touch(context.TODO(), tx, 1)
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EMethodNotAllowed, influxdb.ErrorCode(err))
+	})
+
+	t.Run("find modified between", func(t *testing.T) {
+		timeGen := &stepTimeGenerator{now: start}
+		base, plain, kvStore, done := newStore(t, timeGen)
+		defer done()
+
+		seedEnts(t, kvStore, plain, newFooEnt(1, 9000, "never_touched"))
+		for i := 2; i <= 5; i++ {
+			timeGen.now = start.Add(time.Duration(i) * time.Hour)
+			seedEnts(t, kvStore, base, newFooEnt(influxdb.ID(i), 9000, "foo"))
+		}
+
+		findIDs := func(t *testing.T, from, to time.Time, opts kv.FindOpts) []influxdb.ID {
+			t.Helper()
+
+			var ids []influxdb.ID
+			view(t, kvStore, func(tx kv.Tx) error {
+				opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+					ids = append(ids, decodedVal.(foo).ID)
+					return nil
+				}
+				return base.FindModifiedBetween(context.TODO(), tx, from, to, opts)
+			})
+			return ids
+		}
+
+		assert.Equal(t, []influxdb.ID{3, 4}, findIDs(t, start.Add(3*time.Hour), start.Add(4*time.Hour), kv.FindOpts{}))
+		assert.Equal(t, []influxdb.ID{5, 4}, findIDs(t, start.Add(4*time.Hour), time.Time{}, kv.FindOpts{Descending: true}))
+		assert.Equal(t, []influxdb.ID{2, 3}, findIDs(t, time.Time{}, time.Time{}, kv.FindOpts{Limit: 2}))
+		assert.Empty(t, findIDs(t, start.Add(6*time.Hour), time.Time{}, kv.FindOpts{}))
+
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.FindModifiedBetween(context.TODO(), tx, start.Add(time.Hour), start, kv.FindOpts{})
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+
+		err = kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return plain.FindModifiedBetween(context.TODO(), tx, start, time.Time{}, kv.FindOpts{})
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EMethodNotAllowed, influxdb.ErrorCode(err))
+	})
+}
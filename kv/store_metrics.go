@@ -0,0 +1,73 @@
+package kv
+
+import (
+	"sync"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// StoreMetrics are the cumulative counts of the operations of a StoreBase since it
+// was created. Puts count Put and PutRaw calls, Finds count Find and FindEnt calls,
+// and Deletes count Delete and DeleteEnt calls. FindRowsEmitted counts the results
+// captured by Find calls. Errors counts the calls of any of these that failed,
+// other than a FindEnt or DeleteEnt of a missing entity.
+type StoreMetrics struct {
+	Puts            int64
+	Finds           int64
+	Deletes         int64
+	FindRowsEmitted int64
+	Errors          int64
+}
+
+// MetricsSnapshot returns the store's metrics as of the call. It is safe to call
+// concurrently with the store's operations, and requires no metrics registry.
+func (s *StoreBase) MetricsSnapshot() StoreMetrics {
+	return s.metrics.snapshot()
+}
+
+type metricsOp int
+
+const (
+	metricsOpPut metricsOp = iota
+	metricsOpFind
+	metricsOpDelete
+)
+
+// storeMetrics accumulates the metrics of a store. A nil storeMetrics records
+// nothing.
+type storeMetrics struct {
+	mu sync.Mutex
+	m  StoreMetrics
+}
+
+func (sm *storeMetrics) observe(op metricsOp, rows int, err error) {
+	if sm == nil {
+		return
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	switch op {
+	case metricsOpPut:
+		sm.m.Puts++
+	case metricsOpFind:
+		sm.m.Finds++
+	case metricsOpDelete:
+		sm.m.Deletes++
+	}
+	sm.m.FindRowsEmitted += int64(rows)
+	if err != nil && influxdb.ErrorCode(err) != influxdb.ENotFound {
+		sm.m.Errors++
+	}
+}
+
+func (sm *storeMetrics) snapshot() StoreMetrics {
+	if sm == nil {
+		return StoreMetrics{}
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.m
+}
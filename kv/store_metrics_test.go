@@ -0,0 +1,82 @@
+package kv_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_MetricsSnapshot(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("foo", []byte("foo_metrics"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+	assert.Equal(t, kv.StoreMetrics{}, base.MetricsSnapshot())
+
+	seedEnts(t, kvStore, base,
+		newFooEnt(1, 9000, "foo_1"),
+		newFooEnt(2, 9000, "foo_2"),
+		newFooEnt(3, 9000, "foo_3"),
+	)
+
+	view(t, kvStore, func(tx kv.Tx) error {
+		if err := base.Find(context.TODO(), tx, kv.FindOpts{
+			Limit:     2,
+			CaptureFn: func(key []byte, decodedVal interface{}) error { return nil },
+		}); err != nil {
+			return err
+		}
+		// a missing entity is not an error of the store
+		_, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(4)})
+		isNotFoundErr(t, err)
+		return nil
+	})
+
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.DeleteEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+	})
+
+	err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+		return base.Put(context.TODO(), tx, newFooEnt(2, 9000, "foo_2"), kv.PutNew())
+	})
+	require.Error(t, err)
+
+	assert.Equal(t, kv.StoreMetrics{
+		Puts:            4,
+		Finds:           2,
+		Deletes:         1,
+		FindRowsEmitted: 2,
+		Errors:          1,
+	}, base.MetricsSnapshot())
+
+	t.Run("concurrent readers", func(t *testing.T) {
+		before := base.MetricsSnapshot()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = kvStore.View(context.TODO(), func(tx kv.Tx) error {
+					return base.Find(context.TODO(), tx, kv.FindOpts{
+						CaptureFn: func(key []byte, decodedVal interface{}) error { return nil },
+					})
+				})
+				_ = base.MetricsSnapshot()
+			}()
+		}
+		wg.Wait()
+
+		after := base.MetricsSnapshot()
+		assert.Equal(t, before.Finds+8, after.Finds)
+		assert.Equal(t, before.FindRowsEmitted+8*2, after.FindRowsEmitted)
+	})
+}
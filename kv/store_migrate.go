@@ -0,0 +1,160 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+var migrateCheckpointBucket = []byte("kvmigratecheckpointsv1")
+
+// DefaultMigrateBatchSize is the number of pairs MigrateStore copies per
+// transaction when no batch size is configured.
+const DefaultMigrateBatchSize = 1000
+
+// MigrateTransformFn maps a key/value pair read from the source store to the pair
+// written to the destination. Returning a nil key drops the pair from the migration.
+type MigrateTransformFn func(k, v []byte) (nk, nv []byte, err error)
+
+type migrateOpts struct {
+	batchSize int
+}
+
+// MigrateOptFn configures a MigrateStore call.
+type MigrateOptFn func(o *migrateOpts)
+
+// WithMigrateBatchSize sets the number of pairs copied per transaction.
+func WithMigrateBatchSize(n int) MigrateOptFn {
+	return func(o *migrateOpts) {
+		if n > 0 {
+			o.batchSize = n
+		}
+	}
+}
+
+// MigrateStore copies the bucket from the src store to the dst store, passing every
+// pair through the transform. Pairs are read and written in bounded batches so that
+// neither store is held in a long running transaction.
+//
+// Each batch is committed to dst together with a checkpoint of the last source key
+// it covers, so a migration interrupted by an error or a cancelled context resumes
+// after the last committed batch when called again. The checkpoint is kept once the
+// migration completes; calling MigrateStore again only copies keys added to src
+// beyond it.
+func MigrateStore(ctx context.Context, src, dst Store, bucket []byte, transform MigrateTransformFn, opts ...MigrateOptFn) error {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	opt := migrateOpts{batchSize: DefaultMigrateBatchSize}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	var checkpoint []byte
+	err := dst.Update(ctx, func(tx Tx) error {
+		b, err := tx.Bucket(migrateCheckpointBucket)
+		if err != nil {
+			return err
+		}
+		v, err := b.Get(bucket)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+		checkpoint = copyBytes(v)
+		return nil
+	})
+	if err != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to read migration checkpoint for bucket %q", string(bucket)),
+			Err:  err,
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		pairs, err := migrateReadBatch(ctx, src, bucket, checkpoint, opt.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(pairs) == 0 {
+			return nil
+		}
+
+		last := pairs[len(pairs)-1].Key
+		err = dst.Update(ctx, func(tx Tx) error {
+			b, err := tx.Bucket(bucket)
+			if err != nil {
+				return err
+			}
+			for _, p := range pairs {
+				nk, nv, err := transform(p.Key, p.Value)
+				if err != nil {
+					return &influxdb.Error{
+						Code: influxdb.EInternal,
+						Msg:  fmt.Sprintf("failed to transform key %q", string(p.Key)),
+						Err:  err,
+					}
+				}
+				if nk == nil {
+					continue
+				}
+				if err := b.Put(nk, nv); err != nil {
+					return err
+				}
+			}
+
+			cb, err := tx.Bucket(migrateCheckpointBucket)
+			if err != nil {
+				return err
+			}
+			return cb.Put(bucket, last)
+		})
+		if err != nil {
+			return err
+		}
+		checkpoint = last
+	}
+}
+
+// migrateReadBatch reads up to n pairs from the bucket in src with keys strictly
+// greater than after. The pairs are copied so they outlive the transaction.
+func migrateReadBatch(ctx context.Context, src Store, bucket, after []byte, n int) ([]Pair, error) {
+	var pairs []Pair
+	err := src.View(ctx, func(tx Tx) error {
+		b, err := tx.Bucket(bucket)
+		if err != nil {
+			return err
+		}
+		cur, err := b.Cursor()
+		if err != nil {
+			return err
+		}
+
+		k, v := cur.First()
+		if after != nil {
+			k, v = cur.Seek(after)
+			if bytes.Equal(k, after) {
+				k, v = cur.Next()
+			}
+		}
+		for ; k != nil && len(pairs) < n; k, v = cur.Next() {
+			pairs = append(pairs, Pair{Key: copyBytes(k), Value: copyBytes(v)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to read bucket %q from source store", string(bucket)),
+			Err:  err,
+		}
+	}
+	return pairs, nil
+}
@@ -0,0 +1,140 @@
+package kv_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateStore(t *testing.T) {
+	bucket := []byte("foo_migrate")
+
+	newStores := func(t *testing.T, pairs ...kv.Pair) (kv.Store, kv.Store, func()) {
+		t.Helper()
+
+		src, srcDone, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		dst, dstDone, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		update(t, src, func(tx kv.Tx) error {
+			b, err := tx.Bucket(bucket)
+			if err != nil {
+				return err
+			}
+			for _, p := range pairs {
+				if err := b.Put(p.Key, p.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return src, dst, func() {
+			srcDone()
+			dstDone()
+		}
+	}
+
+	readAll := func(t *testing.T, store kv.Store) []kv.Pair {
+		t.Helper()
+
+		var pairs []kv.Pair
+		view(t, store, func(tx kv.Tx) error {
+			b, err := tx.Bucket(bucket)
+			if err != nil {
+				return err
+			}
+			cur, err := b.Cursor()
+			if err != nil {
+				return err
+			}
+			for k, v := cur.First(); k != nil; k, v = cur.Next() {
+				pairs = append(pairs, kv.Pair{Key: k, Value: v})
+			}
+			return nil
+		})
+		return pairs
+	}
+
+	pairs := []kv.Pair{
+		{Key: []byte("k1"), Value: []byte("v1")},
+		{Key: []byte("k2"), Value: []byte("v2")},
+		{Key: []byte("k3"), Value: []byte("v3")},
+		{Key: []byte("k4"), Value: []byte("v4")},
+		{Key: []byte("k5"), Value: []byte("v5")},
+	}
+
+	upperValue := func(k, v []byte) ([]byte, []byte, error) {
+		return k, bytes.ToUpper(v), nil
+	}
+
+	t.Run("copies and transforms every pair", func(t *testing.T) {
+		src, dst, done := newStores(t, pairs...)
+		defer done()
+
+		err := kv.MigrateStore(context.Background(), src, dst, bucket, upperValue, kv.WithMigrateBatchSize(2))
+		require.NoError(t, err)
+
+		expected := []kv.Pair{
+			{Key: []byte("k1"), Value: []byte("V1")},
+			{Key: []byte("k2"), Value: []byte("V2")},
+			{Key: []byte("k3"), Value: []byte("V3")},
+			{Key: []byte("k4"), Value: []byte("V4")},
+			{Key: []byte("k5"), Value: []byte("V5")},
+		}
+		assert.Equal(t, expected, readAll(t, dst))
+	})
+
+	t.Run("drops pairs mapped to a nil key", func(t *testing.T) {
+		src, dst, done := newStores(t, pairs...)
+		defer done()
+
+		dropOdd := func(k, v []byte) ([]byte, []byte, error) {
+			if (k[1]-'0')%2 == 1 {
+				return nil, nil, nil
+			}
+			return k, v, nil
+		}
+		require.NoError(t, kv.MigrateStore(context.Background(), src, dst, bucket, dropOdd))
+
+		assert.Equal(t, []kv.Pair{pairs[1], pairs[3]}, readAll(t, dst))
+	})
+
+	t.Run("resumes from the last committed batch", func(t *testing.T) {
+		src, dst, done := newStores(t, pairs...)
+		defer done()
+
+		var (
+			seen []string
+			fail = true
+		)
+		transform := func(k, v []byte) ([]byte, []byte, error) {
+			seen = append(seen, string(k))
+			if fail && string(k) == "k3" {
+				return nil, nil, errors.New("interrupted")
+			}
+			return upperValue(k, v)
+		}
+
+		err := kv.MigrateStore(context.Background(), src, dst, bucket, transform, kv.WithMigrateBatchSize(2))
+		require.Error(t, err)
+		assert.Len(t, readAll(t, dst), 2)
+
+		fail = false
+		seen = nil
+		err = kv.MigrateStore(context.Background(), src, dst, bucket, transform, kv.WithMigrateBatchSize(2))
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"k3", "k4", "k5"}, seen)
+		assert.Len(t, readAll(t, dst), len(pairs))
+
+		seen = nil
+		require.NoError(t, kv.MigrateStore(context.Background(), src, dst, bucket, transform))
+		assert.Empty(t, seen)
+	})
+}
@@ -0,0 +1,168 @@
+package kv
+
+import "bytes"
+
+// NamespacedStoreBase is a StoreBase that shares its physical bucket with other
+// resources, keeping its entities under a key namespace of their own. This keeps
+// the bucket count down where many small resources would otherwise each need one.
+//
+// The namespace is prepended to every key the store writes and stripped from every
+// key it hands back, so the encode, decode and capture funcs only ever see the
+// resource's own keys. The translation is made by the StoreBase itself, so every
+// method taking FindOpts, not only those of this type, accepts Prefix and After
+// keys without the namespace. Every scan of the bucket, whether a Find, a Delete
+// or a reindex, is confined to the namespace. No namespace may be a prefix of another
+// sharing the bucket, which is most easily guaranteed by ending each in a
+// separator such as '/'.
+type NamespacedStoreBase struct {
+	*StoreBase
+	Namespace []byte
+}
+
+// NewNamespacedStoreBase creates a store for the resource under the namespace of the
+// shared bucket. The encode and decode funcs deal in keys without the namespace.
+func NewNamespacedStoreBase(resource string, bktName, namespace []byte, encKeyFn, encBodyFn EncodeEntFn, decFn DecodeBucketValFn, decToEntFn ConvertValToEntFn, opts ...StoreBaseOptFn) *NamespacedStoreBase {
+	ns := copyBytes(namespace)
+	opts = append(opts, func(s *StoreBase) {
+		s.namespace = ns
+	})
+	return &NamespacedStoreBase{
+		StoreBase: NewStoreBase(resource, bktName,
+			encNamespaced(ns, encKeyFn),
+			encBodyFn,
+			decNamespaced(ns, decFn),
+			convNamespaced(ns, decToEntFn),
+			opts...,
+		),
+		Namespace: ns,
+	}
+}
+
+// namespaceFindOpts translates the options of a Find over a namespaced store, so
+// that callers deal only in the resource's own keys. The Prefix and After keys are
+// joined with the namespace, and the keys provided to the capture, filter and stop
+// funcs are stripped of it. The options of a store without a namespace are
+// returned as they are.
+func (s *StoreBase) namespaceFindOpts(opts FindOpts) FindOpts {
+	if s.namespace == nil {
+		return opts
+	}
+
+	if len(opts.Prefix) > 0 {
+		opts.Prefix = s.withNamespace(opts.Prefix)
+	}
+	if len(opts.After) > 0 {
+		opts.After = s.withNamespace(opts.After)
+	}
+	if fn := opts.CaptureFn; fn != nil {
+		opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+			return fn(s.withoutNamespace(key), decodedVal)
+		}
+	}
+	if fn := opts.IndexedCaptureFn; fn != nil {
+		opts.IndexedCaptureFn = func(idx int, key []byte, decodedVal interface{}) error {
+			return fn(idx, s.withoutNamespace(key), decodedVal)
+		}
+	}
+	if fn := opts.FilterEntFn; fn != nil {
+		opts.FilterEntFn = func(key []byte, decodedVal interface{}) bool {
+			return fn(s.withoutNamespace(key), decodedVal)
+		}
+	}
+	if fn := opts.StopFn; fn != nil {
+		opts.StopFn = func(key []byte) bool {
+			return fn(s.withoutNamespace(key))
+		}
+	}
+	return opts
+}
+
+// withNamespace returns the key joined with the store's namespace, if any.
+func (s *StoreBase) withNamespace(key []byte) []byte {
+	if s.namespace == nil {
+		return key
+	}
+	return joinNamespace(s.namespace, key)
+}
+
+// withoutNamespace returns the key stripped of the store's namespace, if any.
+func (s *StoreBase) withoutNamespace(key []byte) []byte {
+	return bytes.TrimPrefix(key, s.namespace)
+}
+
+func joinNamespace(ns, key []byte) []byte {
+	out := make([]byte, 0, len(ns)+len(key))
+	return append(append(out, ns...), key...)
+}
+
+func encNamespaced(ns []byte, fn EncodeEntFn) EncodeEntFn {
+	return func(ent Entity) ([]byte, string, error) {
+		key, field, err := fn(ent)
+		if err != nil {
+			return nil, field, err
+		}
+		return joinNamespace(ns, key), field, nil
+	}
+}
+
+// decNamespaced decodes with the key stripped of the namespace. The full key is
+// always returned, as the store relies on it to address the entity in the bucket.
+func decNamespaced(ns []byte, fn DecodeBucketValFn) DecodeBucketValFn {
+	return func(key, val []byte) ([]byte, interface{}, error) {
+		_, decodedVal, err := fn(bytes.TrimPrefix(key, ns), val)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, decodedVal, nil
+	}
+}
+
+func convNamespaced(ns []byte, fn ConvertValToEntFn) ConvertValToEntFn {
+	return func(k []byte, v interface{}) (Entity, error) {
+		return fn(bytes.TrimPrefix(k, ns), v)
+	}
+}
+
+// namespaceCursor confines a cursor to the keys of a namespace. Keys are returned
+// with the namespace intact.
+type namespaceCursor struct {
+	Cursor
+	ns []byte
+}
+
+func (c *namespaceCursor) Seek(prefix []byte) ([]byte, []byte) {
+	if bytes.Compare(prefix, c.ns) < 0 {
+		prefix = c.ns
+	}
+	return c.confine(c.Cursor.Seek(prefix))
+}
+
+func (c *namespaceCursor) First() ([]byte, []byte) {
+	return c.Seek(c.ns)
+}
+
+func (c *namespaceCursor) Last() ([]byte, []byte) {
+	end := prefixEnd(c.ns)
+	if end == nil {
+		return c.confine(c.Cursor.Last())
+	}
+	if k, _ := c.Cursor.Seek(end); k == nil {
+		return c.confine(c.Cursor.Last())
+	}
+	return c.confine(c.Cursor.Prev())
+}
+
+func (c *namespaceCursor) Next() ([]byte, []byte) {
+	return c.confine(c.Cursor.Next())
+}
+
+func (c *namespaceCursor) Prev() ([]byte, []byte) {
+	return c.confine(c.Cursor.Prev())
+}
+
+func (c *namespaceCursor) confine(k, v []byte) ([]byte, []byte) {
+	if !bytes.HasPrefix(k, c.ns) {
+		return nil, nil
+	}
+	return k, v
+}
@@ -0,0 +1,415 @@
+package kv_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespacedStoreBase(t *testing.T) {
+	newStores := func(t *testing.T, bktSuffix string) (*kv.NamespacedStoreBase, *kv.NamespacedStoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		bktName := []byte("shared_" + bktSuffix)
+		first := kv.NewNamespacedStoreBase("foo", bktName, []byte("a/"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		second := kv.NewNamespacedStoreBase("foo", bktName, []byte("b/"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := first.Init(context.TODO(), tx); err != nil {
+				return err
+			}
+			return second.Init(context.TODO(), tx)
+		})
+		return first, second, kvStore, done
+	}
+
+	findKeys := func(t *testing.T, kvStore kv.Store, store *kv.NamespacedStoreBase, opts kv.FindOpts) ([][]byte, []interface{}) {
+		t.Helper()
+
+		var (
+			keys [][]byte
+			vals []interface{}
+		)
+		view(t, kvStore, func(tx kv.Tx) error {
+			opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+				keys = append(keys, append([]byte(nil), key...))
+				vals = append(vals, decodedVal)
+				return nil
+			}
+			return store.Find(context.TODO(), tx, opts)
+		})
+		return keys, vals
+	}
+
+	t.Run("stores share a bucket without seeing each other", func(t *testing.T) {
+		first, second, kvStore, done := newStores(t, "isolation")
+		defer done()
+
+		firstEnts := []kv.Entity{newFooEnt(1, 9000, "a1"), newFooEnt(2, 9000, "a2")}
+		secondEnts := []kv.Entity{newFooEnt(1, 9000, "b1"), newFooEnt(3, 9000, "b3")}
+		seedEnts(t, kvStore, first, firstEnts...)
+		seedEnts(t, kvStore, second, secondEnts...)
+
+		keys, vals := findKeys(t, kvStore, first, kv.FindOpts{})
+		assert.Equal(t, [][]byte{encodeID(t, 1), encodeID(t, 2)}, keys)
+		assert.Equal(t, toIfaces(firstEnts...), vals)
+
+		keys, vals = findKeys(t, kvStore, second, kv.FindOpts{Descending: true})
+		assert.Equal(t, [][]byte{encodeID(t, 3), encodeID(t, 1)}, keys)
+		assert.Equal(t, reverseSlc(toIfaces(secondEnts...)), vals)
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := second.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			require.NoError(t, err)
+			assert.Equal(t, secondEnts[0].Body, v)
+
+			_, err = first.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(3)})
+			isNotFoundErr(t, err)
+			return nil
+		})
+
+		raw := getEntRaw(t, kvStore, first.BktName, append([]byte("a/"), encodeID(t, 2)...))
+		assert.NotEmpty(t, raw)
+	})
+
+	t.Run("after and prefix are relative to the namespace", func(t *testing.T) {
+		first, second, kvStore, done := newStores(t, "range")
+		defer done()
+
+		seedEnts(t, kvStore, first, newFooEnt(1, 9000, "a1"), newFooEnt(2, 9000, "a2"), newFooEnt(3, 9000, "a3"))
+		seedEnts(t, kvStore, second, newFooEnt(4, 9000, "b4"))
+
+		keys, _ := findKeys(t, kvStore, first, kv.FindOpts{After: encodeID(t, 1)})
+		assert.Equal(t, [][]byte{encodeID(t, 2), encodeID(t, 3)}, keys)
+
+		keys, _ = findKeys(t, kvStore, first, kv.FindOpts{Descending: true, After: encodeID(t, 3)})
+		assert.Equal(t, [][]byte{encodeID(t, 2), encodeID(t, 1)}, keys)
+
+		keys, _ = findKeys(t, kvStore, first, kv.FindOpts{Prefix: encodeID(t, 3)})
+		assert.Equal(t, [][]byte{encodeID(t, 3)}, keys)
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			n, err := first.CountByPrefix(context.TODO(), tx, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 3, n)
+
+			pairs, err := second.FindPairs(context.TODO(), tx, kv.FindOpts{})
+			require.NoError(t, err)
+			require.Len(t, pairs, 1)
+			assert.Equal(t, encodeID(t, 4), pairs[0].Key)
+			return nil
+		})
+	})
+
+	t.Run("delete is confined to the namespace", func(t *testing.T) {
+		first, second, kvStore, done := newStores(t, "delete")
+		defer done()
+
+		seedEnts(t, kvStore, first, newFooEnt(1, 9000, "a1"), newFooEnt(2, 9000, "a2"))
+		seedEnts(t, kvStore, second, newFooEnt(1, 9000, "b1"))
+
+		var filtered [][]byte
+		update(t, kvStore, func(tx kv.Tx) error {
+			return first.Delete(context.TODO(), tx, kv.DeleteOpts{
+				FilterFn: func(k []byte, v interface{}) bool {
+					filtered = append(filtered, append([]byte(nil), k...))
+					return true
+				},
+			})
+		})
+		assert.Equal(t, [][]byte{encodeID(t, 1), encodeID(t, 2)}, filtered)
+
+		keys, _ := findKeys(t, kvStore, first, kv.FindOpts{})
+		assert.Empty(t, keys)
+
+		keys, _ = findKeys(t, kvStore, second, kv.FindOpts{})
+		assert.Equal(t, [][]byte{encodeID(t, 1)}, keys)
+	})
+
+	t.Run("tail is confined to the namespace", func(t *testing.T) {
+		first, second, kvStore, done := newStores(t, "tail")
+		defer done()
+
+		firstEnts := []kv.Entity{
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+			newFooEnt(3, 9000, "foo_3"),
+			newFooEnt(0x11, 9000, "foo_17"),
+		}
+		seedEnts(t, kvStore, first, firstEnts...)
+		seedEnts(t, kvStore, second, newFooEnt(4, 9000, "foo_4"), newFooEnt(5, 9000, "foo_5"))
+
+		tail := func(store *kv.NamespacedStoreBase, n int, opts kv.FindOpts) []interface{} {
+			var vals []interface{}
+			view(t, kvStore, func(tx kv.Tx) error {
+				var err error
+				vals, err = store.Tail(context.TODO(), tx, n, opts)
+				return err
+			})
+			return vals
+		}
+
+		assert.Equal(t, toIfaces(firstEnts...), tail(first, 10, kv.FindOpts{}))
+		assert.Equal(t, toIfaces(firstEnts[1:3]...), tail(first, 2, kv.FindOpts{Prefix: []byte("000000000000000")}))
+		assert.Equal(t, toIfaces(firstEnts[3]), tail(first, 2, kv.FindOpts{Prefix: []byte("000000000000001")}))
+		assert.Equal(t, toIfaces(newFooEnt(5, 9000, "foo_5")), tail(second, 1, kv.FindOpts{Prefix: []byte("000000000000000")}))
+	})
+	t.Run("every find translates keys of the namespace", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		nameIndex := kv.StoreIndex{
+			Name:    "name",
+			BktName: []byte("shared_finds_name_index"),
+			KeyFn: func(ent kv.Entity) ([]byte, error) {
+				return []byte(ent.Body.(foo).Name), nil
+			},
+		}
+		first := kv.NewNamespacedStoreBase("foo", []byte("shared_finds"), []byte("a/"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithIndex(nameIndex),
+			kv.WithSeqIndex([]byte("shared_finds_seq")),
+			kv.WithMetadata(&stepTimeGenerator{now: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)}, 0),
+			kv.WithJSONBodies(),
+		)
+		second := kv.NewNamespacedStoreBase("foo", []byte("shared_finds"), []byte("b/"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := first.Init(context.TODO(), tx); err != nil {
+				return err
+			}
+			return second.Init(context.TODO(), tx)
+		})
+
+		ents := []kv.Entity{newFooEnt(1, 9000, "charlie"), newFooEnt(2, 9000, "alpha"), newFooEnt(3, 9000, "bravo")}
+		seedEnts(t, kvStore, first, ents...)
+		seedEnts(t, kvStore, second, newFooEnt(4, 9000, "delta"))
+
+		var keys [][]byte
+		capture := func(key []byte, decodedVal interface{}) error {
+			keys = append(keys, append([]byte(nil), key...))
+			return nil
+		}
+		after := kv.FindOpts{After: encodeID(t, 1), CaptureFn: capture}
+		ids := func(ids ...influxdb.ID) [][]byte {
+			out := make([][]byte, 0, len(ids))
+			for _, id := range ids {
+				out = append(out, encodeID(t, id))
+			}
+			return out
+		}
+
+		tests := []struct {
+			name     string
+			findFn   func(tx kv.Tx) error
+			expected [][]byte
+		}{
+			{
+				name: "Find",
+				findFn: func(tx kv.Tx) error {
+					return first.Find(context.TODO(), tx, after)
+				},
+				expected: ids(2, 3),
+			},
+			{
+				name: "FindPairs",
+				findFn: func(tx kv.Tx) error {
+					pairs, err := first.FindPairs(context.TODO(), tx, kv.FindOpts{Prefix: encodeID(t, 2)})
+					for _, p := range pairs {
+						keys = append(keys, p.Key)
+					}
+					return err
+				},
+				expected: ids(2, 3),
+			},
+			{
+				name: "FindOne",
+				findFn: func(tx kv.Tx) error {
+					v, err := first.FindOne(context.TODO(), tx, kv.FindOpts{Prefix: encodeID(t, 3)})
+					if err == nil {
+						keys = append(keys, encodeID(t, v.(foo).ID))
+					}
+					return err
+				},
+				expected: ids(3),
+			},
+			{
+				name: "FindSortedBy",
+				findFn: func(tx kv.Tx) error {
+					vals, err := first.FindSortedBy(context.TODO(), tx, func(a, b interface{}) bool {
+						return a.(foo).Name < b.(foo).Name
+					}, kv.FindOpts{After: encodeID(t, 1)})
+					for _, v := range vals {
+						keys = append(keys, encodeID(t, v.(foo).ID))
+					}
+					return err
+				},
+				expected: ids(2, 3),
+			},
+			{
+				name: "FindTyped",
+				findFn: func(tx kv.Tx) error {
+					var foos []foo
+					err := first.FindTyped(context.TODO(), tx, kv.FindOpts{After: encodeID(t, 2)}, &foos)
+					for _, f := range foos {
+						keys = append(keys, encodeID(t, f.ID))
+					}
+					return err
+				},
+				expected: ids(3),
+			},
+			{
+				name: "FindBatchStream",
+				findFn: func(tx kv.Tx) error {
+					batches, errc := first.FindBatchStream(context.TODO(), tx, kv.FindOpts{After: encodeID(t, 1), BatchSize: 1})
+					for batch := range batches {
+						for _, kv := range batch {
+							keys = append(keys, kv.Key)
+						}
+					}
+					return <-errc
+				},
+				expected: ids(2, 3),
+			},
+			{
+				name: "FindInSeqOrder",
+				findFn: func(tx kv.Tx) error {
+					return first.FindInSeqOrder(context.TODO(), tx, kv.FindOpts{Descending: true, CaptureFn: capture})
+				},
+				expected: ids(3, 2, 1),
+			},
+			{
+				name: "FindModifiedBetween",
+				findFn: func(tx kv.Tx) error {
+					return first.FindModifiedBetween(context.TODO(), tx, time.Time{}, time.Time{}, after)
+				},
+				expected: ids(2, 3),
+			},
+			{
+				name: "FindViaIndexOrdered",
+				findFn: func(tx kv.Tx) error {
+					return first.FindViaIndexOrdered(context.TODO(), tx, "name", nil, kv.FindOpts{CaptureFn: capture})
+				},
+				expected: ids(2, 3, 1),
+			},
+			{
+				name: "FindRawJSON",
+				findFn: func(tx kv.Tx) error {
+					var buf bytes.Buffer
+					if err := first.FindRawJSON(context.TODO(), tx, &buf, kv.FindOpts{After: encodeID(t, 1)}); err != nil {
+						return err
+					}
+					var foos []foo
+					require.NoError(t, json.Unmarshal(buf.Bytes(), &foos))
+					for _, f := range foos {
+						keys = append(keys, encodeID(t, f.ID))
+					}
+					return nil
+				},
+				expected: ids(2, 3),
+			},
+			{
+				name: "Sample",
+				findFn: func(tx kv.Tx) error {
+					vals, err := first.Sample(context.TODO(), tx, 10)
+					for _, v := range vals {
+						keys = append(keys, encodeID(t, v.(foo).ID))
+					}
+					return err
+				},
+				expected: ids(1, 2, 3),
+			},
+			{
+				name: "ExportJSON",
+				findFn: func(tx kv.Tx) error {
+					var buf bytes.Buffer
+					_, err := first.ExportJSON(context.TODO(), tx, &buf)
+					dec := json.NewDecoder(&buf)
+					for dec.More() {
+						var r kv.ExportRecord
+						require.NoError(t, dec.Decode(&r))
+						keys = append(keys, r.Key)
+					}
+					return err
+				},
+				expected: ids(1, 2, 3),
+			},
+			{
+				name: "FindWithChildren",
+				findFn: func(tx kv.Tx) error {
+					results, err := kv.FindWithChildren(context.TODO(), tx, second.StoreBase, first.StoreBase, func(interface{}) []byte {
+						return encodeID(t, 2)
+					}, kv.FindOpts{})
+					for _, r := range results {
+						keys = append(keys, r.Parent.Key)
+						for _, c := range r.Children {
+							keys = append(keys, c.Key)
+						}
+					}
+					return err
+				},
+				expected: ids(4, 2),
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				keys = nil
+				view(t, kvStore, tt.findFn)
+				assert.Equal(t, tt.expected, keys)
+			})
+		}
+	})
+
+	t.Run("projections are confined to the namespace", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		nameProjectFn := func(ent kv.Entity) ([]byte, error) {
+			return []byte(ent.Body.(foo).Name), nil
+		}
+		decNameFn := func(key, val []byte) ([]byte, interface{}, error) {
+			return key, string(val), nil
+		}
+		newStore := func(namespace string) *kv.NamespacedStoreBase {
+			return kv.NewNamespacedStoreBase("foo", []byte("shared_projection"), []byte(namespace), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+				kv.WithProjection([]byte("shared_projection_names"), nameProjectFn, decNameFn),
+			)
+		}
+		first, second := newStore("a/"), newStore("b/")
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := first.Init(context.TODO(), tx); err != nil {
+				return err
+			}
+			return second.Init(context.TODO(), tx)
+		})
+
+		seedEnts(t, kvStore, first, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2"))
+		seedEnts(t, kvStore, second, newFooEnt(3, 9000, "foo_3"))
+
+		var (
+			keys  [][]byte
+			names []interface{}
+		)
+		view(t, kvStore, func(tx kv.Tx) error {
+			return first.FindProjection(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					keys = append(keys, append([]byte(nil), key...))
+					names = append(names, decodedVal)
+					return nil
+				},
+			})
+		})
+		assert.Equal(t, []interface{}{"foo_1", "foo_2"}, names)
+		assert.Equal(t, [][]byte{encodeID(t, 1), encodeID(t, 2)}, keys)
+	})
+}
@@ -0,0 +1,330 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// OrgIDFn returns the id of the organization the decoded entity belongs to.
+type OrgIDFn func(decodedVal interface{}) (influxdb.ID, error)
+
+// WithOrgKeyPrefix declares that every key of the store begins with the encoded id
+// of the organization the entity belongs to, as with keys built by Encode(EncID(orgID),
+// ...), i.e. the stores of NewOrgNameKeyStore. Per org operations then derive the
+// organization from the key alone, without decoding values.
+func WithOrgKeyPrefix() StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.orgKeyPrefix = true
+	}
+}
+
+// WithOrgIDFn registers the extractor per org operations use to find the
+// organization of an entity, for stores whose keys do not begin with it.
+func WithOrgIDFn(fn OrgIDFn) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.orgIDFn = fn
+	}
+}
+
+// SizeByOrg returns the number of bytes of keys and values the store holds for each
+// organization. The store is scanned with a cursor, holding a single total per
+// organization in memory. Stores configured with WithOrgKeyPrefix are measured
+// without decoding any value, whereas those configured with WithOrgIDFn decode each
+// value to extract its organization.
+func (s *StoreBase) SizeByOrg(ctx context.Context, tx Tx) (map[influxdb.ID]int64, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	orgFn, err := s.orgFn()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[influxdb.ID]int64)
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return sizes, nil
+		}
+		return nil, err
+	}
+
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		orgID, err := orgFn(k, v)
+		if err != nil {
+			return nil, err
+		}
+		sizes[orgID] += int64(len(k) + len(v))
+	}
+	return sizes, nil
+}
+
+// ForEachOrg calls fn once per organization with the decoded entities the store
+// holds for it, in ascending order of organization id and, within an organization,
+// in key order. The entities of every organization are buffered before fn is
+// first called, save for stores configured with WithOrgKeyPrefix, whose keys group
+// the entities of an organization together so only those of one organization are
+// buffered at a time. ForEachOrgEnt streams the entities of huge organizations
+// instead. An error from fn stops the iteration and is returned.
+func (s *StoreBase) ForEachOrg(ctx context.Context, tx Tx, fn func(orgID influxdb.ID, ents []interface{}) error) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if s.orgKeyPrefix {
+		var (
+			cur  influxdb.ID
+			ents []interface{}
+		)
+		err := s.ForEachOrgEnt(ctx, tx, func(orgID influxdb.ID, decodedVal interface{}) error {
+			if len(ents) > 0 && orgID != cur {
+				if err := fn(cur, ents); err != nil {
+					return err
+				}
+				ents = nil
+			}
+			cur = orgID
+			ents = append(ents, decodedVal)
+			return nil
+		})
+		if err != nil || len(ents) == 0 {
+			return err
+		}
+		return fn(cur, ents)
+	}
+
+	if _, err := s.orgFn(); err != nil {
+		return err
+	}
+
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return nil
+		}
+		return err
+	}
+
+	decFn := s.decodeFn()
+	var (
+		byOrg  = make(map[influxdb.ID][]interface{})
+		orgIDs []influxdb.ID
+	)
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, decodedVal, err := decFn(k, v)
+		if err != nil {
+			return &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to decode %s for key %q", s.Resource, string(k)),
+				Err:  err,
+			}
+		}
+		orgID, err := s.valOrgID(k, decodedVal)
+		if err != nil {
+			return err
+		}
+		if _, ok := byOrg[orgID]; !ok {
+			orgIDs = append(orgIDs, orgID)
+		}
+		byOrg[orgID] = append(byOrg[orgID], decodedVal)
+	}
+
+	sortOrgIDs(orgIDs)
+	for _, orgID := range orgIDs {
+		if err := fn(orgID, byOrg[orgID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachOrgEnt calls fn with each decoded entity of the store along with its
+// organization, in the order of ForEachOrg, so the entities of an organization are
+// visited consecutively. Stores configured with WithOrgKeyPrefix are streamed in a
+// single pass. Those configured with WithOrgIDFn are scanned once to group the keys
+// of each organization, without holding on to any entity, and the entities are
+// then read back per organization, decoding every value twice.
+func (s *StoreBase) ForEachOrgEnt(ctx context.Context, tx Tx, fn func(orgID influxdb.ID, decodedVal interface{}) error) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	orgFn, err := s.orgFn()
+	if err != nil {
+		return err
+	}
+
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return nil
+		}
+		return err
+	}
+
+	decFn := s.decodeFn()
+	decode := func(k, v []byte) (interface{}, error) {
+		_, decodedVal, err := decFn(k, v)
+		if err != nil {
+			return nil, &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to decode %s for key %q", s.Resource, string(k)),
+				Err:  err,
+			}
+		}
+		return decodedVal, nil
+	}
+
+	if s.orgKeyPrefix {
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			orgID, err := s.keyOrgID(k)
+			if err != nil {
+				return err
+			}
+			decodedVal, err := decode(k, v)
+			if err != nil {
+				return err
+			}
+			if err := fn(orgID, decodedVal); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		keysByOrg = make(map[influxdb.ID][][]byte)
+		orgIDs    []influxdb.ID
+	)
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		orgID, err := orgFn(k, v)
+		if err != nil {
+			return err
+		}
+		if _, ok := keysByOrg[orgID]; !ok {
+			orgIDs = append(orgIDs, orgID)
+		}
+		keysByOrg[orgID] = append(keysByOrg[orgID], copyBytes(k))
+	}
+
+	sortOrgIDs(orgIDs)
+	for _, orgID := range orgIDs {
+		for _, k := range keysByOrg[orgID] {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			v, err := s.bucketGet(ctx, tx, k)
+			if err != nil {
+				return err
+			}
+			decodedVal, err := decode(k, v)
+			if err != nil {
+				return err
+			}
+			if err := fn(orgID, decodedVal); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sortOrgIDs sorts the organizations in ascending order.
+func sortOrgIDs(ids []influxdb.ID) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
+
+// orgFn returns a func extracting the organization of a raw key and value of the
+// store, or an error when the store has no means of doing so.
+func (s *StoreBase) orgFn() (func(k, v []byte) (influxdb.ID, error), error) {
+	switch {
+	case s.orgKeyPrefix:
+		return func(k, _ []byte) (influxdb.ID, error) {
+			return s.keyOrgID(k)
+		}, nil
+	case s.orgIDFn != nil:
+		decFn := s.decodeFn()
+		return func(k, v []byte) (influxdb.ID, error) {
+			_, decodedVal, err := decFn(k, v)
+			if err != nil {
+				return 0, &influxdb.Error{
+					Code: influxdb.EInternal,
+					Msg:  fmt.Sprintf("failed to decode %s for key %q", s.Resource, string(k)),
+					Err:  err,
+				}
+			}
+			return s.valOrgID(k, decodedVal)
+		}, nil
+	default:
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s store has no means of finding the organization of an entity", s.Resource),
+		}
+	}
+}
+
+// orgPolicyFn adapts the org policy of a Find to the entities the Find iterates.
+func (s *StoreBase) orgPolicyFn(policyFn func(orgID influxdb.ID) bool) func(k []byte, decodedVal interface{}) (bool, error) {
+	return func(k []byte, decodedVal interface{}) (bool, error) {
+		orgID, err := s.entOrgID(k, decodedVal)
+		if err != nil {
+			return false, err
+		}
+		return policyFn(orgID), nil
+	}
+}
+
+// entOrgID extracts the organization of an entity found under the key with the
+// decoded value, from the key alone when the store is configured to allow it.
+func (s *StoreBase) entOrgID(k []byte, decodedVal interface{}) (influxdb.ID, error) {
+	if s.orgKeyPrefix {
+		return s.keyOrgID(k)
+	}
+	return s.valOrgID(k, decodedVal)
+}
+
+// keyOrgID decodes the organization prefixing a key of a store configured with
+// WithOrgKeyPrefix. The key is that of the bucket, so any namespace is stripped
+// before the organization is decoded.
+func (s *StoreBase) keyOrgID(k []byte) (influxdb.ID, error) {
+	orgID, _, err := DecodeOrgNameKey(s.withoutNamespace(k))
+	if err != nil {
+		return 0, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to decode %s organization from key %q", s.Resource, string(k)),
+			Err:  err,
+		}
+	}
+	return orgID, nil
+}
+
+// valOrgID extracts the organization of a decoded value with the store's OrgIDFn.
+func (s *StoreBase) valOrgID(k []byte, decodedVal interface{}) (influxdb.ID, error) {
+	orgID, err := s.orgIDFn(decodedVal)
+	if err != nil {
+		return 0, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to extract %s organization for key %q", s.Resource, string(k)),
+			Err:  err,
+		}
+	}
+	return orgID, nil
+}
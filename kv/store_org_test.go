@@ -0,0 +1,284 @@
+package kv_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fooOrgIDFn(v interface{}) (influxdb.ID, error) {
+	f, ok := v.(foo)
+	if !ok {
+		return 0, fmt.Errorf("invalid entry: %#v", v)
+	}
+	return f.OrgID, nil
+}
+
+func TestStoreBase_SizeByOrg(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	sizeByOrg := func(base *kv.StoreBase) (map[influxdb.ID]int64, error) {
+		var sizes map[influxdb.ID]int64
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			var err error
+			sizes, err = base.SizeByOrg(context.TODO(), tx)
+			return err
+		})
+		return sizes, err
+	}
+
+	t.Run("org key prefix", func(t *testing.T) {
+		base := kv.NewStoreBase("foo", []byte("foo_size_org_key"), kv.EncUniqKey, kv.EncIDKey, kv.DecIndexID,
+			func(k []byte, v interface{}) (kv.Entity, error) {
+				return kv.Entity{PK: kv.EncID(v.(influxdb.ID))}, nil
+			},
+			kv.WithOrgKeyPrefix(),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+
+		// each key is the 16 byte org id and the name, each value the 16 byte id
+		seedEnts(t, kvStore, base,
+			kv.Entity{PK: kv.EncID(1), UniqueKey: kv.Encode(kv.EncID(9000), kv.EncString("a"))},
+			kv.Entity{PK: kv.EncID(2), UniqueKey: kv.Encode(kv.EncID(9000), kv.EncString("bb"))},
+			kv.Entity{PK: kv.EncID(3), UniqueKey: kv.Encode(kv.EncID(9001), kv.EncString("ccc"))},
+		)
+
+		sizes, err := sizeByOrg(base)
+		require.NoError(t, err)
+		assert.Equal(t, map[influxdb.ID]int64{
+			9000: (16 + 1 + 16) + (16 + 2 + 16),
+			9001: 16 + 3 + 16,
+		}, sizes)
+	})
+
+	t.Run("org id func", func(t *testing.T) {
+		base := kv.NewStoreBase("foo", []byte("foo_size_org_fn"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithOrgIDFn(fooOrgIDFn),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9001, "foo_2"),
+			newFooEnt(3, 9000, "foo_3"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		expected := make(map[influxdb.ID]int64)
+		for _, ent := range ents {
+			raw := getEntRaw(t, kvStore, []byte("foo_size_org_fn"), encodeID(t, ent.Body.(foo).ID))
+			expected[ent.Body.(foo).OrgID] += int64(16 + len(raw))
+		}
+
+		sizes, err := sizeByOrg(base)
+		require.NoError(t, err)
+		assert.Equal(t, expected, sizes)
+	})
+
+	t.Run("no org extractor", func(t *testing.T) {
+		base := kv.NewStoreBase("foo", []byte("foo_size_org_none"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+
+		_, err := sizeByOrg(base)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
+
+func TestStoreBase_FindOrgPolicy(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	find := func(base *kv.StoreBase, opts kv.FindOpts) ([]interface{}, error) {
+		var actuals []interface{}
+		opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+			actuals = append(actuals, decodedVal)
+			return nil
+		}
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, opts)
+		})
+		return actuals, err
+	}
+
+	enabled := func(orgID influxdb.ID) bool {
+		return orgID != 9001
+	}
+
+	t.Run("org id func", func(t *testing.T) {
+		base := kv.NewStoreBase("foo", []byte("foo_org_policy_fn"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithOrgIDFn(fooOrgIDFn),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		ents := []kv.Entity{
+			newFooEnt(1, 9001, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+			newFooEnt(3, 9001, "foo_3"),
+			newFooEnt(4, 9000, "foo_4"),
+			newFooEnt(5, 9000, "foo_5"),
+		}
+		seedEnts(t, kvStore, base, ents...)
+
+		actuals, err := find(base, kv.FindOpts{OrgPolicyFn: enabled})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents[1], ents[3], ents[4]), actuals)
+
+		// the policy applies before the offset and limit
+		actuals, err = find(base, kv.FindOpts{OrgPolicyFn: enabled, Offset: 1, Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents[3]), actuals)
+
+		// both the policy and the filter must pass
+		actuals, err = find(base, kv.FindOpts{
+			OrgPolicyFn: enabled,
+			FilterEntFn: func(k []byte, v interface{}) bool {
+				return v.(foo).ID != 4
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents[1], ents[4]), actuals)
+	})
+
+	t.Run("org key prefix", func(t *testing.T) {
+		base := kv.NewStoreBase("foo", []byte("foo_org_policy_key"), kv.EncUniqKey, kv.EncIDKey, kv.DecIndexID,
+			func(k []byte, v interface{}) (kv.Entity, error) {
+				return kv.Entity{PK: kv.EncID(v.(influxdb.ID))}, nil
+			},
+			kv.WithOrgKeyPrefix(),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, base,
+			kv.Entity{PK: kv.EncID(1), UniqueKey: kv.Encode(kv.EncID(9000), kv.EncString("a"))},
+			kv.Entity{PK: kv.EncID(2), UniqueKey: kv.Encode(kv.EncID(9001), kv.EncString("b"))},
+		)
+
+		actuals, err := find(base, kv.FindOpts{OrgPolicyFn: enabled})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{influxdb.ID(1)}, actuals)
+	})
+
+	t.Run("requires an org extractor", func(t *testing.T) {
+		base := kv.NewStoreBase("foo", []byte("foo_org_policy_none"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{OrgPolicyFn: enabled})
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
+
+func TestStoreBase_ForEachOrg(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	type orgEnts struct {
+		OrgID influxdb.ID
+		Ents  []interface{}
+	}
+
+	forEachOrg := func(base *kv.StoreBase) ([]orgEnts, error) {
+		var groups []orgEnts
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.ForEachOrg(context.TODO(), tx, func(orgID influxdb.ID, ents []interface{}) error {
+				groups = append(groups, orgEnts{OrgID: orgID, Ents: ents})
+				return nil
+			})
+		})
+		return groups, err
+	}
+
+	forEachOrgEnt := func(base *kv.StoreBase) ([]orgEnts, error) {
+		var groups []orgEnts
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.ForEachOrgEnt(context.TODO(), tx, func(orgID influxdb.ID, decodedVal interface{}) error {
+				if len(groups) == 0 || groups[len(groups)-1].OrgID != orgID {
+					groups = append(groups, orgEnts{OrgID: orgID})
+				}
+				last := &groups[len(groups)-1]
+				last.Ents = append(last.Ents, decodedVal)
+				return nil
+			})
+		})
+		return groups, err
+	}
+
+	t.Run("org key prefix", func(t *testing.T) {
+		base := kv.NewStoreBase("foo", []byte("foo_each_org_key"), kv.EncUniqKey, kv.EncIDKey, kv.DecIndexID,
+			func(k []byte, v interface{}) (kv.Entity, error) {
+				return kv.Entity{PK: kv.EncID(v.(influxdb.ID))}, nil
+			},
+			kv.WithOrgKeyPrefix(),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, base,
+			kv.Entity{PK: kv.EncID(1), UniqueKey: kv.Encode(kv.EncID(9001), kv.EncString("a"))},
+			kv.Entity{PK: kv.EncID(2), UniqueKey: kv.Encode(kv.EncID(9000), kv.EncString("b"))},
+			kv.Entity{PK: kv.EncID(3), UniqueKey: kv.Encode(kv.EncID(9001), kv.EncString("c"))},
+		)
+
+		expected := []orgEnts{
+			{OrgID: 9000, Ents: []interface{}{influxdb.ID(2)}},
+			{OrgID: 9001, Ents: []interface{}{influxdb.ID(1), influxdb.ID(3)}},
+		}
+		for _, each := range []func(*kv.StoreBase) ([]orgEnts, error){forEachOrg, forEachOrgEnt} {
+			groups, err := each(base)
+			require.NoError(t, err)
+			assert.Equal(t, expected, groups)
+		}
+	})
+
+	t.Run("org id func", func(t *testing.T) {
+		base := kv.NewStoreBase("foo", []byte("foo_each_org_fn"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithOrgIDFn(fooOrgIDFn),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, base,
+			newFooEnt(1, 9001, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+			newFooEnt(3, 9001, "foo_3"),
+		)
+
+		expected := []orgEnts{
+			{OrgID: 9000, Ents: []interface{}{foo{ID: 2, OrgID: 9000, Name: "foo_2"}}},
+			{OrgID: 9001, Ents: []interface{}{foo{ID: 1, OrgID: 9001, Name: "foo_1"}, foo{ID: 3, OrgID: 9001, Name: "foo_3"}}},
+		}
+		for _, each := range []func(*kv.StoreBase) ([]orgEnts, error){forEachOrg, forEachOrgEnt} {
+			groups, err := each(base)
+			require.NoError(t, err)
+			assert.Equal(t, expected, groups)
+		}
+	})
+
+	t.Run("without an org extractor", func(t *testing.T) {
+		base := kv.NewStoreBase("foo", []byte("foo_each_org_none"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+
+		for _, each := range []func(*kv.StoreBase) ([]orgEnts, error){forEachOrg, forEachOrgEnt} {
+			_, err := each(base)
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+var (
+	outboxEventPrefix = []byte("e")
+	outboxSeqKey      = []byte("s")
+)
+
+// WithOutbox registers a transactional outbox for the store, held in the provided
+// bucket. Events appended by PutWithOutbox are durable if and only if the write
+// they accompany commits, and are handed to consumers by DrainOutbox.
+func WithOutbox(bktName []byte) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.outboxBktName = bktName
+	}
+}
+
+// PutWithOutbox puts the entity and appends the event to the store's outbox within
+// the same transaction. Each event is assigned the next value of a sequence that
+// increases monotonically over the life of the outbox, even as it is drained.
+func (s *StoreBase) PutWithOutbox(ctx context.Context, tx Tx, ent Entity, event []byte, opts ...PutOptionFn) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.Put(ctx, tx, ent, opts...); err != nil {
+		return err
+	}
+
+	b, err := s.outboxBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	var seq uint64
+	if v, err := b.Get(outboxSeqKey); err == nil {
+		seq = binary.BigEndian.Uint64(v)
+	} else if !IsNotFound(err) {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	seq++
+
+	seqVal := make([]byte, 8)
+	binary.BigEndian.PutUint64(seqVal, seq)
+	if err := b.Put(outboxSeqKey, seqVal); err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	if err := b.Put(outboxEventKey(seq), event); err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	return nil
+}
+
+// OutboxFn is provided each event drained from an outbox along with its sequence.
+type OutboxFn func(seq uint64, event []byte) error
+
+// DrainOutbox provides the events of the store's outbox to fn in the order they
+// were appended, deleting each event fn returns without error. Draining stops at
+// the first error, which is returned.
+//
+// Delivery is at least once. The deletes are only durable once the transaction
+// commits, so when fn publishes an event and the transaction then fails, for
+// instance because a later event errored, the event is delivered again by the next
+// drain. Consumers should deduplicate by sequence, which is never reused.
+func (s *StoreBase) DrainOutbox(ctx context.Context, tx Tx, fn OutboxFn) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	b, err := s.outboxBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	cur, err := b.Cursor()
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	// collect the events before deleting any of them from underneath the cursor
+	var events []Pair
+	for k, v := cur.Seek(outboxEventPrefix); k != nil && bytes.HasPrefix(k, outboxEventPrefix); k, v = cur.Next() {
+		events = append(events, Pair{Key: copyBytes(k), Value: copyBytes(v)})
+	}
+
+	for _, e := range events {
+		seq := binary.BigEndian.Uint64(e.Key[len(outboxEventPrefix):])
+		if err := fn(seq, e.Value); err != nil {
+			return err
+		}
+		if err := b.Delete(e.Key); err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
+
+func (s *StoreBase) initOutbox(ctx context.Context, tx Tx) error {
+	if s.outboxBktName == nil {
+		return nil
+	}
+	_, err := s.outboxBucket(ctx, tx)
+	return err
+}
+
+func (s *StoreBase) outboxBucket(ctx context.Context, tx Tx) (Bucket, error) {
+	span, _ := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	if s.outboxBktName == nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s store has no outbox; it must be created with WithOutbox", s.Resource),
+		}
+	}
+
+	b, err := tx.Bucket(s.outboxBktName)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s outbox bucket %q is missing; the store must be initialized with Init before use", s.Resource, string(s.outboxBktName)),
+			Err:  err,
+		}
+	}
+	return b, nil
+}
+
+// outboxEventKey encodes the sequence big endian so that the byte order of the
+// keys is the order the events were appended in.
+func outboxEventKey(seq uint64) []byte {
+	key := make([]byte, len(outboxEventPrefix)+8)
+	copy(key, outboxEventPrefix)
+	binary.BigEndian.PutUint64(key[len(outboxEventPrefix):], seq)
+	return key
+}
@@ -0,0 +1,116 @@
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_Outbox(t *testing.T) {
+	type event struct {
+		seq  uint64
+		data string
+	}
+
+	newStore := func(t *testing.T) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_outbox_ent"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithOutbox([]byte("foo_outbox")))
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	putWithEvent := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase, ent kv.Entity, data string) {
+		t.Helper()
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.PutWithOutbox(context.TODO(), tx, ent, []byte(data))
+		})
+	}
+
+	drain := func(kvStore kv.Store, base *kv.StoreBase, fn func(seq uint64, data string) error) ([]event, error) {
+		var drained []event
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.DrainOutbox(context.TODO(), tx, func(seq uint64, e []byte) error {
+				if err := fn(seq, string(e)); err != nil {
+					return err
+				}
+				drained = append(drained, event{seq: seq, data: string(e)})
+				return nil
+			})
+		})
+		return drained, err
+	}
+	accept := func(uint64, string) error { return nil }
+
+	t.Run("events are drained in order with increasing sequences", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		putWithEvent(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), "created 1")
+		putWithEvent(t, kvStore, base, newFooEnt(2, 9000, "foo_2"), "created 2")
+
+		drained, err := drain(kvStore, base, accept)
+		require.NoError(t, err)
+		assert.Equal(t, []event{{1, "created 1"}, {2, "created 2"}}, drained)
+
+		drained, err = drain(kvStore, base, accept)
+		require.NoError(t, err)
+		assert.Empty(t, drained)
+
+		// sequences are not reused once the outbox has been emptied
+		putWithEvent(t, kvStore, base, newFooEnt(1, 9000, "foo_1 renamed"), "updated 1")
+		drained, err = drain(kvStore, base, accept)
+		require.NoError(t, err)
+		assert.Equal(t, []event{{3, "updated 1"}}, drained)
+	})
+
+	t.Run("event is discarded along with a failed write", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		putWithEvent(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), "created 1")
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.PutWithOutbox(context.TODO(), tx, newFooEnt(1, 9000, "foo_1"), []byte("created again"), kv.PutNew())
+		})
+		require.Error(t, err)
+
+		drained, err := drain(kvStore, base, accept)
+		require.NoError(t, err)
+		assert.Equal(t, []event{{1, "created 1"}}, drained)
+	})
+
+	t.Run("failed drain redelivers its events", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		putWithEvent(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), "created 1")
+		putWithEvent(t, kvStore, base, newFooEnt(2, 9000, "foo_2"), "created 2")
+
+		var published []uint64
+		_, err := drain(kvStore, base, func(seq uint64, data string) error {
+			if seq == 2 {
+				return errors.New("publish failed")
+			}
+			published = append(published, seq)
+			return nil
+		})
+		require.Error(t, err)
+		assert.Equal(t, []uint64{1}, published)
+
+		drained, err := drain(kvStore, base, accept)
+		require.NoError(t, err)
+		assert.Equal(t, []event{{1, "created 1"}, {2, "created 2"}}, drained)
+	})
+}
@@ -0,0 +1,132 @@
+package kv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// PaginationParams are the pagination options of an HTTP list endpoint backed by a
+// StoreBase, decoded from the standard limit, offset, after and descending query
+// parameters. A page is positioned either by an Offset or by the opaque After
+// cursor of the previous page, which unlike an Offset is stable under concurrent
+// writes.
+type PaginationParams struct {
+	Limit      int
+	Offset     int
+	After      []byte
+	Descending bool
+}
+
+// PageEnvelope is the response body of a page of results. Next is the cursor of
+// the following page, passed back as the after query parameter, and is empty when
+// the page is the last. Total is the number of results across every page.
+type PageEnvelope struct {
+	Results []interface{} `json:"results"`
+	Next    string        `json:"next,omitempty"`
+	Total   int           `json:"total"`
+}
+
+// DecodeQuery sets the params from the query parameters. A missing limit defaults
+// to influxdb.DefaultPageSize, and a limit outside of 1 to influxdb.MaxPageSize, a
+// negative offset, a malformed after cursor, or an offset along with a cursor are
+// invalid.
+func (p *PaginationParams) DecodeQuery(qp url.Values) error {
+	params := PaginationParams{Limit: influxdb.DefaultPageSize}
+
+	if limit := qp.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  "limit is invalid",
+			}
+		}
+		if l < 1 || l > influxdb.MaxPageSize {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  fmt.Sprintf("limit must be between 1 and %d", influxdb.MaxPageSize),
+			}
+		}
+		params.Limit = l
+	}
+
+	if offset := qp.Get("offset"); offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  "offset is invalid",
+			}
+		}
+		if o < 0 {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  fmt.Sprintf("offset must not be negative; got %d", o),
+			}
+		}
+		params.Offset = o
+	}
+
+	if after := qp.Get("after"); after != "" {
+		key, err := base64.RawURLEncoding.DecodeString(after)
+		if err != nil || len(key) == 0 {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  "after cursor is invalid",
+			}
+		}
+		if params.Offset > 0 {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  "a page may be positioned by an offset or an after cursor, not both",
+			}
+		}
+		params.After = key
+	}
+
+	if descending := qp.Get("descending"); descending != "" {
+		desc, err := strconv.ParseBool(descending)
+		if err != nil {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  "descending is invalid",
+			}
+		}
+		params.Descending = desc
+	}
+
+	*p = params
+	return nil
+}
+
+// FindOpts returns the options of a Find for the page. Callers add their own
+// prefix, filter and capture functions.
+func (p PaginationParams) FindOpts() FindOpts {
+	return FindOpts{
+		Limit:      p.Limit,
+		Offset:     p.Offset,
+		After:      p.After,
+		Descending: p.Descending,
+	}
+}
+
+// Envelope returns the response body of the page of pairs found with the params'
+// FindOpts, of total results in all. A full page has a Next cursor of the key of
+// its last pair, so the page after the last full one is empty.
+func (p PaginationParams) Envelope(pairs []KV, total int) PageEnvelope {
+	env := PageEnvelope{
+		Results: make([]interface{}, 0, len(pairs)),
+		Total:   total,
+	}
+	for _, pair := range pairs {
+		env.Results = append(env.Results, pair.Val)
+	}
+	if len(pairs) > 0 && len(pairs) >= p.Limit {
+		env.Next = base64.RawURLEncoding.EncodeToString(pairs[len(pairs)-1].Key)
+	}
+	return env
+}
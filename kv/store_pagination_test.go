@@ -0,0 +1,139 @@
+package kv_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginationParams_DecodeQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected kv.PaginationParams
+		wantErr  bool
+	}{
+		{
+			name:     "defaults",
+			expected: kv.PaginationParams{Limit: influxdb.DefaultPageSize},
+		},
+		{
+			name:     "offset page",
+			query:    "limit=5&offset=10&descending=true",
+			expected: kv.PaginationParams{Limit: 5, Offset: 10, Descending: true},
+		},
+		{
+			name:     "after cursor",
+			query:    "limit=5&after=Zm9vXzE",
+			expected: kv.PaginationParams{Limit: 5, After: []byte("foo_1")},
+		},
+		{name: "limit not a number", query: "limit=ten", wantErr: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit over the maximum", query: "limit=101", wantErr: true},
+		{name: "negative offset", query: "offset=-1", wantErr: true},
+		{name: "malformed cursor", query: "after=%21%21", wantErr: true},
+		{name: "offset with a cursor", query: "offset=1&after=Zm9vXzE", wantErr: true},
+		{name: "descending not a bool", query: "descending=sure", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qp, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			var params kv.PaginationParams
+			err = params.DecodeQuery(qp)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, params)
+		})
+	}
+}
+
+func TestPaginationParams_Envelope(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("foo", []byte("foo_paginated"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	ents := []kv.Entity{
+		newFooEnt(1, 9000, "foo_1"),
+		newFooEnt(2, 9000, "foo_2"),
+		newFooEnt(3, 9000, "foo_3"),
+		newFooEnt(4, 9000, "foo_4"),
+		newFooEnt(5, 9000, "foo_5"),
+	}
+	seedEnts(t, kvStore, base, ents...)
+
+	page := func(t *testing.T, query url.Values) kv.PageEnvelope {
+		t.Helper()
+
+		var params kv.PaginationParams
+		require.NoError(t, params.DecodeQuery(query))
+
+		var env kv.PageEnvelope
+		view(t, kvStore, func(tx kv.Tx) error {
+			pairs, err := base.FindPairs(context.TODO(), tx, params.FindOpts())
+			if err != nil {
+				return err
+			}
+			total, err := base.CountByPrefix(context.TODO(), tx, nil)
+			if err != nil {
+				return err
+			}
+			env = params.Envelope(pairs, total)
+			return nil
+		})
+		return env
+	}
+
+	t.Run("follows the next cursor to the last page", func(t *testing.T) {
+		var (
+			results []interface{}
+			pages   int
+		)
+		query := url.Values{"limit": {"2"}}
+		for {
+			env := page(t, query)
+			assert.Equal(t, len(ents), env.Total)
+			results = append(results, env.Results...)
+			pages++
+			if env.Next == "" {
+				break
+			}
+			query.Set("after", env.Next)
+		}
+		assert.Equal(t, 3, pages)
+		assert.Equal(t, toIfaces(ents...), results)
+	})
+
+	t.Run("descending", func(t *testing.T) {
+		env := page(t, url.Values{"limit": {"3"}, "descending": {"true"}})
+		assert.Equal(t, toIfaces(ents[4], ents[3], ents[2]), env.Results)
+		require.NotEmpty(t, env.Next)
+
+		env = page(t, url.Values{"limit": {"3"}, "descending": {"true"}, "after": {env.Next}})
+		assert.Equal(t, toIfaces(ents[1], ents[0]), env.Results)
+		assert.Empty(t, env.Next)
+	})
+
+	t.Run("empty page", func(t *testing.T) {
+		env := page(t, url.Values{"offset": {"10"}})
+		assert.Equal(t, []interface{}{}, env.Results)
+		assert.Empty(t, env.Next)
+		assert.Equal(t, len(ents), env.Total)
+	})
+}
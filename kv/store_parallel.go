@@ -0,0 +1,121 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// FindEntMapParallel is FindEntMap with the decoding of the found values spread
+// across up to workers goroutines, for hydrating large sets of entities whose decode
+// is expensive. A non positive workers decodes on the calling goroutine alone.
+//
+// Transactions are not safe for concurrent use, as with bolt's, so only the calling
+// goroutine touches the transaction: it reads every value with a single GetBatch
+// before any worker starts. The workers only decode the bytes read, which remain
+// valid until the transaction ends, and the call returns once they are all done.
+// The store's decode func, and any read transform, must be safe for concurrent use.
+func (s *StoreBase) FindEntMapParallel(ctx context.Context, tx Tx, workers int, ids ...influxdb.ID) (map[influxdb.ID]interface{}, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	ents := make(map[influxdb.ID]interface{}, len(ids))
+	if len(ids) == 0 {
+		return ents, nil
+	}
+
+	keys := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		key, err := s.EntKey(ctx, Entity{PK: EncID(id)})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return ents, nil
+		}
+		return nil, err
+	}
+
+	vals, err := b.GetBatch(keys...)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Err:  err,
+		}
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(vals) {
+		workers = len(vals)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		decFn   = s.decodeFn()
+		decoded = make([]interface{}, len(vals))
+		errOnce sync.Once
+		decErr  error
+		wg      sync.WaitGroup
+		idxs    = make(chan int)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxs {
+				_, v, err := decFn(keys[i], vals[i])
+				if err != nil {
+					errOnce.Do(func() {
+						decErr = &influxdb.Error{
+							Code: influxdb.EInternal,
+							Msg:  fmt.Sprintf("failed to decode %s body", s.Resource),
+							Err:  err,
+						}
+						cancel()
+					})
+					continue
+				}
+				decoded[i] = v
+			}
+		}()
+	}
+
+send:
+	for i, val := range vals {
+		if val == nil {
+			continue
+		}
+		select {
+		case idxs <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(idxs)
+	wg.Wait()
+
+	if decErr != nil {
+		return nil, decErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, v := range decoded {
+		if vals[i] != nil {
+			ents[ids[i]] = v
+		}
+	}
+	return ents, nil
+}
@@ -0,0 +1,82 @@
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_FindEntMapParallel(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	var decodes int32
+	failID := influxdb.ID(0)
+	base := kv.NewStoreBase("foo", []byte("foo_parallel"), kv.EncIDKey, kv.EncBodyJSON,
+		func(key, val []byte) ([]byte, interface{}, error) {
+			atomic.AddInt32(&decodes, 1)
+			k, v, err := decJSONFooFn(key, val)
+			if err == nil && v.(foo).ID == failID {
+				return nil, nil, errors.New("corrupt")
+			}
+			return k, v, err
+		},
+		decFooEntFn,
+	)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	var (
+		ents []kv.Entity
+		ids  []influxdb.ID
+	)
+	for i := 1; i <= 50; i++ {
+		ents = append(ents, newFooEnt(influxdb.ID(i), 9000, "foo"))
+		ids = append(ids, influxdb.ID(i))
+	}
+	seedEnts(t, kvStore, base, ents...)
+
+	find := func(workers int, ids ...influxdb.ID) (map[influxdb.ID]interface{}, error) {
+		var m map[influxdb.ID]interface{}
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			var err error
+			m, err = base.FindEntMapParallel(context.TODO(), tx, workers, ids...)
+			return err
+		})
+		return m, err
+	}
+
+	t.Run("matches FindEntMap", func(t *testing.T) {
+		var expected map[influxdb.ID]interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			expected, err = base.FindEntMap(context.TODO(), tx, append(ids, 99)...)
+			return err
+		})
+
+		for _, workers := range []int{0, 1, 4, 100} {
+			atomic.StoreInt32(&decodes, 0)
+			actual, err := find(workers, append(ids, 99)...)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+			assert.Equal(t, int32(len(ids)), atomic.LoadInt32(&decodes))
+		}
+	})
+
+	t.Run("decode error", func(t *testing.T) {
+		failID = 25
+		defer func() { failID = 0 }()
+
+		_, err := find(4, ids...)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+	})
+}
@@ -0,0 +1,162 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// ProjectFn maps an entity to the compact projection of it stored in the store's
+// projection bucket, i.e. just the fields a list view displays.
+type ProjectFn func(ent Entity) ([]byte, error)
+
+// projection is a materialized view of the store, holding the projection of each
+// entity keyed by the key of the entity it belongs to.
+type projection struct {
+	bktName   []byte
+	projectFn ProjectFn
+	decodeFn  DecodeBucketValFn
+}
+
+// WithProjection registers a projection of the store, materialized in the bucket
+// with bktName. Every Put writes the projection fn returns for the entity within
+// the same transaction, and deleting an entity deletes its projection, so the
+// projection bucket is kept consistent with the primary. FindProjection scans the
+// projections, decoding them with decodeFn, which for list views is far cheaper
+// than decoding full bodies. Init creates the projection bucket along with the
+// store's own. When the projection fn changes, the projections of the entities
+// stored before are stale until ReindexAll rebuilds them.
+func WithProjection(bktName []byte, fn ProjectFn, decodeFn DecodeBucketValFn) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.projection = &projection{bktName: bktName, projectFn: fn, decodeFn: decodeFn}
+	}
+}
+
+// FindProjection runs a Find over the projections of the store rather than its
+// entities. The options are as for Find, except that their filter and capture
+// functions are provided the projections as decoded by the projection's decoder,
+// and that an OrgPolicyFn requires a store with WithOrgKeyPrefix. The projections
+// of a namespaced store are confined to its namespace. FindProjection requires
+// WithProjection.
+func (s *StoreBase) FindProjection(ctx context.Context, tx Tx, opts FindOpts) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.checkTx(tx); err != nil {
+		return err
+	}
+	if s.projection == nil {
+		return &influxdb.Error{
+			Code: influxdb.EMethodNotAllowed,
+			Msg:  fmt.Sprintf("%s store has no projection", s.Resource),
+		}
+	}
+	if opts.OrgPolicyFn != nil && !s.orgKeyPrefix {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("find %s projections with an org policy requires a store with org prefixed keys", s.Resource),
+		}
+	}
+	if err := s.validateFindOpts(opts); err != nil {
+		return err
+	}
+	if err := s.throttle(ctx); err != nil {
+		return err
+	}
+
+	b, err := s.projectionBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+	cur, err := b.Cursor()
+	if err != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to retrieve cursor for %s projections", s.Resource),
+			Err:  err,
+		}
+	}
+	if s.namespace != nil {
+		cur = &namespaceCursor{Cursor: cur, ns: s.namespace}
+	}
+	return s.findCursorDec(ctx, cur, opts, s.projection.decodeFn, nil)
+}
+
+func (s *StoreBase) projectionBucket(ctx context.Context, tx Tx) (Bucket, error) {
+	span, _ := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	b, err := tx.Bucket(s.projection.bktName)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s projection bucket %q is missing; the store must be initialized with Init before use", s.Resource, string(s.projection.bktName)),
+			Err:  err,
+		}
+	}
+	return b, nil
+}
+
+func (s *StoreBase) initProjection(ctx context.Context, tx Tx) error {
+	if s.projection == nil {
+		return nil
+	}
+	_, err := s.projectionBucket(ctx, tx)
+	return err
+}
+
+// putProjection writes the projection of the entity stored under key.
+func (s *StoreBase) putProjection(ctx context.Context, tx Tx, key []byte, ent Entity) error {
+	if s.projection == nil {
+		return nil
+	}
+
+	val, err := s.projection.projectFn(ent)
+	if err != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("failed to project %s", s.Resource),
+			Err:  err,
+		}
+	}
+
+	b, err := s.projectionBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(copyBytes(key), val); err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	return nil
+}
+
+// deleteProjection removes the projection of the entity stored under key.
+func (s *StoreBase) deleteProjection(ctx context.Context, tx Tx, key []byte) error {
+	if s.projection == nil {
+		return nil
+	}
+
+	b, err := s.projectionBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := b.Delete(key); err != nil && !IsNotFound(err) {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	return nil
+}
+
+// clearProjection removes every projection, ahead of their rebuild.
+func (s *StoreBase) clearProjection(ctx context.Context, tx Tx) error {
+	if s.projection == nil {
+		return nil
+	}
+
+	b, err := s.projectionBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return clearBucket(b, nil, nil)
+}
@@ -0,0 +1,172 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_WithProjection(t *testing.T) {
+	bktName, projBktName := []byte("foo_projected"), []byte("foo_projected_names")
+
+	nameProjectFn := func(ent kv.Entity) ([]byte, error) {
+		return []byte(ent.Body.(foo).Name), nil
+	}
+	decNameFn := func(key, val []byte) ([]byte, interface{}, error) {
+		return key, string(val), nil
+	}
+
+	newStore := func(t *testing.T, kvStore kv.Store, fn kv.ProjectFn) *kv.StoreBase {
+		t.Helper()
+
+		base := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithProjection(projBktName, fn, decNameFn),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base
+	}
+
+	findProjection := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase, opts kv.FindOpts) []interface{} {
+		t.Helper()
+
+		var names []interface{}
+		opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+			names = append(names, decodedVal)
+			return nil
+		}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.FindProjection(context.TODO(), tx, opts)
+		})
+		return names
+	}
+
+	t.Run("is kept consistent with the primary", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := newStore(t, kvStore, nameProjectFn)
+		seedEnts(t, kvStore, base,
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+			newFooEnt(3, 9000, "foo_3"),
+		)
+		assert.Equal(t, []interface{}{"foo_1", "foo_2", "foo_3"}, findProjection(t, kvStore, base, kv.FindOpts{}))
+
+		seedEnts(t, kvStore, base, newFooEnt(2, 9000, "foo_2_renamed"))
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.DeleteEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+		})
+		assert.Equal(t, []interface{}{"foo_2_renamed", "foo_3"}, findProjection(t, kvStore, base, kv.FindOpts{}))
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Delete(context.TODO(), tx, kv.DeleteOpts{
+				FilterFn: func(k []byte, v interface{}) bool { return v.(foo).ID == 3 },
+			})
+		})
+		assert.Equal(t, []interface{}{"foo_2_renamed"}, findProjection(t, kvStore, base, kv.FindOpts{}))
+	})
+
+	t.Run("applies the find options", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := newStore(t, kvStore, nameProjectFn)
+		seedEnts(t, kvStore, base,
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+			newFooEnt(3, 9000, "foo_3"),
+		)
+
+		names := findProjection(t, kvStore, base, kv.FindOpts{Descending: true, Limit: 2})
+		assert.Equal(t, []interface{}{"foo_3", "foo_2"}, names)
+
+		names = findProjection(t, kvStore, base, kv.FindOpts{
+			FilterEntFn: func(key []byte, decodedVal interface{}) bool { return decodedVal != "foo_2" },
+		})
+		assert.Equal(t, []interface{}{"foo_1", "foo_3"}, names)
+	})
+
+	t.Run("rolls back with the primary", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := newStore(t, kvStore, nameProjectFn)
+		err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			if err := base.Put(context.TODO(), tx, newFooEnt(1, 9000, "foo_1")); err != nil {
+				return err
+			}
+			return &influxdb.Error{Code: influxdb.EInternal, Msg: "rollback"}
+		})
+		require.Error(t, err)
+		assert.Empty(t, findProjection(t, kvStore, base, kv.FindOpts{}))
+	})
+
+	t.Run("is rebuilt by ReindexAll", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := newStore(t, kvStore, nameProjectFn)
+		seedEnts(t, kvStore, base,
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+		)
+
+		orgProjectFn := func(ent kv.Entity) ([]byte, error) {
+			return []byte(ent.Body.(foo).OrgID.String()), nil
+		}
+		changed := newStore(t, kvStore, orgProjectFn)
+		assert.Equal(t, []interface{}{"foo_1", "foo_2"}, findProjection(t, kvStore, changed, kv.FindOpts{}))
+
+		var n int
+		update(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			n, err = changed.ReindexAll(context.TODO(), tx)
+			return err
+		})
+		assert.Equal(t, 2, n)
+
+		org := influxdb.ID(9000).String()
+		assert.Equal(t, []interface{}{org, org}, findProjection(t, kvStore, changed, kv.FindOpts{}))
+	})
+
+	t.Run("requires a projection", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		err = kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.FindProjection(context.TODO(), tx, kv.FindOpts{})
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EMethodNotAllowed, influxdb.ErrorCode(err))
+	})
+
+	t.Run("fails the put when the projection fails", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := newStore(t, kvStore, func(ent kv.Entity) ([]byte, error) {
+			return nil, &influxdb.Error{Code: influxdb.EInternal, Msg: "no projection"}
+		})
+		err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, newFooEnt(1, 9000, "foo_1"))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
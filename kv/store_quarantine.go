@@ -0,0 +1,171 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// DecodeErrorPolicy decides what a Find does with a value that fails to decode.
+type DecodeErrorPolicy int
+
+const (
+	// DecodeErrorFail fails the Find with the decode error. It is the default.
+	DecodeErrorFail DecodeErrorPolicy = iota
+	// DecodeErrorSkip skips the value as though it did not exist, quarantining it
+	// when the store has a quarantine.
+	DecodeErrorSkip
+)
+
+// WithQuarantine registers a quarantine bucket for the values a Find with the
+// DecodeErrorSkip policy fails to decode. Each such value is copied, raw key and
+// value as stored, to the bucket, where operators inspect it with ListQuarantine
+// and return it to the store with Requeue once its decoder is fixed. When remove is
+// true the value is also deleted from the store, so later Finds no longer trip over
+// it. It is deleted as DeleteEnt would, along with its index entries, projection,
+// sequence entries and sidecar data, though the index entries cannot be derived
+// without decoding it and are instead found by scanning the indexes.
+//
+// Quarantining writes, so values are only quarantined by Finds run within an update
+// transaction. A Find within a read transaction skips them all the same, leaving
+// them to be quarantined by the next Find that can.
+func WithQuarantine(bktName []byte, remove bool) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.quarantineBktName = bktName
+		s.quarantineRemove = remove
+	}
+}
+
+// ListQuarantine returns the raw pairs held in the store's quarantine, in key order.
+func (s *StoreBase) ListQuarantine(ctx context.Context, tx Tx) ([]Pair, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	b, err := s.quarantineBucket(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := b.Cursor()
+	if err != nil {
+		return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	var pairs []Pair
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		pairs = append(pairs, Pair{Key: copyBytes(k), Value: copyBytes(v)})
+	}
+	return pairs, nil
+}
+
+// Requeue returns the quarantined value for the key to the store, removing it from
+// the quarantine. The value is decoded and put as any other entity, so its indexes
+// and hooks are maintained. A value that still fails to decode is invalid and stays
+// quarantined, while a key absent from the quarantine is not found.
+func (s *StoreBase) Requeue(ctx context.Context, tx Tx, key []byte) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	b, err := s.quarantineBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+	raw, err := b.Get(key)
+	if IsNotFound(err) {
+		return &influxdb.Error{
+			Code: influxdb.ENotFound,
+			Msg:  fmt.Sprintf("no %s is quarantined for key %q", s.Resource, string(key)),
+		}
+	}
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	_, decodedVal, err := s.decodeFn()(key, raw)
+	if err != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("quarantined %s for key %q still fails to decode", s.Resource, string(key)),
+			Err:  err,
+		}
+	}
+	ent, err := s.ConvertValToEntFn(key, decodedVal)
+	if err != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("failed to convert quarantined %s for key %q", s.Resource, string(key)),
+			Err:  err,
+		}
+	}
+	if ent.Body == nil {
+		ent.Body = decodedVal
+	}
+
+	if err := s.put(ctx, tx, key, ent); err != nil {
+		return err
+	}
+	if err := b.Delete(key); err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	return nil
+}
+
+// quarantine copies the pairs that failed to decode to the store's quarantine,
+// deleting them from the store's bucket when configured to. Within a read
+// transaction nothing can be written, and the pairs are left for a later Find.
+func (s *StoreBase) quarantine(ctx context.Context, tx Tx, pairs []Pair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	b, err := s.quarantineBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		err := b.Put(p.Key, p.Value)
+		if err == ErrTxNotWritable {
+			return nil
+		}
+		if err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+		if s.quarantineRemove {
+			if err := s.deleteUndecodable(ctx, tx, p.Key); err != nil && influxdb.ErrorCode(err) != influxdb.ENotFound {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *StoreBase) initQuarantine(ctx context.Context, tx Tx) error {
+	if s.quarantineBktName == nil {
+		return nil
+	}
+	_, err := s.quarantineBucket(ctx, tx)
+	return err
+}
+
+func (s *StoreBase) quarantineBucket(ctx context.Context, tx Tx) (Bucket, error) {
+	span, _ := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	if s.quarantineBktName == nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EMethodNotAllowed,
+			Msg:  fmt.Sprintf("%s store has no quarantine; it must be created with WithQuarantine", s.Resource),
+		}
+	}
+
+	b, err := tx.Bucket(s.quarantineBktName)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s quarantine bucket %q is missing; the store must be initialized with Init before use", s.Resource, string(s.quarantineBktName)),
+			Err:  err,
+		}
+	}
+	return b, nil
+}
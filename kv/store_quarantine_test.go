@@ -0,0 +1,135 @@
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_Quarantine(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	// the decoder rejects foos named poison until it is fixed
+	fixed := false
+	decFn := func(key, val []byte) ([]byte, interface{}, error) {
+		k, v, err := decJSONFooFn(key, val)
+		if err == nil && v.(foo).Name == "poison" && !fixed {
+			return nil, nil, errors.New("poison")
+		}
+		return k, v, err
+	}
+
+	base := kv.NewStoreBase("foo", []byte("foo_quarantine"), kv.EncIDKey, kv.EncBodyJSON, decFn, decFooEntFn,
+		kv.WithQuarantine([]byte("foo_quarantine_poison"), true),
+		kv.WithNameFoldIndex([]byte("foo_quarantine_name"), fooNameFn, false),
+		kv.WithSidecar("notes", []byte("foo_quarantine_notes")),
+	)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	fixed = true
+	seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "poison"), newFooEnt(3, 9000, "foo_3"))
+	fixed = false
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.PutSidecar(context.TODO(), tx, 2, "notes", []byte("note_2"))
+	})
+
+	findAll := func(tx kv.Tx, policy kv.DecodeErrorPolicy) ([]interface{}, error) {
+		var vals []interface{}
+		err := base.Find(context.TODO(), tx, kv.FindOpts{
+			OnDecodeError: policy,
+			CaptureFn: func(key []byte, decodedVal interface{}) error {
+				vals = append(vals, decodedVal)
+				return nil
+			},
+		})
+		return vals, err
+	}
+
+	expected := []interface{}{
+		foo{ID: 1, OrgID: 9000, Name: "foo_1"},
+		foo{ID: 3, OrgID: 9000, Name: "foo_3"},
+	}
+
+	view(t, kvStore, func(tx kv.Tx) error {
+		_, err := findAll(tx, kv.DecodeErrorFail)
+		require.Error(t, err)
+
+		// skipped but not quarantined within a read transaction
+		vals, err := findAll(tx, kv.DecodeErrorSkip)
+		require.NoError(t, err)
+		assert.Equal(t, expected, vals)
+
+		pairs, err := base.ListQuarantine(context.TODO(), tx)
+		require.NoError(t, err)
+		assert.Empty(t, pairs)
+		return nil
+	})
+
+	update(t, kvStore, func(tx kv.Tx) error {
+		vals, err := findAll(tx, kv.DecodeErrorSkip)
+		require.NoError(t, err)
+		assert.Equal(t, expected, vals)
+		return nil
+	})
+
+	poisonKey := encodeID(t, 2)
+	view(t, kvStore, func(tx kv.Tx) error {
+		vals, err := findAll(tx, kv.DecodeErrorFail)
+		require.NoError(t, err)
+		assert.Equal(t, expected, vals)
+
+		pairs, err := base.ListQuarantine(context.TODO(), tx)
+		require.NoError(t, err)
+		require.Len(t, pairs, 1)
+		assert.Equal(t, poisonKey, pairs[0].Key)
+
+		// removed along with its index entries and sidecar data
+		var pks [][]byte
+		err = base.IterIndex(context.TODO(), tx, kv.NameFoldIndexName, func(_, pk []byte) error {
+			pks = append(pks, pk)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{encodeID(t, 1), encodeID(t, 3)}, pks)
+
+		_, err = base.GetSidecar(context.TODO(), tx, 2, "notes")
+		isNotFoundErr(t, err)
+		return nil
+	})
+
+	err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+		return base.Requeue(context.TODO(), tx, poisonKey)
+	})
+	require.Error(t, err)
+	assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+
+	fixed = true
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Requeue(context.TODO(), tx, poisonKey)
+	})
+
+	view(t, kvStore, func(tx kv.Tx) error {
+		v, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(2)})
+		require.NoError(t, err)
+		assert.Equal(t, foo{ID: 2, OrgID: 9000, Name: "poison"}, v)
+
+		pairs, err := base.ListQuarantine(context.TODO(), tx)
+		require.NoError(t, err)
+		assert.Empty(t, pairs)
+		return nil
+	})
+
+	err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+		return base.Requeue(context.TODO(), tx, poisonKey)
+	})
+	isNotFoundErr(t, err)
+}
@@ -0,0 +1,68 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// RateLimiter gates the operations of a store. It is satisfied by *rate.Limiter
+// from golang.org/x/time/rate.
+type RateLimiter interface {
+	// Allow reports whether an operation may proceed now.
+	Allow() bool
+	// Wait blocks until an operation may proceed or the context is done.
+	Wait(ctx context.Context) error
+}
+
+// RateLimitPolicy determines how a throttled store operation behaves.
+type RateLimitPolicy int
+
+const (
+	// RateLimitReject fails a throttled operation with a too many requests error.
+	RateLimitReject RateLimitPolicy = iota
+	// RateLimitWait blocks a throttled operation until the limiter admits it or
+	// its context is done. The operation waits within the transaction it was
+	// provided, and an update transaction holds the store's write lock for as long
+	// as it waits, stalling every other writer. It must therefore not be used with
+	// stores operated on within Update; use RateLimitReject for those and retry
+	// the rejected transaction once the limiter admits it.
+	RateLimitWait
+)
+
+// WithRateLimiter gates Put, Delete, DeleteEnt, and Find operations on the store
+// through the limiter, each consuming one token. Throttled operations are rejected
+// or wait according to the policy. Operations issued internally by another gated
+// operation, such as the Find backing a Delete, do not consume further tokens.
+func WithRateLimiter(limiter RateLimiter, policy RateLimitPolicy) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.limiter = limiter
+		s.limitPolicy = policy
+	}
+}
+
+func (s *StoreBase) throttle(ctx context.Context) error {
+	if s.limiter == nil {
+		return nil
+	}
+
+	if s.limitPolicy == RateLimitWait {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return &influxdb.Error{
+				Code: influxdb.ETooManyRequests,
+				Msg:  fmt.Sprintf("%s store operation throttled", s.Resource),
+				Err:  err,
+			}
+		}
+		return nil
+	}
+
+	if !s.limiter.Allow() {
+		return &influxdb.Error{
+			Code: influxdb.ETooManyRequests,
+			Msg:  fmt.Sprintf("%s store operation throttled", s.Resource),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLimiter struct {
+	tokens int
+	waits  int
+}
+
+func (l *fakeLimiter) Allow() bool {
+	if l.tokens == 0 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func (l *fakeLimiter) Wait(ctx context.Context) error {
+	l.waits++
+	if l.tokens == 0 {
+		return errors.New("limiter exhausted")
+	}
+	l.tokens--
+	return nil
+}
+
+func TestStoreBase_RateLimiter(t *testing.T) {
+	newStore := func(t *testing.T, limiter kv.RateLimiter, policy kv.RateLimitPolicy) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_rate_limit"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithRateLimiter(limiter, policy))
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	find := func(kvStore kv.Store, base *kv.StoreBase) error {
+		return kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error { return nil },
+			})
+		})
+	}
+
+	t.Run("rejects once the limiter is exhausted", func(t *testing.T) {
+		limiter := &fakeLimiter{tokens: 3}
+		base, kvStore, done := newStore(t, limiter, kv.RateLimitReject)
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"))
+
+		// a delete consumes a single token despite finding via the store
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Delete(context.TODO(), tx, kv.DeleteOpts{
+				FilterFn: func(key []byte, decodedVal interface{}) bool { return true },
+			})
+		})
+		require.NoError(t, find(kvStore, base))
+
+		err := find(kvStore, base)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.ETooManyRequests, influxdb.ErrorCode(err))
+
+		err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, newFooEnt(2, 9000, "foo_2"))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.ETooManyRequests, influxdb.ErrorCode(err))
+
+		err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.PutRaw(context.TODO(), tx, encodeID(t, 2), newFooEnt(2, 9000, "foo_2"))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.ETooManyRequests, influxdb.ErrorCode(err))
+		assert.Zero(t, limiter.waits)
+	})
+
+	t.Run("waits on the limiter", func(t *testing.T) {
+		limiter := &fakeLimiter{tokens: 1}
+		base, kvStore, done := newStore(t, limiter, kv.RateLimitWait)
+		defer done()
+
+		require.NoError(t, find(kvStore, base))
+
+		err := find(kvStore, base)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.ETooManyRequests, influxdb.ErrorCode(err))
+		assert.Equal(t, 2, limiter.waits)
+	})
+}
@@ -0,0 +1,121 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// FindRawJSON writes the stored values of the results of a Find to w as a single
+// JSON array, relaying each value as stored rather than decoding and re-encoding
+// it. It serves endpoints that pass stored bodies through unchanged.
+//
+// The store must be built with WithJSONBodies and must not have a read transform,
+// which could only be applied to decoded values. Options acting on decoded values,
+// the FilterEntFn, DedupeKeyFn, OrgPolicyFn, and capture functions, are rejected as
+// invalid; the remaining options apply. The array is streamed as results are found,
+// so w holds a partial array should the Find fail.
+func (s *StoreBase) FindRawJSON(ctx context.Context, tx Tx, w io.Writer, opts FindOpts) (err error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	var rows int
+	defer func(start time.Time) { s.observe(metricsOpFind, "FindRawJSON", start, rows, err) }(time.Now())
+
+	if err := s.validateRawJSON(opts); err != nil {
+		return err
+	}
+	if err := s.validateFindOpts(opts); err != nil {
+		return err
+	}
+	if err := s.throttle(ctx); err != nil {
+		return err
+	}
+
+	write := func(b []byte) error {
+		if _, err := w.Write(b); err != nil {
+			return &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to write %s JSON", s.Resource),
+				Err:  err,
+			}
+		}
+		return nil
+	}
+
+	if err := write([]byte("[")); err != nil {
+		return err
+	}
+
+	opts.IndexedCaptureFn = func(idx int, key []byte, decodedVal interface{}) error {
+		if idx > 0 {
+			if err := write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		rows++
+		return write(decodedVal.(json.RawMessage))
+	}
+
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		if !s.isMissingBucket(err) {
+			return err
+		}
+		if err := s.findEmpty(opts); err != nil {
+			return err
+		}
+	} else if err := s.findCursorDec(ctx, cur, opts, s.rawJSONDecodeFn(), nil); err != nil {
+		return err
+	}
+
+	return write([]byte("]"))
+}
+
+func (s *StoreBase) validateRawJSON(opts FindOpts) error {
+	if !s.encodesJSON() || s.readTransform != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s store does not store its bodies as JSON that can be relayed as is", s.Resource),
+		}
+	}
+	if opts.FilterEntFn != nil || opts.DedupeKeyFn != nil || opts.OrgPolicyFn != nil ||
+		opts.CaptureFn != nil || opts.IndexedCaptureFn != nil || opts.BatchCaptureFn != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("find %s raw JSON does not decode values and cannot apply filter, dedupe, org policy, or capture functions", s.Resource),
+		}
+	}
+	return nil
+}
+
+// WithJSONBodies declares that the store's body encoder writes JSON, as EncBodyJSON
+// and EncBodyJSONWith do. FindRawJSON and IncrField operate on the stored bodies
+// directly, and require it. The store does not check the declaration, so a store
+// whose bodies are not JSON must not make it.
+func WithJSONBodies() StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.jsonBodies = true
+	}
+}
+
+// encodesJSON reports whether the store declares its bodies to be JSON.
+func (s *StoreBase) encodesJSON() bool {
+	return s.jsonBodies
+}
+
+// rawJSONDecodeFn returns the stored body of each value, with its frame removed,
+// in place of its decoded value.
+func (s *StoreBase) rawJSONDecodeFn() DecodeBucketValFn {
+	return func(key, val []byte) ([]byte, interface{}, error) {
+		f, err := s.unframe(val)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, json.RawMessage(f.body), nil
+	}
+}
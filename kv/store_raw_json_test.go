@@ -0,0 +1,104 @@
+package kv_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_FindRawJSON(t *testing.T) {
+	newStore := func(t *testing.T, encBodyFn kv.EncodeEntFn, opts ...kv.StoreBaseOptFn) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		opts = append([]kv.StoreBaseOptFn{kv.WithJSONBodies()}, opts...)
+		base := kv.NewStoreBase("foo", []byte("foo_raw_json"), kv.EncIDKey, encBodyFn, decJSONFooFn, decFooEntFn, opts...)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	findRaw := func(kvStore kv.Store, base *kv.StoreBase, opts kv.FindOpts) (string, error) {
+		var buf bytes.Buffer
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.FindRawJSON(context.TODO(), tx, &buf, opts)
+		})
+		return buf.String(), err
+	}
+
+	foo1 := `{"ID":"0000000000000001","OrgID":"0000000000002328","Name":"foo_1"}`
+	foo2 := `{"ID":"0000000000000002","OrgID":"0000000000002329","Name":"foo_2"}`
+
+	t.Run("relays stored bodies as an array", func(t *testing.T) {
+		base, kvStore, done := newStore(t, kv.EncBodyJSON)
+		defer done()
+
+		out, err := findRaw(kvStore, base, kv.FindOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "[]", out)
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9001, "foo_2"))
+
+		out, err = findRaw(kvStore, base, kv.FindOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "["+foo1+","+foo2+"]", out)
+
+		var decoded []foo
+		require.NoError(t, json.Unmarshal([]byte(out), &decoded))
+		assert.Equal(t, []foo{{ID: 1, OrgID: 9000, Name: "foo_1"}, {ID: 2, OrgID: 9001, Name: "foo_2"}}, decoded)
+
+		out, err = findRaw(kvStore, base, kv.FindOpts{Descending: true, Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, "["+foo2+"]", out)
+	})
+
+	t.Run("strips frames", func(t *testing.T) {
+		timeGen := &stepTimeGenerator{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		base, kvStore, done := newStore(t, kv.EncBodyJSONWith(kv.JSONOpts{}), kv.WithMetadata(timeGen, 0), kv.WithChecksum(kv.CRC32Checksum))
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"))
+
+		out, err := findRaw(kvStore, base, kv.FindOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "["+foo1+"]", out)
+	})
+
+	t.Run("rejects stores not declaring JSON bodies", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := kv.NewStoreBase("foo", []byte("foo_raw_json_opaque"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+
+		_, err = findRaw(kvStore, base, kv.FindOpts{})
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+
+	t.Run("rejects options acting on decoded values", func(t *testing.T) {
+		base, kvStore, done := newStore(t, kv.EncBodyJSON)
+		defer done()
+
+		for _, opts := range []kv.FindOpts{
+			{FilterEntFn: func(key []byte, decodedVal interface{}) bool { return true }},
+			{CaptureFn: func(key []byte, decodedVal interface{}) error { return nil }},
+			{DedupeKeyFn: func(decodedVal interface{}) []byte { return nil }},
+		} {
+			_, err := findRaw(kvStore, base, opts)
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package kv
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// SetReadOnly fences off writes to the store while a maintenance operation, such
+// as a reindex, runs. While read only, writes of entities, i.e. Put, Delete,
+// DeleteEnt, Touch, and PutBlob, fail with an unavailable error, whereas reads and
+// maintenance operations such as Compact and ReindexAll continue to work. It is safe to call
+// concurrently with the store's operations.
+func (s *StoreBase) SetReadOnly(readOnly bool) {
+	var v int32
+	if readOnly {
+		v = 1
+	}
+	atomic.StoreInt32(&s.readOnly, v)
+}
+
+// IsReadOnly reports whether writes to the store are fenced off by SetReadOnly.
+func (s *StoreBase) IsReadOnly() bool {
+	return atomic.LoadInt32(&s.readOnly) == 1
+}
+
+func (s *StoreBase) checkWritable() error {
+	if !s.IsReadOnly() {
+		return nil
+	}
+	return &influxdb.Error{
+		Code: influxdb.EUnavailable,
+		Msg:  fmt.Sprintf("%s store is read only", s.Resource),
+	}
+}
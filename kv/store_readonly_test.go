@@ -0,0 +1,76 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_SetReadOnly(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("foo", []byte("foo_read_only"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+	seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"))
+
+	base.SetReadOnly(true)
+	assert.True(t, base.IsReadOnly())
+
+	writes := []struct {
+		name string
+		fn   func(tx kv.Tx) error
+	}{
+		{
+			name: "Put",
+			fn: func(tx kv.Tx) error {
+				return base.Put(context.TODO(), tx, newFooEnt(2, 9000, "foo_2"))
+			},
+		},
+		{
+			name: "DeleteEnt",
+			fn: func(tx kv.Tx) error {
+				return base.DeleteEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			},
+		},
+		{
+			name: "Delete",
+			fn: func(tx kv.Tx) error {
+				return base.Delete(context.TODO(), tx, kv.DeleteOpts{
+					FilterFn: func(key []byte, decodedVal interface{}) bool { return true },
+				})
+			},
+		},
+	}
+	for _, w := range writes {
+		err := kvStore.Update(context.TODO(), w.fn)
+		require.Error(t, err, w.name)
+		assert.Equal(t, influxdb.EUnavailable, influxdb.ErrorCode(err), w.name)
+	}
+
+	var actuals []interface{}
+	view(t, kvStore, func(tx kv.Tx) error {
+		return base.Find(context.TODO(), tx, kv.FindOpts{
+			CaptureFn: func(key []byte, decodedVal interface{}) error {
+				actuals = append(actuals, decodedVal)
+				return nil
+			},
+		})
+	})
+	assert.Equal(t, toIfaces(newFooEnt(1, 9000, "foo_1")), actuals)
+
+	require.NoError(t, base.Compact(context.TODO(), kvStore))
+
+	base.SetReadOnly(false)
+	assert.False(t, base.IsReadOnly())
+	for _, w := range writes {
+		assert.NoError(t, kvStore.Update(context.TODO(), w.fn), w.name)
+	}
+}
@@ -0,0 +1,133 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// Reference declares that the entities of a store refer to the entities of another
+// store by ID, i.e. foos to the org of their OrgID.
+type Reference struct {
+	// Name identifies the reference in errors and reports.
+	Name string
+	// IDsFn returns the IDs the entity refers to. Invalid IDs, as for an unset
+	// OrgID, are treated as absent optional references and are not checked.
+	IDsFn func(ent Entity) ([]influxdb.ID, error)
+	// Target is the store of the referenced entities, which it must key by ID.
+	Target *StoreBase
+}
+
+// WithReference enforces the reference on every Put: a Put of an entity referring
+// to an ID the target store does not hold fails with EReferenceNotFound, within the
+// same transaction as the write. Deleting a referenced entity is not prevented;
+// ValidateReferences finds the references it leaves dangling, as well as those of
+// entities stored before the reference was declared.
+func WithReference(ref Reference) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.references = append(s.references, ref)
+	}
+}
+
+// DanglingReference is a reference to an entity that does not exist.
+type DanglingReference struct {
+	// Key is the key of the referring entity.
+	Key []byte
+	// Reference is the Name of the reference.
+	Reference string
+	// ID is the ID referred to.
+	ID influxdb.ID
+}
+
+// ValidateReferences scans every entity of the store for references to entities that
+// do not exist, returning each found in key order.
+func (s *StoreBase) ValidateReferences(ctx context.Context, tx Tx) ([]DanglingReference, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	var dangling []DanglingReference
+	err := s.Find(ctx, tx, FindOpts{
+		Ascending: true,
+		CaptureFn: func(key []byte, decodedVal interface{}) error {
+			ent, err := s.entFromVal(key, decodedVal)
+			if err != nil {
+				return err
+			}
+			return s.eachReference(ctx, tx, ent, func(ref Reference, id influxdb.ID) {
+				dangling = append(dangling, DanglingReference{
+					Key:       copyBytes(key),
+					Reference: ref.Name,
+					ID:        id,
+				})
+			})
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dangling, nil
+}
+
+// checkReferences fails when the entity refers to an entity that does not exist.
+func (s *StoreBase) checkReferences(ctx context.Context, tx Tx, ent Entity) error {
+	var missing error
+	err := s.eachReference(ctx, tx, ent, func(ref Reference, id influxdb.ID) {
+		if missing == nil {
+			missing = &influxdb.Error{
+				Code: influxdb.EReferenceNotFound,
+				Msg:  fmt.Sprintf("%s %s refers to %s %s, which does not exist", s.Resource, ref.Name, ref.Target.Resource, id),
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return missing
+}
+
+// eachReference calls fn with every ID the entity refers to that its reference's
+// target does not hold.
+func (s *StoreBase) eachReference(ctx context.Context, tx Tx, ent Entity, fn func(ref Reference, id influxdb.ID)) error {
+	for _, ref := range s.references {
+		ids, err := ref.IDsFn(ent)
+		if err != nil {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  fmt.Sprintf("failed to extract %s %s reference", s.Resource, ref.Name),
+				Err:  err,
+			}
+		}
+
+		for _, id := range ids {
+			if !id.Valid() {
+				continue
+			}
+			exists, err := ref.Target.exists(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				fn(ref, id)
+			}
+		}
+	}
+	return nil
+}
+
+// exists reports whether the store holds an entity for the id, without decoding it.
+func (s *StoreBase) exists(ctx context.Context, tx Tx, id influxdb.ID) (bool, error) {
+	key, err := s.EntKey(ctx, Entity{PK: EncID(id)})
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.bucketGet(ctx, tx, key)
+	if err != nil {
+		if influxdb.ErrorCode(err) == influxdb.ENotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_References(t *testing.T) {
+	orgRef := func(orgs *kv.StoreBase) kv.Reference {
+		return kv.Reference{
+			Name: "org",
+			IDsFn: func(ent kv.Entity) ([]influxdb.ID, error) {
+				return []influxdb.ID{ent.Body.(foo).OrgID}, nil
+			},
+			Target: orgs,
+		}
+	}
+
+	newStores := func(t *testing.T, withRef bool) (orgs, foos *kv.StoreBase, kvStore kv.Store, done func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		orgs = kv.NewStoreBase("org", []byte("orgs_ref"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		var opts []kv.StoreBaseOptFn
+		if withRef {
+			opts = append(opts, kv.WithReference(orgRef(orgs)))
+		}
+		foos = kv.NewStoreBase("foo", []byte("foos_ref"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn, opts...)
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := orgs.Init(context.TODO(), tx); err != nil {
+				return err
+			}
+			return foos.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, orgs, newFooEnt(9000, 1, "org_9000"))
+		return orgs, foos, kvStore, done
+	}
+
+	put := func(kvStore kv.Store, store *kv.StoreBase, ent kv.Entity) error {
+		return kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return store.Put(context.TODO(), tx, ent)
+		})
+	}
+
+	t.Run("put of an existing reference succeeds", func(t *testing.T) {
+		_, foos, kvStore, done := newStores(t, true)
+		defer done()
+
+		require.NoError(t, put(kvStore, foos, newFooEnt(1, 9000, "foo_1")))
+	})
+
+	t.Run("put of a missing reference fails", func(t *testing.T) {
+		_, foos, kvStore, done := newStores(t, true)
+		defer done()
+
+		err := put(kvStore, foos, newFooEnt(1, 9001, "foo_1"))
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EReferenceNotFound, influxdb.ErrorCode(err))
+		assert.True(t, kv.IsReferenceNotFound(err))
+
+		err = kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			_, _, err := foos.UpsertMany(context.TODO(), tx, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9001, "foo_2"))
+			return err
+		})
+		assert.True(t, kv.IsReferenceNotFound(err))
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			_, err := foos.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			isNotFoundErr(t, err)
+			return nil
+		})
+	})
+
+	t.Run("validate finds dangling references", func(t *testing.T) {
+		orgs, foos, kvStore, done := newStores(t, false)
+		defer done()
+
+		seedEnts(t, kvStore, foos,
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9001, "foo_2"),
+			newFooEnt(3, 9002, "foo_3"),
+		)
+
+		checked := kv.NewStoreBase("foo", []byte("foos_ref"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn, kv.WithReference(orgRef(orgs)))
+
+		var dangling []kv.DanglingReference
+		view(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			dangling, err = checked.ValidateReferences(context.TODO(), tx)
+			return err
+		})
+		assert.Equal(t, []kv.DanglingReference{
+			{Key: encodeID(t, 2), Reference: "org", ID: 9001},
+			{Key: encodeID(t, 3), Reference: "org", ID: 9002},
+		}, dangling)
+	})
+}
@@ -0,0 +1,166 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+	"go.uber.org/multierr"
+)
+
+// ReindexAll rebuilds every secondary index of the store, and its projection, from
+// its primary entities, returning the number of entities indexed. Each index bucket
+// is cleared and then repopulated, dropping dangling and mismatched entries along
+// the way. A unique index that the stored entities violate fails the rebuild with a
+// conflict, and the caller's transaction should be rolled back.
+func (s *StoreBase) ReindexAll(ctx context.Context, tx Tx) (int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	for _, idx := range s.indexes {
+		if err := s.clearIndex(ctx, tx, idx); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.clearProjection(ctx, tx); err != nil {
+		return 0, err
+	}
+
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	decFn := s.decodeFn()
+	var n int
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		_, decodedVal, err := decFn(k, v)
+		if err != nil {
+			return 0, &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to decode %s for key %q", s.Resource, string(k)),
+				Err:  err,
+			}
+		}
+		if err := s.reindexEnt(ctx, tx, k, decodedVal); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (s *StoreBase) clearIndex(ctx context.Context, tx Tx, idx StoreIndex) error {
+	b, err := s.indexBucket(ctx, tx, idx)
+	if err != nil {
+		return err
+	}
+	return clearBucket(b, nil, nil)
+}
+
+// clearBucket deletes every key of the bucket, or when ns is provided every key
+// within that namespace of it, dropping each from the decode cache.
+func clearBucket(b Bucket, ns []byte, cache *decodeCache) error {
+	cur, err := b.Cursor()
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	if ns != nil {
+		cur = &namespaceCursor{Cursor: cur, ns: ns}
+	}
+
+	var keys [][]byte
+	for k, _ := cur.First(); k != nil; k, _ = cur.Next() {
+		keys = append(keys, copyBytes(k))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil && !IsNotFound(err) {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+		cache.invalidate(k)
+	}
+	return nil
+}
+
+// reindexEnt writes the index entries of the entity stored under pk into indexes
+// that have been cleared.
+func (s *StoreBase) reindexEnt(ctx context.Context, tx Tx, pk []byte, decodedVal interface{}) error {
+	if len(s.indexes) == 0 && s.projection == nil {
+		return nil
+	}
+
+	ent, err := s.entFromVal(pk, decodedVal)
+	if err != nil {
+		return err
+	}
+	if err := s.putProjection(ctx, tx, pk, ent); err != nil {
+		return err
+	}
+
+	for _, idx := range s.indexes {
+		key, err := s.indexKey(idx, ent)
+		if err != nil {
+			return err
+		}
+
+		if idx.Unique {
+			existingPK, err := s.indexLookup(ctx, tx, idx, key)
+			if err != nil {
+				return err
+			}
+			if existingPK != nil && !bytes.Equal(existingPK, pk) {
+				return &influxdb.Error{
+					Code: influxdb.EConflict,
+					Msg:  fmt.Sprintf("%s is not unique for %s index key %q", s.Resource, idx.Name, string(key)),
+				}
+			}
+		}
+
+		b, err := s.indexBucket(ctx, tx, idx)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(indexEntryKey(idx, key, copyBytes(pk)), copyBytes(pk)); err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
+
+// ReindexStores rebuilds the indexes of each of the stores with ReindexAll, each in
+// its own update transaction, returning the number of entities indexed keyed by the
+// bucket name of the store. A store that fails to reindex is rolled back and left
+// out of the counts, and the remaining stores are still reindexed. The errors of
+// all failed stores are returned together.
+func ReindexStores(ctx context.Context, store Store, stores []*StoreBase) (map[string]int, error) {
+	counts := make(map[string]int, len(stores))
+
+	var errs error
+	for _, s := range stores {
+		var n int
+		err := store.Update(ctx, func(tx Tx) error {
+			var err error
+			n, err = s.ReindexAll(ctx, tx)
+			return err
+		})
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", string(s.BktName), err))
+			continue
+		}
+		counts[string(s.BktName)] = n
+	}
+
+	if errs != nil {
+		return counts, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to reindex %d of %d stores", len(multierr.Errors(errs)), len(stores)),
+			Err:  errs,
+		}
+	}
+	return counts, nil
+}
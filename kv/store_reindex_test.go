@@ -0,0 +1,72 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReindexStores(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	newStores := func(name string, unique bool) (*kv.StoreBase, *kv.StoreBase) {
+		bktName := []byte("foo_reindex_" + name)
+		indexed := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithNameFoldIndex([]byte("foo_reindex_name_fold_"+name), fooNameFn, unique),
+		)
+		plain := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return indexed.Init(context.TODO(), tx)
+		})
+		return indexed, plain
+	}
+
+	findByName := func(base *kv.StoreBase, name string) error {
+		return kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			_, err := base.FindEntByNameFold(context.TODO(), tx, name)
+			return err
+		})
+	}
+
+	// entities written without their indexes, as by a version predating them
+	good, goodPlain := newStores("good", true)
+	seedEnts(t, kvStore, good, newFooEnt(1, 9000, "indexed"))
+	seedEnts(t, kvStore, goodPlain, newFooEnt(2, 9000, "unindexed"), newFooEnt(1, 9000, "renamed"))
+
+	bad, badPlain := newStores("bad", true)
+	seedEnts(t, kvStore, badPlain, newFooEnt(1, 9000, "dupe"), newFooEnt(2, 9000, "DUPE"))
+
+	nonUnique, nonUniquePlain := newStores("non_unique", false)
+	seedEnts(t, kvStore, nonUniquePlain, newFooEnt(1, 9000, "dupe"), newFooEnt(2, 9000, "DUPE"))
+
+	isNotFoundErr(t, findByName(good, "unindexed"))
+
+	counts, err := kv.ReindexStores(context.TODO(), kvStore, []*kv.StoreBase{good, bad, nonUnique})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to reindex 1 of 3 stores")
+	assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+
+	assert.Equal(t, map[string]int{
+		"foo_reindex_good":       2,
+		"foo_reindex_non_unique": 2,
+	}, counts)
+
+	require.NoError(t, findByName(good, "unindexed"))
+	require.NoError(t, findByName(good, "renamed"))
+	isNotFoundErr(t, findByName(good, "indexed"))
+	require.NoError(t, findByName(nonUnique, "dupe"))
+
+	view(t, kvStore, func(tx kv.Tx) error {
+		report, err := good.VerifyIndexIntegrity(context.TODO(), tx, kv.NameFoldIndexName)
+		require.NoError(t, err)
+		assert.True(t, report.OK())
+		assert.Equal(t, 2, report.Checked)
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// RenameBucket moves every pair of the bucket oldName to the bucket newName within
+// the transaction, so a resource renamed at the schema level keeps its data. The
+// move is atomic: should the transaction fail, both buckets are left as they were.
+// Stores are then pointed at the new bucket by constructing them with newName.
+// Only the named bucket is moved; the buckets of a store's indexes, sidecars, and
+// sequence index are renamed with calls of their own.
+//
+// Renaming onto a bucket that holds any pair fails with a conflict rather than
+// clobbering it. Buckets are created when first retrieved, so an empty destination
+// is indistinguishable from a missing one and is written to. The old bucket is
+// removed when the transaction implements BucketDeleter, and otherwise emptied.
+func RenameBucket(ctx context.Context, tx Tx, oldName, newName []byte) error {
+	span, _ := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	if len(oldName) == 0 || len(newName) == 0 {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  "bucket names must not be empty",
+		}
+	}
+	if bytes.Equal(oldName, newName) {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("cannot rename bucket %q to itself", string(oldName)),
+		}
+	}
+
+	dst, err := tx.Bucket(newName)
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	dstCur, err := dst.Cursor()
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	if k, _ := dstCur.First(); k != nil {
+		return &influxdb.Error{
+			Code: influxdb.EConflict,
+			Msg:  fmt.Sprintf("cannot rename bucket %q to %q as it already holds data", string(oldName), string(newName)),
+		}
+	}
+
+	src, err := tx.Bucket(oldName)
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	srcCur, err := src.Cursor()
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	// the pairs are collected before any is written, as writing beneath an open
+	// cursor is not supported by every store.
+	var pairs []Pair
+	for k, v := srcCur.First(); k != nil; k, v = srcCur.Next() {
+		pairs = append(pairs, Pair{Key: copyBytes(k), Value: copyBytes(v)})
+	}
+
+	for _, p := range pairs {
+		if err := dst.Put(p.Key, p.Value); err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+
+	if deleter, ok := tx.(BucketDeleter); ok {
+		if err := deleter.DeleteBucket(oldName); err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+		return nil
+	}
+	for _, p := range pairs {
+		if err := src.Delete(p.Key); err != nil && !IsNotFound(err) {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/inmem"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenameBucket(t *testing.T) {
+	newFooStore := func(bktName string) *kv.StoreBase {
+		return kv.NewStoreBase("foo", []byte(bktName), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	}
+
+	newStore := func(t *testing.T) *inmem.KVStore {
+		t.Helper()
+
+		kvStore := inmem.NewKVStore()
+		base := newFooStore("foo_old")
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2"))
+		return kvStore
+	}
+
+	findAll := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase) []interface{} {
+		t.Helper()
+
+		var vals []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					vals = append(vals, decodedVal)
+					return nil
+				},
+			})
+		})
+		return vals
+	}
+
+	hasBucket := func(kvStore *inmem.KVStore, name string) bool {
+		for _, b := range kvStore.Buckets(context.TODO()) {
+			if string(b) == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("moves every pair to the new bucket", func(t *testing.T) {
+		kvStore := newStore(t)
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return kv.RenameBucket(context.TODO(), tx, []byte("foo_old"), []byte("foo_new"))
+		})
+
+		expected := []interface{}{
+			foo{ID: 1, OrgID: 9000, Name: "foo_1"},
+			foo{ID: 2, OrgID: 9000, Name: "foo_2"},
+		}
+		assert.Equal(t, expected, findAll(t, kvStore, newFooStore("foo_new")))
+		assert.False(t, hasBucket(kvStore, "foo_old"))
+	})
+
+	t.Run("leaves both buckets as they were when the transaction fails", func(t *testing.T) {
+		kvStore := newStore(t)
+
+		errAbort := errors.New("abort")
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			if err := kv.RenameBucket(context.TODO(), tx, []byte("foo_old"), []byte("foo_new")); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		require.Equal(t, errAbort, err)
+
+		assert.Len(t, findAll(t, kvStore, newFooStore("foo_old")), 2)
+		assert.False(t, hasBucket(kvStore, "foo_new"))
+	})
+
+	t.Run("does not clobber a destination holding data", func(t *testing.T) {
+		kvStore := newStore(t)
+
+		existing := newFooStore("foo_new")
+		update(t, kvStore, func(tx kv.Tx) error {
+			return existing.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, existing, newFooEnt(3, 9000, "foo_3"))
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return kv.RenameBucket(context.TODO(), tx, []byte("foo_old"), []byte("foo_new"))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EConflict, influxdb.ErrorCode(err))
+
+		assert.Len(t, findAll(t, kvStore, newFooStore("foo_old")), 2)
+		assert.Equal(t, []interface{}{foo{ID: 3, OrgID: 9000, Name: "foo_3"}}, findAll(t, kvStore, existing))
+	})
+
+	t.Run("rejects renaming a bucket to itself", func(t *testing.T) {
+		kvStore := newStore(t)
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return kv.RenameBucket(context.TODO(), tx, []byte("foo_old"), []byte("foo_old"))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Len(t, findAll(t, kvStore, newFooStore("foo_old")), 2)
+	})
+}
@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// RepairKeys rewrites every entry stored under a key other than the one the store's
+// key encoder produces for its body, as left behind by a faulty import. Each body is
+// decoded and converted to an entity to recompute its key; mismatched entries are
+// moved to the correct key, with their index entries, projections, sequence entries
+// and sidecar data moved along with them. The raw
+// stored bytes are moved unchanged and the put and delete callbacks are not invoked.
+//
+// The number of entries moved is returned. A healthy store is left untouched and
+// reports zero. When the correct key is already occupied by another entry, the repair
+// aborts with a conflict error rather than overwrite it, leaving the caller to decide
+// which of the two to keep.
+func (s *StoreBase) RepairKeys(ctx context.Context, tx Tx) (int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	type move struct {
+		from, to []byte
+		raw      []byte
+		val      interface{}
+		ent      Entity
+	}
+
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	// collect all moves before mutating the bucket underneath the cursor
+	var moves []move
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		_, decodedVal, err := s.decodeFn()(k, v)
+		if err != nil {
+			return 0, &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to decode %s body at key %q", s.Resource, string(k)),
+				Err:  err,
+			}
+		}
+		ent, err := s.ConvertValToEntFn(k, decodedVal)
+		if err != nil {
+			return 0, &influxdb.Error{
+				Code: influxdb.EInternal,
+				Msg:  fmt.Sprintf("failed to convert %s body at key %q", s.Resource, string(k)),
+				Err:  err,
+			}
+		}
+		key, err := s.EntKey(ctx, ent)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(key, k) {
+			continue
+		}
+		moves = append(moves, move{
+			from: copyBytes(k),
+			to:   key,
+			raw:  copyBytes(v),
+			val:  decodedVal,
+			ent:  ent,
+		})
+	}
+
+	for _, m := range moves {
+		if _, err := s.bucketGet(ctx, tx, m.to); err == nil {
+			return 0, &influxdb.Error{
+				Code: influxdb.EConflict,
+				Msg:  fmt.Sprintf("%s at key %q belongs at key %q which is already occupied", s.Resource, string(m.from), string(m.to)),
+			}
+		} else if influxdb.ErrorCode(err) != influxdb.ENotFound {
+			return 0, err
+		}
+
+		if err := s.deleteIndexes(ctx, tx, m.from, m.val); err != nil {
+			return 0, err
+		}
+		if err := s.bucketDelete(ctx, tx, m.from); err != nil {
+			return 0, err
+		}
+		if err := s.deleteProjection(ctx, tx, m.from); err != nil {
+			return 0, err
+		}
+		if err := s.putIndexes(ctx, tx, m.to, m.ent, nil); err != nil {
+			return 0, err
+		}
+		if err := s.bucketPut(ctx, tx, m.to, m.raw); err != nil {
+			return 0, err
+		}
+		if err := s.putProjection(ctx, tx, m.to, m.ent); err != nil {
+			return 0, err
+		}
+		if err := s.moveSeq(ctx, tx, m.from, m.to); err != nil {
+			return 0, err
+		}
+		if err := s.moveSidecars(ctx, tx, m.from, m.to); err != nil {
+			return 0, err
+		}
+	}
+	return len(moves), nil
+}
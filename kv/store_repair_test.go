@@ -0,0 +1,156 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_RepairKeys(t *testing.T) {
+	newStore := func(t *testing.T) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_repair"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	repair := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase) (int, error) {
+		t.Helper()
+
+		var n int
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			var err error
+			n, err = base.RepairKeys(context.TODO(), tx)
+			return err
+		})
+		return n, err
+	}
+
+	t.Run("healthy store is untouched", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2"))
+
+		n, err := repair(t, kvStore, base)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("moves mismatched entries to their correct key", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+			newFooEnt(3, 9000, "foo_3"),
+		}
+		seedEnts(t, kvStore, base, ents[0])
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := base.PutRaw(context.TODO(), tx, encodeID(t, 20), ents[1]); err != nil {
+				return err
+			}
+			return base.PutRaw(context.TODO(), tx, encodeID(t, 30), ents[2])
+		})
+
+		n, err := repair(t, kvStore, base)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		var keys [][]byte
+		var actuals []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					keys = append(keys, key)
+					actuals = append(actuals, decodedVal)
+					return nil
+				},
+			})
+		})
+		assert.Equal(t, toIfaces(ents...), actuals)
+		assert.Equal(t, [][]byte{encodeID(t, 1), encodeID(t, 2), encodeID(t, 3)}, keys)
+
+		n, err = repair(t, kvStore, base)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+	})
+
+	t.Run("moves seq entries and sidecars along with the entity", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := kv.NewStoreBase("foo", []byte("foo_repair"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithSeqIndex([]byte("foo_repair_seq")),
+			kv.WithSidecar("notes", []byte("foo_repair_notes")),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+
+		ents := []kv.Entity{
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+		}
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := base.PutRaw(context.TODO(), tx, encodeID(t, 20), ents[1]); err != nil {
+				return err
+			}
+			if err := base.PutSidecar(context.TODO(), tx, 20, "notes", []byte("note_2")); err != nil {
+				return err
+			}
+			return base.Put(context.TODO(), tx, ents[0])
+		})
+
+		n, err := repair(t, kvStore, base)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		var actuals []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.FindInSeqOrder(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					actuals = append(actuals, decodedVal)
+					return nil
+				},
+			})
+		})
+		assert.Equal(t, toIfaces(ents[1], ents[0]), actuals)
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			val, err := base.GetSidecar(context.TODO(), tx, 2, "notes")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("note_2"), val)
+
+			_, err = base.GetSidecar(context.TODO(), tx, 20, "notes")
+			isNotFoundErr(t, err)
+			return nil
+		})
+	})
+
+	t.Run("refuses to overwrite an occupied key", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"))
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.PutRaw(context.TODO(), tx, encodeID(t, 10), newFooEnt(1, 9000, "imposter"))
+		})
+
+		_, err := repair(t, kvStore, base)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EConflict, influxdb.ErrorCode(err))
+	})
+}
@@ -0,0 +1,146 @@
+package kv
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+const (
+	defaultRetryMaxAttempts = 5
+	defaultRetryBaseDelay   = 10 * time.Millisecond
+	defaultRetryMaxDelay    = time.Second
+	defaultRetryMultiplier  = 2
+	defaultRetryJitter      = 0.5
+)
+
+// RetryConfig configures how RetryUpdate backs off between attempts. The delay
+// before retry n is BaseDelay * Multiplier^(n-1), capped at MaxDelay. Jitter is
+// the fraction of that delay that is randomized, so callers contending on the
+// same bucket spread out their retries rather than retrying in lockstep. A
+// Jitter of 0.5 yields a delay in the range [delay/2, delay].
+//
+// Any unset field is replaced by its default from DefaultRetryConfig, as is a
+// Jitter outside of [0, 1], so a zero config spreads out its retries too. Jitter is
+// disabled with NoJitter, for callers that need predictable delays.
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Multiplier  float64
+	Jitter      float64
+	NoJitter    bool
+	// RetryableFn reports whether a failed attempt should be retried. The
+	// default retries errors coded EUnavailable and ETooManyRequests.
+	RetryableFn func(err error) bool
+}
+
+// DefaultRetryConfig returns the config used by RetryUpdate for any field left unset.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts: defaultRetryMaxAttempts,
+		BaseDelay:   defaultRetryBaseDelay,
+		MaxDelay:    defaultRetryMaxDelay,
+		Multiplier:  defaultRetryMultiplier,
+		Jitter:      defaultRetryJitter,
+		RetryableFn: IsRetryable,
+	}
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	def := DefaultRetryConfig()
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = def.MaxAttempts
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = def.BaseDelay
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = def.MaxDelay
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = def.Multiplier
+	}
+	switch {
+	case c.NoJitter:
+		c.Jitter = 0
+	case c.Jitter <= 0 || c.Jitter > 1:
+		c.Jitter = def.Jitter
+	}
+	if c.RetryableFn == nil {
+		c.RetryableFn = def.RetryableFn
+	}
+	return c
+}
+
+// Delay returns the backoff to wait before the provided retry attempt, where
+// attempt 1 is the first retry after the initial failure.
+func (c RetryConfig) Delay(attempt int) time.Duration {
+	c = c.withDefaults()
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(c.BaseDelay) * math.Pow(c.Multiplier, float64(attempt-1))
+	if delay > float64(c.MaxDelay) {
+		delay = float64(c.MaxDelay)
+	}
+	delay -= delay * c.Jitter * retryRand()
+	return time.Duration(delay)
+}
+
+var (
+	retryRandMu  sync.Mutex
+	retryRandSrc = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func retryRand() float64 {
+	retryRandMu.Lock()
+	defer retryRandMu.Unlock()
+	return retryRandSrc.Float64()
+}
+
+// IsRetryable returns true when the error indicates a transient failure caused by
+// contention, where the same update may succeed if attempted again. Conflicts are
+// not retryable, as a duplicate key or unique index violation fails the same way on
+// every attempt; callers whose conflicts are transient say so with a RetryableFn.
+func IsRetryable(err error) bool {
+	switch influxdb.ErrorCode(err) {
+	case influxdb.EUnavailable, influxdb.ETooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryUpdate runs fn in an update transaction, retrying it with a jittered exponential
+// backoff while it fails with a retryable error. Each attempt runs in its own
+// transaction, so fn must be safe to run more than once. The last error is returned
+// once the attempts are exhausted, and the context error is returned if the context
+// is done while waiting between attempts.
+func RetryUpdate(ctx context.Context, store Store, cfg RetryConfig, fn func(tx Tx) error) error {
+	cfg = cfg.withDefaults()
+
+	var err error
+	for attempt := 0; attempt < cfg.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(cfg.Delay(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		err = store.Update(ctx, fn)
+		if err == nil || !cfg.RetryableFn(err) {
+			return err
+		}
+	}
+	return err
+}
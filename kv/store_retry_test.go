@@ -0,0 +1,123 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryConfig_Delay(t *testing.T) {
+	t.Run("grows and is bounded without jitter", func(t *testing.T) {
+		cfg := kv.RetryConfig{
+			BaseDelay:  10 * time.Millisecond,
+			MaxDelay:   100 * time.Millisecond,
+			Multiplier: 2,
+			NoJitter:   true,
+		}
+		expected := []time.Duration{
+			10 * time.Millisecond,
+			20 * time.Millisecond,
+			40 * time.Millisecond,
+			80 * time.Millisecond,
+			100 * time.Millisecond,
+			100 * time.Millisecond,
+		}
+		for i, exp := range expected {
+			assert.Equal(t, exp, cfg.Delay(i+1), "attempt %d", i+1)
+		}
+	})
+
+	t.Run("jitter stays within bounds", func(t *testing.T) {
+		cfg := kv.RetryConfig{
+			BaseDelay:  10 * time.Millisecond,
+			MaxDelay:   time.Second,
+			Multiplier: 3,
+			Jitter:     0.5,
+		}
+		var prevMax time.Duration
+		for attempt := 1; attempt <= 8; attempt++ {
+			max := 10 * time.Millisecond
+			for i := 1; i < attempt; i++ {
+				max *= 3
+			}
+			if max > time.Second {
+				max = time.Second
+			}
+			assert.True(t, max >= prevMax)
+			prevMax = max
+
+			for i := 0; i < 50; i++ {
+				d := cfg.Delay(attempt)
+				assert.True(t, d <= max, "attempt %d: %s > %s", attempt, d, max)
+				assert.True(t, d >= max/2, "attempt %d: %s < %s", attempt, d, max/2)
+			}
+		}
+	})
+
+	t.Run("zero config jitters by default", func(t *testing.T) {
+		var cfg kv.RetryConfig
+		max := kv.DefaultRetryConfig().BaseDelay
+
+		delays := make(map[time.Duration]bool)
+		for i := 0; i < 50; i++ {
+			d := cfg.Delay(1)
+			assert.True(t, d <= max, "%s > %s", d, max)
+			assert.True(t, d >= max/2, "%s < %s", d, max/2)
+			delays[d] = true
+		}
+		assert.True(t, len(delays) > 1, "all 50 delays were %v", delays)
+	})
+}
+
+func TestRetryUpdate(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	cfg := kv.RetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   time.Microsecond,
+		MaxDelay:    time.Millisecond,
+	}
+
+	t.Run("retries until success", func(t *testing.T) {
+		var attempts int
+		err := kv.RetryUpdate(context.Background(), kvStore, cfg, func(tx kv.Tx) error {
+			attempts++
+			if attempts < 3 {
+				return &influxdb.Error{Code: influxdb.EUnavailable}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		var attempts int
+		err := kv.RetryUpdate(context.Background(), kvStore, cfg, func(tx kv.Tx) error {
+			attempts++
+			return &influxdb.Error{Code: influxdb.EUnavailable}
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EUnavailable, influxdb.ErrorCode(err))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		for _, code := range []string{influxdb.EInvalid, influxdb.EConflict} {
+			var attempts int
+			err := kv.RetryUpdate(context.Background(), kvStore, cfg, func(tx kv.Tx) error {
+				attempts++
+				return &influxdb.Error{Code: code}
+			})
+			require.Error(t, err)
+			assert.Equal(t, 1, attempts, code)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// Sample returns up to n decoded entities of the store as examples of its data, i.e.
+// for generating documentation or test fixtures. The entities are the first n in
+// the store's natural order, so sampling reads no more than n values regardless of
+// the size of the store. Samples are redacted by the store's RedactFn when one is
+// registered.
+func (s *StoreBase) Sample(ctx context.Context, tx Tx, n int) ([]interface{}, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if n <= 0 {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s sample size must be positive; got %d", s.Resource, n),
+		}
+	}
+
+	samples := make([]interface{}, 0, n)
+	err := s.Find(ctx, tx, FindOpts{
+		Limit:  n,
+		retain: true,
+		CaptureFn: func(key []byte, decodedVal interface{}) error {
+			samples = append(samples, s.redact(decodedVal))
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
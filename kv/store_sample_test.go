@@ -0,0 +1,51 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_Sample(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("foo", []byte("foo_sample"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	ents := []kv.Entity{
+		newFooEnt(1, 9000, "foo_1"),
+		newFooEnt(2, 9000, "foo_2"),
+		newFooEnt(3, 9000, "foo_3"),
+	}
+	seedEnts(t, kvStore, base, ents...)
+
+	sample := func(n int) ([]interface{}, error) {
+		var samples []interface{}
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			var err error
+			samples, err = base.Sample(context.TODO(), tx, n)
+			return err
+		})
+		return samples, err
+	}
+
+	samples, err := sample(2)
+	require.NoError(t, err)
+	assert.Equal(t, toIfaces(ents[:2]...), samples)
+
+	samples, err = sample(10)
+	require.NoError(t, err)
+	assert.Equal(t, toIfaces(ents...), samples)
+
+	_, err = sample(0)
+	require.Error(t, err)
+	assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+}
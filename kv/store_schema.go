@@ -0,0 +1,426 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// WithBodySchema validates the encoded body of every entity the store puts against
+// the schema, failing the put as invalid with the violations found before anything
+// is written. It suits stores of user supplied bodies, whose structure the types of
+// the store do not enforce. The bodies must be encoded as JSON.
+//
+// The schema is a minimal subset of JSON Schema, not an implementation of it: it
+// covers the type, enum, const, properties, required, additionalProperties, items,
+// minItems, maxItems, minLength, maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, and exclusiveMaximum keywords with their meaning in JSON Schema
+// draft 6 and later, save that patterns are Go regular expressions. The annotations
+// title, description, default, examples, $schema, $id, and $comment are ignored.
+// There are no references, combinators, conditionals, or formats. The schema is
+// compiled once, when the store is built, and one using any keyword beyond the
+// subset fails Init and every put rather than being partially enforced.
+func WithBodySchema(schema []byte) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.schema, s.schemaErr = compileBodySchema(schema)
+	}
+}
+
+// checkSchema validates the encoded body against the store's schema, if any.
+func (s *StoreBase) checkSchema(body []byte) error {
+	if s.schema == nil && s.schemaErr == nil {
+		return nil
+	}
+	if s.schemaErr != nil {
+		return s.errInvalidSchema()
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s body is not JSON and cannot be validated against its schema", s.Resource),
+			Err:  err,
+		}
+	}
+
+	var violations []string
+	s.schema.validate("", doc, &violations)
+	if len(violations) > 0 {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s body does not match its schema: %s", s.Resource, strings.Join(violations, "; ")),
+		}
+	}
+	return nil
+}
+
+func (s *StoreBase) errInvalidSchema() error {
+	return &influxdb.Error{
+		Code: influxdb.EInvalid,
+		Msg:  fmt.Sprintf("%s store has an invalid body schema", s.Resource),
+		Err:  s.schemaErr,
+	}
+}
+
+// bodySchema is a compiled body schema. Absent numeric bounds are nil.
+type bodySchema struct {
+	types    []string
+	enum     []interface{}
+	constVal *interface{}
+
+	properties           map[string]*bodySchema
+	required             []string
+	additionalProperties *bodySchema
+	noAdditional         bool
+
+	items              *bodySchema
+	minItems, maxItems *int
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+}
+
+var schemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+var schemaAnnotations = map[string]bool{
+	"title": true, "description": true, "default": true, "examples": true,
+	"$schema": true, "$id": true, "$comment": true,
+}
+
+func compileBodySchema(raw []byte) (*bodySchema, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return compileBodySchemaValue("#", v)
+}
+
+func compileBodySchemaValue(path string, v interface{}) (*bodySchema, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object", path)
+	}
+
+	// keywords are compiled in sorted order so a schema reports the same error
+	// every time it fails to compile
+	keywords := make([]string, 0, len(m))
+	for kw := range m {
+		keywords = append(keywords, kw)
+	}
+	sort.Strings(keywords)
+
+	sch := &bodySchema{}
+	for _, kw := range keywords {
+		val := m[kw]
+		kwPath := path + "/" + kw
+
+		var err error
+		switch kw {
+		case "type":
+			sch.types, err = compileSchemaTypes(kwPath, val)
+		case "enum":
+			enum, ok := val.([]interface{})
+			if !ok {
+				err = fmt.Errorf("%s: must be an array", kwPath)
+			}
+			sch.enum = enum
+		case "const":
+			c := val
+			sch.constVal = &c
+		case "properties":
+			props, ok := val.(map[string]interface{})
+			if !ok {
+				err = fmt.Errorf("%s: must be an object", kwPath)
+				break
+			}
+			sch.properties = make(map[string]*bodySchema, len(props))
+			for name, prop := range props {
+				if sch.properties[name], err = compileBodySchemaValue(kwPath+"/"+name, prop); err != nil {
+					break
+				}
+			}
+		case "required":
+			sch.required, err = schemaStrings(kwPath, val)
+		case "additionalProperties":
+			if b, ok := val.(bool); ok {
+				sch.noAdditional = !b
+				break
+			}
+			sch.additionalProperties, err = compileBodySchemaValue(kwPath, val)
+		case "items":
+			sch.items, err = compileBodySchemaValue(kwPath, val)
+		case "minItems":
+			sch.minItems, err = schemaCount(kwPath, val)
+		case "maxItems":
+			sch.maxItems, err = schemaCount(kwPath, val)
+		case "minLength":
+			sch.minLength, err = schemaCount(kwPath, val)
+		case "maxLength":
+			sch.maxLength, err = schemaCount(kwPath, val)
+		case "pattern":
+			p, ok := val.(string)
+			if !ok {
+				err = fmt.Errorf("%s: must be a string", kwPath)
+				break
+			}
+			sch.pattern, err = regexp.Compile(p)
+		case "minimum":
+			sch.minimum, err = schemaNumber(kwPath, val)
+		case "maximum":
+			sch.maximum, err = schemaNumber(kwPath, val)
+		case "exclusiveMinimum":
+			sch.exclusiveMinimum, err = schemaNumber(kwPath, val)
+		case "exclusiveMaximum":
+			sch.exclusiveMaximum, err = schemaNumber(kwPath, val)
+		default:
+			if !schemaAnnotations[kw] {
+				err = fmt.Errorf("%s: keyword is not supported", kwPath)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sch, nil
+}
+
+func compileSchemaTypes(path string, v interface{}) ([]string, error) {
+	if t, ok := v.(string); ok {
+		v = []interface{}{t}
+	}
+	types, err := schemaStrings(path, v)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range types {
+		if !schemaTypes[t] {
+			return nil, fmt.Errorf("%s: unknown type %q", path, t)
+		}
+	}
+	return types, nil
+}
+
+func schemaStrings(path string, v interface{}) ([]string, error) {
+	vals, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an array of strings", path)
+	}
+	strs := make([]string, 0, len(vals))
+	for _, val := range vals {
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: must be an array of strings", path)
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+func schemaCount(path string, v interface{}) (*int, error) {
+	num, ok := v.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a non negative integer", path)
+	}
+	n, err := num.Int64()
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%s: must be a non negative integer", path)
+	}
+	count := int(n)
+	return &count, nil
+}
+
+func schemaNumber(path string, v interface{}) (*float64, error) {
+	num, ok := v.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a number", path)
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("%s: must be a number", path)
+	}
+	return &f, nil
+}
+
+// validate appends a violation for each way the document at the JSON pointer path
+// does not match the schema.
+func (sch *bodySchema) validate(path string, doc interface{}, violations *[]string) {
+	violate := func(format string, args ...interface{}) {
+		at := path
+		if at == "" {
+			at = "/"
+		}
+		*violations = append(*violations, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(sch.types) > 0 && !schemaTypeMatches(sch.types, doc) {
+		violate("expected %s, found %s", strings.Join(sch.types, " or "), schemaTypeOf(doc))
+		return
+	}
+	if sch.constVal != nil && !schemaEqual(*sch.constVal, doc) {
+		violate("must equal the const value")
+	}
+	if sch.enum != nil {
+		var found bool
+		for _, e := range sch.enum {
+			if schemaEqual(e, doc) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violate("must be one of the enum values")
+		}
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for _, name := range sch.required {
+			if _, ok := v[name]; !ok {
+				violate("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			propPath := path + "/" + name
+			if prop, ok := sch.properties[name]; ok {
+				prop.validate(propPath, v[name], violations)
+				continue
+			}
+			if sch.noAdditional {
+				violate("property %q is not allowed", name)
+			} else if sch.additionalProperties != nil {
+				sch.additionalProperties.validate(propPath, v[name], violations)
+			}
+		}
+	case []interface{}:
+		if sch.minItems != nil && len(v) < *sch.minItems {
+			violate("must have at least %d items", *sch.minItems)
+		}
+		if sch.maxItems != nil && len(v) > *sch.maxItems {
+			violate("must have at most %d items", *sch.maxItems)
+		}
+		if sch.items != nil {
+			for i, item := range v {
+				sch.items.validate(fmt.Sprintf("%s/%d", path, i), item, violations)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if sch.minLength != nil && n < *sch.minLength {
+			violate("must be at least %d characters", *sch.minLength)
+		}
+		if sch.maxLength != nil && n > *sch.maxLength {
+			violate("must be at most %d characters", *sch.maxLength)
+		}
+		if sch.pattern != nil && !sch.pattern.MatchString(v) {
+			violate("must match the pattern %q", sch.pattern.String())
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if sch.minimum != nil && f < *sch.minimum {
+			violate("must be at least %v", *sch.minimum)
+		}
+		if sch.maximum != nil && f > *sch.maximum {
+			violate("must be at most %v", *sch.maximum)
+		}
+		if sch.exclusiveMinimum != nil && f <= *sch.exclusiveMinimum {
+			violate("must be greater than %v", *sch.exclusiveMinimum)
+		}
+		if sch.exclusiveMaximum != nil && f >= *sch.exclusiveMaximum {
+			violate("must be less than %v", *sch.exclusiveMaximum)
+		}
+	}
+}
+
+func schemaTypeMatches(types []string, doc interface{}) bool {
+	actual := schemaTypeOf(doc)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypeOf returns the schema type of a document decoded with UseNumber,
+// reporting numbers without a fractional part as integers.
+func schemaTypeOf(doc interface{}) string {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return "null"
+	}
+}
+
+// schemaEqual compares two documents decoded with UseNumber, comparing numbers by
+// value rather than by their representation.
+func schemaEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, aErr := av.Float64()
+		bf, bErr := bv.Float64()
+		return aErr == nil && bErr == nil && af == bf
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			if other, ok := bv[k]; !ok || !schemaEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !schemaEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
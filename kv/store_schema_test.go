@@ -0,0 +1,88 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_BodySchema(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	schema := []byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type": "object",
+		"required": ["ID", "OrgID", "Name"],
+		"properties": {
+			"ID": {"type": "string", "pattern": "^[0-9a-f]{16}$"},
+			"OrgID": {"type": "string"},
+			"Name": {"type": "string", "minLength": 1, "maxLength": 8}
+		},
+		"additionalProperties": false
+	}`)
+
+	base := kv.NewStoreBase("foo", []byte("foo_schema"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+		kv.WithBodySchema(schema),
+	)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	put := func(ent kv.Entity) error {
+		return kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, ent)
+		})
+	}
+
+	t.Run("valid document", func(t *testing.T) {
+		require.NoError(t, put(newFooEnt(1, 9000, "foo_1")))
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			require.NoError(t, err)
+			assert.Equal(t, foo{ID: 1, OrgID: 9000, Name: "foo_1"}, v)
+			return nil
+		})
+	})
+
+	t.Run("invalid document", func(t *testing.T) {
+		err := put(newFooEnt(2, 9000, "much_too_long"))
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Contains(t, err.Error(), "/Name: must be at most 8 characters")
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			_, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(2)})
+			isNotFoundErr(t, err)
+			return nil
+		})
+	})
+
+	t.Run("invalid document upserted", func(t *testing.T) {
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			_, _, err := base.UpsertMany(context.TODO(), tx, newFooEnt(3, 9000, ""))
+			return err
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Contains(t, err.Error(), "/Name: must be at least 1 characters")
+	})
+
+	t.Run("unsupported schema", func(t *testing.T) {
+		bad := kv.NewStoreBase("foo", []byte("foo_schema_bad"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithBodySchema([]byte(`{"anyOf": [{"type": "object"}]}`)),
+		)
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return bad.Init(context.TODO(), tx)
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Contains(t, err.Error(), "#/anyOf: keyword is not supported")
+	})
+}
@@ -0,0 +1,554 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// NameFoldIndexName is the name of the index registered by WithNameFoldIndex.
+const NameFoldIndexName = "name_fold"
+
+// StoreIndex is a secondary index maintained by a StoreBase. Each index lives in
+// its own bucket and maps the key produced by KeyFn to the primary key of the
+// entity. The store keeps its indexes up to date on every Put and delete.
+//
+// A unique index stores a single entry per index key, and a Put that would map
+// an index key to a second entity fails with a conflict. A non unique index stores
+// one entry per entity, keyed by the escaped and terminated index key followed by
+// the primary key.
+type StoreIndex struct {
+	Name    string
+	BktName []byte
+	KeyFn   func(ent Entity) ([]byte, error)
+	Unique  bool
+}
+
+// WithIndex registers a secondary index on the store.
+func WithIndex(idx StoreIndex) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.indexes = append(s.indexes, idx)
+	}
+}
+
+// WithNameFoldIndex registers an index on the case folded name of the entity, as
+// returned by nameFn. This provides case insensitive name lookups via FindEntByNameFold.
+// When unique, names that differ only by case conflict with one another.
+func WithNameFoldIndex(bktName []byte, nameFn func(ent Entity) (string, error), unique bool) StoreBaseOptFn {
+	return WithIndex(StoreIndex{
+		Name:    NameFoldIndexName,
+		BktName: bktName,
+		KeyFn: func(ent Entity) ([]byte, error) {
+			name, err := nameFn(ent)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(strings.ToLower(name)), nil
+		},
+		Unique: unique,
+	})
+}
+
+// FindEntByNameFold returns the decoded entity whose name matches the provided name
+// regardless of case. It requires the store to have been created with WithNameFoldIndex.
+// When the index is not unique and several entities share the name, the entity with
+// the lowest primary key is returned.
+func (s *StoreBase) FindEntByNameFold(ctx context.Context, tx Tx, name string) (interface{}, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	return s.FindEntByIndex(ctx, tx, NameFoldIndexName, []byte(strings.ToLower(name)))
+}
+
+// FindEntByIndex returns the decoded entity referenced by the index key within the
+// named index.
+func (s *StoreBase) FindEntByIndex(ctx context.Context, tx Tx, indexName string, indexKey []byte) (interface{}, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	idx, err := s.index(indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := s.indexLookup(ctx, tx, idx, indexKey)
+	if err != nil {
+		return nil, err
+	}
+	if pk == nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.ENotFound,
+			Msg:  fmt.Sprintf("%s not found for %s index key %q", s.Resource, idx.Name, string(indexKey)),
+		}
+	}
+
+	body, err := s.bucketGet(ctx, tx, pk)
+	if err != nil {
+		return nil, err
+	}
+	return s.decodeEnt(ctx, body)
+}
+
+func (s *StoreBase) index(name string) (StoreIndex, error) {
+	for _, idx := range s.indexes {
+		if idx.Name == name {
+			return idx, nil
+		}
+	}
+	return StoreIndex{}, &influxdb.Error{
+		Code: influxdb.EInvalid,
+		Msg:  fmt.Sprintf("%s has no index named %q", s.Resource, name),
+	}
+}
+
+func (s *StoreBase) initIndexes(ctx context.Context, tx Tx) error {
+	for _, idx := range s.indexes {
+		if _, err := s.indexBucket(ctx, tx, idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StoreBase) indexBucket(ctx context.Context, tx Tx, idx StoreIndex) (Bucket, error) {
+	span, _ := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	b, err := tx.Bucket(idx.BktName)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s index bucket %q is missing; the store must be initialized with Init before use", s.Resource, string(idx.BktName)),
+			Err:  err,
+		}
+	}
+	return b, nil
+}
+
+// The index key of a non unique index entry has each 0x00 byte escaped as 0x00 0xff
+// and is terminated by 0x00 0x01 ahead of the primary key. The terminator sorts
+// before any byte that may follow within a longer index key, so the entries keep
+// the order of their index keys.
+const (
+	indexKeyEscape  = 0x00
+	indexKeyEscaped = 0xff
+	indexKeyTerm    = 0x01
+)
+
+// indexEntryKey returns the key of the entry in the index bucket for the provided
+// index key and primary key. Escaping the index key of a non unique entry keeps the
+// entries of distinct pairs distinct, i.e. ("ab", "cX") and ("abc", "X").
+func indexEntryKey(idx StoreIndex, indexKey, pk []byte) []byte {
+	if idx.Unique {
+		return indexKey
+	}
+	return append(indexEntryPrefix(idx, indexKey), pk...)
+}
+
+// indexEntryPrefix returns the prefix shared by the entries of the index key.
+func indexEntryPrefix(idx StoreIndex, indexKey []byte) []byte {
+	if idx.Unique {
+		return indexKey
+	}
+	return append(escapeIndexKey(indexKey), indexKeyEscape, indexKeyTerm)
+}
+
+// escapeIndexKey escapes the 0x00 bytes of a non unique index key, or of a prefix
+// of one. The escaped prefix of an index key prefixes the escaped index key.
+func escapeIndexKey(indexKey []byte) []byte {
+	escaped := make([]byte, 0, len(indexKey)+2)
+	for _, c := range indexKey {
+		escaped = append(escaped, c)
+		if c == indexKeyEscape {
+			escaped = append(escaped, indexKeyEscaped)
+		}
+	}
+	return escaped
+}
+
+// isIndexEntryFor returns true when the entry with key k and primary key value v
+// belongs to the index key provided.
+func isIndexEntryFor(idx StoreIndex, indexKey, k, v []byte) bool {
+	return bytes.Equal(k, indexEntryKey(idx, indexKey, v))
+}
+
+// indexLookup returns the primary key referenced by the index key, or nil when
+// the index holds no entry for it.
+func (s *StoreBase) indexLookup(ctx context.Context, tx Tx, idx StoreIndex, indexKey []byte) ([]byte, error) {
+	b, err := s.indexBucket(ctx, tx, idx)
+	if err != nil {
+		return nil, err
+	}
+
+	if idx.Unique {
+		pk, err := b.Get(indexKey)
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+		return pk, nil
+	}
+
+	cur, err := b.Cursor()
+	if err != nil {
+		return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	prefix := indexEntryPrefix(idx, indexKey)
+	for k, v := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+		if isIndexEntryFor(idx, indexKey, k, v) {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// entFromVal converts a decoded value into its entity, making sure the body is set.
+func (s *StoreBase) entFromVal(pk []byte, decodedVal interface{}) (Entity, error) {
+	ent, err := s.ConvertValToEntFn(pk, decodedVal)
+	if err != nil {
+		return Entity{}, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to convert %s value to entity", s.Resource),
+			Err:  err,
+		}
+	}
+	if ent.Body == nil {
+		ent.Body = decodedVal
+	}
+	return ent, nil
+}
+
+func (s *StoreBase) indexKey(idx StoreIndex, ent Entity) ([]byte, error) {
+	key, err := idx.KeyFn(ent)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("failed to encode %s %s index key", s.Resource, idx.Name),
+			Err:  err,
+		}
+	}
+	return key, nil
+}
+
+// putIndexes writes the index entries for the entity stored under pk, removing any
+// stale entries left by the previous value of the entity and enforcing uniqueness.
+// The prevVal is the decoded value previously stored under pk, or nil if there was
+// none.
+func (s *StoreBase) putIndexes(ctx context.Context, tx Tx, pk []byte, ent Entity, prevVal interface{}) error {
+	if len(s.indexes) == 0 {
+		return nil
+	}
+
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	var prev *Entity
+	if prevVal != nil {
+		prevEnt, err := s.entFromVal(pk, prevVal)
+		if err != nil {
+			return err
+		}
+		prev = &prevEnt
+	}
+
+	for _, idx := range s.indexes {
+		newKey, err := s.indexKey(idx, ent)
+		if err != nil {
+			return err
+		}
+
+		b, err := s.indexBucket(ctx, tx, idx)
+		if err != nil {
+			return err
+		}
+
+		if prev != nil {
+			oldKey, err := s.indexKey(idx, *prev)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(oldKey, newKey) {
+				if err := b.Delete(indexEntryKey(idx, oldKey, pk)); err != nil && !IsNotFound(err) {
+					return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+				}
+			}
+		}
+
+		if idx.Unique {
+			existingPK, err := s.indexLookup(ctx, tx, idx, newKey)
+			if err != nil {
+				return err
+			}
+			if existingPK != nil && !bytes.Equal(existingPK, pk) {
+				return &influxdb.Error{
+					Code: influxdb.EConflict,
+					Msg:  fmt.Sprintf("%s is not unique for %s index key %q", s.Resource, idx.Name, string(newKey)),
+				}
+			}
+		}
+
+		if err := b.Put(indexEntryKey(idx, newKey, pk), pk); err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
+
+// deleteIndexes removes the index entries for the entity stored under pk with the
+// provided decoded value.
+func (s *StoreBase) deleteIndexes(ctx context.Context, tx Tx, pk []byte, decodedVal interface{}) error {
+	if len(s.indexes) == 0 {
+		return nil
+	}
+
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	ent, err := s.entFromVal(pk, decodedVal)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range s.indexes {
+		key, err := s.indexKey(idx, ent)
+		if err != nil {
+			return err
+		}
+
+		b, err := s.indexBucket(ctx, tx, idx)
+		if err != nil {
+			return err
+		}
+		if err := b.Delete(indexEntryKey(idx, key, pk)); err != nil && !IsNotFound(err) {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
+
+// deleteIndexesFor removes every index entry referencing pk. Unlike deleteIndexes it
+// needs no decoded value, at the cost of scanning each index in full.
+func (s *StoreBase) deleteIndexesFor(ctx context.Context, tx Tx, pk []byte) error {
+	if len(s.indexes) == 0 {
+		return nil
+	}
+
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	for _, idx := range s.indexes {
+		b, err := s.indexBucket(ctx, tx, idx)
+		if err != nil {
+			return err
+		}
+		cur, err := b.Cursor()
+		if err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+
+		var keys [][]byte
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			if bytes.Equal(v, pk) {
+				keys = append(keys, copyBytes(k))
+			}
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil && !IsNotFound(err) {
+				return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// IterIndex walks the raw entries of the named index in index key order, calling fn
+// with each index key and the primary key it references. The primary bodies are never
+// read, which makes this suitable for inspecting an index for drift from the primary
+// store.
+func (s *StoreBase) IterIndex(ctx context.Context, tx Tx, indexName string, fn func(indexKey, primaryKey []byte) error) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	idx, err := s.index(indexName)
+	if err != nil {
+		return err
+	}
+
+	b, err := s.indexBucket(ctx, tx, idx)
+	if err != nil {
+		return err
+	}
+
+	cur, err := b.Cursor()
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(indexEntryIndexKey(idx, k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexEntryIndexKey returns the index key portion of the entry key k. A non
+// unique entry key lacking a terminator is returned as it is.
+func indexEntryIndexKey(idx StoreIndex, k []byte) []byte {
+	if idx.Unique {
+		return k
+	}
+	indexKey := make([]byte, 0, len(k))
+	for i := 0; i < len(k); i++ {
+		if k[i] != indexKeyEscape || i+1 == len(k) {
+			indexKey = append(indexKey, k[i])
+			continue
+		}
+		i++
+		switch k[i] {
+		case indexKeyTerm:
+			return indexKey
+		case indexKeyEscaped:
+			indexKey = append(indexKey, indexKeyEscape)
+		default:
+			return k
+		}
+	}
+	return k
+}
+
+type (
+	// IndexEntry is a single entry of a secondary index.
+	IndexEntry struct {
+		IndexKey   []byte
+		PrimaryKey []byte
+	}
+
+	// IntegrityReport describes the problems found in a secondary index. Dangling
+	// entries reference a primary key that no longer exists. Mismatched entries
+	// reference an entity that now produces a different index key.
+	IntegrityReport struct {
+		Checked    int
+		Dangling   []IndexEntry
+		Mismatched []IndexEntry
+	}
+)
+
+// OK returns true when no problems were found in the index.
+func (r IntegrityReport) OK() bool {
+	return len(r.Dangling) == 0 && len(r.Mismatched) == 0
+}
+
+// VerifyIndexIntegrity walks the named index and checks that each entry references
+// an entity that still exists and still maps back to the same index key. It is read
+// only, and only the problem entries are held in memory. A report with problems
+// indicates the index needs to be rebuilt.
+func (s *StoreBase) VerifyIndexIntegrity(ctx context.Context, tx Tx, indexName string) (IntegrityReport, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	idx, err := s.index(indexName)
+	if err != nil {
+		return IntegrityReport{}, err
+	}
+
+	var report IntegrityReport
+	err = s.IterIndex(ctx, tx, indexName, func(indexKey, pk []byte) error {
+		report.Checked++
+		entry := IndexEntry{IndexKey: copyBytes(indexKey), PrimaryKey: copyBytes(pk)}
+
+		existing, err := s.findByKey(ctx, tx, pk)
+		if influxdb.ErrorCode(err) == influxdb.ENotFound {
+			report.Dangling = append(report.Dangling, entry)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ent, err := s.entFromVal(pk, existing)
+		if err != nil {
+			return err
+		}
+		key, err := s.indexKey(idx, ent)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(key, indexKey) {
+			report.Mismatched = append(report.Mismatched, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return IntegrityReport{}, err
+	}
+	return report, nil
+}
+
+// PruneDanglingIndex deletes the entries of the named index whose primary key no
+// longer exists, returning the number deleted. It is a targeted cleanup for
+// indexes left with dangling entries by irregular deletes, far lighter than a
+// ReindexAll: primary bodies are checked for existence only, never decoded, and
+// entries referencing existing entities are left alone, mismatched or not. The
+// existence checks and deletes happen within the caller's update transaction, so
+// the prune is safe to run alongside the writes of other transactions.
+func (s *StoreBase) PruneDanglingIndex(ctx context.Context, tx Tx, indexName string) (int, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	idx, err := s.index(indexName)
+	if err != nil {
+		return 0, err
+	}
+	ib, err := s.indexBucket(ctx, tx, idx)
+	if err != nil {
+		return 0, err
+	}
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	cur, err := ib.Cursor()
+	if err != nil {
+		return 0, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	// the dangling entries are collected before any is deleted, as writing beneath
+	// an open cursor is not supported by every store.
+	var dangling [][]byte
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		_, err := b.Get(v)
+		if IsNotFound(err) {
+			dangling = append(dangling, copyBytes(k))
+			continue
+		}
+		if err != nil {
+			return 0, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+
+	for _, k := range dangling {
+		if err := ib.Delete(k); err != nil && !IsNotFound(err) {
+			return 0, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return len(dangling), nil
+}
@@ -0,0 +1,336 @@
+package kv_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fooNameFn(ent kv.Entity) (string, error) {
+	f, ok := ent.Body.(foo)
+	if !ok {
+		return "", fmt.Errorf("invalid entry: %#v", ent.Body)
+	}
+	return f.Name, nil
+}
+
+func newFooNameFoldStore(t *testing.T, bktSuffix string, unique bool) (*kv.StoreBase, func(), kv.Store) {
+	t.Helper()
+
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+
+	base := kv.NewStoreBase("foo", []byte("foo_"+bktSuffix), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+		kv.WithNameFoldIndex([]byte("foo_name_fold_"+bktSuffix), fooNameFn, unique),
+	)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+	return base, done, kvStore
+}
+
+func TestStoreBase_NameFoldIndex(t *testing.T) {
+	findByName := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase, name string) (interface{}, error) {
+		var (
+			actual interface{}
+			err    error
+		)
+		view(t, kvStore, func(tx kv.Tx) error {
+			actual, err = base.FindEntByNameFold(context.TODO(), tx, name)
+			return nil
+		})
+		return actual, err
+	}
+
+	t.Run("finds entity regardless of case", func(t *testing.T) {
+		base, done, kvStore := newFooNameFoldStore(t, "fold_find", true)
+		defer done()
+
+		expected := newFooEnt(1, 9000, "Foo_Name")
+		seedEnts(t, kvStore, base, expected, newFooEnt(2, 9000, "other"))
+
+		for _, name := range []string{"Foo_Name", "foo_name", "FOO_NAME"} {
+			actual, err := findByName(t, kvStore, base, name)
+			require.NoError(t, err)
+			assert.Equal(t, expected.Body, actual)
+		}
+
+		_, err := findByName(t, kvStore, base, "missing")
+		isNotFoundErr(t, err)
+	})
+
+	t.Run("unique index rejects names differing only by case", func(t *testing.T) {
+		base, done, kvStore := newFooNameFoldStore(t, "fold_unique", true)
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "Foo"))
+
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, newFooEnt(2, 9000, "fOO"))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EConflict, influxdb.ErrorCode(err))
+
+		// updating the same entity keeps its own index entry
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "FOO"))
+	})
+
+	t.Run("renaming updates the index", func(t *testing.T) {
+		base, done, kvStore := newFooNameFoldStore(t, "fold_rename", true)
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "before"))
+		renamed := newFooEnt(1, 9000, "After")
+		seedEnts(t, kvStore, base, renamed)
+
+		_, err := findByName(t, kvStore, base, "before")
+		isNotFoundErr(t, err)
+
+		actual, err := findByName(t, kvStore, base, "after")
+		require.NoError(t, err)
+		assert.Equal(t, renamed.Body, actual)
+
+		// the old name is free for reuse
+		seedEnts(t, kvStore, base, newFooEnt(2, 9000, "before"))
+	})
+
+	t.Run("deletes remove index entries", func(t *testing.T) {
+		base, done, kvStore := newFooNameFoldStore(t, "fold_delete", true)
+		defer done()
+
+		seedEnts(t, kvStore, base,
+			newFooEnt(1, 9000, "one"),
+			newFooEnt(2, 9000, "two"),
+		)
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.DeleteEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+		})
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Delete(context.TODO(), tx, kv.DeleteOpts{
+				FilterFn: func(k []byte, v interface{}) bool {
+					return v.(foo).ID == 2
+				},
+			})
+		})
+
+		for _, name := range []string{"one", "two"} {
+			_, err := findByName(t, kvStore, base, name)
+			isNotFoundErr(t, err)
+		}
+	})
+
+	t.Run("raw puts maintain the index", func(t *testing.T) {
+		base, done, kvStore := newFooNameFoldStore(t, "fold_raw", true)
+		defer done()
+
+		expected := newFooEnt(1, 9000, "Raw")
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.PutRaw(context.TODO(), tx, []byte("raw-key"), expected)
+		})
+
+		actual, err := findByName(t, kvStore, base, "raw")
+		require.NoError(t, err)
+		assert.Equal(t, expected.Body, actual)
+	})
+
+	t.Run("non unique index allows duplicates", func(t *testing.T) {
+		base, done, kvStore := newFooNameFoldStore(t, "fold_multi", false)
+		defer done()
+
+		first := newFooEnt(1, 9000, "Dup")
+		seedEnts(t, kvStore, base, first, newFooEnt(2, 9000, "dup"), newFooEnt(3, 9000, "dupe"))
+
+		actual, err := findByName(t, kvStore, base, "DUP")
+		require.NoError(t, err)
+		assert.Equal(t, first.Body, actual)
+	})
+}
+
+func TestStoreBase_IterIndex(t *testing.T) {
+	for _, unique := range []bool{true, false} {
+		t.Run(fmt.Sprintf("unique %t", unique), func(t *testing.T) {
+			base, done, kvStore := newFooNameFoldStore(t, fmt.Sprintf("iter_index_%t", unique), unique)
+			defer done()
+
+			seedEnts(t, kvStore, base,
+				newFooEnt(2, 9000, "Bravo"),
+				newFooEnt(1, 9000, "alpha"),
+			)
+
+			var (
+				indexKeys   []string
+				primaryKeys [][]byte
+			)
+			view(t, kvStore, func(tx kv.Tx) error {
+				return base.IterIndex(context.TODO(), tx, kv.NameFoldIndexName, func(indexKey, primaryKey []byte) error {
+					indexKeys = append(indexKeys, string(indexKey))
+					primaryKeys = append(primaryKeys, primaryKey)
+					return nil
+				})
+			})
+
+			assert.Equal(t, []string{"alpha", "bravo"}, indexKeys)
+			assert.Equal(t, [][]byte{encodeID(t, 1), encodeID(t, 2)}, primaryKeys)
+		})
+	}
+
+	t.Run("non unique entries of overlapping keys are distinct", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := kv.NewStoreBase("foo", []byte("foo_iter_index_overlap"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithIndex(kv.StoreIndex{
+				Name:    "name",
+				BktName: []byte("foo_iter_index_overlap_name"),
+				KeyFn: func(ent kv.Entity) ([]byte, error) {
+					return []byte(ent.Body.(foo).Name), nil
+				},
+			}),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+
+		// the index and primary keys of the first two concatenate to the same bytes
+		newEnt := func(pk, name string) kv.Entity {
+			return kv.Entity{PK: kv.EncString(pk), Body: foo{ID: 1, OrgID: 9000, Name: name}}
+		}
+		seedEnts(t, kvStore, base, newEnt("cX", "ab"), newEnt("X", "abc"), newEnt("Y", "ab\x00"))
+
+		iter := func() (indexKeys, primaryKeys []string) {
+			view(t, kvStore, func(tx kv.Tx) error {
+				return base.IterIndex(context.TODO(), tx, "name", func(indexKey, primaryKey []byte) error {
+					indexKeys = append(indexKeys, string(indexKey))
+					primaryKeys = append(primaryKeys, string(primaryKey))
+					return nil
+				})
+			})
+			return indexKeys, primaryKeys
+		}
+
+		indexKeys, primaryKeys := iter()
+		assert.Equal(t, []string{"ab", "ab\x00", "abc"}, indexKeys)
+		assert.Equal(t, []string{"cX", "Y", "X"}, primaryKeys)
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.DeleteEnt(context.TODO(), tx, newEnt("X", "abc"))
+		})
+		indexKeys, primaryKeys = iter()
+		assert.Equal(t, []string{"ab", "ab\x00"}, indexKeys)
+		assert.Equal(t, []string{"cX", "Y"}, primaryKeys)
+	})
+
+	t.Run("unknown index", func(t *testing.T) {
+		base, done, kvStore := newFooNameFoldStore(t, "iter_index_unknown", true)
+		defer done()
+
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.IterIndex(context.TODO(), tx, "nope", func(indexKey, primaryKey []byte) error {
+				return nil
+			})
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
+
+func TestStoreBase_VerifyIndexIntegrity(t *testing.T) {
+	base, done, kvStore := newFooNameFoldStore(t, "verify_index", true)
+	defer done()
+
+	seedEnts(t, kvStore, base,
+		newFooEnt(1, 9000, "one"),
+		newFooEnt(2, 9000, "two"),
+		newFooEnt(3, 9000, "three"),
+	)
+
+	verify := func(t *testing.T) kv.IntegrityReport {
+		t.Helper()
+
+		var report kv.IntegrityReport
+		view(t, kvStore, func(tx kv.Tx) error {
+			r, err := base.VerifyIndexIntegrity(context.TODO(), tx, kv.NameFoldIndexName)
+			report = r
+			return err
+		})
+		return report
+	}
+
+	report := verify(t)
+	assert.True(t, report.OK())
+	assert.Equal(t, 3, report.Checked)
+
+	// corrupt the primary store behind the index's back
+	update(t, kvStore, func(tx kv.Tx) error {
+		b, err := tx.Bucket(base.BktName)
+		if err != nil {
+			return err
+		}
+		if err := b.Delete(encodeID(t, 1)); err != nil {
+			return err
+		}
+		return b.Put(encodeID(t, 2), []byte(`{"ID":"0000000000000002","OrgID":"0000000000002328","Name":"renamed"}`))
+	})
+
+	report = verify(t)
+	assert.False(t, report.OK())
+	assert.Equal(t, 3, report.Checked)
+	assert.Equal(t, []kv.IndexEntry{{IndexKey: []byte("one"), PrimaryKey: encodeID(t, 1)}}, report.Dangling)
+	assert.Equal(t, []kv.IndexEntry{{IndexKey: []byte("two"), PrimaryKey: encodeID(t, 2)}}, report.Mismatched)
+}
+
+func TestStoreBase_PruneDanglingIndex(t *testing.T) {
+	for _, unique := range []bool{true, false} {
+		t.Run(fmt.Sprintf("unique %t", unique), func(t *testing.T) {
+			base, done, kvStore := newFooNameFoldStore(t, fmt.Sprintf("prune_index_%t", unique), unique)
+			defer done()
+
+			seedEnts(t, kvStore, base,
+				newFooEnt(1, 9000, "one"),
+				newFooEnt(2, 9000, "two"),
+				newFooEnt(3, 9000, "three"),
+			)
+
+			// delete primaries behind the index's back
+			update(t, kvStore, func(tx kv.Tx) error {
+				b, err := tx.Bucket(base.BktName)
+				if err != nil {
+					return err
+				}
+				if err := b.Delete(encodeID(t, 1)); err != nil {
+					return err
+				}
+				return b.Delete(encodeID(t, 3))
+			})
+
+			update(t, kvStore, func(tx kv.Tx) error {
+				n, err := base.PruneDanglingIndex(context.TODO(), tx, kv.NameFoldIndexName)
+				require.NoError(t, err)
+				assert.Equal(t, 2, n)
+				return nil
+			})
+
+			view(t, kvStore, func(tx kv.Tx) error {
+				report, err := base.VerifyIndexIntegrity(context.TODO(), tx, kv.NameFoldIndexName)
+				require.NoError(t, err)
+				assert.True(t, report.OK())
+				assert.Equal(t, 1, report.Checked)
+				return nil
+			})
+
+			update(t, kvStore, func(tx kv.Tx) error {
+				n, err := base.PruneDanglingIndex(context.TODO(), tx, kv.NameFoldIndexName)
+				require.NoError(t, err)
+				assert.Zero(t, n)
+				return nil
+			})
+		})
+	}
+}
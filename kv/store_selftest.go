@@ -0,0 +1,66 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// SelfTest checks that the number of keys counted by the keys only path of
+// CountByPrefix matches the number of values the decoding path of Find decodes
+// successfully. A discrepancy indicates values that fail to decode, or a bug in
+// either path, and fails the self test with an internal error naming the first
+// key that failed to decode, if any. It is a cheap invariant for tests and health
+// checks, complementing VerifyIndexIntegrity. Every value is decoded, so its cost
+// grows with the size of the store.
+func (s *StoreBase) SelfTest(ctx context.Context, tx Tx) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	count, err := s.CountByPrefix(ctx, tx, nil)
+	if err != nil {
+		return err
+	}
+
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		if s.isMissingBucket(err) {
+			return nil
+		}
+		return err
+	}
+
+	var (
+		decoded   int
+		failedKey []byte
+		failure   error
+	)
+	decFn := s.decodeFn()
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, _, err := decFn(k, v); err != nil {
+			if failure == nil {
+				failedKey, failure = copyBytes(k), err
+			}
+			continue
+		}
+		decoded++
+	}
+
+	if count == decoded {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s self test counted %d keys but decoded %d values", s.Resource, count, decoded)
+	if failure != nil {
+		msg += fmt.Sprintf("; first failed to decode at key %q", string(failedKey))
+	}
+	return &influxdb.Error{
+		Code: influxdb.EInternal,
+		Msg:  msg,
+		Err:  failure,
+	}
+}
@@ -0,0 +1,197 @@
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// The sequence index bucket holds the last sequence assigned, an entry per entity
+// keyed by its sequence and referencing its primary key, and the reverse entry per
+// entity used to find its sequence on delete.
+var (
+	seqLastKey     = []byte("n")
+	seqEntryPrefix = []byte("s")
+	seqPKPrefix    = []byte("p")
+)
+
+// WithSeqIndex maintains an index of the order in which entities were created, held
+// in the provided bucket, for listing them via FindInSeqOrder. Each entity is
+// assigned the next value of a monotonic sequence when first put, keeping it across
+// updates, and its entry is removed when it is deleted. Entities stored before the
+// option was enabled have no sequence and are not listed.
+func WithSeqIndex(bktName []byte) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.seqBktName = bktName
+	}
+}
+
+// FindInSeqOrder lists the entities in the order they were created, regardless of
+// the order of their keys, i.e. the most recently created foos with random IDs when
+// Descending. The Descending, Offset, Limit, FilterEntFn, and capture options apply;
+// the remaining options are ignored. FindInSeqOrder requires WithSeqIndex.
+func (s *StoreBase) FindInSeqOrder(ctx context.Context, tx Tx, opts FindOpts) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if s.seqBktName == nil {
+		return &influxdb.Error{
+			Code: influxdb.EMethodNotAllowed,
+			Msg:  fmt.Sprintf("%s store does not maintain a sequence index", s.Resource),
+		}
+	}
+	if err := s.validateFindOpts(opts); err != nil {
+		return err
+	}
+
+	sb, err := s.seqBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+	b, err := s.bucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	cur, err := sb.Cursor()
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	return s.findViaIndexCursor(ctx, b, cur, seqEntryPrefix, opts)
+}
+
+func (s *StoreBase) initSeq(ctx context.Context, tx Tx) error {
+	if s.seqBktName == nil {
+		return nil
+	}
+	_, err := s.seqBucket(ctx, tx)
+	return err
+}
+
+func (s *StoreBase) seqBucket(ctx context.Context, tx Tx) (Bucket, error) {
+	span, _ := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	b, err := tx.Bucket(s.seqBktName)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s sequence index bucket %q is missing; the store must be initialized with Init before use", s.Resource, string(s.seqBktName)),
+			Err:  err,
+		}
+	}
+	return b, nil
+}
+
+// putSeq assigns the entity stored under pk the next sequence, unless it already
+// has one.
+func (s *StoreBase) putSeq(ctx context.Context, tx Tx, pk []byte) error {
+	if s.seqBktName == nil {
+		return nil
+	}
+
+	b, err := s.seqBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.Get(seqKey(seqPKPrefix, pk))
+	if err == nil {
+		return nil
+	}
+	if !IsNotFound(err) {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	var last uint64
+	if v, err := b.Get(seqLastKey); err == nil {
+		last = binary.BigEndian.Uint64(v)
+	} else if !IsNotFound(err) {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	seq := make([]byte, 8)
+	binary.BigEndian.PutUint64(seq, last+1)
+	for _, p := range []Pair{
+		{Key: seqLastKey, Value: seq},
+		{Key: seqKey(seqEntryPrefix, seq), Value: pk},
+		{Key: seqKey(seqPKPrefix, pk), Value: seq},
+	} {
+		if err := b.Put(p.Key, p.Value); err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
+
+// deleteSeq removes the sequence index entries of the entity stored under pk.
+func (s *StoreBase) deleteSeq(ctx context.Context, tx Tx, pk []byte) error {
+	if s.seqBktName == nil {
+		return nil
+	}
+
+	b, err := s.seqBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	pkKey := seqKey(seqPKPrefix, pk)
+	seq, err := b.Get(pkKey)
+	if IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+
+	for _, k := range [][]byte{seqKey(seqEntryPrefix, seq), pkKey} {
+		if err := b.Delete(k); err != nil && !IsNotFound(err) {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
+
+// moveSeq moves the sequence of the entity stored under from to the entity now
+// stored under to, keeping its place in the sequence.
+func (s *StoreBase) moveSeq(ctx context.Context, tx Tx, from, to []byte) error {
+	if s.seqBktName == nil {
+		return nil
+	}
+
+	b, err := s.seqBucket(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	fromKey := seqKey(seqPKPrefix, from)
+	seq, err := b.Get(fromKey)
+	if IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	seq = copyBytes(seq)
+
+	if err := b.Delete(fromKey); err != nil && !IsNotFound(err) {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	for _, p := range []Pair{
+		{Key: seqKey(seqEntryPrefix, seq), Value: copyBytes(to)},
+		{Key: seqKey(seqPKPrefix, to), Value: seq},
+	} {
+		if err := b.Put(p.Key, p.Value); err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
+
+func seqKey(prefix, key []byte) []byte {
+	k := make([]byte, 0, len(prefix)+len(key))
+	return append(append(k, prefix...), key...)
+}
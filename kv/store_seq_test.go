@@ -0,0 +1,100 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_FindInSeqOrder(t *testing.T) {
+	newStore := func(t *testing.T, opts ...kv.StoreBaseOptFn) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_seq"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn, opts...)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	findIDs := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase, opts kv.FindOpts) []influxdb.ID {
+		t.Helper()
+
+		var ids []influxdb.ID
+		view(t, kvStore, func(tx kv.Tx) error {
+			opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+				ids = append(ids, decodedVal.(foo).ID)
+				return nil
+			}
+			return base.FindInSeqOrder(context.TODO(), tx, opts)
+		})
+		return ids
+	}
+
+	t.Run("lists in creation order", func(t *testing.T) {
+		base, kvStore, done := newStore(t, kv.WithSeqIndex([]byte("foo_seq_index")))
+		defer done()
+
+		seedEnts(t, kvStore, base,
+			newFooEnt(3, 9000, "foo_3"),
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+		)
+		// updates keep their place in the sequence
+		seedEnts(t, kvStore, base, newFooEnt(3, 9000, "foo_3_renamed"))
+
+		assert.Equal(t, []influxdb.ID{3, 1, 2}, findIDs(t, kvStore, base, kv.FindOpts{}))
+		assert.Equal(t, []influxdb.ID{2, 1, 3}, findIDs(t, kvStore, base, kv.FindOpts{Descending: true}))
+		assert.Equal(t, []influxdb.ID{1}, findIDs(t, kvStore, base, kv.FindOpts{Offset: 1, Limit: 1}))
+		assert.Equal(t, []influxdb.ID{3, 2}, findIDs(t, kvStore, base, kv.FindOpts{
+			FilterEntFn: func(k []byte, v interface{}) bool {
+				return v.(foo).ID != 1
+			},
+		}))
+	})
+
+	t.Run("deletes remove sequence entries", func(t *testing.T) {
+		base, kvStore, done := newStore(t, kv.WithSeqIndex([]byte("foo_seq_index")))
+		defer done()
+
+		seedEnts(t, kvStore, base,
+			newFooEnt(3, 9000, "foo_3"),
+			newFooEnt(1, 9000, "foo_1"),
+			newFooEnt(2, 9000, "foo_2"),
+		)
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.DeleteEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+		})
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Delete(context.TODO(), tx, kv.DeleteOpts{
+				FilterFn: func(k []byte, v interface{}) bool {
+					return v.(foo).ID == 3
+				},
+			})
+		})
+		assert.Equal(t, []influxdb.ID{2}, findIDs(t, kvStore, base, kv.FindOpts{}))
+
+		// a recreated entity is sequenced anew
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"))
+		assert.Equal(t, []influxdb.ID{2, 1}, findIDs(t, kvStore, base, kv.FindOpts{}))
+	})
+
+	t.Run("requires a sequence index", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.FindInSeqOrder(context.TODO(), tx, kv.FindOpts{})
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EMethodNotAllowed, influxdb.ErrorCode(err))
+	})
+}
@@ -0,0 +1,231 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// ShardedStore spreads the entities of a single resource across a fixed number of
+// sub buckets, chosen by a hash of the entity key. Spreading writes across buckets
+// reduces the contention on any single bucket for hot resources.
+//
+// Entity lookups only touch the shard owning the key. Find presents the shards as
+// a single store by merging the shard cursors in key order, which costs a cursor
+// and a comparison per shard for every key emitted. The shard count is part of the
+// storage layout and may not change once data has been written.
+type ShardedStore struct {
+	Resource string
+	Shards   []*StoreBase
+}
+
+// NewShardedStore creates a store sharded across n buckets. The bucket for shard i
+// is named by suffixing bktName with "_shard_i". Options are applied to every shard.
+func NewShardedStore(resource string, bktName []byte, n int, encKeyFn, encBodyFn EncodeEntFn, decFn DecodeBucketValFn, decToEntFn ConvertValToEntFn, opts ...StoreBaseOptFn) *ShardedStore {
+	if n < 1 {
+		n = 1
+	}
+
+	s := &ShardedStore{Resource: resource}
+	for i := 0; i < n; i++ {
+		name := []byte(fmt.Sprintf("%s_shard_%d", bktName, i))
+		s.Shards = append(s.Shards, NewStoreBase(resource, name, encKeyFn, encBodyFn, decFn, decToEntFn, opts...))
+	}
+	return s
+}
+
+// Init creates the buckets for every shard.
+func (s *ShardedStore) Init(ctx context.Context, tx Tx) error {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	for _, shard := range s.Shards {
+		if err := shard.Init(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put persists the entity in the shard owning its key.
+func (s *ShardedStore) Put(ctx context.Context, tx Tx, ent Entity, opts ...PutOptionFn) error {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	shard, err := s.shardFor(ctx, ent)
+	if err != nil {
+		return err
+	}
+	return shard.Put(ctx, tx, ent, opts...)
+}
+
+// FindEnt returns the decoded entity body from the shard owning its key.
+func (s *ShardedStore) FindEnt(ctx context.Context, tx Tx, ent Entity) (interface{}, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	shard, err := s.shardFor(ctx, ent)
+	if err != nil {
+		return nil, err
+	}
+	return shard.FindEnt(ctx, tx, ent)
+}
+
+// DeleteEnt deletes the entity from the shard owning its key.
+func (s *ShardedStore) DeleteEnt(ctx context.Context, tx Tx, ent Entity) error {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	shard, err := s.shardFor(ctx, ent)
+	if err != nil {
+		return err
+	}
+	return shard.DeleteEnt(ctx, tx, ent)
+}
+
+// Delete deletes the entities matching the options from every shard.
+func (s *ShardedStore) Delete(ctx context.Context, tx Tx, opts DeleteOpts) error {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	for _, shard := range s.Shards {
+		if err := shard.Delete(ctx, tx, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find looks through all shards as though they were a single bucket. The shard
+// cursors are merged so results are emitted in key order across shards, with the
+// Limit and Offset applied to the merged results.
+func (s *ShardedStore) Find(ctx context.Context, tx Tx, opts FindOpts) error {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	if err := s.Shards[0].validateFindOpts(opts); err != nil {
+		return err
+	}
+
+	cursors := make([]Cursor, 0, len(s.Shards))
+	for _, shard := range s.Shards {
+		cur, err := shard.bucketCursor(ctx, tx)
+		if err != nil {
+			return err
+		}
+		cursors = append(cursors, cur)
+	}
+	return s.Shards[0].findCursor(ctx, &mergeCursor{cursors: cursors}, opts)
+}
+
+func (s *ShardedStore) shardFor(ctx context.Context, ent Entity) (*StoreBase, error) {
+	key, err := s.Shards[0].EntKey(ctx, ent)
+	if err != nil {
+		return nil, err
+	}
+	return s.Shards[shardIndex(key, len(s.Shards))], nil
+}
+
+func shardIndex(key []byte, n int) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(n))
+}
+
+// mergeCursor merges a set of cursors into a single cursor ordered by key. The
+// cursor may be ranged forward with Next or backward with Prev from any position,
+// and may change direction part way through, as a descending Find resuming After a
+// key does with a Seek followed by Prev.
+type mergeCursor struct {
+	cursors []Cursor
+	heads   []Pair
+	current int
+	desc    bool
+}
+
+func (m *mergeCursor) Seek(prefix []byte) ([]byte, []byte) {
+	return m.position(func(c Cursor) ([]byte, []byte) { return c.Seek(prefix) }, false)
+}
+
+func (m *mergeCursor) First() ([]byte, []byte) {
+	return m.position(Cursor.First, false)
+}
+
+func (m *mergeCursor) Last() ([]byte, []byte) {
+	return m.position(Cursor.Last, true)
+}
+
+func (m *mergeCursor) Next() ([]byte, []byte) {
+	return m.advance(Cursor.Next, false)
+}
+
+func (m *mergeCursor) Prev() ([]byte, []byte) {
+	return m.advance(Cursor.Prev, true)
+}
+
+func (m *mergeCursor) position(fn func(Cursor) ([]byte, []byte), desc bool) ([]byte, []byte) {
+	m.heads = make([]Pair, len(m.cursors))
+	m.desc = desc
+	for i, c := range m.cursors {
+		k, v := fn(c)
+		m.heads[i] = Pair{Key: k, Value: v}
+	}
+	return m.pick(desc)
+}
+
+func (m *mergeCursor) advance(fn func(Cursor) ([]byte, []byte), desc bool) ([]byte, []byte) {
+	if m.heads == nil || m.current < 0 {
+		return nil, nil
+	}
+	if desc != m.desc {
+		return m.turn(desc)
+	}
+	k, v := fn(m.cursors[m.current])
+	m.heads[m.current] = Pair{Key: k, Value: v}
+	return m.pick(desc)
+}
+
+// turn reverses the direction of the cursor. The heads of the shards other than
+// the current one lie beyond the current key in the old direction, so every shard
+// is positioned anew on its first key beyond the current key in the new direction.
+func (m *mergeCursor) turn(desc bool) ([]byte, []byte) {
+	key := copyBytes(m.heads[m.current].Key)
+	return m.position(func(c Cursor) ([]byte, []byte) {
+		k, v := c.Seek(key)
+		switch {
+		case desc && k == nil:
+			return c.Last()
+		case desc:
+			return c.Prev()
+		case bytes.Equal(k, key):
+			return c.Next()
+		default:
+			return k, v
+		}
+	}, desc)
+}
+
+// pick selects the head with the lowest key, or the highest key when descending.
+func (m *mergeCursor) pick(desc bool) ([]byte, []byte) {
+	m.current = -1
+	for i, head := range m.heads {
+		if head.Key == nil {
+			continue
+		}
+		if m.current == -1 {
+			m.current = i
+			continue
+		}
+		cmp := bytes.Compare(head.Key, m.heads[m.current].Key)
+		if (!desc && cmp < 0) || (desc && cmp > 0) {
+			m.current = i
+		}
+	}
+	if m.current == -1 {
+		return nil, nil
+	}
+	return m.heads[m.current].Key, m.heads[m.current].Value
+}
@@ -0,0 +1,110 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedStore(t *testing.T) {
+	newFooShardedStore := func(t *testing.T, bktSuffix string) (*kv.ShardedStore, func(), kv.Store) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		store := kv.NewShardedStore("foo", []byte("foo_"+bktSuffix), 3, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return store.Init(context.TODO(), tx)
+		})
+		return store, done, kvStore
+	}
+
+	t.Run("Put spreads entities across shards", func(t *testing.T) {
+		store, done, kvStore := newFooShardedStore(t, "sharded_put")
+		defer done()
+
+		for i := 1; i <= 30; i++ {
+			seedEnts(t, kvStore, store, newFooEnt(influxdb.ID(i), 9000, "foo"))
+		}
+
+		var total int
+		for _, shard := range store.Shards {
+			view(t, kvStore, func(tx kv.Tx) error {
+				n, err := shard.CountByPrefix(context.TODO(), tx, nil)
+				assert.NotZero(t, n, "shard %s is empty", shard.BktName)
+				total += n
+				return err
+			})
+		}
+		assert.Equal(t, 30, total)
+	})
+
+	t.Run("DeleteEnt", func(t *testing.T) {
+		store, done, kvStore := newFooShardedStore(t, "sharded_delete_ent")
+		defer done()
+
+		testDeleteEntBase(t, kvStore, store)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		testDeleteBase(t, func(t *testing.T, suffix string) (storeBase, func(), kv.Store) {
+			return newFooShardedStore(t, suffix)
+		})
+	})
+
+	t.Run("FindEnt", func(t *testing.T) {
+		store, done, kvStore := newFooShardedStore(t, "sharded_find_ent")
+		defer done()
+
+		testFindEnt(t, kvStore, store)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		testFind(t, func(t *testing.T, suffix string) (storeBase, func(), kv.Store) {
+			return newFooShardedStore(t, suffix)
+		})
+	})
+
+	t.Run("Find resuming After a key", func(t *testing.T) {
+		store, done, kvStore := newFooShardedStore(t, "sharded_find_after")
+		defer done()
+
+		var ents []kv.Entity
+		for i := 1; i <= 9; i++ {
+			ents = append(ents, newFooEnt(influxdb.ID(i), 9000, "foo"))
+		}
+		seedEnts(t, kvStore, store, ents...)
+
+		find := func(opts kv.FindOpts) []interface{} {
+			var vals []interface{}
+			opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+				vals = append(vals, decodedVal)
+				return nil
+			}
+			view(t, kvStore, func(tx kv.Tx) error {
+				return store.Find(context.TODO(), tx, opts)
+			})
+			return vals
+		}
+
+		assert.Equal(t, toIfaces(ents[6:]...), find(kv.FindOpts{After: encodeID(t, 6)}))
+		assert.Equal(t,
+			toIfaces(ents[4], ents[3], ents[2], ents[1], ents[0]),
+			find(kv.FindOpts{Descending: true, After: encodeID(t, 6)}),
+		)
+		assert.Equal(t,
+			toIfaces(ents[8], ents[7], ents[6]),
+			find(kv.FindOpts{Descending: true, After: append(encodeID(t, 9), 0), Limit: 3}),
+		)
+		assert.Empty(t, find(kv.FindOpts{Descending: true, After: encodeID(t, 1)}))
+		assert.Equal(t,
+			toIfaces(ents[2], ents[1]),
+			find(kv.FindOpts{Descending: true, After: encodeID(t, 4), Limit: 2}),
+		)
+	})
+}
@@ -0,0 +1,156 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// sidecar is a named bucket holding raw data related to the store's entities,
+// keyed by the key of the entity it belongs to.
+type sidecar struct {
+	name    string
+	bktName []byte
+}
+
+// WithSidecar declares a named sidecar bucket for the store, holding raw data
+// related to each entity, i.e. small metadata kept apart from the body. Init creates
+// the sidecar bucket along with the store's own, and deleting an entity deletes its
+// sidecar data.
+func WithSidecar(name string, bktName []byte) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.sidecars = append(s.sidecars, sidecar{name: name, bktName: bktName})
+	}
+}
+
+// PutSidecar stores the value in the named sidecar for the entity with the id. The
+// entity itself need not exist yet, so the sidecar may be written before or after it
+// within the transaction.
+func (s *StoreBase) PutSidecar(ctx context.Context, tx Tx, id influxdb.ID, name string, val []byte) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	b, key, err := s.sidecarBucketKey(ctx, tx, id, name)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(key, val); err != nil {
+		return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	return nil
+}
+
+// GetSidecar returns the value stored in the named sidecar for the entity with the
+// id, failing with a not found error when there is none.
+func (s *StoreBase) GetSidecar(ctx context.Context, tx Tx, id influxdb.ID, name string) ([]byte, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	b, key, err := s.sidecarBucketKey(ctx, tx, id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := b.Get(key)
+	if IsNotFound(err) {
+		return nil, &influxdb.Error{
+			Code: influxdb.ENotFound,
+			Msg:  fmt.Sprintf("%s %s not found for key %q", s.Resource, name, id.String()),
+		}
+	}
+	if err != nil {
+		return nil, &influxdb.Error{Code: influxdb.EInternal, Err: err}
+	}
+	return val, nil
+}
+
+func (s *StoreBase) sidecarBucketKey(ctx context.Context, tx Tx, id influxdb.ID, name string) (Bucket, []byte, error) {
+	for _, sc := range s.sidecars {
+		if sc.name != name {
+			continue
+		}
+
+		key, err := s.EntKey(ctx, Entity{PK: EncID(id)})
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := s.sidecarBucket(ctx, tx, sc)
+		if err != nil {
+			return nil, nil, err
+		}
+		return b, key, nil
+	}
+	return nil, nil, &influxdb.Error{
+		Code: influxdb.EInvalid,
+		Msg:  fmt.Sprintf("%s has no sidecar named %q", s.Resource, name),
+	}
+}
+
+func (s *StoreBase) sidecarBucket(ctx context.Context, tx Tx, sc sidecar) (Bucket, error) {
+	span, _ := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	b, err := tx.Bucket(sc.bktName)
+	if err != nil {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s sidecar bucket %q is missing; the store must be initialized with Init before use", s.Resource, string(sc.bktName)),
+			Err:  err,
+		}
+	}
+	return b, nil
+}
+
+func (s *StoreBase) initSidecars(ctx context.Context, tx Tx) error {
+	for _, sc := range s.sidecars {
+		if _, err := s.sidecarBucket(ctx, tx, sc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteSidecars removes the sidecar data of the entity stored under key.
+func (s *StoreBase) deleteSidecars(ctx context.Context, tx Tx, key []byte) error {
+	for _, sc := range s.sidecars {
+		b, err := s.sidecarBucket(ctx, tx, sc)
+		if err != nil {
+			return err
+		}
+		if err := b.Delete(key); err != nil && !IsNotFound(err) {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
+
+// moveSidecars moves the sidecar data of the entity stored under from to the
+// entity now stored under to.
+func (s *StoreBase) moveSidecars(ctx context.Context, tx Tx, from, to []byte) error {
+	for _, sc := range s.sidecars {
+		b, err := s.sidecarBucket(ctx, tx, sc)
+		if err != nil {
+			return err
+		}
+		val, err := b.Get(from)
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+		if err := b.Put(copyBytes(to), copyBytes(val)); err != nil {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+		if err := b.Delete(from); err != nil && !IsNotFound(err) {
+			return &influxdb.Error{Code: influxdb.EInternal, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_Sidecar(t *testing.T) {
+	newStore := func(t *testing.T) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_sidecar"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithSidecar("stats", []byte("foo_sidecar_stats")),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	getSidecar := func(kvStore kv.Store, base *kv.StoreBase, id influxdb.ID, name string) ([]byte, error) {
+		var val []byte
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			var err error
+			val, err = base.GetSidecar(context.TODO(), tx, id, name)
+			return err
+		})
+		return val, err
+	}
+
+	t.Run("put and get", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"))
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.PutSidecar(context.TODO(), tx, 1, "stats", []byte("hits=3"))
+		})
+
+		val, err := getSidecar(kvStore, base, 1, "stats")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("hits=3"), val)
+
+		_, err = getSidecar(kvStore, base, 2, "stats")
+		isNotFoundErr(t, err)
+
+		_, err = getSidecar(kvStore, base, 1, "missing")
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+
+	t.Run("deleting the entity deletes its sidecar data", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9000, "foo_2"), newFooEnt(3, 9000, "foo_3"))
+		update(t, kvStore, func(tx kv.Tx) error {
+			for _, id := range []influxdb.ID{1, 2, 3} {
+				if err := base.PutSidecar(context.TODO(), tx, id, "stats", []byte(id.String())); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			if err := base.DeleteEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)}); err != nil {
+				return err
+			}
+			return base.Delete(context.TODO(), tx, kv.DeleteOpts{
+				FilterFn: func(key []byte, decodedVal interface{}) bool {
+					return decodedVal.(foo).ID == 2
+				},
+			})
+		})
+
+		for _, id := range []influxdb.ID{1, 2} {
+			_, err := getSidecar(kvStore, base, id, "stats")
+			isNotFoundErr(t, err)
+		}
+		val, err := getSidecar(kvStore, base, 3, "stats")
+		require.NoError(t, err)
+		assert.Equal(t, []byte(influxdb.ID(3).String()), val)
+	})
+}
@@ -0,0 +1,84 @@
+package kv
+
+import (
+	"context"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kit/tracing"
+)
+
+// Snapshot is a consistent, read only view of a store shared by any number of
+// StoreBase operations, possibly across different stores backed by the same kv.Store.
+// Every read made through a snapshot observes the same state, regardless of writes
+// committed concurrently.
+//
+// A snapshot is only valid for the duration of the ReadSnapshot callback it was
+// provided to; operations on it after the callback returns fail rather than touch
+// the closed transaction.
+type Snapshot struct {
+	tx     Tx
+	closed bool
+}
+
+// ReadSnapshot opens a single read transaction and provides it to fn as a Snapshot.
+// The transaction is closed when fn returns.
+//
+// Holding a read transaction open has a cost: for the bolt store, pages freed by
+// writes committed while it is open cannot be reused until it closes, so the file
+// grows under write heavy load, and a remap of a growing file waits on it. Keep the
+// work done within fn to the reads that need to agree with one another.
+//
+// fn must not call Update on the store, nor wait on an Update running elsewhere:
+// the commit of a bolt update may need to remap the file, which waits on the open
+// read transaction, so either deadlocks.
+func ReadSnapshot(ctx context.Context, store Store, fn func(snap *Snapshot) error) error {
+	span, ctx := tracing.StartSpanFromContext(ctx)
+	defer span.Finish()
+
+	return store.View(ctx, func(tx Tx) error {
+		snap := &Snapshot{tx: tx}
+		defer func() { snap.closed = true }()
+		return fn(snap)
+	})
+}
+
+// Tx returns the underlying read transaction, for operations not wrapped by the
+// snapshot. It must not be retained beyond the ReadSnapshot callback.
+func (s *Snapshot) Tx() (Tx, error) {
+	if s.closed {
+		return nil, errSnapshotClosed
+	}
+	return s.tx, nil
+}
+
+// Find runs the store's Find against the snapshot.
+func (s *Snapshot) Find(ctx context.Context, store *StoreBase, opts FindOpts) error {
+	tx, err := s.Tx()
+	if err != nil {
+		return err
+	}
+	return store.Find(ctx, tx, opts)
+}
+
+// FindEnt runs the store's FindEnt against the snapshot.
+func (s *Snapshot) FindEnt(ctx context.Context, store *StoreBase, ent Entity) (interface{}, error) {
+	tx, err := s.Tx()
+	if err != nil {
+		return nil, err
+	}
+	return store.FindEnt(ctx, tx, ent)
+}
+
+// FindEntMap runs the store's FindEntMap against the snapshot.
+func (s *Snapshot) FindEntMap(ctx context.Context, store *StoreBase, ids ...influxdb.ID) (map[influxdb.ID]interface{}, error) {
+	tx, err := s.Tx()
+	if err != nil {
+		return nil, err
+	}
+	return store.FindEntMap(ctx, tx, ids...)
+}
+
+var errSnapshotClosed = &influxdb.Error{
+	Code: influxdb.EInternal,
+	Msg:  "snapshot used after its read transaction was closed",
+}
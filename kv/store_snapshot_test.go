@@ -0,0 +1,90 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSnapshot(t *testing.T) {
+	kvStore, done, err := NewTestBoltStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("foo", []byte("foo_snapshot"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	ents := []kv.Entity{
+		newFooEnt(1, 9000, "foo_1"),
+		newFooEnt(2, 9000, "foo_2"),
+	}
+	seedEnts(t, kvStore, base, ents...)
+
+	t.Run("reads observe one consistent state", func(t *testing.T) {
+		findAll := func(snap *kv.Snapshot) []interface{} {
+			var actuals []interface{}
+			require.NoError(t, snap.Find(context.TODO(), base, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					actuals = append(actuals, decodedVal)
+					return nil
+				},
+			}))
+			return actuals
+		}
+
+		// a write racing the snapshot is not observed by it, whether it commits while
+		// the snapshot is open or, as with a store whose writers wait on readers, only
+		// once it closes. It is never waited on from within the callback, as that
+		// deadlocks on bolt.
+		writeErr := make(chan error, 1)
+		err := kv.ReadSnapshot(context.TODO(), kvStore, func(snap *kv.Snapshot) error {
+			before := findAll(snap)
+
+			go func() {
+				writeErr <- kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+					return base.Put(context.TODO(), tx, newFooEnt(3, 9000, "foo_3"))
+				})
+			}()
+
+			assert.Equal(t, before, findAll(snap))
+
+			_, err := snap.FindEnt(context.TODO(), base, kv.Entity{PK: kv.EncID(3)})
+			isNotFoundErr(t, err)
+
+			m, err := snap.FindEntMap(context.TODO(), base, 1, 2, 3)
+			require.NoError(t, err)
+			assert.Len(t, m, 2)
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, <-writeErr)
+
+		var actual interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			actual, err = base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(3)})
+			return err
+		})
+		assert.Equal(t, newFooEnt(3, 9000, "foo_3").Body, actual)
+	})
+
+	t.Run("snapshot is unusable after the callback returns", func(t *testing.T) {
+		var leaked *kv.Snapshot
+		require.NoError(t, kv.ReadSnapshot(context.TODO(), kvStore, func(snap *kv.Snapshot) error {
+			leaked = snap
+			return nil
+		}))
+
+		_, err := leaked.FindEnt(context.TODO(), base, kv.Entity{PK: kv.EncID(1)})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+
+		_, err = leaked.Tx()
+		require.Error(t, err)
+	})
+}
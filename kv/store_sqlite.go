@@ -0,0 +1,323 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// sqliteDriverName is the database/sql driver ExportToSQLite opens databases with
+// unless another is named with WithSQLiteDriver.
+const sqliteDriverName = "sqlite3"
+
+// SQLiteKeyColumn is the column of an exported table holding the key of each
+// entity. It is the primary key of the table.
+const SQLiteKeyColumn = "_key"
+
+// SQLiteExportOptFn is a functional option for configuring ExportToSQLite.
+type SQLiteExportOptFn func(o *sqliteExportOpts)
+
+type sqliteExportOpts struct {
+	driverName string
+}
+
+// WithSQLiteDriver opens the database with the database/sql driver registered
+// under name rather than "sqlite3".
+func WithSQLiteDriver(name string) SQLiteExportOptFn {
+	return func(o *sqliteExportOpts) {
+		o.driverName = name
+	}
+}
+
+// FlattenFn flattens a decoded value into the columns of a row.
+type FlattenFn func(decodedVal interface{}) map[string]interface{}
+
+// ExportToSQLite writes every entity of the store to a table named after the
+// store's resource in the SQLite database at dbPath, replacing any table of that
+// name. The binary must register a database/sql driver named "sqlite3", as
+// importing github.com/mattn/go-sqlite3 does, or name the driver it registers with
+// WithSQLiteDriver; kv does not import a driver itself.
+//
+// Each decoded value is flattened to the columns of its row by flatten, or by
+// FlattenJSON when flatten is nil. The table has the SQLiteKeyColumn followed by a
+// column for every name flattened from any entity, in name order, and entities
+// lacking a column hold NULL in it. A column's type is derived from its values:
+// INTEGER for integers and bools, REAL for floats, BLOB for byte slices, and TEXT
+// for strings and times, which are written as RFC3339 with nanoseconds. Maps,
+// slices, and structs are nested values and are written as their JSON encoding to
+// a TEXT column. A column holding values of differing types is declared without a
+// type.
+//
+// The store is read twice within the transaction, once to derive the schema and
+// once to write the rows, so only a single row is held in memory at a time. The
+// rows are written in a single SQLite transaction, leaving the database unchanged
+// on failure.
+func ExportToSQLite(ctx context.Context, tx Tx, base *StoreBase, dbPath string, flatten FlattenFn, opts ...SQLiteExportOptFn) error {
+	span, ctx := base.startSpan(ctx)
+	defer span.Finish()
+
+	o := sqliteExportOpts{driverName: sqliteDriverName}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if flatten == nil {
+		flatten = FlattenJSON
+	}
+
+	columns := make(map[string]string)
+	err := base.Find(ctx, tx, FindOpts{
+		CaptureFn: func(key []byte, decodedVal interface{}) error {
+			for name, v := range flatten(decodedVal) {
+				if name == SQLiteKeyColumn {
+					return &influxdb.Error{
+						Code: influxdb.EInvalid,
+						Msg:  fmt.Sprintf("flattened %s for key %q has reserved column %q", base.Resource, string(key), SQLiteKeyColumn),
+					}
+				}
+				typ := sqliteType(v)
+				prev, seen := columns[name]
+				switch {
+				case !seen || prev == "":
+					columns[name] = typ
+				case typ != "" && typ != prev:
+					columns[name] = sqliteMixedType
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	db, err := sql.Open(o.driverName, dbPath)
+	if err != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to open sqlite database %q", dbPath),
+			Err:  err,
+		}
+	}
+	defer db.Close()
+
+	sqlTx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errSQLiteExport(err)
+	}
+	defer sqlTx.Rollback()
+
+	table := sqliteIdent(base.Resource)
+	if _, err := sqlTx.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+		return errSQLiteExport(err)
+	}
+	if _, err := sqlTx.ExecContext(ctx, sqliteCreateTable(table, names, columns)); err != nil {
+		return errSQLiteExport(err)
+	}
+
+	idents := []string{sqliteIdent(SQLiteKeyColumn)}
+	for _, name := range names {
+		idents = append(idents, sqliteIdent(name))
+	}
+	stmt, err := sqlTx.PrepareContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		table,
+		strings.Join(idents, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(idents)), ", "),
+	))
+	if err != nil {
+		return errSQLiteExport(err)
+	}
+	defer stmt.Close()
+
+	err = base.Find(ctx, tx, FindOpts{
+		CaptureFn: func(key []byte, decodedVal interface{}) error {
+			row := flatten(decodedVal)
+			args := make([]interface{}, 0, len(idents))
+			args = append(args, string(key))
+			for _, name := range names {
+				v, err := sqliteValue(row[name])
+				if err != nil {
+					return &influxdb.Error{
+						Code: influxdb.EInternal,
+						Msg:  fmt.Sprintf("failed to encode column %q of %s for key %q", name, base.Resource, string(key)),
+						Err:  err,
+					}
+				}
+				args = append(args, v)
+			}
+			if _, err := stmt.ExecContext(ctx, args...); err != nil {
+				return errSQLiteExport(err)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := sqlTx.Commit(); err != nil {
+		return errSQLiteExport(err)
+	}
+	return nil
+}
+
+// FlattenJSON flattens a value by way of its JSON encoding. The fields of nested
+// objects become columns named by joining the field names with a '.', so a field
+// "b" of the object in field "a" is the column "a.b". Arrays are kept whole as
+// nested values. A value not encoding to a JSON object flattens to a single column
+// named "value".
+func FlattenJSON(decodedVal interface{}) map[string]interface{} {
+	b, err := json.Marshal(decodedVal)
+	if err != nil {
+		return map[string]interface{}{"value": fmt.Sprint(decodedVal)}
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return map[string]interface{}{"value": string(b)}
+	}
+
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{"value": jsonScalar(v)}
+	}
+
+	out := make(map[string]interface{})
+	flattenJSONObject(out, "", obj)
+	return out
+}
+
+func flattenJSONObject(out map[string]interface{}, prefix string, obj map[string]interface{}) {
+	for k, v := range obj {
+		name := prefix + k
+		if nested, ok := v.(map[string]interface{}); ok {
+			flattenJSONObject(out, name+".", nested)
+			continue
+		}
+		out[name] = jsonScalar(v)
+	}
+}
+
+// jsonScalar converts a decoded JSON number to an int64 when it is integral and a
+// float64 otherwise.
+func jsonScalar(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
+// sqliteMixedType marks a column holding values of differing types.
+const sqliteMixedType = "mixed"
+
+// sqliteType returns the column type of the value, or "" for a NULL.
+func sqliteType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return "BLOB"
+	case time.Time:
+		return "TEXT"
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "REAL"
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return ""
+		}
+		return sqliteType(rv.Elem().Interface())
+	default:
+		return "TEXT"
+	}
+}
+
+// sqliteValue converts the value to one accepted by database/sql drivers.
+func sqliteValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, []byte, string, bool, int64, float64:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return sqliteValue(rv.Elem().Interface())
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+}
+
+func sqliteCreateTable(table string, names []string, columns map[string]string) string {
+	defs := []string{sqliteIdent(SQLiteKeyColumn) + " TEXT PRIMARY KEY"}
+	for _, name := range names {
+		def := sqliteIdent(name)
+		if typ := columns[name]; typ != "" && typ != sqliteMixedType {
+			def += " " + typ
+		}
+		defs = append(defs, def)
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(defs, ", "))
+}
+
+// sqliteIdent quotes the name for use as an identifier.
+func sqliteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func errSQLiteExport(err error) error {
+	return &influxdb.Error{
+		Code: influxdb.EInternal,
+		Msg:  "failed to write sqlite export",
+		Err:  err,
+	}
+}
@@ -0,0 +1,226 @@
+package kv_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDriver stands in for a sqlite3 driver, recording the statements each
+// database committed.
+type recordingDriver struct {
+	mu        sync.Mutex
+	committed map[string][]recordedExec
+	failOn    string
+}
+
+type recordedExec struct {
+	query string
+	args  []driver.Value
+}
+
+var recordingSQLiteDrivers int32
+
+// registerRecordingSQLite registers a fresh recordingDriver under a name private to
+// the test, so neither a real sqlite3 driver nor the statements recorded by earlier
+// runs of the test are disturbed.
+func registerRecordingSQLite() (*recordingDriver, string) {
+	d := &recordingDriver{committed: make(map[string][]recordedExec)}
+	name := fmt.Sprintf("kv_test_recording_sqlite_%d", atomic.AddInt32(&recordingSQLiteDrivers, 1))
+	sql.Register(name, d)
+	return d, name
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{d: d, name: name}, nil
+}
+
+func (d *recordingDriver) execs(name string) []recordedExec {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.committed[name]
+}
+
+type recordingConn struct {
+	d       *recordingDriver
+	name    string
+	pending []recordedExec
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{c: c, query: query}, nil
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *recordingConn) Commit() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.committed[c.name] = append(c.d.committed[c.name], c.pending...)
+	c.pending = nil
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	c.pending = nil
+	return nil
+}
+
+type recordingStmt struct {
+	c     *recordingConn
+	query string
+}
+
+func (s *recordingStmt) Close() error { return nil }
+
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.c.d.failOn != "" && s.c.d.failOn == s.c.name {
+		return nil, errors.New("disk I/O error")
+	}
+	s.c.pending = append(s.c.pending, recordedExec{query: s.query, args: args})
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("queries are not supported")
+}
+
+func TestExportToSQLite(t *testing.T) {
+	recorder, driverName := registerRecordingSQLite()
+
+	newStore := func(t *testing.T) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_sqlite"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, base, newFooEnt(1, 9000, "foo_1"), newFooEnt(2, 9001, "foo_2"))
+		return base, kvStore, done
+	}
+
+	t.Run("exports flattened JSON by default", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			return kv.ExportToSQLite(context.TODO(), tx, base, "default.db", nil, kv.WithSQLiteDriver(driverName))
+		})
+
+		execs := recorder.execs("default.db")
+		require.Len(t, execs, 4)
+		assert.Equal(t, `DROP TABLE IF EXISTS "foo"`, execs[0].query)
+		assert.Equal(t, `CREATE TABLE "foo" ("_key" TEXT PRIMARY KEY, "ID" TEXT, "Name" TEXT, "OrgID" TEXT)`, execs[1].query)
+
+		insert := `INSERT INTO "foo" ("_key", "ID", "Name", "OrgID") VALUES (?, ?, ?, ?)`
+		assert.Equal(t, insert, execs[2].query)
+		assert.Equal(t, []driver.Value{string(encodeID(t, 1)), influxdb.ID(1).String(), "foo_1", influxdb.ID(9000).String()}, execs[2].args)
+		assert.Equal(t, insert, execs[3].query)
+		assert.Equal(t, []driver.Value{string(encodeID(t, 2)), influxdb.ID(2).String(), "foo_2", influxdb.ID(9001).String()}, execs[3].args)
+	})
+
+	t.Run("derives column types from flattened values", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		flatten := func(v interface{}) map[string]interface{} {
+			f := v.(foo)
+			row := map[string]interface{}{
+				"id":    uint64(f.ID),
+				"tags":  []string{f.Name},
+				"mixed": f.Name,
+			}
+			if f.ID == 1 {
+				row["mixed"] = 1.5
+				row["only_first"] = true
+			}
+			return row
+		}
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			return kv.ExportToSQLite(context.TODO(), tx, base, "typed.db", flatten, kv.WithSQLiteDriver(driverName))
+		})
+
+		execs := recorder.execs("typed.db")
+		require.Len(t, execs, 4)
+		assert.Equal(t, `CREATE TABLE "foo" ("_key" TEXT PRIMARY KEY, "id" INTEGER, "mixed", "only_first" INTEGER, "tags" TEXT)`, execs[1].query)
+		assert.Equal(t, []driver.Value{string(encodeID(t, 1)), int64(1), 1.5, true, `["foo_1"]`}, execs[2].args)
+		assert.Equal(t, []driver.Value{string(encodeID(t, 2)), int64(2), "foo_2", nil, `["foo_2"]`}, execs[3].args)
+	})
+
+	t.Run("rejects the reserved key column", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		flatten := func(v interface{}) map[string]interface{} {
+			return map[string]interface{}{kv.SQLiteKeyColumn: "x"}
+		}
+
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return kv.ExportToSQLite(context.TODO(), tx, base, "reserved.db", flatten, kv.WithSQLiteDriver(driverName))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+		assert.Empty(t, recorder.execs("reserved.db"))
+	})
+
+	t.Run("commits nothing when a write fails", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		recorder.mu.Lock()
+		recorder.failOn = "failing.db"
+		recorder.mu.Unlock()
+		defer func() {
+			recorder.mu.Lock()
+			recorder.failOn = ""
+			recorder.mu.Unlock()
+		}()
+
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return kv.ExportToSQLite(context.TODO(), tx, base, "failing.db", nil, kv.WithSQLiteDriver(driverName))
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInternal, influxdb.ErrorCode(err))
+		assert.Empty(t, recorder.execs("failing.db"))
+	})
+}
+
+func TestFlattenJSON(t *testing.T) {
+	type inner struct {
+		B int     `json:"b"`
+		C float64 `json:"c"`
+	}
+	type outer struct {
+		A    inner    `json:"a"`
+		List []string `json:"list"`
+		Nil  *inner   `json:"nil"`
+	}
+
+	got := kv.FlattenJSON(outer{A: inner{B: 1, C: 2.5}, List: []string{"x"}})
+	assert.Equal(t, map[string]interface{}{
+		"a.b":  int64(1),
+		"a.c":  2.5,
+		"list": []interface{}{"x"},
+		"nil":  nil,
+	}, got)
+
+	assert.Equal(t, map[string]interface{}{"value": "scalar"}, kv.FlattenJSON("scalar"))
+}
@@ -0,0 +1,144 @@
+package kv
+
+import (
+	"context"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// Stage is a staging area for rebuilding the entire contents of a store. Entities
+// are written to the staging bucket through the embedded StoreBase, over as many
+// transactions as the rebuild needs, while readers of the live store are unaffected.
+// Commit then swaps the staged contents in.
+type Stage struct {
+	*StoreBase
+	live *StoreBase
+}
+
+// StageAndSwap begins a rebuild of the store, returning a Stage writing to a staging
+// bucket named after the store's bucket with a "_staging" suffix. Any contents left
+// in the staging bucket by an earlier, abandoned rebuild are cleared.
+//
+// The staged store shares the store's codec but maintains no indexes, sidecars, or
+// outbox, and runs no hooks.
+func (s *StoreBase) StageAndSwap(ctx context.Context, tx Tx) (*Stage, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	staged := NewStoreBase(s.Resource, stagingBktName(s.BktName), s.EncodeEntKeyFn, s.EncodeEntBodyFn, s.DecodeEntFn, s.ConvertValToEntFn)
+	staged.naturalDescending = s.naturalDescending
+	staged.readTransform = s.readTransform
+	staged.timeGen, staged.metadataTTL = s.timeGen, s.metadataTTL
+
+	if err := staged.Init(ctx, tx); err != nil {
+		return nil, err
+	}
+	if err := staged.clear(ctx, tx); err != nil {
+		return nil, err
+	}
+	return &Stage{StoreBase: staged, live: s}, nil
+}
+
+// Commit replaces the contents of the live store with the staged contents within
+// the transaction, then clears the staging bucket. Readers see either the old or
+// the new contents in full, never a mix of the two. Entities absent from the staged
+// contents are deleted along with their sidecar data, projections and sequence
+// entries, as by DeleteEnt, while those staged are written as by Put, keeping the
+// sidecar data and sequence of entities already stored. The live store's indexes
+// and projection are then rebuilt from the new contents within the same
+// transaction. Its hooks do not run, and, as for Put, no outbox events are
+// appended.
+func (st *Stage) Commit(ctx context.Context, tx Tx) error {
+	span, ctx := st.live.startSpan(ctx)
+	defer span.Finish()
+
+	if err := st.live.checkWritable(); err != nil {
+		return err
+	}
+	if err := st.live.clearUnstaged(ctx, tx, st.StoreBase); err != nil {
+		return err
+	}
+
+	cur, err := st.bucketCursor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := copyBytes(k)
+		if err := st.live.bucketPut(ctx, tx, key, copyBytes(v)); err != nil {
+			return err
+		}
+		if err := st.live.putSeq(ctx, tx, key); err != nil {
+			return err
+		}
+	}
+
+	if err := st.clear(ctx, tx); err != nil {
+		return err
+	}
+	if len(st.live.indexes) > 0 || st.live.projection != nil {
+		if _, err := st.live.ReindexAll(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Abort abandons the rebuild, clearing the staging bucket.
+func (st *Stage) Abort(ctx context.Context, tx Tx) error {
+	span, ctx := st.live.startSpan(ctx)
+	defer span.Finish()
+
+	return st.clear(ctx, tx)
+}
+
+// clear deletes every entity of the store as by DeleteEnt, but for their index
+// entries.
+func (s *StoreBase) clear(ctx context.Context, tx Tx) error {
+	return s.clearWhere(ctx, tx, func(key []byte) (bool, error) { return true, nil })
+}
+
+// clearUnstaged deletes the entities of the store that are absent from the staged
+// store, as clear does.
+func (s *StoreBase) clearUnstaged(ctx context.Context, tx Tx, staged *StoreBase) error {
+	return s.clearWhere(ctx, tx, func(key []byte) (bool, error) {
+		_, err := staged.bucketGet(ctx, tx, key)
+		if influxdb.ErrorCode(err) == influxdb.ENotFound {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+func (s *StoreBase) clearWhere(ctx context.Context, tx Tx, fn func(key []byte) (bool, error)) error {
+	cur, err := s.bucketCursor(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	for k, _ := cur.First(); k != nil; k, _ = cur.Next() {
+		ok, err := fn(k)
+		if err != nil {
+			return err
+		}
+		if ok {
+			keys = append(keys, copyBytes(k))
+		}
+	}
+	for _, k := range keys {
+		if err := s.deleteKey(ctx, tx, k); err != nil && influxdb.ErrorCode(err) != influxdb.ENotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func stagingBktName(bktName []byte) []byte {
+	name := make([]byte, 0, len(bktName)+len("_staging"))
+	name = append(name, bktName...)
+	return append(name, "_staging"...)
+}
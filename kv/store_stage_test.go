@@ -0,0 +1,184 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_StageAndSwap(t *testing.T) {
+	findAll := func(t *testing.T, kvStore kv.Store, base *kv.StoreBase) []interface{} {
+		t.Helper()
+
+		var actuals []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					actuals = append(actuals, decodedVal)
+					return nil
+				},
+			})
+		})
+		return actuals
+	}
+
+	newStore := func(t *testing.T) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		base := kv.NewStoreBase("foo", []byte("foo_stage"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithNameFoldIndex([]byte("foo_stage_name_fold"), fooNameFn, true),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		return base, kvStore, done
+	}
+
+	old := []kv.Entity{newFooEnt(1, 9000, "old_1"), newFooEnt(2, 9000, "old_2")}
+	rebuilt := []kv.Entity{newFooEnt(2, 9000, "new_2"), newFooEnt(3, 9000, "new_3")}
+
+	t.Run("commit swaps in the staged contents", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		seedEnts(t, kvStore, base, old...)
+
+		var stage *kv.Stage
+		update(t, kvStore, func(tx kv.Tx) error {
+			var err error
+			stage, err = base.StageAndSwap(context.TODO(), tx)
+			return err
+		})
+		seedEnts(t, kvStore, stage, rebuilt...)
+
+		// live readers are unaffected until the commit
+		assert.Equal(t, toIfaces(old...), findAll(t, kvStore, base))
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			return stage.Commit(context.TODO(), tx)
+		})
+
+		assert.Equal(t, toIfaces(rebuilt...), findAll(t, kvStore, base))
+		assert.Empty(t, findAll(t, kvStore, stage.StoreBase))
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEntByNameFold(context.TODO(), tx, "NEW_3")
+			require.NoError(t, err)
+			assert.Equal(t, rebuilt[1].Body, v)
+
+			_, err = base.FindEntByNameFold(context.TODO(), tx, "old_1")
+			isNotFoundErr(t, err)
+			return nil
+		})
+	})
+
+	t.Run("abort leaves the live contents", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		seedEnts(t, kvStore, base, old...)
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			stage, err := base.StageAndSwap(context.TODO(), tx)
+			if err != nil {
+				return err
+			}
+			for _, ent := range rebuilt {
+				if err := stage.Put(context.TODO(), tx, ent); err != nil {
+					return err
+				}
+			}
+			return stage.Abort(context.TODO(), tx)
+		})
+
+		assert.Equal(t, toIfaces(old...), findAll(t, kvStore, base))
+
+		// a new stage starts empty
+		update(t, kvStore, func(tx kv.Tx) error {
+			stage, err := base.StageAndSwap(context.TODO(), tx)
+			if err != nil {
+				return err
+			}
+			return stage.Commit(context.TODO(), tx)
+		})
+		assert.Empty(t, findAll(t, kvStore, base))
+	})
+
+	t.Run("commit maintains companion buckets", func(t *testing.T) {
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+		defer done()
+
+		base := kv.NewStoreBase("foo", []byte("foo_stage_companions"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+			kv.WithProjection([]byte("foo_stage_names"), func(ent kv.Entity) ([]byte, error) {
+				return []byte(ent.Body.(foo).Name), nil
+			}, func(key, val []byte) ([]byte, interface{}, error) {
+				return key, string(val), nil
+			}),
+			kv.WithSeqIndex([]byte("foo_stage_seq")),
+			kv.WithSidecar("notes", []byte("foo_stage_notes")),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+
+		seedEnts(t, kvStore, base, old...)
+		update(t, kvStore, func(tx kv.Tx) error {
+			for _, id := range []influxdb.ID{1, 2} {
+				if err := base.PutSidecar(context.TODO(), tx, id, "notes", []byte("note")); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		update(t, kvStore, func(tx kv.Tx) error {
+			stage, err := base.StageAndSwap(context.TODO(), tx)
+			if err != nil {
+				return err
+			}
+			for _, ent := range rebuilt {
+				if err := stage.Put(context.TODO(), tx, ent); err != nil {
+					return err
+				}
+			}
+			return stage.Commit(context.TODO(), tx)
+		})
+
+		view(t, kvStore, func(tx kv.Tx) error {
+			var names []interface{}
+			err := base.FindProjection(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					names = append(names, decodedVal)
+					return nil
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, []interface{}{"new_2", "new_3"}, names)
+
+			var inSeq []interface{}
+			err = base.FindInSeqOrder(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					inSeq = append(inSeq, decodedVal)
+					return nil
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, toIfaces(rebuilt...), inSeq)
+
+			_, err = base.GetSidecar(context.TODO(), tx, 1, "notes")
+			isNotFoundErr(t, err)
+			note, err := base.GetSidecar(context.TODO(), tx, 2, "notes")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("note"), note)
+			return nil
+		})
+	})
+}
@@ -0,0 +1,65 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// BatchStreamDepth is the number of batches FindBatchStream buffers ahead of its
+// consumer before the scan blocks.
+const BatchStreamDepth = 2
+
+// FindBatchStream runs the Find in a goroutine of its own, emitting its results in
+// batches of up to the BatchSize of opts over the returned channel. The channel
+// buffers BatchStreamDepth batches, after which the scan blocks until the consumer
+// takes one, so a slow consumer holds the scan back rather than letting it run
+// ahead. At most BatchSize × (BatchStreamDepth + 1) results are held in memory at
+// a time: those buffered and those of the batch being filled.
+//
+// Once the scan ends the batch channel is closed, and the error of the Find, nil on
+// success, is sent on the error channel, which is then closed too. Capture
+// functions of opts are invalid, as the stream does the capturing.
+//
+// The scan reads from tx until the error channel yields, so the transaction must be
+// kept open until then, and must not be used concurrently by the caller meanwhile,
+// as transactions are not safe for concurrent use. A consumer giving up on the
+// stream early must cancel ctx, which ends the scan promptly with the context's
+// error rather than leaving it blocked on the full channel, holding tx open.
+func (s *StoreBase) FindBatchStream(ctx context.Context, tx Tx, opts FindOpts) (<-chan []KV, <-chan error) {
+	batches := make(chan []KV, BatchStreamDepth)
+	errc := make(chan error, 1)
+
+	if opts.CaptureFn != nil || opts.IndexedCaptureFn != nil || opts.BatchCaptureFn != nil {
+		errc <- &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("find %s batch stream captures its results itself and cannot apply capture functions", s.Resource),
+		}
+		close(batches)
+		close(errc)
+		return batches, errc
+	}
+
+	opts.BatchCaptureFn = func(batch []KV) error {
+		// a full channel is not all that ends a select on a canceled context, so
+		// cancellation is checked first to stop sending to a consumer that left
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		select {
+		case batches <- batch:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	go func() {
+		defer close(errc)
+		defer close(batches)
+
+		errc <- s.Find(ctx, tx, opts)
+	}()
+	return batches, errc
+}
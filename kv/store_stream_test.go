@@ -0,0 +1,84 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_FindBatchStream(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("foo", []byte("foo_batch_stream"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	var ents []kv.Entity
+	for i := 1; i <= 7; i++ {
+		ents = append(ents, newFooEnt(influxdb.ID(i), 9000, "foo"))
+	}
+	seedEnts(t, kvStore, base, ents...)
+
+	t.Run("emits every result in batches", func(t *testing.T) {
+		var (
+			sizes []int
+			vals  []interface{}
+		)
+		view(t, kvStore, func(tx kv.Tx) error {
+			batches, errc := base.FindBatchStream(context.TODO(), tx, kv.FindOpts{BatchSize: 3})
+			for batch := range batches {
+				sizes = append(sizes, len(batch))
+				for _, pair := range batch {
+					vals = append(vals, pair.Val)
+				}
+			}
+			return <-errc
+		})
+
+		assert.Equal(t, []int{3, 3, 1}, sizes)
+		assert.Equal(t, toIfaces(ents...), vals)
+	})
+
+	t.Run("cancellation ends the scan", func(t *testing.T) {
+		view(t, kvStore, func(tx kv.Tx) error {
+			ctx, cancel := context.WithCancel(context.Background())
+			batches, errc := base.FindBatchStream(ctx, tx, kv.FindOpts{BatchSize: 1})
+
+			first := <-batches
+			require.Len(t, first, 1)
+			cancel()
+
+			// drain whatever was buffered before the cancellation, along with at
+			// most one batch sent as it happened
+			var n int
+			for range batches {
+				n++
+			}
+			assert.LessOrEqual(t, n, kv.BatchStreamDepth+1)
+			assert.Equal(t, context.Canceled, <-errc)
+			return nil
+		})
+	})
+
+	t.Run("with a capture fn", func(t *testing.T) {
+		view(t, kvStore, func(tx kv.Tx) error {
+			batches, errc := base.FindBatchStream(context.TODO(), tx, kv.FindOpts{
+				CaptureFn: func(key []byte, decodedVal interface{}) error { return nil },
+			})
+			_, ok := <-batches
+			assert.False(t, ok)
+
+			err := <-errc
+			require.Error(t, err)
+			assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+			return nil
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// Tail returns the decoded values of the last n entities matching the options in
+// key order, i.e. the n most recent events of a store with time ordered keys. The
+// cursor is positioned on the last key of the options' Prefix and read backward, so
+// no more than n matches are decoded however many precede them, and the results are
+// then returned oldest first. Fewer than n values are returned when fewer match. An
+// Offset skips that many of the latest matches. The options' capture functions are
+// ignored, and as Tail positions the cursor itself, the options may neither order
+// the results nor resume from an After key.
+func (s *StoreBase) Tail(ctx context.Context, tx Tx, n int, opts FindOpts) ([]interface{}, error) {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if n <= 0 {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("%s tail size must be positive; got %d", s.Resource, n),
+		}
+	}
+	if opts.Descending || opts.Ascending || len(opts.After) > 0 {
+		return nil, &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("tail of %s may not order results or resume after a key", s.Resource),
+		}
+	}
+
+	prefix, stopFn := opts.Prefix, opts.StopFn
+	opts.Prefix, opts.Descending, opts.Limit = nil, true, n
+	opts.After = prefixEnd(prefix)
+	if len(prefix) > 0 {
+		opts.StopFn = func(key []byte) bool {
+			return !bytes.HasPrefix(key, prefix) || (stopFn != nil && stopFn(key))
+		}
+	}
+
+	vals := make([]interface{}, 0, n)
+	opts.retain = true
+	opts.IndexedCaptureFn, opts.BatchCaptureFn = nil, nil
+	opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+		vals = append(vals, decodedVal)
+		return nil
+	}
+	if err := s.Find(ctx, tx, opts); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(vals)-1; i < j; i, j = i+1, j-1 {
+		vals[i], vals[j] = vals[j], vals[i]
+	}
+	return vals, nil
+}
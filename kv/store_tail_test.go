@@ -0,0 +1,117 @@
+package kv_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_Tail(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	// keys are the org id followed by the name, so each org's entities are
+	// ordered by name within the org's key range
+	base := kv.NewStoreBase("foo", []byte("foo_tail"), kv.EncUniqKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	ents := []kv.Entity{
+		newFooEnt(1, 9000, "foo_1"),
+		newFooEnt(2, 9000, "foo_2"),
+		newFooEnt(3, 9000, "foo_3"),
+		newFooEnt(4, 9000, "foo_4"),
+		newFooEnt(5, 9001, "foo_5"),
+		newFooEnt(6, 9001, "foo_6"),
+		newFooEnt(7, 9002, "foo_7"),
+	}
+	seedEnts(t, kvStore, base, ents...)
+
+	orgPrefix := func(t *testing.T, orgID influxdb.ID) []byte {
+		t.Helper()
+
+		b, err := orgID.Encode()
+		require.NoError(t, err)
+		return b
+	}
+
+	tail := func(n int, opts kv.FindOpts) ([]interface{}, error) {
+		var vals []interface{}
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			var err error
+			vals, err = base.Tail(context.TODO(), tx, n, opts)
+			return err
+		})
+		return vals, err
+	}
+
+	t.Run("returns the last n in key order", func(t *testing.T) {
+		vals, err := tail(3, kv.FindOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents[4:]...), vals)
+	})
+
+	t.Run("returns every entity when fewer than n exist", func(t *testing.T) {
+		vals, err := tail(10, kv.FindOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents...), vals)
+	})
+
+	t.Run("is scoped to the prefix", func(t *testing.T) {
+		vals, err := tail(2, kv.FindOpts{Prefix: orgPrefix(t, 9000)})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents[2:4]...), vals)
+
+		vals, err = tail(5, kv.FindOpts{Prefix: orgPrefix(t, 9001)})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents[4:6]...), vals)
+
+		vals, err = tail(5, kv.FindOpts{Prefix: orgPrefix(t, 9003)})
+		require.NoError(t, err)
+		assert.Empty(t, vals)
+	})
+
+	t.Run("applies the filter and offset to the latest matches", func(t *testing.T) {
+		vals, err := tail(2, kv.FindOpts{
+			Prefix: orgPrefix(t, 9000),
+			Offset: 1,
+			FilterEntFn: func(key []byte, decodedVal interface{}) bool {
+				return !strings.HasSuffix(decodedVal.(foo).Name, "_2")
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, toIfaces(ents[0], ents[2]), vals)
+	})
+
+	t.Run("decodes no more than n matches", func(t *testing.T) {
+		var stats kv.FindStats
+		_, err := tail(2, kv.FindOpts{Stats: &stats})
+		require.NoError(t, err)
+		assert.Equal(t, 2, stats.KeysScanned)
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		for _, tc := range []struct {
+			name string
+			n    int
+			opts kv.FindOpts
+		}{
+			{name: "zero size", n: 0},
+			{name: "descending", n: 1, opts: kv.FindOpts{Descending: true}},
+			{name: "after", n: 1, opts: kv.FindOpts{After: []byte("foo")}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := tail(tc.n, tc.opts)
+				require.Error(t, err)
+				assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+			})
+		}
+	})
+}
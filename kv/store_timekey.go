@@ -0,0 +1,78 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// ReverseTimeKeyMax is the nanosecond unix time from which EncReverseTimeKey
+// subtracts an entity's time, the latest time representable as an int64 of
+// nanoseconds, in the year 2262.
+const ReverseTimeKeyMax = math.MaxInt64
+
+// reverseTimeLen is the length of the reversed time prefixing each key.
+const reverseTimeLen = 8
+
+// EncReverseTimeKey returns a key encoder that orders entities newest first in the
+// ascending byte order of the store. Each key is the big endian uint64 of
+// ReverseTimeKeyMax less the nanosecond unix time extracted from the body,
+// followed by the entity's PK to keep entities sharing a time distinct. Times
+// before the unix epoch cannot be encoded.
+//
+// As the key derives from the body, FindEnt and DeleteEnt must be provided an
+// entity with its body set. ReverseTimeWindow provides the Find options for a
+// window of time over such keys.
+func EncReverseTimeKey(extract func(body interface{}) time.Time) EncodeEntFn {
+	return func(ent Entity) ([]byte, string, error) {
+		if ent.PK == nil {
+			return nil, "time key", errors.New("no ID provided")
+		}
+		pk, err := ent.PK()
+		if err != nil {
+			return nil, "time key", err
+		}
+
+		prefix, err := reverseTime(extract(ent.Body))
+		if err != nil {
+			return nil, "time key", err
+		}
+		return append(prefix, pk...), "time key", nil
+	}
+}
+
+// ReverseTimeWindow returns the Find options positioning an ascending Find over
+// keys encoded by EncReverseTimeKey on the entities with times from the from time
+// through the to time, both inclusive, newest first. Times outside what the
+// encoder can represent are clamped to its range.
+func ReverseTimeWindow(from, to time.Time) FindOpts {
+	last := clampedReverseTime(from)
+	return FindOpts{
+		Ascending: true,
+		// every key with the to time's prefix sorts after the bare prefix
+		After: clampedReverseTime(to),
+		StopFn: func(key []byte) bool {
+			return len(key) < reverseTimeLen || bytes.Compare(key[:reverseTimeLen], last) > 0
+		},
+	}
+}
+
+func reverseTime(t time.Time) ([]byte, error) {
+	n := t.UnixNano()
+	if n < 0 {
+		return nil, errors.New("times before the unix epoch cannot be encoded")
+	}
+	b := make([]byte, reverseTimeLen)
+	binary.BigEndian.PutUint64(b, uint64(ReverseTimeKeyMax-n))
+	return b, nil
+}
+
+func clampedReverseTime(t time.Time) []byte {
+	if t.Before(time.Unix(0, 0)) {
+		t = time.Unix(0, 0)
+	}
+	b, _ := reverseTime(t)
+	return b
+}
@@ -0,0 +1,95 @@
+package kv_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timedFoo struct {
+	ID        influxdb.ID `json:"id"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+func TestEncReverseTimeKey(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	createdAt := func(body interface{}) time.Time {
+		return body.(timedFoo).CreatedAt
+	}
+	base := kv.NewStoreBase("foo", []byte("foo_reverse_time"), kv.EncReverseTimeKey(createdAt), kv.EncBodyJSON,
+		func(key, val []byte) ([]byte, interface{}, error) {
+			var f timedFoo
+			if err := json.Unmarshal(val, &f); err != nil {
+				return nil, nil, err
+			}
+			return key, f, nil
+		},
+		func(k []byte, v interface{}) (kv.Entity, error) {
+			f := v.(timedFoo)
+			return kv.Entity{PK: kv.EncID(f.ID), Body: f}, nil
+		},
+	)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	start := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	var foos []timedFoo
+	for i := 0; i < 5; i++ {
+		f := timedFoo{ID: influxdb.ID(i + 1), CreatedAt: start.Add(time.Duration(i) * time.Hour)}
+		foos = append(foos, f)
+		seedEnts(t, kvStore, base, kv.Entity{PK: kv.EncID(f.ID), Body: f})
+	}
+	// a second entity at the same time as the third
+	same := timedFoo{ID: 10, CreatedAt: foos[2].CreatedAt}
+	seedEnts(t, kvStore, base, kv.Entity{PK: kv.EncID(same.ID), Body: same})
+
+	find := func(opts kv.FindOpts) []influxdb.ID {
+		var ids []influxdb.ID
+		opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+			ids = append(ids, decodedVal.(timedFoo).ID)
+			return nil
+		}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, opts)
+		})
+		return ids
+	}
+
+	t.Run("ascending order is newest first", func(t *testing.T) {
+		assert.Equal(t, []influxdb.ID{5, 4, 3, 10, 2, 1}, find(kv.FindOpts{}))
+	})
+
+	t.Run("window bounds are inclusive", func(t *testing.T) {
+		opts := kv.ReverseTimeWindow(foos[1].CreatedAt, foos[3].CreatedAt)
+		assert.Equal(t, []influxdb.ID{4, 3, 10, 2}, find(opts))
+	})
+
+	t.Run("window between entities", func(t *testing.T) {
+		opts := kv.ReverseTimeWindow(foos[1].CreatedAt.Add(time.Minute), foos[2].CreatedAt.Add(-time.Minute))
+		assert.Empty(t, find(opts))
+	})
+
+	t.Run("window beyond the encodable range", func(t *testing.T) {
+		opts := kv.ReverseTimeWindow(time.Unix(-10, 0), time.Unix(0, kv.ReverseTimeKeyMax))
+		assert.Equal(t, []influxdb.ID{5, 4, 3, 10, 2, 1}, find(opts))
+	})
+
+	t.Run("times before the epoch are invalid", func(t *testing.T) {
+		f := timedFoo{ID: 20, CreatedAt: time.Unix(-1, 0)}
+		err := kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.Put(context.TODO(), tx, kv.Entity{PK: kv.EncID(f.ID), Body: f})
+		})
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
@@ -0,0 +1,95 @@
+package kv
+
+import (
+	"sync"
+	"time"
+)
+
+// OpTiming is a single operation recorded by a TimingHook.
+type OpTiming struct {
+	// Op is the name of the StoreBase method, i.e. "Find" or "PutRaw".
+	Op       string
+	Duration time.Duration
+	// Rows is the number of results captured, for Find and FindRawJSON.
+	Rows int
+	Err  error
+}
+
+// TimingHook records the duration of every operation of the stores it is attached
+// to with WithTimingHook, for tests asserting operations stay within budget, i.e.
+// that a lookup has not regressed to a full scan. It records the same operations
+// as MetricsSnapshot counts, along with FindRawJSON. A TimingHook is safe for
+// concurrent use and may be shared between stores.
+type TimingHook struct {
+	mu      sync.Mutex
+	timings []OpTiming
+}
+
+// NewTimingHook creates an empty timing hook.
+func NewTimingHook() *TimingHook {
+	return &TimingHook{}
+}
+
+// WithTimingHook records the duration of each of the store's operations in h.
+func WithTimingHook(h *TimingHook) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.timingHook = h
+	}
+}
+
+// Timings returns the operations recorded so far, in the order they completed.
+func (h *TimingHook) Timings() []OpTiming {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]OpTiming(nil), h.timings...)
+}
+
+// Count returns the number of recorded operations named op.
+func (h *TimingHook) Count(op string) int {
+	var n int
+	for _, t := range h.Timings() {
+		if t.Op == op {
+			n++
+		}
+	}
+	return n
+}
+
+// Max returns the longest duration recorded for the operations named op, or zero
+// when none were recorded.
+func (h *TimingHook) Max(op string) time.Duration {
+	var max time.Duration
+	for _, t := range h.Timings() {
+		if t.Op == op && t.Duration > max {
+			max = t.Duration
+		}
+	}
+	return max
+}
+
+// Reset discards the operations recorded so far.
+func (h *TimingHook) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.timings = nil
+}
+
+func (h *TimingHook) record(t OpTiming) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.timings = append(h.timings, t)
+}
+
+// observe records the completed operation, which started at start, in the store's
+// metrics and timing hook.
+func (s *StoreBase) observe(op metricsOp, name string, start time.Time, rows int, err error) {
+	s.metrics.observe(op, rows, err)
+	if s.timingHook != nil {
+		s.timingHook.record(OpTiming{
+			Op:       name,
+			Duration: time.Since(start),
+			Rows:     rows,
+			Err:      err,
+		})
+	}
+}
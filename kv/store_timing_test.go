@@ -0,0 +1,62 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimingHook(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	const decodeCost = 2 * time.Millisecond
+	slowDecFn := func(key, val []byte) ([]byte, interface{}, error) {
+		time.Sleep(decodeCost)
+		return decJSONFooFn(key, val)
+	}
+
+	hook := kv.NewTimingHook()
+	base := kv.NewStoreBase("foo", []byte("foo_timing"), kv.EncIDKey, kv.EncBodyJSON, slowDecFn, decFooEntFn, kv.WithTimingHook(hook))
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+	seedEnts(t, kvStore, base,
+		newFooEnt(1, 9000, "foo_1"),
+		newFooEnt(2, 9000, "foo_2"),
+		newFooEnt(3, 9000, "foo_3"),
+	)
+	assert.Equal(t, 3, hook.Count("Put"))
+
+	hook.Reset()
+	view(t, kvStore, func(tx kv.Tx) error {
+		if err := base.Find(context.TODO(), tx, kv.FindOpts{
+			CaptureFn: func(key []byte, decodedVal interface{}) error { return nil },
+		}); err != nil {
+			return err
+		}
+		_, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(4)})
+		isNotFoundErr(t, err)
+		return nil
+	})
+
+	timings := hook.Timings()
+	require.Len(t, timings, 2)
+
+	assert.Equal(t, "Find", timings[0].Op)
+	assert.Equal(t, 3, timings[0].Rows)
+	assert.NoError(t, timings[0].Err)
+	// the full scan decodes every value
+	assert.True(t, timings[0].Duration >= 3*decodeCost, "find took %s", timings[0].Duration)
+	assert.Equal(t, timings[0].Duration, hook.Max("Find"))
+
+	assert.Equal(t, "FindEnt", timings[1].Op)
+	isNotFoundErr(t, timings[1].Err)
+
+	assert.Zero(t, hook.Max("Delete"))
+}
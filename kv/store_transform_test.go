@@ -0,0 +1,85 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_WithReadTransform(t *testing.T) {
+	bktName := []byte("foo_transform")
+
+	// records written before names were required are given a default on read
+	defaultName := func(v interface{}) interface{} {
+		f := v.(foo)
+		if f.Name == "" {
+			f.Name = "unnamed"
+		}
+		return f
+	}
+
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	legacy := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	base := kv.NewStoreBase("foo", bktName, kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn,
+		kv.WithReadTransform(defaultName),
+	)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+	seedEnts(t, kvStore, legacy, newFooEnt(1, 9000, ""), newFooEnt(2, 9000, "foo_2"))
+
+	expected := []interface{}{
+		foo{ID: 1, OrgID: 9000, Name: "unnamed"},
+		foo{ID: 2, OrgID: 9000, Name: "foo_2"},
+	}
+
+	t.Run("FindEnt", func(t *testing.T) {
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			require.NoError(t, err)
+			assert.Equal(t, expected[0], v)
+			return nil
+		})
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		var actuals []interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			return base.Find(context.TODO(), tx, kv.FindOpts{
+				FilterEntFn: func(key []byte, decodedVal interface{}) bool {
+					return decodedVal.(foo).Name != ""
+				},
+				CaptureFn: func(key []byte, decodedVal interface{}) error {
+					actuals = append(actuals, decodedVal)
+					return nil
+				},
+			})
+		})
+		assert.Equal(t, expected, actuals)
+	})
+
+	t.Run("FindEntMap", func(t *testing.T) {
+		view(t, kvStore, func(tx kv.Tx) error {
+			m, err := base.FindEntMap(context.TODO(), tx, 1, 2)
+			require.NoError(t, err)
+			assert.Equal(t, map[influxdb.ID]interface{}{1: expected[0], 2: expected[1]}, m)
+			return nil
+		})
+	})
+
+	t.Run("stored bytes are unchanged", func(t *testing.T) {
+		view(t, kvStore, func(tx kv.Tx) error {
+			v, err := legacy.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			require.NoError(t, err)
+			assert.Equal(t, foo{ID: 1, OrgID: 9000}, v)
+			return nil
+		})
+	})
+}
@@ -0,0 +1,52 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// FindTyped runs a Find appending each decoded value to the slice pointed to by
+// out, i.e. a *[]foo, saving call sites the append and type assertion of a
+// CaptureFn. A decoded value not assignable to the slice's element type fails the
+// Find with an invalid error. Any CaptureFn on the options still runs after the
+// value is appended.
+//
+// The values are appended via reflection, which costs an allocation and a type
+// check per value over a CaptureFn. Hot paths over large results should prefer a
+// CaptureFn.
+func (s *StoreBase) FindTyped(ctx context.Context, tx Tx, opts FindOpts, out interface{}) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return &influxdb.Error{
+			Code: influxdb.EInvalid,
+			Msg:  fmt.Sprintf("find typed requires a pointer to a slice; got %T", out),
+		}
+	}
+	slc := ptr.Elem()
+	elemType := slc.Type().Elem()
+
+	opts.retain = true
+	captureFn := opts.CaptureFn
+	opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+		v := reflect.ValueOf(decodedVal)
+		if !v.IsValid() || !v.Type().AssignableTo(elemType) {
+			return &influxdb.Error{
+				Code: influxdb.EInvalid,
+				Msg:  fmt.Sprintf("decoded %s of type %T is not assignable to %s", s.Resource, decodedVal, elemType),
+			}
+		}
+		slc.Set(reflect.Append(slc, v))
+
+		if captureFn != nil {
+			return captureFn(key, decodedVal)
+		}
+		return nil
+	}
+	return s.Find(ctx, tx, opts)
+}
@@ -0,0 +1,65 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreBase_FindTyped(t *testing.T) {
+	kvStore, done, err := NewTestInmemStore(t)
+	require.NoError(t, err)
+	defer done()
+
+	base := kv.NewStoreBase("foo", []byte("foo_typed"), kv.EncIDKey, kv.EncBodyJSON, decJSONFooFn, decFooEntFn)
+	update(t, kvStore, func(tx kv.Tx) error {
+		return base.Init(context.TODO(), tx)
+	})
+
+	seedEnts(t, kvStore, base,
+		newFooEnt(1, 9000, "foo_0"),
+		newFooEnt(2, 9000, "foo_1"),
+		newFooEnt(3, 9003, "foo_2"),
+	)
+
+	findTyped := func(opts kv.FindOpts, out interface{}) error {
+		return kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			return base.FindTyped(context.TODO(), tx, opts, out)
+		})
+	}
+
+	t.Run("appends to a typed slice", func(t *testing.T) {
+		var foos []foo
+		require.NoError(t, findTyped(kv.FindOpts{Limit: 2}, &foos))
+
+		expected := []foo{
+			{ID: 1, OrgID: 9000, Name: "foo_0"},
+			{ID: 2, OrgID: 9000, Name: "foo_1"},
+		}
+		assert.Equal(t, expected, foos)
+	})
+
+	t.Run("appends to an interface slice", func(t *testing.T) {
+		var vals []interface{}
+		require.NoError(t, findTyped(kv.FindOpts{Offset: 2}, &vals))
+		assert.Equal(t, []interface{}{foo{ID: 3, OrgID: 9003, Name: "foo_2"}}, vals)
+	})
+
+	t.Run("mismatched element type", func(t *testing.T) {
+		var ids []influxdb.ID
+		err := findTyped(kv.FindOpts{}, &ids)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+
+	t.Run("not a pointer to a slice", func(t *testing.T) {
+		var foos []foo
+		err := findTyped(kv.FindOpts{}, foos)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EInvalid, influxdb.ErrorCode(err))
+	})
+}
@@ -0,0 +1,69 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb/v2"
+)
+
+// VersionFn returns the version of a decoded entity body, incremented by the
+// service on every update to the entity.
+type VersionFn func(decodedVal interface{}) (uint64, error)
+
+// WithVersionFn provides the store with the means of reading the version of its
+// entities, enabling optimistic concurrency via the conditional operations such
+// as DeleteEntIfVersion.
+func WithVersionFn(fn VersionFn) StoreBaseOptFn {
+	return func(s *StoreBase) {
+		s.versionFn = fn
+	}
+}
+
+// DeleteEntIfVersion deletes the entity with the provided ID, along with its index
+// entries, only when its stored version matches the expected version. When another
+// writer has since modified the entity the versions differ, and a conflict error is
+// returned with the entity left in place. The store must have been created with
+// WithVersionFn.
+func (s *StoreBase) DeleteEntIfVersion(ctx context.Context, tx Tx, id influxdb.ID, expectedVersion uint64) error {
+	span, ctx := s.startSpan(ctx)
+	defer span.Finish()
+
+	if s.versionFn == nil {
+		return &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("%s store has no version func; it must be created with WithVersionFn", s.Resource),
+		}
+	}
+
+	if err := s.throttle(ctx); err != nil {
+		return err
+	}
+
+	key, err := s.EntKey(ctx, Entity{PK: EncID(id)})
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.findByKey(ctx, tx, key)
+	if err != nil {
+		return err
+	}
+
+	version, err := s.versionFn(existing)
+	if err != nil {
+		return &influxdb.Error{
+			Code: influxdb.EInternal,
+			Msg:  fmt.Sprintf("failed to read version of %s %s", s.Resource, id),
+			Err:  err,
+		}
+	}
+	if version != expectedVersion {
+		return &influxdb.Error{
+			Code: influxdb.EConflict,
+			Msg:  fmt.Sprintf("%s %s is at version %d; expected version %d", s.Resource, id, version, expectedVersion),
+		}
+	}
+
+	return s.deleteExisting(ctx, tx, key, existing)
+}
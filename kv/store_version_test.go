@@ -0,0 +1,119 @@
+package kv_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/influxdb/v2"
+	"github.com/influxdata/influxdb/v2/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type versionedFoo struct {
+	ID      influxdb.ID `json:"id"`
+	Name    string      `json:"name"`
+	Version uint64      `json:"version"`
+}
+
+func newVersionedFooEnt(id influxdb.ID, name string, version uint64) kv.Entity {
+	return kv.Entity{
+		PK:   kv.EncID(id),
+		Body: versionedFoo{ID: id, Name: name, Version: version},
+	}
+}
+
+func decJSONVersionedFooFn(key, val []byte) ([]byte, interface{}, error) {
+	var f versionedFoo
+	if err := json.Unmarshal(val, &f); err != nil {
+		return nil, nil, err
+	}
+	return key, f, nil
+}
+
+func decVersionedFooEntFn(k []byte, v interface{}) (kv.Entity, error) {
+	f, ok := v.(versionedFoo)
+	if !ok {
+		return kv.Entity{}, fmt.Errorf("invalid entry: %#v", v)
+	}
+	return newVersionedFooEnt(f.ID, f.Name, f.Version), nil
+}
+
+func TestStoreBase_DeleteEntIfVersion(t *testing.T) {
+	newStore := func(t *testing.T) (*kv.StoreBase, kv.Store, func()) {
+		t.Helper()
+
+		kvStore, done, err := NewTestInmemStore(t)
+		require.NoError(t, err)
+
+		nameFn := func(ent kv.Entity) (string, error) {
+			return ent.Body.(versionedFoo).Name, nil
+		}
+		versionFn := func(v interface{}) (uint64, error) {
+			f, ok := v.(versionedFoo)
+			if !ok {
+				return 0, fmt.Errorf("invalid entry: %#v", v)
+			}
+			return f.Version, nil
+		}
+		base := kv.NewStoreBase("foo", []byte("foo_versioned"), kv.EncIDKey, kv.EncBodyJSON, decJSONVersionedFooFn, decVersionedFooEntFn,
+			kv.WithNameFoldIndex([]byte("foo_versioned_name_fold"), nameFn, true),
+			kv.WithVersionFn(versionFn),
+		)
+		update(t, kvStore, func(tx kv.Tx) error {
+			return base.Init(context.TODO(), tx)
+		})
+		seedEnts(t, kvStore, base, newVersionedFooEnt(1, "foo_1", 3))
+		return base, kvStore, done
+	}
+
+	deleteIfVersion := func(kvStore kv.Store, base *kv.StoreBase, id influxdb.ID, version uint64) error {
+		return kvStore.Update(context.TODO(), func(tx kv.Tx) error {
+			return base.DeleteEntIfVersion(context.TODO(), tx, id, version)
+		})
+	}
+
+	t.Run("deletes the entity and its index entries on a version match", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		require.NoError(t, deleteIfVersion(kvStore, base, 1, 3))
+
+		err := kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			_, err := base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			return err
+		})
+		isNotFoundErr(t, err)
+
+		err = kvStore.View(context.TODO(), func(tx kv.Tx) error {
+			_, err := base.FindEntByNameFold(context.TODO(), tx, "foo_1")
+			return err
+		})
+		isNotFoundErr(t, err)
+	})
+
+	t.Run("conflicts on a version mismatch", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		err := deleteIfVersion(kvStore, base, 1, 2)
+		require.Error(t, err)
+		assert.Equal(t, influxdb.EConflict, influxdb.ErrorCode(err))
+
+		var actual interface{}
+		view(t, kvStore, func(tx kv.Tx) error {
+			actual, err = base.FindEnt(context.TODO(), tx, kv.Entity{PK: kv.EncID(1)})
+			return err
+		})
+		assert.Equal(t, versionedFoo{ID: 1, Name: "foo_1", Version: 3}, actual)
+	})
+
+	t.Run("missing entity is not found", func(t *testing.T) {
+		base, kvStore, done := newStore(t)
+		defer done()
+
+		isNotFoundErr(t, deleteIfVersion(kvStore, base, 2, 1))
+	})
+}
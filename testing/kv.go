@@ -68,10 +68,18 @@ func KVStore(
 			name: "Update",
 			fn:   KVUpdate,
 		},
+		{
+			name: "UpdateRollback",
+			fn:   KVUpdateRollback,
+		},
 		{
 			name: "ConcurrentUpdate",
 			fn:   KVConcurrentUpdate,
 		},
+		{
+			name: "StoreBaseOrdering",
+			fn:   KVStoreBaseOrdering,
+		},
 	}
 
 	for _, tt := range tests {
@@ -537,6 +545,56 @@ func KVCursor(
 				},
 			},
 		},
+		{
+			name: "seek to a key that does not exist",
+			fields: KVStoreFields{
+				Bucket: []byte("bucket"),
+				Pairs: []kv.Pair{
+					{
+						Key:   []byte("a"),
+						Value: []byte("1"),
+					},
+					{
+						Key:   []byte("abc"),
+						Value: []byte("2"),
+					},
+					{
+						Key:   []byte("bcd"),
+						Value: []byte("3"),
+					},
+					{
+						Key:   []byte("cd"),
+						Value: []byte("4"),
+					},
+				},
+			},
+			args: args{
+				bucket: []byte("bucket"),
+				seek:   []byte("abd"),
+			},
+			wants: wants{
+				first: kv.Pair{
+					Key:   []byte("a"),
+					Value: []byte("1"),
+				},
+				last: kv.Pair{
+					Key:   []byte("cd"),
+					Value: []byte("4"),
+				},
+				seek: kv.Pair{
+					Key:   []byte("bcd"),
+					Value: []byte("3"),
+				},
+				next: kv.Pair{
+					Key:   []byte("cd"),
+					Value: []byte("4"),
+				},
+				prev: kv.Pair{
+					Key:   []byte("bcd"),
+					Value: []byte("3"),
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1338,7 +1396,6 @@ func KVUpdate(
 			},
 			wants: wants{},
 		},
-		// TODO: add case with failed update transaction that doesn't apply all of the changes.
 	}
 
 	for _, tt := range tests {
@@ -1424,6 +1481,93 @@ func KVUpdate(
 	}
 }
 
+// KVUpdateRollback tests that none of the writes of a failed update transaction
+// are applied.
+func KVUpdateRollback(
+	init func(KVStoreFields, *testing.T) (kv.Store, func()),
+	t *testing.T,
+) {
+	s, close := init(KVStoreFields{
+		Bucket: []byte("bucket"),
+		Pairs: []kv.Pair{
+			{
+				Key:   []byte("hello"),
+				Value: []byte("cruel world"),
+			},
+			{
+				Key:   []byte("goodbye"),
+				Value: []byte("world"),
+			},
+		},
+	}, t)
+	defer close()
+
+	errFailed := errors.New("failed update")
+	err := s.Update(context.Background(), func(tx kv.Tx) error {
+		b, err := tx.Bucket([]byte("bucket"))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("hello"), []byte("world")); err != nil {
+			return err
+		}
+		if err := b.Put([]byte("new"), []byte("key")); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte("goodbye")); err != nil {
+			return err
+		}
+
+		nb, err := tx.Bucket([]byte("new_bucket"))
+		if err != nil {
+			return err
+		}
+		if err := nb.Put([]byte("new"), []byte("key")); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if err != errFailed {
+		t.Fatalf("expected error %v got %v", errFailed, err)
+	}
+
+	err = s.View(context.Background(), func(tx kv.Tx) error {
+		b, err := tx.Bucket([]byte("bucket"))
+		if err != nil {
+			return err
+		}
+
+		cur, err := b.Cursor()
+		if err != nil {
+			return err
+		}
+
+		var got []kv.Pair
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			got = append(got, kv.Pair{Key: k, Value: v})
+		}
+
+		exp := []kv.Pair{
+			{Key: []byte("goodbye"), Value: []byte("world")},
+			{Key: []byte("hello"), Value: []byte("cruel world")},
+		}
+		if !cmp.Equal(got, exp) {
+			t.Errorf("unexpected bucket contents: -got/+exp\n%v", cmp.Diff(got, exp))
+		}
+
+		// a bucket created by the failed transaction is either absent or empty
+		if nb, err := tx.Bucket([]byte("new_bucket")); err == nil {
+			if _, err := nb.Get([]byte("new")); err != kv.ErrKeyNotFound {
+				t.Errorf("expected key in new bucket to be rolled back")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error during view transaction: %v", err)
+	}
+}
+
 // KVConcurrentUpdate tests concurrent calls to update.
 func KVConcurrentUpdate(
 	init func(KVStoreFields, *testing.T) (kv.Store, func()),
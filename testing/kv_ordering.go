@@ -0,0 +1,164 @@
+package testing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/influxdata/influxdb/v2/kv"
+)
+
+// orderingKeys are stored raw, listed here in byte order. They cover the cases
+// where byte order differs from naive string ordering: case, keys that are
+// prefixes of one another, NUL separators, and bytes beyond ASCII.
+var orderingKeys = []string{
+	"0",
+	"A",
+	"a",
+	"a\x00",
+	"a\x00b",
+	"aa",
+	"ab",
+	"b",
+	"\xff",
+	"\xff\xff",
+}
+
+// KVStoreBaseOrdering tests that a StoreBase over the key value store iterates in
+// the byte order of its keys, for ascending, descending, prefix, and ranged scans.
+// Find behaving identically across backends relies on these guarantees.
+func KVStoreBaseOrdering(
+	init func(KVStoreFields, *testing.T) (kv.Store, func()),
+	t *testing.T,
+) {
+	bucket := []byte("ordering")
+
+	var pairs []kv.Pair
+	for _, k := range orderingKeys {
+		pairs = append(pairs, kv.Pair{Key: []byte(k), Value: []byte(k)})
+	}
+
+	base := kv.NewStoreBase("ordering", bucket,
+		kv.EncIDKey,
+		func(ent kv.Entity) ([]byte, string, error) {
+			return []byte(ent.Body.(string)), "body", nil
+		},
+		func(key, val []byte) ([]byte, interface{}, error) {
+			return key, string(val), nil
+		},
+		func(k []byte, v interface{}) (kv.Entity, error) {
+			return kv.Entity{PK: kv.EncString(string(k)), Body: v}, nil
+		},
+	)
+
+	reversed := func(keys []string) []string {
+		out := make([]string, 0, len(keys))
+		for i := len(keys) - 1; i >= 0; i-- {
+			out = append(out, keys[i])
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		opts kv.FindOpts
+		exp  []string
+	}{
+		{
+			name: "ascending",
+			exp:  orderingKeys,
+		},
+		{
+			name: "descending",
+			opts: kv.FindOpts{Descending: true},
+			exp:  reversed(orderingKeys),
+		},
+		{
+			name: "ascending with limit and offset",
+			opts: kv.FindOpts{Offset: 2, Limit: 3},
+			exp:  []string{"a", "a\x00", "a\x00b"},
+		},
+		{
+			name: "descending with limit and offset",
+			opts: kv.FindOpts{Descending: true, Offset: 2, Limit: 3},
+			exp:  []string{"b", "ab", "aa"},
+		},
+		{
+			name: "range after an existing key",
+			opts: kv.FindOpts{After: []byte("a\x00"), Limit: 3},
+			exp:  []string{"a\x00b", "aa", "ab"},
+		},
+		{
+			name: "range after a missing key",
+			opts: kv.FindOpts{After: []byte("a\x01")},
+			exp:  []string{"aa", "ab", "b", "\xff", "\xff\xff"},
+		},
+		{
+			name: "descending range before an existing key",
+			opts: kv.FindOpts{Descending: true, After: []byte("aa")},
+			exp:  []string{"a\x00b", "a\x00", "a", "A", "0"},
+		},
+		{
+			name: "descending range before a missing key",
+			opts: kv.FindOpts{Descending: true, After: []byte("\xfe")},
+			exp:  []string{"b", "ab", "aa", "a\x00b", "a\x00", "a", "A", "0"},
+		},
+		{
+			name: "descending range past the last key",
+			opts: kv.FindOpts{Descending: true, After: []byte("\xff\xff\xff")},
+			exp:  reversed(orderingKeys),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, close := init(KVStoreFields{Bucket: bucket, Pairs: pairs}, t)
+			defer close()
+
+			var got []string
+			err := s.View(context.Background(), func(tx kv.Tx) error {
+				opts := tt.opts
+				opts.CaptureFn = func(key []byte, decodedVal interface{}) error {
+					got = append(got, string(key))
+					return nil
+				}
+				return base.Find(context.Background(), tx, opts)
+			})
+			if err != nil {
+				t.Fatalf("error during view transaction: %v", err)
+			}
+
+			if exp := tt.exp; !cmp.Equal(got, exp) {
+				t.Errorf("unexpected keys: -got/+exp\n%v", cmp.Diff(got, exp))
+			}
+		})
+	}
+
+	t.Run("prefix count", func(t *testing.T) {
+		s, close := init(KVStoreFields{Bucket: bucket, Pairs: pairs}, t)
+		defer close()
+
+		prefixes := map[string]int{
+			"":      len(orderingKeys),
+			"a":     5,
+			"a\x00": 2,
+			"\xff":  2,
+			"c":     0,
+		}
+		for prefix, exp := range prefixes {
+			err := s.View(context.Background(), func(tx kv.Tx) error {
+				n, err := base.CountByPrefix(context.Background(), tx, []byte(prefix))
+				if err != nil {
+					return err
+				}
+				if n != exp {
+					t.Errorf("expected %d keys with prefix %q got %d", exp, prefix, n)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("error during view transaction: %v", err)
+			}
+		}
+	})
+}